@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"time"
 )
 
 const (
@@ -30,13 +31,106 @@ type Repository struct {
 // config.Engine is the engine service configuration
 type Engine struct {
 	// Tickers is the array of tickers the trading engine will use to create Traders
-	Symbols string				`envconfig:"TICKERS" required:"true"`
+	Symbols []string			`envconfig:"TICKERS" required:"true"`
 	// Timeframes is the array of timeframe the trading engine will use to create Traders
-	Timeframes string			`envconfig:"TIMEFRAMES" required:"true"`
+	Timeframes []string			`envconfig:"TIMEFRAMES" required:"true"`
 	// Exchanges is the array of exchanges the trading engine will use to create Traders
-	Exchanges string 			`envconfig:"EXCHANGES" required:"true"`
+	Exchanges []string 			`envconfig:"EXCHANGES" required:"true"`
+	// TraderMatrix combines Tickers, Timeframes & Exchanges into markets by ZIP (by position) or CARTESIAN product
+	TraderMatrix string			`envconfig:"TRADER_MATRIX" default:"ZIP"`
+	// TraderOverrides replaces the cash, order value or strategy of markets in the format
+	// "symbol_timeframe_exchange=cash:5000,order_value:500,strategy:rsi;symbol_timeframe_exchange=..."
+	TraderOverrides string		`envconfig:"TRADER_OVERRIDES"`
+	// Strategy is the strategy every market trades unless overridden
+	Strategy string				`envconfig:"STRATEGY" default:"rsi"`
+	// StrategyParams overrides the parameters of the strategy in the format "name:value,name:value", eg/
+	// "period:14,entry:30,exit:70" for rsi - parameters left out take their defaults
+	StrategyParams string		`envconfig:"STRATEGY_PARAMS"`
 	// StartingCash is the starting capital of the entire service
 	StartingCash float64		`envconfig:"STARTING_CASH" required:"true"`
+	// FillTiming determines the bar & price simulated orders are filled at (CLOSE, NEXT_OPEN or NEXT_VWAP)
+	FillTiming string			`envconfig:"FILL_TIMING" default:"NEXT_OPEN"`
+	// ExchangeFees is the fee model of each exchange in the format "exchange=model:params;exchange=model:params"
+	ExchangeFees string			`envconfig:"EXCHANGE_FEES"`
+	// SlippageModel is the slippage model applied to simulated fills in the format "model:param", unless overridden
+	SlippageModel string		`envconfig:"SLIPPAGE_MODEL"`
+	// NetworkFees is the gas cost model of each on-chain exchange in the format "exchange=chain:gasUnits:nativeSymbol"
+	NetworkFees string			`envconfig:"NETWORK_FEES"`
+	// AMMPools is the LP fee of each constant-product AMM exchange in the format "exchange=lpFee;exchange=lpFee"
+	AMMPools string				`envconfig:"AMM_POOLS"`
+	// OrderType is the type of entry order generated from signals (MARKET, LIMIT, STOP or STOP_LIMIT), exits are MARKET
+	OrderType string			`envconfig:"ORDER_TYPE" default:"MARKET"`
+	// OrderPriceOffset is the fraction of the current price that LIMIT & STOP prices are placed away from it
+	OrderPriceOffset float64	`envconfig:"ORDER_PRICE_OFFSET" default:"0.0"`
+	// TimeInForce is the time in force of orders generated from signals (GTC, IOC, FOK or GTD)
+	TimeInForce string			`envconfig:"TIME_IN_FORCE" default:"GTC"`
+	// OrderTimeToLive is the lifetime of GTD orders
+	OrderTimeToLive time.Duration `envconfig:"ORDER_TIME_TO_LIVE" default:"72h"`
+	// MaxVolumeFraction caps each simulated fill at a fraction of the bar's volume, zero disables the cap
+	MaxVolumeFraction float64	`envconfig:"MAX_VOLUME_FRACTION" default:"0.0"`
+	// StopLoss is the protective exit below LONG & above SHORT entries in the format "pct:fraction" or
+	// "atr:period:multiple", empty disables it
+	StopLoss string				`envconfig:"STOP_LOSS"`
+	// TakeProfit is the profit target above LONG & below SHORT entries in the same format as StopLoss
+	TakeProfit string			`envconfig:"TAKE_PROFIT"`
+	// TrailingStop is the stop that ratchets behind the most favourable price in the same format as StopLoss
+	TrailingStop string			`envconfig:"TRAILING_STOP"`
+	// ExitPriority decides which exit wins when a bar touches several (STOP_FIRST, TARGET_FIRST or NEAREST_OPEN)
+	ExitPriority string			`envconfig:"EXIT_PRIORITY" default:"STOP_FIRST"`
+	// PortfolioMode is SHARED for one portfolio pooling the cash of every symbol, or ISOLATED for a portfolio per symbol
+	PortfolioMode string		`envconfig:"PORTFOLIO_MODE" default:"ISOLATED"`
+	// MaxWorkers is the number of traders backtested in parallel, zero uses a worker per CPU
+	MaxWorkers int				`envconfig:"MAX_WORKERS" default:"0"`
+	// DataFeed is the source of bars for dry & live runs, POLL for a bar feed server or KLINE_STREAM for a Binance-style
+	// kline WebSocket stream
+	DataFeed string				`envconfig:"DATA_FEED" default:"POLL"`
+	// DataFeedURL is the base URL of the bar feed server, or the REST API kline streams are backfilled from
+	DataFeedURL string			`envconfig:"DATA_FEED_URL" default:"http://localhost:8081"`
+	// DataStreamURL is the base URL of the kline WebSocket streams
+	DataStreamURL string		`envconfig:"DATA_STREAM_URL" default:"ws://localhost:8081"`
+	// Heartbeat is the interval dry & live traders poll their data feed for new bars
+	Heartbeat time.Duration		`envconfig:"HEARTBEAT" default:"1s"`
+	// ExchangeAPIURL is the base URL of the REST API live orders are placed on
+	ExchangeAPIURL string		`envconfig:"EXCHANGE_API_URL" default:"https://api.binance.com"`
+	// ExchangeAPIKey is the API key live orders are placed with
+	ExchangeAPIKey string		`envconfig:"EXCHANGE_API_KEY"`
+	// ExchangeAPISecret is the secret live order requests are signed with
+	ExchangeAPISecret string	`envconfig:"EXCHANGE_API_SECRET"`
+	// BaseTimeframe is the timeframe of the bars backtests load & aggregate into each trader's timeframe, eg/ 1H bars
+	// rolled up into 4H & 1D traders, empty loads each trader's timeframe directly
+	BaseTimeframe string		`envconfig:"BASE_TIMEFRAME"`
+	// CSVSchemas maps the columns of each exchange's historic data files in the format
+	// "exchange=timestamp:open_time,close_price:RAW,time_format:UNIX_MS;exchange=...", unlisted exchanges are Yahoo-format
+	CSVSchemas string			`envconfig:"CSV_SCHEMAS"`
+	// BacktestStart is the ISO date or RFC3339 timestamp trading begins at in backtests, empty starts at the first bar
+	BacktestStart string		`envconfig:"BACKTEST_START"`
+	// BacktestEnd is the ISO date or RFC3339 timestamp backtests stop before, empty ends at the last bar
+	BacktestEnd string			`envconfig:"BACKTEST_END"`
+	// WarmupBars is the number of bars before BacktestStart fed to strategies without trading
+	WarmupBars int				`envconfig:"WARMUP_BARS" default:"0"`
+	// DataQuality overrides the policy (FAIL, WARN, FILL or DROP) of each check of historic data in the format
+	// "check:policy,check:policy", where the checks are duplicate, non_monotonic, missing, ohlc, zero_volume & outlier
+	DataQuality string			`envconfig:"DATA_QUALITY"`
+	// DataQualityOutlier is the robust standard deviations a return must exceed to be an outlier, zero disables it
+	DataQualityOutlier float64	`envconfig:"DATA_QUALITY_OUTLIER" default:"10.0"`
+	// DataSource is the source of bars for backtests, CSV for the historic data files or SYNTHETIC for SynthModel
+	DataSource string			`envconfig:"DATA_SOURCE" default:"CSV"`
+	// SynthModel is the price process synthetic bars are generated from in the format "process:params", eg/ "gbm:0.1:0.8"
+	SynthModel string			`envconfig:"SYNTH_MODEL" default:"gbm:0.0:0.8"`
+	// SynthSeed seeds the synthetic bars of every symbol so backtests are reproducible
+	SynthSeed int64				`envconfig:"SYNTH_SEED" default:"1"`
+	// SynthBars is the number of synthetic bars generated for every symbol
+	SynthBars int				`envconfig:"SYNTH_BARS" default:"1000"`
+	// SynthStart is the timestamp of the first synthetic bar
+	SynthStart time.Time		`envconfig:"SYNTH_START" default:"2020-01-01T00:00:00Z"`
+	// SynthStartPrice is the open of the first synthetic bar
+	SynthStartPrice float64		`envconfig:"SYNTH_START_PRICE" default:"100.0"`
+	// MaxGrossExposure caps the sum of every position's exposure as a fraction of portfolio value, zero disables it
+	MaxGrossExposure float64	`envconfig:"MAX_GROSS_EXPOSURE" default:"0.0"`
+	// MaxSymbolExposure caps the exposure of a single symbol as a fraction of portfolio value, zero disables it
+	MaxSymbolExposure float64	`envconfig:"MAX_SYMBOL_EXPOSURE" default:"0.0"`
+	// MarginRequirement is the fraction of an entry's value that must be available in cash, zero disables it
+	MarginRequirement float64	`envconfig:"MARGIN_REQUIREMENT" default:"1.0"`
 }
 
 // config.Server is the HTTP server configuration
@@ -53,6 +147,8 @@ type Server struct {
 type Trader struct {
 	// Log is the logger this instance of Trader is using
 	Log *zap.Logger
+	// Mode is the trading mode this instance of Trader runs in (BACKTEST, DRY or LIVE)
+	Mode string
 	// Symbol is the ticker symbol this instance of Trader is using
 	Symbol string
 	// Timeframe is the interval between bars this instance of Trader is using
@@ -61,8 +157,86 @@ type Trader struct {
 	Exchange string
 	// StartingCash is the starting capital allocated to this instance of Trader
 	StartingCash float64
+	// Strategy is the strategy this instance of Trader trades
+	Strategy string
+	// StrategyParams overrides the parameters of the strategy in the format "name:value,name:value"
+	StrategyParams string
 	// DefaultOrderValue is the default value used by the SizeManager to determine the quantity of an order
 	DefaultOrderValue float64
+	// FillTiming determines the bar & price simulated orders are filled at
+	FillTiming string
+	// ExchangeFees is the fee model specification of every exchange
+	ExchangeFees string
+	// SlippageModel is the slippage model specification this instance of Trader is using
+	SlippageModel string
+	// NetworkFees is the network fee model specification of every on-chain exchange
+	NetworkFees string
+	// AMMPools is the LP fee of every constant-product AMM exchange
+	AMMPools string
+	// OrderType is the type of order this instance of Trader generates from signals
+	OrderType string
+	// OrderPriceOffset is the fraction of the current price that LIMIT & STOP prices are placed away from it
+	OrderPriceOffset float64
+	// TimeInForce is the time in force of orders this instance of Trader generates from signals
+	TimeInForce string
+	// OrderTimeToLive is the lifetime of GTD orders
+	OrderTimeToLive time.Duration
+	// MaxVolumeFraction caps each simulated fill at a fraction of the bar's volume, zero disables the cap
+	MaxVolumeFraction float64
+	// StopLoss is the protective exit attached to every Position this instance of Trader enters
+	StopLoss string
+	// TakeProfit is the profit target attached to every Position this instance of Trader enters
+	TakeProfit string
+	// TrailingStop is the ratcheting stop attached to every Position this instance of Trader enters
+	TrailingStop string
+	// ExitPriority decides which exit wins when a bar touches several
+	ExitPriority string
+	// MaxGrossExposure caps the sum of every position's exposure as a fraction of portfolio value
+	MaxGrossExposure float64
+	// MaxSymbolExposure caps the exposure of a single symbol as a fraction of portfolio value
+	MaxSymbolExposure float64
+	// MarginRequirement is the fraction of an entry's value that must be available in cash
+	MarginRequirement float64
+	// DataFeed is the source of bars in DRY & LIVE mode
+	DataFeed string
+	// DataFeedURL is the base URL of the bar feed server, or the REST API kline streams are backfilled from
+	DataFeedURL string
+	// DataStreamURL is the base URL of the kline WebSocket streams
+	DataStreamURL string
+	// Heartbeat is the interval this instance of Trader polls its data feed for new bars
+	Heartbeat time.Duration
+	// ExchangeAPIURL is the base URL of the REST API LIVE orders are placed on
+	ExchangeAPIURL string
+	// ExchangeAPIKey is the API key LIVE orders are placed with
+	ExchangeAPIKey string
+	// ExchangeAPISecret is the secret LIVE order requests are signed with
+	ExchangeAPISecret string
+	// BaseTimeframe is the timeframe of the bars aggregated into this instance of Trader's timeframe
+	BaseTimeframe string
+	// CSVSchemas maps the columns of every exchange's historic data files
+	CSVSchemas string
+	// BacktestStart is the timestamp trading begins at in BACKTEST mode, zero starts at the first bar
+	BacktestStart time.Time
+	// BacktestEnd is the timestamp BACKTEST mode stops before, zero ends at the last bar
+	BacktestEnd time.Time
+	// WarmupBars is the number of bars before BacktestStart fed to strategies without trading
+	WarmupBars int
+	// DataQuality overrides the policy of each check of historic data
+	DataQuality string
+	// DataQualityOutlier is the robust standard deviations a return must exceed to be an outlier
+	DataQualityOutlier float64
+	// DataSource is the source of bars in BACKTEST mode
+	DataSource string
+	// SynthModel is the price process specification synthetic bars are generated from
+	SynthModel string
+	// SynthSeed seeds the synthetic bars of this instance of Trader
+	SynthSeed int64
+	// SynthBars is the number of synthetic bars generated
+	SynthBars int
+	// SynthStart is the timestamp of the first synthetic bar
+	SynthStart time.Time
+	// SynthStartPrice is the open of the first synthetic bar
+	SynthStartPrice float64
 }
 
 func GetConfig(log *zap.Logger) (*Config, error) {
@@ -94,7 +268,12 @@ func validateConfig(cfg Config) error {
 	refl := reflect.ValueOf(cfg)
 	for i := 0; i < refl.NumField(); i++ {
 		for j := 0; j < refl.Field(i).NumField(); j++ {
-			if refl.Field(i).Field(j).Interface() == "" {
+			// Optional fields are allowed to be empty
+			if refl.Field(i).Type().Field(j).Tag.Get("required") != "true" {
+				continue
+			}
+			field := refl.Field(i).Field(j)
+			if field.Interface() == "" || (field.Kind() == reflect.Slice && field.Len() == 0) {
 				return errors.New(fmt.Sprintf("config field %s cannot be empty", refl.Field(i).Type().Field(j).Name))
 			}
 		}
@@ -16,13 +16,25 @@ import (
 
 const(
 	dataDirectory = "data/"
+	gasDirectory = "data/gas/"
 	timestampLayoutIso = "2006-01-02"
 )
 
+const (
+	DataSourceCSV		= "CSV"			// Load bars from the historic data files
+	DataSourceSynthetic	= "SYNTHETIC"	// Synthesise bars from the SYNTH_MODEL price process
+)
+
 type Handler interface {
 	ShouldContinue() bool
 	UpdateData()
 	GetLatestData() (*model.SymbolData, int64)
+	NextTimestamp() time.Time
+}
+
+// WarmUpper is a Handler whose bars before TradingStart only warm up strategies & their indicators
+type WarmUpper interface {
+	TradingStart() time.Time
 }
 
 // historicHandler is a Handler for backtesting trading strategies with historic data
@@ -33,6 +45,8 @@ type historicHandler struct {
 	allSymbolData     model.SymbolData 	// All the data available from historic data file
 	currentSymbolData model.SymbolData 	// Data available up to current timestamp
 	latestBarIndex    int64      		// Current index of the latest bar in the symbolData
+	qualityReport     QualityReport		// Outcome of validating the historic data file
+	tradingStart      time.Time			// Timestamp of the first bar traded, earlier bars only warm up strategies
 }
 
 // ShouldContinue determines if the market data feed should be terminated
@@ -50,14 +64,7 @@ func (sh *historicHandler) UpdateData() {
 	sh.latestBarIndex++
 
 	// Add latest bar to currentSymbolData
-	latestBar := model.Bar{
-		Timestamp: sh.allSymbolData.Timestamps[sh.latestBarIndex],
-		Open:      sh.allSymbolData.Opens[sh.latestBarIndex],
-		High:      sh.allSymbolData.Highs[sh.latestBarIndex],
-		Low:       sh.allSymbolData.Lows[sh.latestBarIndex],
-		Close:     sh.allSymbolData.Closes[sh.latestBarIndex],
-		Volume:    sh.allSymbolData.Volumes[sh.latestBarIndex],
-	}
+	latestBar := sh.allSymbolData.GetBar(sh.latestBarIndex)
 	sh.currentSymbolData.AddBar(latestBar)
 
 	// Add MarketEvent to the queue
@@ -74,16 +81,77 @@ func (sh *historicHandler) GetLatestData() (*model.SymbolData, int64) {
 	return &sh.currentSymbolData, sh.latestBarIndex
 }
 
+// NextTimestamp returns the timestamp of the bar the next call to UpdateData will add
+func (sh *historicHandler) NextTimestamp() time.Time {
+	return sh.allSymbolData.Timestamps[sh.latestBarIndex+1]
+}
+
+// window restricts the bars replayed to the trader's backtest window & its warm-up bars, where without a
+// BACKTEST_START the first WARMUP_BARS of the data only warm up
+func (sh *historicHandler) window(cfg config.Trader) error {
+	start := cfg.BacktestStart
+	if start.IsZero() && cfg.WarmupBars > 0 {
+		if cfg.WarmupBars >= len(sh.allSymbolData.Timestamps) {
+			return errors.New(fmt.Sprintf("%v warm-up bars leave none of the %v bars to backtest", cfg.WarmupBars, len(sh.allSymbolData.Timestamps)))
+		}
+		start = sh.allSymbolData.Timestamps[cfg.WarmupBars]
+	}
+	if start.IsZero() && cfg.BacktestEnd.IsZero() {
+		return nil
+	}
+
+	windowed, warmupBars, err := WindowSymbolData(sh.allSymbolData, start, cfg.BacktestEnd, cfg.WarmupBars)
+	if err != nil {
+		return err
+	}
+	if warmupBars < cfg.WarmupBars {
+		sh.log.Warn(fmt.Sprintf("only %v of %v warm-up bars of %s precede the backtest start", warmupBars, cfg.WarmupBars, sh.symbol))
+	}
+	sh.allSymbolData = windowed
+	sh.tradingStart = windowed.Timestamps[warmupBars]
+	return nil
+}
+
+// TradingStart returns the timestamp of the first bar traded, the bars before it only warm up strategies
+func (sh *historicHandler) TradingStart() time.Time {
+	return sh.tradingStart
+}
+
+// QualityReport returns the outcome of validating the historic data file, empty if the data was not loaded from one
+func (sh *historicHandler) QualityReport() QualityReport {
+	return sh.qualityReport
+}
+
 // NewHistoricHandler returns an instance of a data.historicHandler
 func NewHistoricHandler(cfg config.Trader, eventQ *queue.Queue) (*historicHandler, error) {
 	filePath := buildCSVFilePath(cfg)
 	cfg.Log.Debug(fmt.Sprintf("loading CSV symbol data with file path: %s", filePath))
 
-	allSymbolData, err := loadCSVSymbolData(filePath)
+	schema, err := CSVSchemaForExchange(cfg.CSVSchemas, cfg.Exchange)
+	if err != nil {
+		return &historicHandler{}, err
+	}
+	loadedSymbolData, err := loadCSVSymbolData(filePath, schema)
 	if err != nil {
 		return &historicHandler{}, errors.Wrap(err, "failed to load CSV data")
 	}
 
+	// Validate the data, repairing it as configured by DATA_QUALITY
+	timeframe, err := ParseTimeframe(cfg.Timeframe)
+	if err != nil {
+		return &historicHandler{}, err
+	}
+	policies, err := NewQualityPolicies(cfg.DataQuality, cfg.DataQualityOutlier)
+	if err != nil {
+		return &historicHandler{}, errors.Wrap(err, "invalid data quality policies")
+	}
+	allSymbolData, qualityReport, err := ValidateSymbolData(loadedSymbolData, timeframe, policies, filePath)
+	if err != nil {
+		return &historicHandler{}, errors.Wrap(err, fmt.Sprintf("data quality check of %s failed", filePath))
+	}
+	qualityReport.logIssues(func(message string) { cfg.Log.Warn(message) })
+	cfg.Log.Info(fmt.Sprintf("data quality of %s: %s", filePath, qualityReport.Summary()))
+
 	var latestBarIndex int64 = -1
 	var currentSymbolData model.SymbolData
 
@@ -94,22 +162,66 @@ func NewHistoricHandler(cfg config.Trader, eventQ *queue.Queue) (*historicHandle
 		allSymbolData:  	allSymbolData,
 		currentSymbolData:	currentSymbolData,
 		latestBarIndex: 	latestBarIndex,
+		qualityReport:		qualityReport,
 	}
 
 	return handler, nil
 }
 
+// NewBacktestHandler returns the Handler of the configured DATA_SOURCE for backtesting, aggregating bars of the
+// BASE_TIMEFRAME into the trader's timeframe if one is configured, windowed to the BACKTEST_START & BACKTEST_END
+func NewBacktestHandler(cfg config.Trader, eventQ *queue.Queue) (Handler, error) {
+	var dataHandler Handler
+	var historic *historicHandler
+	if cfg.BaseTimeframe != "" && cfg.BaseTimeframe != cfg.Timeframe {
+		resampled, err := NewResampledHandler(cfg, eventQ)
+		if err != nil {
+			return nil, err
+		}
+		dataHandler, historic = resampled, resampled.historicHandler
+	} else {
+		source, err := newSourceHandler(cfg, eventQ)
+		if err != nil {
+			return nil, err
+		}
+		dataHandler, historic = source, source
+	}
+
+	if err := historic.window(cfg); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to window data of %s", cfg.Symbol))
+	}
+	return dataHandler, nil
+}
+
+// newSourceHandler returns a historicHandler of the trader's timeframe loaded or synthesised from the DATA_SOURCE
+func newSourceHandler(cfg config.Trader, eventQ *queue.Queue) (*historicHandler, error) {
+	switch cfg.DataSource {
+	case DataSourceCSV, "":
+		return NewHistoricHandler(cfg, eventQ)
+	case DataSourceSynthetic:
+		return NewSyntheticHandler(cfg, eventQ)
+	}
+	return &historicHandler{}, errors.New(fmt.Sprintf("unsupported data source %s", cfg.DataSource))
+}
+
 // buildCSVFilePath returns a file path string in the format "dataDirectory + symbol + _ + timeframe + fileExtension"
 func buildCSVFilePath(cfg config.Trader) string {
 	return fmt.Sprintf("%s%s_%s.csv", dataDirectory, cfg.Symbol, cfg.Timeframe)
 }
 
-// loadCSVSymbolData
-func loadCSVSymbolData(filePath string) (model.SymbolData, error) {
+// loadCSVSymbolData loads a historic data file, locating each Bar field by the header names of the provided schema
+func loadCSVSymbolData(filePath string, schema CSVSchema) (model.SymbolData, error) {
 	lines, err := ReadCSV(filePath)
 	if err != nil {
 		return model.SymbolData{}, err
 	}
+	if len(lines) == 0 {
+		return model.SymbolData{}, errors.New(fmt.Sprintf("%s has no header", filePath))
+	}
+	columns, err := schema.resolveColumns(lines[0])
+	if err != nil {
+		return model.SymbolData{}, errors.Wrap(err, fmt.Sprintf("failed to map the columns of %s", filePath))
+	}
 
 	// Loop through (ignoring headers) & build arrays for symbolData struct
 	var timestamps []time.Time
@@ -117,43 +229,43 @@ func loadCSVSymbolData(filePath string) (model.SymbolData, error) {
 	var highs []float64
 	var lows []float64
 	var closes []float64
-	var volumes []uint64
+	var volumes []float64
 
 	for index, line := range lines[1:] {
 		// Add +1 to index to reflect true CSV line number for logging
 		index++
 		// Timestamp
-		timestamp, err := time.Parse(timestampLayoutIso, line[0])
+		timestamp, err := schema.parseTimestamp(line[columns.timestamp])
 		if err != nil {
 			return model.SymbolData{}, errors.Wrap(err, fmt.Sprintf("failed to parse timestamp at index %v", index))
 		}
 		timestamps = append(timestamps, timestamp)
 		// Open
-		open, err := strconv.ParseFloat(line[1], 64)
+		open, err := strconv.ParseFloat(line[columns.open], 64)
 		if err != nil {
 			return model.SymbolData{}, errors.Wrap(err, fmt.Sprintf("failed to parse open at index %v", index))
 		}
 		opens = append(opens, open)
 		// High
-		high, err := strconv.ParseFloat(line[2], 64)
+		high, err := strconv.ParseFloat(line[columns.high], 64)
 		if err != nil {
 			return model.SymbolData{}, errors.Wrap(err, fmt.Sprintf("failed to parse high at index %v", index))
 		}
 		highs = append(highs, high)
 		// Low
-		low, err := strconv.ParseFloat(line[3], 64)
+		low, err := strconv.ParseFloat(line[columns.low], 64)
 		if err != nil {
 			return model.SymbolData{}, errors.Wrap(err, fmt.Sprintf("failed to parse low at index %v", index))
 		}
 		lows = append(lows, low)
-		// Close
-		adjClose, err := strconv.ParseFloat(line[5], 64)
+		// Close (raw or adjusted as chosen by the schema)
+		close, err := strconv.ParseFloat(line[columns.close], 64)
 		if err != nil {
 			return model.SymbolData{}, errors.Wrap(err, fmt.Sprintf("failed to parse close at index %v", index))
 		}
-		closes = append(closes, adjClose)
+		closes = append(closes, close)
 		// Volume
-		volume, err := strconv.ParseUint(line[6], 10,64)
+		volume, err := strconv.ParseFloat(line[columns.volume], 64)
 		if err != nil {
 			return model.SymbolData{}, errors.Wrap(err, fmt.Sprintf("failed to parse volume at index %v", index))
 		}
@@ -173,6 +285,110 @@ func loadCSVSymbolData(filePath string) (model.SymbolData, error) {
 	return allSymbolData, nil
 }
 
+// LoadCSVTimeSeries loads a two column "timestamp,value" CSV file (with headers) in ascending timestamp order, eg/ a
+// historical gas price series
+func LoadCSVTimeSeries(filePath string) (model.TimeSeries, error) {
+	lines, err := ReadCSV(filePath)
+	if err != nil {
+		return model.TimeSeries{}, err
+	}
+	if len(lines) < 2 {
+		return model.TimeSeries{}, errors.New(fmt.Sprintf("%s has no values", filePath))
+	}
+
+	var timeSeries model.TimeSeries
+	for index, line := range lines[1:] {
+		// Add +1 to index to reflect true CSV line number for logging
+		index++
+		if len(line) < 2 {
+			return model.TimeSeries{}, errors.New(fmt.Sprintf("expected 2 columns at index %v", index))
+		}
+		timestamp, err := parseTimestamp(line[0])
+		if err != nil {
+			return model.TimeSeries{}, errors.Wrap(err, fmt.Sprintf("failed to parse timestamp at index %v", index))
+		}
+		value, err := strconv.ParseFloat(line[1], 64)
+		if err != nil {
+			return model.TimeSeries{}, errors.Wrap(err, fmt.Sprintf("failed to parse value at index %v", index))
+		}
+		timeSeries.Timestamps = append(timeSeries.Timestamps, timestamp)
+		timeSeries.Values = append(timeSeries.Values, value)
+	}
+
+	return timeSeries, nil
+}
+
+// LoadCSVCloseSeries loads the close prices of a symbol's historic data file as a TimeSeries, locating the columns
+// with the schema of the exchange the file is from
+func LoadCSVCloseSeries(symbol string, timeframe string, schema CSVSchema) (model.TimeSeries, error) {
+	return loadCSVCloseSeries(buildCSVFilePath(config.Trader{Symbol: symbol, Timeframe: timeframe}), schema)
+}
+
+// loadCSVCloseSeries loads the close prices of the historic data file at the provided filePath as a TimeSeries
+func loadCSVCloseSeries(filePath string, schema CSVSchema) (model.TimeSeries, error) {
+	symbolData, err := loadCSVSymbolData(filePath, schema)
+	if err != nil {
+		return model.TimeSeries{}, err
+	}
+	return model.TimeSeries{Timestamps: symbolData.Timestamps, Values: symbolData.Closes}, nil
+}
+
+// LoadCSVGasPriceSeries loads the historical gas price series (gwei) of a chain from "gasDirectory + chain.csv"
+func LoadCSVGasPriceSeries(chain string) (model.TimeSeries, error) {
+	return LoadCSVTimeSeries(fmt.Sprintf("%s%s.csv", gasDirectory, chain))
+}
+
+// LoadCSVPoolReserves loads the historical AMM pool reserves of a symbol from a "timestamp,base_reserve,quote_reserve"
+// CSV file (with headers) in the format "dataDirectory + symbol + _ + timeframe + _RESERVES.csv"
+func LoadCSVPoolReserves(symbol string, timeframe string) (model.PoolReserves, error) {
+	return loadCSVPoolReserves(fmt.Sprintf("%s%s_%s_RESERVES.csv", dataDirectory, symbol, timeframe))
+}
+
+// loadCSVPoolReserves loads the "timestamp,base_reserve,quote_reserve" CSV file at the provided filePath
+func loadCSVPoolReserves(filePath string) (model.PoolReserves, error) {
+	lines, err := ReadCSV(filePath)
+	if err != nil {
+		return model.PoolReserves{}, err
+	}
+	if len(lines) < 2 {
+		return model.PoolReserves{}, errors.New(fmt.Sprintf("%s has no reserves", filePath))
+	}
+
+	var reserves model.PoolReserves
+	for index, line := range lines[1:] {
+		// Add +1 to index to reflect true CSV line number for logging
+		index++
+		if len(line) < 3 {
+			return model.PoolReserves{}, errors.New(fmt.Sprintf("expected 3 columns at index %v", index))
+		}
+		timestamp, err := parseTimestamp(line[0])
+		if err != nil {
+			return model.PoolReserves{}, errors.Wrap(err, fmt.Sprintf("failed to parse timestamp at index %v", index))
+		}
+		baseReserve, err := strconv.ParseFloat(line[1], 64)
+		if err != nil {
+			return model.PoolReserves{}, errors.Wrap(err, fmt.Sprintf("failed to parse base reserve at index %v", index))
+		}
+		quoteReserve, err := strconv.ParseFloat(line[2], 64)
+		if err != nil {
+			return model.PoolReserves{}, errors.Wrap(err, fmt.Sprintf("failed to parse quote reserve at index %v", index))
+		}
+		reserves.Timestamps = append(reserves.Timestamps, timestamp)
+		reserves.BaseReserves = append(reserves.BaseReserves, baseReserve)
+		reserves.QuoteReserves = append(reserves.QuoteReserves, quoteReserve)
+	}
+
+	return reserves, nil
+}
+
+// parseTimestamp parses an ISO date or RFC3339 timestamp
+func parseTimestamp(value string) (time.Time, error) {
+	if timestamp, err := time.Parse(timestampLayoutIso, value); err == nil {
+		return timestamp, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 // ReadCSV reads the file at the provided filePath and returns a 2D array of strings to represent its contents
 func ReadCSV(filePath string) ([][]string, error) {
 	// Todo: Improve parser w/ https://github.com/dirkolbrich/gobacktest/blob/668a578c68f771714e56e6bedb9744068b6ee2d2/data/data-csv.go#L144
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadCSVTimeSeries(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		contents      string
+		expected      model.TimeSeries
+		expectedError bool
+	}{
+		{
+			name:     "TestLoadCSVTimeSeries_values",
+			contents: "timestamp,gwei\n2021-01-01,50\n2021-01-02T00:00:00Z,100\n",
+			expected: model.TimeSeries{
+				Timestamps: []time.Time{testTimestamp, testTimestamp.AddDate(0, 0, 1)},
+				Values:     []float64{50, 100},
+			},
+		},
+		{
+			name:          "TestLoadCSVTimeSeries_empty",
+			contents:      "",
+			expectedError: true,
+		},
+		{
+			name:          "TestLoadCSVTimeSeries_headerOnly",
+			contents:      "timestamp,gwei\n",
+			expectedError: true,
+		},
+		{
+			name:          "TestLoadCSVTimeSeries_invalidValue",
+			contents:      "timestamp,gwei\n2021-01-01,high\n",
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "ethereum.csv")
+			if err := ioutil.WriteFile(filePath, []byte(testCase.contents), 0644); err != nil {
+				t.Fatalf("failed to write file: %s", err)
+			}
+
+			timeSeries, err := LoadCSVTimeSeries(filePath)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if diff := cmp.Diff(testCase.expected, timeSeries); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadCSVPoolReserves(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		contents      string
+		expected      model.PoolReserves
+		expectedError bool
+	}{
+		{
+			name:     "TestLoadCSVPoolReserves_values",
+			contents: "timestamp,base_reserve,quote_reserve\n2021-01-01,1000,1000000\n",
+			expected: model.PoolReserves{
+				Timestamps:    []time.Time{testTimestamp},
+				BaseReserves:  []float64{1000},
+				QuoteReserves: []float64{1000000},
+			},
+		},
+		{
+			name:          "TestLoadCSVPoolReserves_empty",
+			contents:      "",
+			expectedError: true,
+		},
+		{
+			name:          "TestLoadCSVPoolReserves_headerOnly",
+			contents:      "timestamp,base_reserve,quote_reserve\n",
+			expectedError: true,
+		},
+		{
+			name:          "TestLoadCSVPoolReserves_missingColumn",
+			contents:      "timestamp,base_reserve,quote_reserve\n2021-01-01,1000\n",
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "ETH-USD_1d_RESERVES.csv")
+			if err := ioutil.WriteFile(filePath, []byte(testCase.contents), 0644); err != nil {
+				t.Fatalf("failed to write file: %s", err)
+			}
+
+			reserves, err := loadCSVPoolReserves(filePath)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if diff := cmp.Diff(testCase.expected, reserves); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadCSVCloseSeries(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		contents      string
+		schemas       string
+		expected      model.TimeSeries
+		expectedError bool
+	}{
+		{
+			name:     "TestLoadCSVCloseSeries_defaultSchema",
+			contents: "Date,Open,High,Low,Close,Adj Close,Volume\n2021-01-01,1,2,0.5,1.5,1.4,100\n",
+			expected: model.TimeSeries{Timestamps: []time.Time{testTimestamp}, Values: []float64{1.4}},
+		},
+		{
+			name:     "TestLoadCSVCloseSeries_exchangeSchema",
+			contents: "open_time,open,high,low,close,volume\n1609459200000,1,2,0.5,1.5,100\n",
+			schemas:  "binance=timestamp:open_time,close_price:RAW,time_format:UNIX_MS",
+			expected: model.TimeSeries{Timestamps: []time.Time{testTimestamp}, Values: []float64{1.5}},
+		},
+		{
+			name:          "TestLoadCSVCloseSeries_defaultSchemaMismatch",
+			contents:      "open_time,open,high,low,close,volume\n1609459200000,1,2,0.5,1.5,100\n",
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "ETH-USD_1d.csv")
+			if err := ioutil.WriteFile(filePath, []byte(testCase.contents), 0644); err != nil {
+				t.Fatalf("failed to write file: %s", err)
+			}
+
+			schema, err := CSVSchemaForExchange(testCase.schemas, "binance")
+			if err != nil {
+				t.Fatal(err)
+			}
+			closes, err := loadCSVCloseSeries(filePath, schema)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if diff := cmp.Diff(testCase.expected, closes); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
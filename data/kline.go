@@ -0,0 +1,331 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Minute
+	streamReadTimeout   = 5 * time.Minute // Binance pings every 3 minutes, so a silent stream has dropped
+	klinesLimit         = 1000            // Maximum klines returned by a single REST request
+)
+
+// binanceKlineEvent is a kline update of a Binance kline stream, sent every time the current kline changes. Keys
+// differing only by case, eg/ "t" & "T", are all declared as JSON keys otherwise match fields case-insensitively.
+type binanceKlineEvent struct {
+	EventType string `json:"e"`
+	EventTime int64  `json:"E"`
+	Kline     struct {
+		OpenTime            int64  `json:"t"`
+		CloseTime           int64  `json:"T"`
+		Open                string `json:"o"`
+		High                string `json:"h"`
+		Low                 string `json:"l"`
+		Close               string `json:"c"`
+		Volume              string `json:"v"`
+		TakerBuyVolume      string `json:"V"`
+		QuoteVolume         string `json:"q"`
+		TakerBuyQuoteVolume string `json:"Q"`
+		IsClosed            bool   `json:"x"`
+	} `json:"k"`
+}
+
+// klineStreamFeed is a Feed subscribing to a Binance-style kline WebSocket stream, receiving each bar as it closes.
+// Dropped connections are reconnected with exponential backoff, and bars missed whilst disconnected are backfilled
+// from the REST klines endpoint.
+type klineStreamFeed struct {
+	log         *zap.Logger
+	client      *http.Client
+	streamURL   string
+	restURL     string
+	symbol      string
+	interval    string
+	timeframe   time.Duration
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	readTimeout time.Duration
+	startOnce   sync.Once
+	mutex       sync.Mutex
+	received    []model.Bar // Closed bars received from the stream since the last Fetch
+	connections int
+	isRecovered bool // The stream reconnected, so bars may have been missed whilst disconnected
+}
+
+// Fetch returns the closed bars received from the stream after the provided timestamp, backfilling any gap before
+// them or since a reconnect from the REST API - the stream is subscribed to on the first Fetch & runs until the
+// context is cancelled. A stream never finishes.
+func (kf *klineStreamFeed) Fetch(ctx context.Context, after time.Time) ([]model.Bar, bool, error) {
+	kf.startOnce.Do(func() {
+		go kf.stream(ctx)
+	})
+
+	kf.mutex.Lock()
+	received, isRecovered := kf.received, kf.isRecovered
+	kf.received, kf.isRecovered = nil, false
+	kf.mutex.Unlock()
+	sort.Slice(received, func(i, j int) bool {
+		return received[i].Timestamp.Before(received[j].Timestamp)
+	})
+
+	var bars []model.Bar
+	cursor := after
+	if isRecovered && !cursor.IsZero() {
+		missing, err := kf.backfill(ctx, cursor, time.Time{})
+		if err != nil {
+			kf.requeue(received, true)
+			return nil, false, err
+		}
+		bars = append(bars, missing...)
+		if len(missing) > 0 {
+			cursor = missing[len(missing)-1].Timestamp
+		}
+	}
+
+	for _, bar := range received {
+		if !bar.Timestamp.After(cursor) {
+			continue
+		}
+		// Bars are contiguous unless the stream missed some
+		if !cursor.IsZero() && bar.Timestamp.After(cursor.Add(kf.timeframe)) {
+			missing, err := kf.backfill(ctx, cursor, bar.Timestamp)
+			if err != nil {
+				kf.requeue(received, false)
+				return nil, false, err
+			}
+			bars = append(bars, missing...)
+		}
+		bars = append(bars, bar)
+		cursor = bar.Timestamp
+	}
+	return bars, false, nil
+}
+
+// requeue returns bars taken from the stream to be fetched again after a failed backfill
+func (kf *klineStreamFeed) requeue(bars []model.Bar, isRecovered bool) {
+	kf.mutex.Lock()
+	defer kf.mutex.Unlock()
+	kf.received = append(bars, kf.received...)
+	kf.isRecovered = kf.isRecovered || isRecovered
+}
+
+// stream keeps the stream subscribed until the context is cancelled, reconnecting with exponential backoff
+func (kf *klineStreamFeed) stream(ctx context.Context) {
+	backoff := kf.minBackoff
+	for ctx.Err() == nil {
+		isConnected, err := kf.consume(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if isConnected {
+			backoff = kf.minBackoff
+		}
+		kf.log.Warn(fmt.Sprintf("kline stream for %s disconnected, reconnecting in %s: %s", kf.symbol, backoff, err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > kf.maxBackoff {
+			backoff = kf.maxBackoff
+		}
+	}
+}
+
+// consume connects to the stream & buffers the closed bars it sends until the connection fails, returning whether
+// the connection was established
+func (kf *klineStreamFeed) consume(ctx context.Context) (bool, error) {
+	streamURL := fmt.Sprintf("%s/ws/%s@kline_%s", kf.streamURL, strings.ToLower(kf.symbol), kf.interval)
+	conn, err := dialWebsocket(ctx, streamURL)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// Close the connection when the run is cancelled to unblock the read
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	kf.mutex.Lock()
+	kf.connections++
+	kf.isRecovered = kf.isRecovered || kf.connections > 1
+	kf.mutex.Unlock()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(kf.readTimeout))
+		message, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+
+		var event binanceKlineEvent
+		if err := json.Unmarshal(message, &event); err != nil || event.EventType != "kline" {
+			continue
+		}
+		if !event.Kline.IsClosed {
+			continue
+		}
+		kline := event.Kline
+		bar, err := newKlineBar(kline.OpenTime, kline.Open, kline.High, kline.Low, kline.Close, kline.Volume)
+		if err != nil {
+			kf.log.Warn(fmt.Sprintf("failed to parse kline of %s: %s", kf.symbol, err))
+			continue
+		}
+
+		kf.mutex.Lock()
+		kf.received = append(kf.received, bar)
+		kf.mutex.Unlock()
+	}
+}
+
+// backfill requests the closed bars after the provided timestamp & before the provided end, if not zero, from the
+// REST klines endpoint
+func (kf *klineStreamFeed) backfill(ctx context.Context, after time.Time, before time.Time) ([]model.Bar, error) {
+	var bars []model.Bar
+	startTime := after.Add(time.Millisecond)
+	for {
+		query := url.Values{}
+		query.Set("symbol", kf.symbol)
+		query.Set("interval", kf.interval)
+		query.Set("startTime", strconv.FormatInt(toMilliseconds(startTime), 10))
+		if !before.IsZero() {
+			query.Set("endTime", strconv.FormatInt(toMilliseconds(before)-1, 10))
+		}
+		query.Set("limit", strconv.Itoa(klinesLimit))
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v3/klines?%s", kf.restURL, query.Encode()), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to build klines request")
+		}
+		response, err := kf.client.Do(request)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to request klines")
+		}
+		var rows [][]json.RawMessage
+		err = json.NewDecoder(response.Body).Decode(&rows)
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, errors.New(fmt.Sprintf("klines request responded with status %s", response.Status))
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode klines")
+		}
+
+		for _, row := range rows {
+			bar, closeTime, err := parseKlineRow(row)
+			if err != nil {
+				return nil, err
+			}
+			// The REST API also returns the kline still in progress
+			if closeTime.After(time.Now()) {
+				continue
+			}
+			bars = append(bars, bar)
+			startTime = bar.Timestamp.Add(time.Millisecond)
+		}
+		if len(rows) < klinesLimit {
+			break
+		}
+	}
+
+	if len(bars) > 0 {
+		kf.log.Info(fmt.Sprintf("backfilled %v bars of %s from %s", len(bars), kf.symbol, bars[0].Timestamp))
+	}
+	return bars, nil
+}
+
+// parseKlineRow parses a REST kline in the format [openTime, open, high, low, close, volume, closeTime, ...]
+func parseKlineRow(row []json.RawMessage) (model.Bar, time.Time, error) {
+	if len(row) < 7 {
+		return model.Bar{}, time.Time{}, errors.New(fmt.Sprintf("expected at least 7 kline fields, got %v", len(row)))
+	}
+	var openTime, closeTime int64
+	var fields [5]string
+	if err := json.Unmarshal(row[0], &openTime); err != nil {
+		return model.Bar{}, time.Time{}, errors.Wrap(err, "failed to parse kline open time")
+	}
+	for index := range fields {
+		if err := json.Unmarshal(row[index+1], &fields[index]); err != nil {
+			return model.Bar{}, time.Time{}, errors.Wrap(err, "failed to parse kline prices")
+		}
+	}
+	if err := json.Unmarshal(row[6], &closeTime); err != nil {
+		return model.Bar{}, time.Time{}, errors.Wrap(err, "failed to parse kline close time")
+	}
+
+	bar, err := newKlineBar(openTime, fields[0], fields[1], fields[2], fields[3], fields[4])
+	return bar, fromMilliseconds(closeTime), err
+}
+
+// newKlineBar builds a Bar from a kline's open time in milliseconds & its decimal string prices & volume
+func newKlineBar(openTime int64, open string, high string, low string, close string, volume string) (model.Bar, error) {
+	var values [5]float64
+	for index, value := range []string{open, high, low, close, volume} {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return model.Bar{}, errors.Wrap(err, fmt.Sprintf("failed to parse kline value %s", value))
+		}
+		values[index] = parsed
+	}
+	return model.Bar{
+		Timestamp: fromMilliseconds(openTime),
+		Open:      values[0],
+		High:      values[1],
+		Low:       values[2],
+		Close:     values[3],
+		Volume:    values[4],
+	}, nil
+}
+
+// toMilliseconds returns the Unix milliseconds of a timestamp
+func toMilliseconds(timestamp time.Time) int64 {
+	return timestamp.UnixNano() / int64(time.Millisecond)
+}
+
+// fromMilliseconds returns the UTC timestamp of Unix milliseconds
+func fromMilliseconds(milliseconds int64) time.Time {
+	return time.Unix(0, milliseconds*int64(time.Millisecond)).UTC()
+}
+
+// NewKlineStreamFeed constructs a Feed subscribing to the kline stream of the trader's symbol & timeframe at
+// DATA_STREAM_URL, backfilling from the REST API at DATA_FEED_URL
+func NewKlineStreamFeed(cfg config.Trader) (*klineStreamFeed, error) {
+	timeframe, err := ParseTimeframe(cfg.Timeframe)
+	if err != nil {
+		return &klineStreamFeed{}, err
+	}
+	return &klineStreamFeed{
+		log:         cfg.Log,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		streamURL:   strings.TrimSuffix(cfg.DataStreamURL, "/"),
+		restURL:     strings.TrimSuffix(cfg.DataFeedURL, "/"),
+		symbol:      BinanceSymbol(cfg.Symbol),
+		interval:    binanceInterval(cfg.Timeframe),
+		timeframe:   timeframe,
+		minBackoff:  minReconnectBackoff,
+		maxBackoff:  maxReconnectBackoff,
+		readTimeout: streamReadTimeout,
+	}, nil
+}
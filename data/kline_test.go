@@ -0,0 +1,189 @@
+package data
+
+import (
+	"context"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replayClock is a replay server clock advanced by the test
+type replayClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (rc *replayClock) get() time.Time {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.now
+}
+
+func (rc *replayClock) set(now time.Time) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.now = now
+}
+
+// newTestReplay returns a ReplayServer of five daily ETH-USD bars, replaying a day every second of the clock
+func newTestReplay(clock *replayClock) (*ReplayServer, []model.Bar) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var bars []model.Bar
+	for day := 0; day < 5; day++ {
+		bars = append(bars, model.Bar{Timestamp: start.AddDate(0, 0, day), Open: 100, High: 110, Low: 90,
+			Close: float64(100 + day), Volume: 10})
+	}
+	clock.set(start)
+	return &ReplayServer{
+		log:     zap.NewNop(),
+		speed:   86400,
+		start:   start,
+		now:     clock.get,
+		series:  map[string][]model.Bar{"ETH-USD_1D": bars},
+		loadCSV: csvBarLoader(DefaultCSVSchema()),
+	}, bars
+}
+
+func TestKlineStreamFeed_Fetch(t *testing.T) {
+	clock := &replayClock{}
+	replayServer, bars := newTestReplay(clock)
+	clock.set(bars[0].Timestamp.Add(10 * time.Second))
+	server := httptest.NewServer(replayServer)
+	defer server.Close()
+
+	testCases := []struct {
+		name           string
+		after          time.Time
+		received       []model.Bar
+		isRecovered    bool
+		expectedCloses []float64
+	}{
+		{
+			name:           "TestKlineStreamFeed_Fetch_contiguous",
+			after:          bars[2].Timestamp,
+			received:       []model.Bar{bars[3]},
+			expectedCloses: []float64{103},
+		},
+		{
+			name:           "TestKlineStreamFeed_Fetch_gapBackfilled",
+			after:          bars[0].Timestamp,
+			received:       []model.Bar{bars[3], bars[2]},
+			expectedCloses: []float64{101, 102, 103},
+		},
+		{
+			name:           "TestKlineStreamFeed_Fetch_reconnectBackfilled",
+			after:          bars[1].Timestamp,
+			isRecovered:    true,
+			expectedCloses: []float64{102, 103, 104},
+		},
+		{
+			name:           "TestKlineStreamFeed_Fetch_alreadyReceivedIgnored",
+			after:          bars[3].Timestamp,
+			received:       []model.Bar{bars[2], bars[3]},
+			expectedCloses: nil,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			feed, err := NewKlineStreamFeed(config.Trader{Log: zap.NewNop(), Symbol: "ETH-USD", Timeframe: "1D",
+				DataFeedURL: server.URL})
+			if err != nil {
+				t.Fatalf("failed to init feed: %s", err)
+			}
+			// Stream bars are provided by the test case
+			feed.startOnce.Do(func() {})
+			feed.received, feed.isRecovered = testCase.received, testCase.isRecovered
+
+			fetched, _, err := feed.Fetch(context.Background(), testCase.after)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var closes []float64
+			for _, bar := range fetched {
+				closes = append(closes, bar.Close)
+			}
+			if len(closes) != len(testCase.expectedCloses) {
+				t.Fatalf("expected closes %v, got: %v", testCase.expectedCloses, closes)
+			}
+			for index := range closes {
+				if closes[index] != testCase.expectedCloses[index] {
+					t.Errorf("expected closes %v, got: %v", testCase.expectedCloses, closes)
+				}
+			}
+		})
+	}
+}
+
+func TestKlineStreamFeed_stream(t *testing.T) {
+	clock := &replayClock{}
+	replayServer, bars := newTestReplay(clock)
+
+	// The first stream connection is dropped straight away to force a reconnect
+	var connections int
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ws/") {
+			mutex.Lock()
+			connections++
+			isFirst := connections == 1
+			mutex.Unlock()
+			if isFirst {
+				if conn, err := acceptWebsocket(w, r); err == nil {
+					conn.Close()
+				}
+				return
+			}
+		}
+		replayServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	feed, err := NewKlineStreamFeed(config.Trader{Log: zap.NewNop(), Symbol: "ETH-USD", Timeframe: "1D",
+		DataFeedURL: server.URL, DataStreamURL: "ws" + strings.TrimPrefix(server.URL, "http")})
+	if err != nil {
+		t.Fatalf("failed to init feed: %s", err)
+	}
+	feed.minBackoff = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, _, err := feed.Fetch(ctx, time.Time{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Wait for the reconnected stream before releasing the next bar
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		feed.mutex.Lock()
+		isReconnected := feed.connections == 2
+		feed.mutex.Unlock()
+		if isReconnected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the stream to reconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	clock.set(bars[0].Timestamp.Add(time.Second))
+
+	var fetched []model.Bar
+	for len(fetched) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a bar from the reconnected stream")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if fetched, _, err = feed.Fetch(ctx, time.Time{}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if len(fetched) != 1 || fetched[0].Timestamp != bars[1].Timestamp || fetched[0].Close != bars[1].Close {
+		t.Errorf("expected bar %+v, got: %+v", bars[1], fetched)
+	}
+}
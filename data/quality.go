@@ -0,0 +1,308 @@
+package data
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	CheckDuplicate    = "duplicate"     // Bar with the same timestamp as the previous bar
+	CheckNonMonotonic = "non_monotonic" // Bar with a timestamp before the previous bar
+	CheckMissing      = "missing"       // Bars of the timeframe missing between two bars
+	CheckOHLC         = "ohlc"          // High below Low, Open or Close outside the range, or a non-positive price
+	CheckZeroVolume   = "zero_volume"   // Bar with no volume
+	CheckOutlier      = "outlier"       // Close-to-close return beyond the outlier threshold
+)
+
+const (
+	PolicyFail = "FAIL" // Fail the load
+	PolicyWarn = "WARN" // Keep the bar & log a warning
+	PolicyFill = "FILL" // Replace the bar, or insert missing bars, flat at the previous close with zero volume
+	PolicyDrop = "DROP" // Remove the bar
+)
+
+// maxLoggedIssues is the number of issues of each check logged individually before they are only counted
+const maxLoggedIssues = 5
+
+// qualityChecks are the checks in the order each bar is validated, with the policies they support
+var qualityChecks = []struct {
+	check    string
+	policies []string
+}{
+	{CheckDuplicate, []string{PolicyFail, PolicyWarn, PolicyDrop}},
+	{CheckNonMonotonic, []string{PolicyFail, PolicyWarn, PolicyDrop}},
+	{CheckMissing, []string{PolicyFail, PolicyWarn, PolicyFill}},
+	{CheckOHLC, []string{PolicyFail, PolicyWarn, PolicyFill, PolicyDrop}},
+	{CheckZeroVolume, []string{PolicyFail, PolicyWarn, PolicyFill, PolicyDrop}},
+	{CheckOutlier, []string{PolicyFail, PolicyWarn, PolicyFill, PolicyDrop}},
+}
+
+// qualityProblem is a check a bar failed & why
+type qualityProblem struct {
+	check  string
+	detail string
+}
+
+// QualityPolicies is the policy applied to each data-quality check & the outlier threshold
+type QualityPolicies struct {
+	Policies map[string]string
+	// OutlierThreshold is the number of robust standard deviations (1.4826 * median absolute deviation) a close-to-close
+	// log return must exceed the median by to be an outlier, zero disables the check
+	OutlierThreshold float64
+}
+
+// QualityIssue is a single problem found validating historic data
+type QualityIssue struct {
+	Check     string
+	Policy    string
+	Line      int // CSV line of the bar, where the header is line 0
+	Timestamp time.Time
+	Detail    string
+}
+
+// QualityReport is the outcome of validating historic data
+type QualityReport struct {
+	Source     string
+	InputBars  int
+	OutputBars int
+	Counts     map[string]int // map[check]number of issues
+	Issues     []QualityIssue
+}
+
+// Summary returns a one line description of the report, eg/ "365 bars loaded as 366, missing: 1"
+func (qr QualityReport) Summary() string {
+	summary := fmt.Sprintf("%v bars loaded as %v", qr.InputBars, qr.OutputBars)
+	for _, qualityCheck := range qualityChecks {
+		if count := qr.Counts[qualityCheck.check]; count > 0 {
+			summary += fmt.Sprintf(", %s: %v", qualityCheck.check, count)
+		}
+	}
+	return summary
+}
+
+// QualityReporter is a Handler whose historic data was validated on load
+type QualityReporter interface {
+	QualityReport() QualityReport
+}
+
+// DefaultQualityPolicies returns policies failing on duplicate & non-monotonic timestamps & warning of every other
+// problem
+func DefaultQualityPolicies() QualityPolicies {
+	return QualityPolicies{
+		Policies: map[string]string{
+			CheckDuplicate:    PolicyFail,
+			CheckNonMonotonic: PolicyFail,
+			CheckMissing:      PolicyWarn,
+			CheckOHLC:         PolicyWarn,
+			CheckZeroVolume:   PolicyWarn,
+			CheckOutlier:      PolicyWarn,
+		},
+		OutlierThreshold: 10,
+	}
+}
+
+// NewQualityPolicies constructs QualityPolicies overriding the DefaultQualityPolicies with a specification in the
+// format "check:policy,check:policy", eg/ "missing:FILL,outlier:DROP"
+func NewQualityPolicies(specification string, outlierThreshold float64) (QualityPolicies, error) {
+	policies := DefaultQualityPolicies()
+	if outlierThreshold < 0 {
+		return QualityPolicies{}, errors.New(fmt.Sprintf("outlier threshold %v cannot be negative", outlierThreshold))
+	}
+	policies.OutlierThreshold = outlierThreshold
+
+	for _, field := range strings.Split(specification, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		checkPolicy := strings.Split(strings.TrimSpace(field), ":")
+		if len(checkPolicy) != 2 {
+			return QualityPolicies{}, errors.New(fmt.Sprintf("failed to parse data quality policy %s", field))
+		}
+		check, policy := strings.ToLower(checkPolicy[0]), strings.ToUpper(checkPolicy[1])
+
+		var supported []string
+		for _, qualityCheck := range qualityChecks {
+			if qualityCheck.check == check {
+				supported = qualityCheck.policies
+			}
+		}
+		if supported == nil {
+			return QualityPolicies{}, errors.New(fmt.Sprintf("unsupported data quality check %s", check))
+		}
+		isSupported := false
+		for _, candidate := range supported {
+			isSupported = isSupported || candidate == policy
+		}
+		if !isSupported {
+			return QualityPolicies{}, errors.New(fmt.Sprintf("data quality check %s supports policies %v, got %s", check, supported, policy))
+		}
+		policies.Policies[check] = policy
+	}
+	return policies, nil
+}
+
+// ValidateSymbolData checks bars of the timeframe in file order, applying the policy of each problem found & returning
+// the repaired bars with a report of every issue. An error is returned for the first issue with the FAIL policy.
+func ValidateSymbolData(symbolData model.SymbolData, timeframe time.Duration, policies QualityPolicies,
+	source string) (model.SymbolData, QualityReport, error) {
+	report := QualityReport{Source: source, InputBars: len(symbolData.Timestamps), Counts: make(map[string]int)}
+	validated := model.SymbolData{Indicators: make(map[string][]interface{})}
+	median, robustStdev := returnDistribution(symbolData.Closes)
+
+	// record adds an issue to the report, returning an error if its policy is FAIL
+	record := func(check string, index int, timestamp time.Time, detail string) (string, error) {
+		policy := policies.Policies[check]
+		report.Counts[check]++
+		report.Issues = append(report.Issues, QualityIssue{Check: check, Policy: policy, Line: index + 1,
+			Timestamp: timestamp, Detail: detail})
+		if policy == PolicyFail {
+			return policy, errors.New(fmt.Sprintf("%s bar at line %v (%s): %s", check, index+1, timestamp.Format(time.RFC3339), detail))
+		}
+		return policy, nil
+	}
+
+	for index := range symbolData.Timestamps {
+		bar := symbolData.GetBar(int64(index))
+		latestIndex := len(validated.Timestamps) - 1
+		var previous model.Bar
+		if latestIndex >= 0 {
+			previous = validated.GetBar(int64(latestIndex))
+		}
+
+		if latestIndex >= 0 && !bar.Timestamp.After(previous.Timestamp) {
+			check := CheckNonMonotonic
+			if bar.Timestamp.Equal(previous.Timestamp) {
+				check = CheckDuplicate
+			}
+			policy, err := record(check, index, bar.Timestamp, fmt.Sprintf("previous bar at %s", previous.Timestamp.Format(time.RFC3339)))
+			if err != nil {
+				return model.SymbolData{}, report, err
+			}
+			if policy == PolicyDrop {
+				continue
+			}
+		}
+
+		if latestIndex >= 0 && bar.Timestamp.After(previous.Timestamp.Add(timeframe)) {
+			missing := int(bar.Timestamp.Sub(previous.Timestamp)/timeframe) - 1
+			if bar.Timestamp.Sub(previous.Timestamp)%timeframe != 0 {
+				missing++
+			}
+			policy, err := record(CheckMissing, index, bar.Timestamp, fmt.Sprintf("%v bars missing since %s", missing,
+				previous.Timestamp.Format(time.RFC3339)))
+			if err != nil {
+				return model.SymbolData{}, report, err
+			}
+			if policy == PolicyFill {
+				for timestamp := previous.Timestamp.Add(timeframe); timestamp.Before(bar.Timestamp); timestamp = timestamp.Add(timeframe) {
+					validated.AddBar(flatBar(timestamp, previous.Close))
+				}
+			}
+		}
+
+		var problems []qualityProblem
+		if detail := ohlcProblem(bar); detail != "" {
+			problems = append(problems, qualityProblem{CheckOHLC, detail})
+		}
+		if bar.Volume <= 0 {
+			problems = append(problems, qualityProblem{CheckZeroVolume, fmt.Sprintf("volume %v", bar.Volume)})
+		}
+		if latestIndex >= 0 && policies.OutlierThreshold > 0 && robustStdev > 0 && bar.Close > 0 && previous.Close > 0 {
+			logReturn := math.Log(bar.Close / previous.Close)
+			if deviations := math.Abs(logReturn-median) / robustStdev; deviations > policies.OutlierThreshold {
+				problems = append(problems, qualityProblem{CheckOutlier,
+					fmt.Sprintf("log return %.4f is %.1f robust standard deviations from the median", logReturn, deviations)})
+			}
+		}
+
+		isDropped := false
+		for _, problem := range problems {
+			policy, err := record(problem.check, index, bar.Timestamp, problem.detail)
+			if err != nil {
+				return model.SymbolData{}, report, err
+			}
+			// The first bar has no previous close to fill from
+			if policy == PolicyDrop || (policy == PolicyFill && latestIndex < 0) {
+				isDropped = true
+				break
+			}
+			if policy == PolicyFill {
+				bar = flatBar(bar.Timestamp, previous.Close)
+				break
+			}
+		}
+		if !isDropped {
+			validated.AddBar(bar)
+		}
+	}
+
+	report.OutputBars = len(validated.Timestamps)
+	return validated, report, nil
+}
+
+// logIssues logs the issues of the report with the WARN, FILL or DROP policy, up to maxLoggedIssues of each check
+func (qr QualityReport) logIssues(warn func(string)) {
+	logged := make(map[string]int)
+	for _, issue := range qr.Issues {
+		if logged[issue.Check] < maxLoggedIssues {
+			warn(fmt.Sprintf("data quality of %s: %s bar at line %v (%s) %s: %s", qr.Source, issue.Check, issue.Line,
+				issue.Timestamp.Format(time.RFC3339), strings.ToLower(issue.Policy), issue.Detail))
+		}
+		logged[issue.Check]++
+	}
+}
+
+// ohlcProblem describes why a bar's prices are inconsistent, or returns an empty string if they are consistent
+func ohlcProblem(bar model.Bar) string {
+	switch {
+	case bar.Open <= 0 || bar.High <= 0 || bar.Low <= 0 || bar.Close <= 0:
+		return fmt.Sprintf("non-positive price in open %v, high %v, low %v, close %v", bar.Open, bar.High, bar.Low, bar.Close)
+	case bar.High < bar.Low:
+		return fmt.Sprintf("high %v below low %v", bar.High, bar.Low)
+	case bar.Open > bar.High || bar.Open < bar.Low:
+		return fmt.Sprintf("open %v outside range %v-%v", bar.Open, bar.Low, bar.High)
+	case bar.Close > bar.High || bar.Close < bar.Low:
+		return fmt.Sprintf("close %v outside range %v-%v", bar.Close, bar.Low, bar.High)
+	}
+	return ""
+}
+
+// flatBar returns a bar without trades, flat at the provided price
+func flatBar(timestamp time.Time, price float64) model.Bar {
+	return model.Bar{Timestamp: timestamp, Open: price, High: price, Low: price, Close: price}
+}
+
+// returnDistribution returns the median & robust standard deviation (1.4826 * median absolute deviation) of the
+// close-to-close log returns
+func returnDistribution(closes []float64) (float64, float64) {
+	var returns []float64
+	for index := 1; index < len(closes); index++ {
+		if closes[index] > 0 && closes[index-1] > 0 {
+			returns = append(returns, math.Log(closes[index]/closes[index-1]))
+		}
+	}
+	if len(returns) == 0 {
+		return 0, 0
+	}
+	median := medianOf(returns)
+	deviations := make([]float64, len(returns))
+	for index, logReturn := range returns {
+		deviations[index] = math.Abs(logReturn - median)
+	}
+	return median, 1.4826 * medianOf(deviations)
+}
+
+// medianOf returns the median of the values, sorting them in place
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[middle-1] + values[middle]) / 2
+	}
+	return values[middle]
+}
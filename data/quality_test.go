@@ -0,0 +1,169 @@
+package data
+
+import (
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"testing"
+	"time"
+)
+
+func TestValidateSymbolData(t *testing.T) {
+	day := func(offset int) time.Time {
+		return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, offset)
+	}
+	bar := func(offset int, close float64, volume float64) model.Bar {
+		return model.Bar{Timestamp: day(offset), Open: close, High: close + 1, Low: close - 1, Close: close, Volume: volume}
+	}
+	// Returns alternate +-1% so the robust standard deviation is well defined
+	var clean []model.Bar
+	for offset := 0; offset < 20; offset++ {
+		clean = append(clean, bar(offset, 100+float64(offset%2), 10))
+	}
+	with := func(changes func(bars []model.Bar) []model.Bar) model.SymbolData {
+		bars := changes(append([]model.Bar{}, clean...))
+		symbolData := model.SymbolData{}
+		for _, bar := range bars {
+			symbolData.AddBar(bar)
+		}
+		return symbolData
+	}
+
+	testCases := []struct {
+		name           string
+		symbolData     model.SymbolData
+		policies       string
+		expectedError  bool
+		expectedBars   int
+		expectedCounts map[string]int
+		expectedCloses map[int]float64 // map[output index]close
+	}{
+		{
+			name:           "TestValidateSymbolData_clean",
+			symbolData:     with(func(bars []model.Bar) []model.Bar { return bars }),
+			expectedBars:   20,
+			expectedCounts: map[string]int{},
+		},
+		{
+			name:          "TestValidateSymbolData_duplicateFail",
+			symbolData:    with(func(bars []model.Bar) []model.Bar { return append(bars[:6], bars[5:]...) }),
+			expectedError: true,
+		},
+		{
+			name:           "TestValidateSymbolData_duplicateDrop",
+			symbolData:     with(func(bars []model.Bar) []model.Bar { return append(bars[:6], bars[5:]...) }),
+			policies:       "duplicate:DROP",
+			expectedBars:   20,
+			expectedCounts: map[string]int{CheckDuplicate: 1},
+		},
+		{
+			name: "TestValidateSymbolData_nonMonotonicDrop",
+			symbolData: with(func(bars []model.Bar) []model.Bar {
+				return append(bars[:6], append([]model.Bar{bar(2, 100, 10)}, bars[6:]...)...)
+			}),
+			policies:       "non_monotonic:DROP",
+			expectedBars:   20,
+			expectedCounts: map[string]int{CheckNonMonotonic: 1},
+		},
+		{
+			name:           "TestValidateSymbolData_missingWarn",
+			symbolData:     with(func(bars []model.Bar) []model.Bar { return append(bars[:5], bars[8:]...) }),
+			expectedBars:   17,
+			expectedCounts: map[string]int{CheckMissing: 1},
+		},
+		{
+			name:           "TestValidateSymbolData_missingFill",
+			symbolData:     with(func(bars []model.Bar) []model.Bar { return append(bars[:5], bars[8:]...) }),
+			policies:       "missing:FILL",
+			expectedBars:   20,
+			expectedCounts: map[string]int{CheckMissing: 1},
+			expectedCloses: map[int]float64{5: 100, 6: 100, 7: 100, 8: 100},
+		},
+		{
+			name: "TestValidateSymbolData_ohlcFill",
+			symbolData: with(func(bars []model.Bar) []model.Bar {
+				bars[10].High = bars[10].Low - 1
+				return bars
+			}),
+			policies:       "ohlc:FILL",
+			expectedBars:   20,
+			expectedCounts: map[string]int{CheckOHLC: 1},
+			expectedCloses: map[int]float64{10: 101},
+		},
+		{
+			name: "TestValidateSymbolData_zeroVolumeDrop",
+			symbolData: with(func(bars []model.Bar) []model.Bar {
+				bars[3].Volume = 0
+				return bars
+			}),
+			policies:     "zero_volume:DROP",
+			expectedBars: 19,
+			// Dropping the bar leaves it missing
+			expectedCounts: map[string]int{CheckZeroVolume: 1, CheckMissing: 1},
+		},
+		{
+			name: "TestValidateSymbolData_outlierDrop",
+			symbolData: with(func(bars []model.Bar) []model.Bar {
+				bars[12] = bar(12, 1000, 10)
+				return bars
+			}),
+			policies:       "outlier:DROP",
+			expectedBars:   19,
+			expectedCounts: map[string]int{CheckOutlier: 1, CheckMissing: 1},
+			expectedCloses: map[int]float64{12: 101},
+		},
+		{
+			name: "TestValidateSymbolData_outlierWarn",
+			symbolData: with(func(bars []model.Bar) []model.Bar {
+				bars[12] = bar(12, 1000, 10)
+				return bars
+			}),
+			expectedBars: 20,
+			// Both the spike & the return from it are outliers when the spike is kept
+			expectedCounts: map[string]int{CheckOutlier: 2},
+		},
+		{
+			name:          "TestValidateSymbolData_unsupportedPolicy",
+			symbolData:    with(func(bars []model.Bar) []model.Bar { return bars }),
+			policies:      "missing:DROP",
+			expectedError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			policies, err := NewQualityPolicies(testCase.policies, 10)
+			var validated model.SymbolData
+			var report QualityReport
+			if err == nil {
+				validated, report, err = ValidateSymbolData(testCase.symbolData, 24*time.Hour, policies, "test")
+			}
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if testCase.expectedError {
+				return
+			}
+
+			if len(validated.Timestamps) != testCase.expectedBars || report.OutputBars != testCase.expectedBars {
+				t.Errorf("expected %v bars, got %v", testCase.expectedBars, len(validated.Timestamps))
+			}
+			if len(report.Counts) != len(testCase.expectedCounts) {
+				t.Errorf("expected counts %v, got %v", testCase.expectedCounts, report.Counts)
+			}
+			for check, count := range testCase.expectedCounts {
+				if report.Counts[check] != count {
+					t.Errorf("expected %v %s issues, got %v", count, check, report.Counts[check])
+				}
+			}
+			for index, close := range testCase.expectedCloses {
+				if validated.Closes[index] != close {
+					t.Errorf("expected close %v at index %v, got %v", close, index, validated.Closes[index])
+				}
+			}
+			for index := 1; index < len(validated.Timestamps); index++ {
+				if !validated.Timestamps[index].After(validated.Timestamps[index-1]) && report.Counts[CheckDuplicate] == 0 {
+					t.Errorf("expected ascending timestamps at index %v", index)
+				}
+			}
+		})
+	}
+}
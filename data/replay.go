@@ -0,0 +1,295 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replayTick is the interval kline streams check the replay clock for newly released bars
+const replayTick = 50 * time.Millisecond
+
+// ReplayServer is a local stand-in for a live bar feed, replaying the historic data files at an accelerated speed. The
+// replay clock of every series starts at its first bar when the server starts & advances Speed times faster than real
+// time, releasing each bar once the clock reaches its timestamp. Bars are served from "/bars" for the POLL feed, and
+// from a Binance-style kline WebSocket stream & REST klines endpoint for the KLINE_STREAM feed.
+type ReplayServer struct {
+	log     *zap.Logger
+	speed   float64
+	start   time.Time
+	now     func() time.Time
+	mutex   sync.Mutex
+	series  map[string][]model.Bar // map[symbol_timeframe]Bars loaded from the historic data files
+	loadCSV func(symbol string, timeframe string) ([]model.Bar, error)
+}
+
+// ServeHTTP routes requests to the bar feed, REST klines & kline stream endpoints
+func (rs *ReplayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method != http.MethodGet:
+		http.NotFound(w, r)
+	case r.URL.Path == "/bars":
+		rs.serveBars(w, r)
+	case r.URL.Path == "/api/v3/klines":
+		rs.serveKlines(w, r)
+	case strings.HasPrefix(r.URL.Path, "/ws/"):
+		rs.serveKlineStream(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveBars responds to "GET /bars?symbol=&timeframe=&after=" with the released bars after the provided RFC3339
+// timestamp & whether every bar of the series has been released
+func (rs *ReplayServer) serveBars(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	bars, err := rs.getSeries(query.Get("symbol"), query.Get("timeframe"))
+	if err != nil {
+		rs.log.Warn(fmt.Sprintf("failed to load replay series: %s", err))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var after time.Time
+	if value := query.Get("after"); value != "" {
+		if after, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse after timestamp %s", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response := feedResponse{Bars: []model.Bar{}}
+	released := rs.released(bars)
+	for _, bar := range bars[:released] {
+		if bar.Timestamp.After(after) {
+			response.Bars = append(response.Bars, bar)
+		}
+	}
+	response.Finished = released == len(bars)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		rs.log.Warn(fmt.Sprintf("failed to write replay response: %s", err))
+	}
+}
+
+// serveKlines responds to "GET /api/v3/klines?symbol=&interval=&startTime=&endTime=&limit=" with the released bars
+// opened within the provided Unix millisecond range in the Binance REST kline format
+func (rs *ReplayServer) serveKlines(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	bars, timeframe, err := rs.resolveSeries(query.Get("symbol"), query.Get("interval"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	startTime, endTime, limit := int64(0), int64(math.MaxInt64), klinesLimit
+	for name, value := range map[string]*int64{"startTime": &startTime, "endTime": &endTime} {
+		if raw := query.Get(name); raw != "" {
+			if *value, err = strconv.ParseInt(raw, 10, 64); err != nil {
+				http.Error(w, fmt.Sprintf("failed to parse %s %s", name, raw), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if raw := query.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 || limit > klinesLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 & %v", klinesLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows := [][]interface{}{}
+	for _, bar := range bars[:rs.released(bars)] {
+		openTime := toMilliseconds(bar.Timestamp)
+		if openTime < startTime || openTime > endTime || len(rows) == limit {
+			continue
+		}
+		rows = append(rows, []interface{}{openTime, formatFloat(bar.Open), formatFloat(bar.High), formatFloat(bar.Low),
+			formatFloat(bar.Close), formatFloat(bar.Volume), openTime + timeframe.Milliseconds() - 1})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rows); err != nil {
+		rs.log.Warn(fmt.Sprintf("failed to write klines response: %s", err))
+	}
+}
+
+// serveKlineStream upgrades "/ws/<symbol>@kline_<interval>" to a WebSocket & sends a closed kline event for every bar
+// released whilst connected - like an exchange stream, bars released before connecting are not sent
+func (rs *ReplayServer) serveKlineStream(w http.ResponseWriter, r *http.Request) {
+	stream := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/ws/"), "@kline_", 2)
+	if len(stream) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	bars, timeframe, err := rs.resolveSeries(stream[0], stream[1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	conn, err := acceptWebsocket(w, r)
+	if err != nil {
+		rs.log.Warn(fmt.Sprintf("failed to accept kline stream: %s", err))
+		return
+	}
+	defer conn.Close()
+
+	// Read until the client disconnects, answering pings & close frames
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+		for {
+			if _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	sent := rs.released(bars)
+	ticker := time.NewTicker(replayTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-disconnected:
+			return
+		case <-ticker.C:
+		}
+
+		for released := rs.released(bars); sent < released; sent++ {
+			bar := bars[sent]
+			event := map[string]interface{}{
+				"e": "kline",
+				"E": toMilliseconds(rs.now()),
+				"s": strings.ToUpper(stream[0]),
+				"k": map[string]interface{}{
+					"t": toMilliseconds(bar.Timestamp),
+					"T": toMilliseconds(bar.Timestamp) + timeframe.Milliseconds() - 1,
+					"i": stream[1],
+					"o": formatFloat(bar.Open),
+					"h": formatFloat(bar.High),
+					"l": formatFloat(bar.Low),
+					"c": formatFloat(bar.Close),
+					"v": formatFloat(bar.Volume),
+					"x": true,
+				},
+			}
+			message, err := json.Marshal(event)
+			if err != nil {
+				rs.log.Warn(fmt.Sprintf("failed to encode kline event: %s", err))
+				return
+			}
+			if err := conn.WriteMessage(message); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// resolveSeries returns the bars & timeframe of the series whose Binance symbol & interval match, searching the
+// loaded series & the historic data files named "symbol_timeframe.csv"
+func (rs *ReplayServer) resolveSeries(binanceSymbol string, interval string) ([]model.Bar, time.Duration, error) {
+	names, err := filepath.Glob(fmt.Sprintf("%s*.csv", dataDirectory))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to list historic data files")
+	}
+	rs.mutex.Lock()
+	for key := range rs.series {
+		names = append(names, key)
+	}
+	rs.mutex.Unlock()
+
+	for _, name := range names {
+		name = strings.TrimSuffix(filepath.Base(name), ".csv")
+		separator := strings.LastIndex(name, "_")
+		if separator < 0 {
+			continue
+		}
+		symbol, timeframe := name[:separator], name[separator+1:]
+		duration, err := ParseTimeframe(timeframe)
+		if err != nil || BinanceSymbol(symbol) != strings.ToUpper(binanceSymbol) || binanceInterval(timeframe) != interval {
+			continue
+		}
+		bars, err := rs.getSeries(symbol, timeframe)
+		return bars, duration, err
+	}
+	return nil, 0, errors.New(fmt.Sprintf("no historic data for %s %s", binanceSymbol, interval))
+}
+
+// released returns the number of the series' bars the replay clock has reached
+func (rs *ReplayServer) released(bars []model.Bar) int {
+	if len(bars) == 0 {
+		return 0
+	}
+	elapsed := time.Duration(float64(rs.now().Sub(rs.start)) * rs.speed)
+	clock := bars[0].Timestamp.Add(elapsed)
+
+	released := 0
+	for released < len(bars) && !bars[released].Timestamp.After(clock) {
+		released++
+	}
+	return released
+}
+
+// getSeries returns the bars of a symbol & timeframe, loading them from the historic data file on first request
+func (rs *ReplayServer) getSeries(symbol string, timeframe string) ([]model.Bar, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	key := fmt.Sprintf("%s_%s", symbol, timeframe)
+	if bars, isLoaded := rs.series[key]; isLoaded {
+		return bars, nil
+	}
+	bars, err := rs.loadCSV(symbol, timeframe)
+	if err != nil {
+		return nil, err
+	}
+	rs.series[key] = bars
+	return bars, nil
+}
+
+// formatFloat formats a float as a decimal string without an exponent
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// csvBarLoader returns a loader of the bars of a symbol's historic data file, mapping its columns with the schema
+func csvBarLoader(schema CSVSchema) func(symbol string, timeframe string) ([]model.Bar, error) {
+	return func(symbol string, timeframe string) ([]model.Bar, error) {
+		symbolData, err := loadCSVSymbolData(buildCSVFilePath(config.Trader{Symbol: symbol, Timeframe: timeframe}), schema)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to load CSV data for %s_%s", symbol, timeframe))
+		}
+		bars := make([]model.Bar, len(symbolData.Timestamps))
+		for index := range bars {
+			bars[index] = symbolData.GetBar(int64(index))
+		}
+		return bars, nil
+	}
+}
+
+// NewReplayServer constructs a ReplayServer replaying the historic data files, read with the provided schema, at the
+// provided multiple of real time, eg/ a speed of 86400 replays a day of bars every second
+func NewReplayServer(log *zap.Logger, speed float64, schema CSVSchema) (*ReplayServer, error) {
+	if speed <= 0 {
+		return &ReplayServer{}, errors.New(fmt.Sprintf("replay speed %v must be positive", speed))
+	}
+	return &ReplayServer{
+		log:     log,
+		speed:   speed,
+		start:   time.Now(),
+		now:     time.Now,
+		series:  make(map[string][]model.Bar),
+		loadCSV: csvBarLoader(schema),
+	}, nil
+}
@@ -0,0 +1,170 @@
+package data
+
+import (
+	"fmt"
+	"github.com/eapache/queue"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"math"
+	"sort"
+	"time"
+)
+
+// weekAnchor is the Monday that weekly buckets are aligned to, as the Unix epoch is a Thursday
+var weekAnchor = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+// MultiTimeframe is a Handler that also serves its bars aggregated into other timeframes, eg/ to confirm daily signals
+// with intraday structure
+type MultiTimeframe interface {
+	Handler
+	// GetLatestTimeframeData returns a tuple of (bars of the timeframe closed by the end of the latest bar, latest bar
+	// index) - a bar of a higher timeframe only becomes visible once it has closed
+	GetLatestTimeframeData(timeframe string) (*model.SymbolData, int64, error)
+}
+
+// BucketStart returns the start of the timeframe bucket containing the timestamp. Buckets are aligned to the Unix
+// epoch, except weekly buckets which start on Mondays, all in UTC.
+func BucketStart(timestamp time.Time, timeframe time.Duration) time.Time {
+	anchor := time.Unix(0, 0).UTC()
+	if timeframe%(7*24*time.Hour) == 0 {
+		anchor = weekAnchor
+	}
+	elapsed := timestamp.Sub(anchor)
+	buckets := elapsed / timeframe
+	if elapsed%timeframe < 0 {
+		buckets--
+	}
+	return anchor.Add(buckets * timeframe)
+}
+
+// Resample aggregates bars of the base timeframe into complete bars of a timeframe that is a multiple of it - Open is
+// the first Open, High the highest High, Low the lowest Low, Close the last Close & Volume the total Volume of the base
+// bars in each bucket. Buckets missing any of their base bars are dropped as their bars would be partial, including a
+// leading bucket the data starts part way through, a trailing bucket the data ends before closing & buckets with gaps.
+func Resample(base model.SymbolData, baseTimeframe time.Duration, timeframe time.Duration) (model.SymbolData, error) {
+	if timeframe%baseTimeframe != 0 {
+		return model.SymbolData{}, errors.New(fmt.Sprintf("timeframe %s is not a multiple of the base timeframe %s", timeframe, baseTimeframe))
+	}
+	resampled := model.SymbolData{Indicators: make(map[string][]interface{})}
+	barsPerBucket := int(timeframe / baseTimeframe)
+
+	var bucket model.Bar
+	var numBars int
+	for index := range base.Timestamps {
+		bar := base.GetBar(int64(index))
+		start := BucketStart(bar.Timestamp, timeframe)
+		if numBars > 0 && start.Equal(bucket.Timestamp) {
+			bucket.High = math.Max(bucket.High, bar.High)
+			bucket.Low = math.Min(bucket.Low, bar.Low)
+			bucket.Close = bar.Close
+			bucket.Volume += bar.Volume
+			numBars++
+			continue
+		}
+		if numBars == barsPerBucket {
+			resampled.AddBar(bucket)
+		}
+		bucket = model.Bar{Timestamp: start, Open: bar.Open, High: bar.High, Low: bar.Low, Close: bar.Close, Volume: bar.Volume}
+		numBars = 1
+	}
+	if numBars == barsPerBucket {
+		resampled.AddBar(bucket)
+	}
+	return resampled, nil
+}
+
+// timeframeSeries is the bars of a single timeframe, revealed as the latest bar of the trading timeframe closes
+type timeframeSeries struct {
+	allSymbolData     model.SymbolData // Every complete bar of the timeframe
+	currentSymbolData model.SymbolData // Bars closed by the end of the latest bar of the trading timeframe
+	latestBarIndex    int64
+}
+
+// resampledHandler is a Handler for backtesting that loads bars of a base timeframe & aggregates them into the trading
+// timeframe & any other timeframe a strategy requests
+type resampledHandler struct {
+	*historicHandler
+	baseTimeframe  time.Duration
+	timeframe      time.Duration
+	baseSymbolData model.SymbolData
+	series         map[time.Duration]*timeframeSeries
+}
+
+// GetLatestTimeframeData returns a tuple of (bars of the timeframe closed by the end of the latest bar, latest bar
+// index), the timeframe must be a multiple of BASE_TIMEFRAME
+func (rh *resampledHandler) GetLatestTimeframeData(timeframe string) (*model.SymbolData, int64, error) {
+	duration, err := ParseTimeframe(timeframe)
+	if err != nil {
+		return nil, -1, err
+	}
+	series, isCached := rh.series[duration]
+	if !isCached {
+		allSymbolData, err := Resample(rh.baseSymbolData, rh.baseTimeframe, duration)
+		if err != nil {
+			return nil, -1, err
+		}
+		series = &timeframeSeries{
+			allSymbolData:     allSymbolData,
+			currentSymbolData: model.SymbolData{Indicators: make(map[string][]interface{})},
+			latestBarIndex:    -1,
+		}
+		rh.series[duration] = series
+	}
+
+	// Reveal the bars closed by the end of the latest bar of the trading timeframe
+	if rh.latestBarIndex >= 0 {
+		clock := rh.allSymbolData.Timestamps[rh.latestBarIndex].Add(rh.timeframe)
+		closed := sort.Search(len(series.allSymbolData.Timestamps), func(i int) bool {
+			return series.allSymbolData.Timestamps[i].Add(duration).After(clock)
+		})
+		for series.latestBarIndex < int64(closed)-1 {
+			series.latestBarIndex++
+			series.currentSymbolData.AddBar(series.allSymbolData.GetBar(series.latestBarIndex))
+		}
+	}
+	return &series.currentSymbolData, series.latestBarIndex, nil
+}
+
+// NewResampledHandler returns a Handler for backtesting that aggregates the bars of the trader's BASE_TIMEFRAME, loaded
+// from its historic data file or synthesised, into the trader's timeframe
+func NewResampledHandler(cfg config.Trader, eventQ *queue.Queue) (*resampledHandler, error) {
+	baseTimeframe, err := ParseTimeframe(cfg.BaseTimeframe)
+	if err != nil {
+		return &resampledHandler{}, errors.Wrap(err, "invalid base timeframe")
+	}
+	timeframe, err := ParseTimeframe(cfg.Timeframe)
+	if err != nil {
+		return &resampledHandler{}, err
+	}
+
+	baseCfg := cfg
+	baseCfg.Timeframe = cfg.BaseTimeframe
+	baseHandler, err := newSourceHandler(baseCfg, eventQ)
+	if err != nil {
+		return &resampledHandler{}, err
+	}
+
+	allSymbolData, err := Resample(baseHandler.allSymbolData, baseTimeframe, timeframe)
+	if err != nil {
+		return &resampledHandler{}, err
+	}
+	cfg.Log.Debug(fmt.Sprintf("resampled %v %s bars of %s into %v %s bars", len(baseHandler.allSymbolData.Timestamps),
+		cfg.BaseTimeframe, cfg.Symbol, len(allSymbolData.Timestamps), cfg.Timeframe))
+
+	return &resampledHandler{
+		historicHandler: &historicHandler{
+			log:               cfg.Log,
+			eventQ:            eventQ,
+			symbol:            cfg.Symbol,
+			allSymbolData:     allSymbolData,
+			currentSymbolData: model.SymbolData{},
+			latestBarIndex:    -1,
+			qualityReport:     baseHandler.qualityReport,
+		},
+		baseTimeframe:  baseTimeframe,
+		timeframe:      timeframe,
+		baseSymbolData: baseHandler.allSymbolData,
+		series:         make(map[time.Duration]*timeframeSeries),
+	}, nil
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"github.com/eapache/queue"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestResample(t *testing.T) {
+	// Hourly bars from 02:00 on the 1st to 05:00 on the 3rd, the last bar closing at 06:00
+	start := time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name            string
+		timeframe       time.Duration
+		missingHours    map[int]bool // Hours after the start with no base bar
+		expectedBars    []model.Bar
+		expectedError   bool
+		expectedNumBars int
+	}{
+		{
+			name:      "TestResample_4H",
+			timeframe: 4 * time.Hour,
+			// The leading 00:00-04:00 bucket is partial, 04:00 on the 3rd closes exactly as the data ends
+			expectedNumBars: 12,
+			expectedBars: []model.Bar{
+				{Timestamp: time.Date(2021, 1, 1, 4, 0, 0, 0, time.UTC), Open: 102, High: 107, Low: 101, Close: 106, Volume: 40},
+			},
+		},
+		{
+			name:            "TestResample_1D",
+			timeframe:       24 * time.Hour,
+			expectedNumBars: 1,
+			expectedBars: []model.Bar{
+				{Timestamp: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), Open: 122, High: 147, Low: 121, Close: 146, Volume: 240},
+			},
+		},
+		{
+			name:      "TestResample_4HInternalGap",
+			timeframe: 4 * time.Hour,
+			// The 12:00-16:00 bucket on the 1st is missing its 12:00 bar
+			missingHours:    map[int]bool{10: true},
+			expectedNumBars: 11,
+			expectedBars: []model.Bar{
+				{Timestamp: time.Date(2021, 1, 1, 4, 0, 0, 0, time.UTC), Open: 102, High: 107, Low: 101, Close: 106, Volume: 40},
+				{Timestamp: time.Date(2021, 1, 1, 8, 0, 0, 0, time.UTC), Open: 106, High: 111, Low: 105, Close: 110, Volume: 40},
+				{Timestamp: time.Date(2021, 1, 1, 16, 0, 0, 0, time.UTC), Open: 114, High: 119, Low: 113, Close: 118, Volume: 40},
+			},
+		},
+		{
+			name:          "TestResample_notMultiple",
+			timeframe:     90 * time.Minute,
+			expectedError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			base := model.SymbolData{}
+			for hour := 0; hour < 52; hour++ {
+				if testCase.missingHours[hour] {
+					continue
+				}
+				price := float64(100 + hour)
+				base.AddBar(model.Bar{Timestamp: start.Add(time.Duration(hour) * time.Hour), Open: price, High: price + 2,
+					Low: price - 1, Close: price + 1, Volume: 10})
+			}
+
+			resampled, err := Resample(base, time.Hour, testCase.timeframe)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if testCase.expectedError {
+				return
+			}
+			if len(resampled.Timestamps) != testCase.expectedNumBars {
+				t.Fatalf("expected %v bars, got %v", testCase.expectedNumBars, len(resampled.Timestamps))
+			}
+			for index, expected := range testCase.expectedBars {
+				if actual := resampled.GetBar(int64(index)); actual != expected {
+					t.Errorf("expected bar %v to be %+v, got %+v", index, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketStart_weekly(t *testing.T) {
+	// Wednesday 2021-01-06 is in the week starting Monday 2021-01-04
+	start := BucketStart(time.Date(2021, 1, 6, 15, 0, 0, 0, time.UTC), 7*24*time.Hour)
+	if expected := time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC); !start.Equal(expected) {
+		t.Errorf("expected week to start %s, got %s", expected, start)
+	}
+}
+
+func TestResampledHandler_GetLatestTimeframeData(t *testing.T) {
+	cfg := config.Trader{
+		Log:             zap.NewNop(),
+		Symbol:          "SYN-USD",
+		Timeframe:       "4H",
+		BaseTimeframe:   "1H",
+		DataSource:      DataSourceSynthetic,
+		SynthModel:      "gbm:0:0.8",
+		SynthBars:       72,
+		SynthStart:      time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		SynthStartPrice: 100,
+	}
+	handler, err := NewResampledHandler(cfg, queue.New())
+	if err != nil {
+		t.Fatalf("failed to init resampled handler: %s", err)
+	}
+
+	testCases := []struct {
+		name               string
+		updates            int
+		expectedDailyBars  int64
+		expectedHourlyBars int64
+	}{
+		{name: "TestResampledHandler_GetLatestTimeframeData_beforeFirstBar", updates: 0, expectedDailyBars: 0, expectedHourlyBars: 0},
+		{name: "TestResampledHandler_GetLatestTimeframeData_dayOpen", updates: 1, expectedDailyBars: 0, expectedHourlyBars: 4},
+		{name: "TestResampledHandler_GetLatestTimeframeData_dayNotClosed", updates: 4, expectedDailyBars: 0, expectedHourlyBars: 20},
+		{name: "TestResampledHandler_GetLatestTimeframeData_dayClosed", updates: 1, expectedDailyBars: 1, expectedHourlyBars: 24},
+		{name: "TestResampledHandler_GetLatestTimeframeData_nextDay", updates: 7, expectedDailyBars: 2, expectedHourlyBars: 52},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			for update := 0; update < testCase.updates; update++ {
+				handler.UpdateData()
+			}
+			daily, dailyIndex, err := handler.GetLatestTimeframeData("1D")
+			if err != nil {
+				t.Fatalf("failed to get daily data: %s", err)
+			}
+			hourly, hourlyIndex, _ := handler.GetLatestTimeframeData("1H")
+			if dailyIndex+1 != testCase.expectedDailyBars || int64(len(daily.Timestamps)) != testCase.expectedDailyBars {
+				t.Errorf("expected %v daily bars, got %v", testCase.expectedDailyBars, dailyIndex+1)
+			}
+			if hourlyIndex+1 != testCase.expectedHourlyBars || int64(len(hourly.Timestamps)) != testCase.expectedHourlyBars {
+				t.Errorf("expected %v hourly bars, got %v", testCase.expectedHourlyBars, hourlyIndex+1)
+			}
+
+			// The latest daily bar rolls up the hourly bars it spans
+			if dailyIndex >= 0 {
+				latestDay := daily.GetBar(dailyIndex)
+				firstHour := hourly.GetBar(dailyIndex * 24)
+				lastHour := hourly.GetBar(dailyIndex*24 + 23)
+				if latestDay.Open != firstHour.Open || latestDay.Close != lastHour.Close {
+					t.Errorf("expected day to open %v & close %v, got %+v", firstHour.Open, lastHour.Close, latestDay)
+				}
+			}
+		})
+	}
+}
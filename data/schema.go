@@ -0,0 +1,247 @@
+package data
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CloseAdjusted = "ADJUSTED" // Close is read from the adjusted close column, eg/ Yahoo's "Adj Close", if present
+	CloseRaw      = "RAW"      // Close is read from the raw close column
+)
+
+const (
+	TimeFormatAuto   = "AUTO"    // Detect ISO dates, datetimes, RFC3339 timestamps & Unix seconds or milliseconds
+	TimeFormatISO    = "ISO"     // "2006-01-02"
+	TimeFormatRFC    = "RFC3339" // "2006-01-02T15:04:05Z07:00"
+	TimeFormatUnix   = "UNIX"    // Unix seconds
+	TimeFormatUnixMs = "UNIX_MS" // Unix milliseconds
+)
+
+// unixMillisecondsThreshold separates Unix seconds from milliseconds when detecting the time format - as seconds it is
+// the year 5138, as milliseconds 1973
+const unixMillisecondsThreshold = 1e11
+
+// autoTimeLayouts are the layouts tried in order by TimeFormatAuto
+var autoTimeLayouts = []string{
+	timestampLayoutIso,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+}
+
+// CSVSchema maps the header of a historic data file to the fields of a Bar. Each field lists the header names it is
+// read from, matched case-insensitively, so one schema covers files whose headers differ by source.
+type CSVSchema struct {
+	Timestamp  []string
+	Open       []string
+	High       []string
+	Low        []string
+	Close      []string
+	AdjClose   []string
+	Volume     []string
+	ClosePrice string         // CloseAdjusted or CloseRaw
+	TimeFormat string         // TimeFormatAuto, TimeFormatISO, TimeFormatRFC, TimeFormatUnix, TimeFormatUnixMs or a Go layout
+	Location   *time.Location // Timezone of timestamps without an offset
+}
+
+// csvColumns is the position of each Bar field in a historic data file
+type csvColumns struct {
+	timestamp int
+	open      int
+	high      int
+	low       int
+	close     int
+	volume    int
+}
+
+// DefaultCSVSchema returns the schema of Yahoo-format files "Date,Open,High,Low,Close,Adj Close,Volume" & common
+// exchange exports, reading the adjusted close or the raw close of files without an adjusted close column
+func DefaultCSVSchema() CSVSchema {
+	return CSVSchema{
+		Timestamp:  []string{"Date", "Datetime", "Timestamp", "Time", "Open Time"},
+		Open:       []string{"Open"},
+		High:       []string{"High"},
+		Low:        []string{"Low"},
+		Close:      []string{"Close"},
+		AdjClose:   []string{"Adj Close", "Adjusted Close"},
+		Volume:     []string{"Volume"},
+		ClosePrice: CloseAdjusted,
+		TimeFormat: TimeFormatAuto,
+		Location:   time.UTC,
+	}
+}
+
+// NewCSVSchema constructs a CSVSchema overriding the DefaultCSVSchema with a specification in the format
+// "timestamp:open_time,volume:vol,close_price:RAW,time_format:UNIX_MS,timezone:America/New_York", where the column keys
+// are timestamp, open, high, low, close, adj_close & volume
+func NewCSVSchema(specification string) (CSVSchema, error) {
+	schema := DefaultCSVSchema()
+	if strings.TrimSpace(specification) == "" {
+		return schema, nil
+	}
+
+	columns := map[string]*[]string{
+		"timestamp": &schema.Timestamp,
+		"open":      &schema.Open,
+		"high":      &schema.High,
+		"low":       &schema.Low,
+		"close":     &schema.Close,
+		"adj_close": &schema.AdjClose,
+		"volume":    &schema.Volume,
+	}
+	for _, field := range strings.Split(specification, ",") {
+		// Split on the first colon only, as time layouts contain colons
+		keyValue := strings.SplitN(strings.TrimSpace(field), ":", 2)
+		if len(keyValue) != 2 || strings.TrimSpace(keyValue[1]) == "" {
+			return CSVSchema{}, errors.New(fmt.Sprintf("failed to parse CSV schema field %s", field))
+		}
+		key, value := strings.ToLower(strings.TrimSpace(keyValue[0])), strings.TrimSpace(keyValue[1])
+
+		if column, isColumn := columns[key]; isColumn {
+			*column = []string{value}
+			continue
+		}
+		switch key {
+		case "close_price":
+			value = strings.ToUpper(value)
+			if value != CloseAdjusted && value != CloseRaw {
+				return CSVSchema{}, errors.New(fmt.Sprintf("close price %s must be %s or %s", value, CloseAdjusted, CloseRaw))
+			}
+			schema.ClosePrice = value
+		case "time_format":
+			schema.TimeFormat = value
+		case "timezone":
+			location, err := time.LoadLocation(value)
+			if err != nil {
+				return CSVSchema{}, errors.Wrap(err, fmt.Sprintf("failed to load timezone %s", value))
+			}
+			schema.Location = location
+		default:
+			return CSVSchema{}, errors.New(fmt.Sprintf("unsupported CSV schema field %s", key))
+		}
+	}
+	return schema, nil
+}
+
+// CSVSchemaForExchange returns the schema of an exchange's historic data files from specifications in the format
+// "exchange=schema;exchange=schema", or the DefaultCSVSchema if the exchange has none
+func CSVSchemaForExchange(specifications string, exchange string) (CSVSchema, error) {
+	for _, specification := range strings.Split(specifications, ";") {
+		if strings.TrimSpace(specification) == "" {
+			continue
+		}
+		exchangeSchema := strings.SplitN(specification, "=", 2)
+		if len(exchangeSchema) != 2 {
+			return CSVSchema{}, errors.New(fmt.Sprintf("failed to parse CSV schema %s", specification))
+		}
+		if strings.TrimSpace(exchangeSchema[0]) == exchange {
+			schema, err := NewCSVSchema(exchangeSchema[1])
+			if err != nil {
+				return CSVSchema{}, errors.Wrap(err, fmt.Sprintf("invalid CSV schema of %s", exchange))
+			}
+			return schema, nil
+		}
+	}
+	return DefaultCSVSchema(), nil
+}
+
+// resolveColumns returns the position of each Bar field in the provided header
+func (cs CSVSchema) resolveColumns(header []string) (csvColumns, error) {
+	positions := make(map[string]int)
+	for index, name := range header {
+		// Strip the byte order mark some exports begin with
+		name = strings.TrimPrefix(name, "\uFEFF")
+		positions[strings.ToLower(strings.TrimSpace(name))] = index
+	}
+	find := func(field string, names []string) (int, error) {
+		for _, name := range names {
+			if position, isFound := positions[strings.ToLower(name)]; isFound {
+				return position, nil
+			}
+		}
+		return 0, errors.New(fmt.Sprintf("no %s column found in header, expected one of %v", field, names))
+	}
+
+	// Exchange exports have no adjusted close, so the raw close stands in for it
+	closeField, closeNames := "adjusted close", cs.AdjClose
+	if _, err := find(closeField, closeNames); err != nil || cs.ClosePrice == CloseRaw {
+		closeField, closeNames = "close", cs.Close
+	}
+
+	var columns csvColumns
+	for _, field := range []struct {
+		name     string
+		names    []string
+		position *int
+	}{
+		{"timestamp", cs.Timestamp, &columns.timestamp},
+		{"open", cs.Open, &columns.open},
+		{"high", cs.High, &columns.high},
+		{"low", cs.Low, &columns.low},
+		{closeField, closeNames, &columns.close},
+		{"volume", cs.Volume, &columns.volume},
+	} {
+		position, err := find(field.name, field.names)
+		if err != nil {
+			return csvColumns{}, err
+		}
+		*field.position = position
+	}
+	return columns, nil
+}
+
+// parseTimestamp parses a timestamp in the schema's time format, returning it in UTC
+func (cs CSVSchema) parseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	location := cs.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	switch cs.TimeFormat {
+	case TimeFormatAuto, "":
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			if number >= unixMillisecondsThreshold {
+				return fromUnix(number / 1000), nil
+			}
+			return fromUnix(number), nil
+		}
+		for _, layout := range autoTimeLayouts {
+			if timestamp, err := time.ParseInLocation(layout, value, location); err == nil {
+				return timestamp.UTC(), nil
+			}
+		}
+		return time.Time{}, errors.New(fmt.Sprintf("failed to detect the time format of %s", value))
+	case TimeFormatUnix, TimeFormatUnixMs:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, fmt.Sprintf("failed to parse Unix timestamp %s", value))
+		}
+		if cs.TimeFormat == TimeFormatUnixMs {
+			number /= 1000
+		}
+		return fromUnix(number), nil
+	}
+
+	layout := map[string]string{TimeFormatISO: timestampLayoutIso, TimeFormatRFC: time.RFC3339Nano}[cs.TimeFormat]
+	if layout == "" {
+		layout = cs.TimeFormat
+	}
+	timestamp, err := time.ParseInLocation(layout, value, location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return timestamp.UTC(), nil
+}
+
+// fromUnix returns the UTC timestamp of fractional Unix seconds, rounded to the millisecond
+func fromUnix(seconds float64) time.Time {
+	return fromMilliseconds(int64(math.Round(seconds * 1000)))
+}
@@ -0,0 +1,142 @@
+package data
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadCSVSymbolData_schema(t *testing.T) {
+	testCases := []struct {
+		name              string
+		contents          string
+		schema            string
+		expectedTimestamp time.Time
+		expectedClose     float64
+		expectedVolume    float64
+		expectedError     bool
+	}{
+		{
+			name:              "TestLoadCSVSymbolData_schema_yahoo",
+			contents:          "Date,Open,High,Low,Close,Adj Close,Volume\n2021-01-02,1,2,0.5,1.5,1.4,100\n",
+			expectedTimestamp: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+			expectedClose:     1.4,
+			expectedVolume:    100,
+		},
+		{
+			name:              "TestLoadCSVSymbolData_schema_rawClose",
+			contents:          "Date,Open,High,Low,Close,Adj Close,Volume\n2021-01-02,1,2,0.5,1.5,1.4,100\n",
+			schema:            "close_price:RAW",
+			expectedTimestamp: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+			expectedClose:     1.5,
+			expectedVolume:    100,
+		},
+		{
+			name:              "TestLoadCSVSymbolData_schema_missingAdjCloseFallsBackToClose",
+			contents:          "timestamp,open,high,low,close,volume\n2021-01-02,1,2,0.5,1.5,100\n",
+			expectedTimestamp: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+			expectedClose:     1.5,
+			expectedVolume:    100,
+		},
+		{
+			name:          "TestLoadCSVSymbolData_schema_missingClose",
+			contents:      "timestamp,open,high,low,volume\n2021-01-02,1,2,0.5,100\n",
+			expectedError: true,
+		},
+		{
+			name:              "TestLoadCSVSymbolData_schema_unixMillisecondsFloatVolume",
+			contents:          "open_time,open,high,low,close,vol\n1609545600000,1,2,0.5,1.5,12.75\n",
+			schema:            "timestamp:open_time,volume:vol,close_price:RAW",
+			expectedTimestamp: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+			expectedClose:     1.5,
+			expectedVolume:    12.75,
+		},
+		{
+			name:              "TestLoadCSVSymbolData_schema_unixSeconds",
+			contents:          "time,close,high,low,open,volume\n1609545600,1.5,2,0.5,1,100\n",
+			schema:            "close_price:RAW,time_format:UNIX",
+			expectedTimestamp: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+			expectedClose:     1.5,
+			expectedVolume:    100,
+		},
+		{
+			name:              "TestLoadCSVSymbolData_schema_intradayTimezone",
+			contents:          "Datetime,Open,High,Low,Close,Volume\n2021-01-02 09:30:00,1,2,0.5,1.5,100\n",
+			schema:            "close_price:RAW,timezone:America/New_York",
+			expectedTimestamp: time.Date(2021, 1, 2, 14, 30, 0, 0, time.UTC),
+			expectedClose:     1.5,
+			expectedVolume:    100,
+		},
+		{
+			name:              "TestLoadCSVSymbolData_schema_layout",
+			contents:          "Date,Open,High,Low,Close,Volume\n02/01/2021 13:00,1,2,0.5,1.5,100\n",
+			schema:            "close_price:RAW,time_format:02/01/2006 15:04",
+			expectedTimestamp: time.Date(2021, 1, 2, 13, 0, 0, 0, time.UTC),
+			expectedClose:     1.5,
+			expectedVolume:    100,
+		},
+		{
+			name:              "TestLoadCSVSymbolData_schema_rfc3339Offset",
+			contents:          "Date,Open,High,Low,Close,Volume\n2021-01-02T10:00:00+02:00,1,2,0.5,1.5,100\n",
+			schema:            "close_price:RAW",
+			expectedTimestamp: time.Date(2021, 1, 2, 8, 0, 0, 0, time.UTC),
+			expectedClose:     1.5,
+			expectedVolume:    100,
+		},
+		{
+			name:          "TestLoadCSVSymbolData_schema_unsupportedField",
+			contents:      "Date,Open,High,Low,Close,Volume\n2021-01-02,1,2,0.5,1.5,100\n",
+			schema:        "price:Close",
+			expectedError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "TEST-USD_1D.csv")
+			if err := ioutil.WriteFile(filePath, []byte(testCase.contents), 0644); err != nil {
+				t.Fatalf("failed to write file: %s", err)
+			}
+
+			schema, err := NewCSVSchema(testCase.schema)
+			if err == nil {
+				_, err = loadCSVSymbolData(filePath, schema)
+			}
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if testCase.expectedError {
+				return
+			}
+
+			symbolData, _ := loadCSVSymbolData(filePath, schema)
+			bar := symbolData.GetBar(0)
+			if !bar.Timestamp.Equal(testCase.expectedTimestamp) {
+				t.Errorf("expected timestamp %s, got %s", testCase.expectedTimestamp, bar.Timestamp)
+			}
+			if bar.Open != 1 || bar.High != 2 || bar.Low != 0.5 {
+				t.Errorf("expected open 1, high 2 & low 0.5, got %+v", bar)
+			}
+			if bar.Close != testCase.expectedClose || bar.Volume != testCase.expectedVolume {
+				t.Errorf("expected close %v & volume %v, got %v & %v", testCase.expectedClose, testCase.expectedVolume,
+					bar.Close, bar.Volume)
+			}
+		})
+	}
+}
+
+func TestCSVSchemaForExchange(t *testing.T) {
+	schema, err := CSVSchemaForExchange("kraken=close_price:RAW;binance=timestamp:open_time,time_format:UNIX_MS", "binance")
+	if err != nil {
+		t.Fatalf("failed to parse CSV schemas: %s", err)
+	}
+	if schema.Timestamp[0] != "open_time" || schema.TimeFormat != TimeFormatUnixMs || schema.ClosePrice != CloseAdjusted {
+		t.Errorf("expected the binance schema, got %+v", schema)
+	}
+
+	schema, err = CSVSchemaForExchange("kraken=close_price:RAW", "coinbase")
+	if err != nil || schema.ClosePrice != CloseAdjusted || schema.Timestamp[0] != "Date" {
+		t.Errorf("expected the default schema for an unlisted exchange, got %+v, %v", schema, err)
+	}
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/eapache/queue"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	FeedPoll        = "POLL"         // Poll the "/bars" endpoint of a bar feed server, eg/ the ReplayServer
+	FeedKlineStream = "KLINE_STREAM" // Subscribe to a Binance-style kline WebSocket stream
+)
+
+// Streamer is a Handler whose bars arrive from a live Feed, polled on the trader's heartbeat
+type Streamer interface {
+	Handler
+	Poll(ctx context.Context) error
+	IsFinished() bool
+}
+
+// Feed is a source of live bars for a streamingHandler
+type Feed interface {
+	// Fetch returns the closed bars after the provided timestamp & whether the feed has no more bars to send
+	Fetch(ctx context.Context, after time.Time) ([]model.Bar, bool, error)
+}
+
+// feedResponse is the body returned by a bar feed endpoint, eg/ the ReplayServer
+type feedResponse struct {
+	Bars     []model.Bar
+	Finished bool
+}
+
+// httpFeed is a Feed polling the "/bars" endpoint of a bar feed server for a single symbol & timeframe
+type httpFeed struct {
+	client    *http.Client
+	baseURL   string
+	symbol    string
+	timeframe string
+}
+
+// Fetch requests the bars after the provided timestamp from the feed server
+func (hf *httpFeed) Fetch(ctx context.Context, after time.Time) ([]model.Bar, bool, error) {
+	query := url.Values{}
+	query.Set("symbol", hf.symbol)
+	query.Set("timeframe", hf.timeframe)
+	if !after.IsZero() {
+		query.Set("after", after.Format(time.RFC3339Nano))
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/bars?%s", hf.baseURL, query.Encode()), nil)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to build feed request")
+	}
+	response, err := hf.client.Do(request)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to request bars")
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, false, errors.New(fmt.Sprintf("feed responded with status %s", response.Status))
+	}
+
+	var body feedResponse
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, false, errors.Wrap(err, "failed to decode bars")
+	}
+	return body.Bars, body.Finished, nil
+}
+
+// NewFeed constructs the Feed configured by DATA_FEED for the trader's symbol & timeframe
+func NewFeed(cfg config.Trader) (Feed, error) {
+	switch cfg.DataFeed {
+	case FeedPoll:
+		return NewHTTPFeed(cfg.DataFeedURL, cfg.Symbol, cfg.Timeframe), nil
+	case FeedKlineStream:
+		return NewKlineStreamFeed(cfg)
+	}
+	return nil, errors.New(fmt.Sprintf("unsupported data feed %s", cfg.DataFeed))
+}
+
+// NewHTTPFeed constructs a Feed polling the bar feed server at the provided base URL
+func NewHTTPFeed(baseURL string, symbol string, timeframe string) *httpFeed {
+	return &httpFeed{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		baseURL:   baseURL,
+		symbol:    symbol,
+		timeframe: timeframe,
+	}
+}
+
+// streamingHandler is a Handler for dry & live trading, buffering the bars received from a Feed until the trader
+// processes them
+type streamingHandler struct {
+	log               *zap.Logger
+	eventQ            *queue.Queue
+	symbol            string
+	feed              Feed
+	bufferedBars      []model.Bar      // Bars received from the feed but not yet added to currentSymbolData
+	currentSymbolData model.SymbolData // Data available up to current timestamp
+	latestBarIndex    int64
+	isFinished        bool
+}
+
+// ShouldContinue determines if a received bar is waiting to be processed
+func (sh *streamingHandler) ShouldContinue() bool {
+	return len(sh.bufferedBars) > 0
+}
+
+// UpdateData adds the oldest buffered bar to currentSymbolData & adds a MarketEvent to the queue
+func (sh *streamingHandler) UpdateData() {
+	latestBar := sh.bufferedBars[0]
+	sh.bufferedBars = sh.bufferedBars[1:]
+
+	sh.latestBarIndex++
+	sh.currentSymbolData.AddBar(latestBar)
+
+	sh.eventQ.Add(model.MarketEvent{
+		TraceId:   uuid.New(),
+		Timestamp: latestBar.Timestamp,
+		Symbol:    sh.symbol,
+		Close:     latestBar.Close,
+	})
+}
+
+// GetLatestData returns a tuple of (data up to the current timestamp, latest bar index)
+func (sh *streamingHandler) GetLatestData() (*model.SymbolData, int64) {
+	return &sh.currentSymbolData, sh.latestBarIndex
+}
+
+// NextTimestamp returns the timestamp of the bar the next call to UpdateData will add
+func (sh *streamingHandler) NextTimestamp() time.Time {
+	return sh.bufferedBars[0].Timestamp
+}
+
+// Poll fetches the bars closed since the latest received bar from the feed, ignoring any already received
+func (sh *streamingHandler) Poll(ctx context.Context) error {
+	latestTimestamp := sh.latestTimestamp()
+	bars, isFinished, err := sh.feed.Fetch(ctx, latestTimestamp)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to poll feed for %s", sh.symbol))
+	}
+
+	for _, bar := range bars {
+		if !bar.Timestamp.After(latestTimestamp) {
+			continue
+		}
+		sh.bufferedBars = append(sh.bufferedBars, bar)
+		latestTimestamp = bar.Timestamp
+	}
+	sh.isFinished = isFinished
+	return nil
+}
+
+// IsFinished determines if the feed has no more bars to send
+func (sh *streamingHandler) IsFinished() bool {
+	return sh.isFinished
+}
+
+// latestTimestamp returns the timestamp of the latest bar received from the feed, zero if none have been received
+func (sh *streamingHandler) latestTimestamp() time.Time {
+	if len(sh.bufferedBars) > 0 {
+		return sh.bufferedBars[len(sh.bufferedBars)-1].Timestamp
+	}
+	if sh.latestBarIndex >= 0 {
+		return sh.currentSymbolData.Timestamps[sh.latestBarIndex]
+	}
+	return time.Time{}
+}
+
+// NewStreamingHandler returns an instance of a data.streamingHandler receiving bars from the provided Feed
+func NewStreamingHandler(cfg config.Trader, eventQ *queue.Queue, feed Feed) (*streamingHandler, error) {
+	if feed == nil {
+		return &streamingHandler{}, errors.New(fmt.Sprintf("streaming handler for %s requires a feed", cfg.Symbol))
+	}
+	return &streamingHandler{
+		log:               cfg.Log,
+		eventQ:            eventQ,
+		symbol:            cfg.Symbol,
+		feed:              feed,
+		currentSymbolData: model.SymbolData{Indicators: make(map[string][]interface{})},
+		latestBarIndex:    -1,
+	}, nil
+}
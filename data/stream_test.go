@@ -0,0 +1,100 @@
+package data
+
+import (
+	"context"
+	"github.com/eapache/queue"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamingHandler_Poll(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var bars []model.Bar
+	for day := 0; day < 4; day++ {
+		bars = append(bars, model.Bar{Timestamp: start.AddDate(0, 0, day), Close: float64(100 + day), Volume: 10})
+	}
+
+	// Replay a day of bars every second of the fake clock
+	now := start
+	replayServer := &ReplayServer{
+		log:     zap.NewNop(),
+		speed:   86400,
+		start:   start,
+		now:     func() time.Time { return now },
+		series:  map[string][]model.Bar{"ETH-USD_1D": bars},
+		loadCSV: csvBarLoader(DefaultCSVSchema()),
+	}
+	server := httptest.NewServer(replayServer)
+	defer server.Close()
+
+	eventQ := queue.New()
+	handler, err := NewStreamingHandler(config.Trader{Log: zap.NewNop(), Symbol: "ETH-USD"}, eventQ,
+		NewHTTPFeed(server.URL, "ETH-USD", "1D"))
+	if err != nil {
+		t.Fatalf("failed to init streaming handler: %s", err)
+	}
+
+	testCases := []struct {
+		name             string
+		elapsed          time.Duration
+		expectedCloses   []float64
+		expectedFinished bool
+	}{
+		{
+			name:           "TestStreamingHandler_Poll_firstBar",
+			elapsed:        0,
+			expectedCloses: []float64{100},
+		},
+		{
+			name:           "TestStreamingHandler_Poll_nothingNew",
+			elapsed:        500 * time.Millisecond,
+			expectedCloses: nil,
+		},
+		{
+			name:           "TestStreamingHandler_Poll_severalBars",
+			elapsed:        2 * time.Second,
+			expectedCloses: []float64{101, 102},
+		},
+		{
+			name:             "TestStreamingHandler_Poll_finished",
+			elapsed:          10 * time.Second,
+			expectedCloses:   []float64{103},
+			expectedFinished: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			now = start.Add(testCase.elapsed)
+			if err := handler.Poll(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var closes []float64
+			for handler.ShouldContinue() {
+				handler.UpdateData()
+				currentData, latestBarIndex := handler.GetLatestData()
+				closes = append(closes, currentData.Closes[latestBarIndex])
+				if _, isMarket := eventQ.Remove().(model.MarketEvent); !isMarket {
+					t.Errorf("expected a MarketEvent for every bar")
+				}
+			}
+
+			if len(closes) != len(testCase.expectedCloses) {
+				t.Fatalf("expected closes %v, got: %v", testCase.expectedCloses, closes)
+			}
+			for index := range closes {
+				if closes[index] != testCase.expectedCloses[index] {
+					t.Errorf("expected closes %v, got: %v", testCase.expectedCloses, closes)
+				}
+			}
+			if handler.IsFinished() != testCase.expectedFinished {
+				t.Errorf("expected finished %v, got: %v", testCase.expectedFinished, handler.IsFinished())
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package data
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/eapache/queue"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SynthProcessGBM    = "gbm"    // Geometric Brownian motion
+	SynthProcessHeston = "heston" // Heston stochastic volatility
+	SynthProcessJump   = "jump"   // Merton jump-diffusion
+	SynthProcessRegime = "regime" // Two-state Markov regime-switching GBM
+)
+
+const (
+	synthSubsteps   = 16        // Steps simulated within each bar to form its High & Low
+	synthBaseVolume = 1000000.0 // Median Volume of a bar with no price change
+	synthYear       = 365 * 24 * time.Hour
+)
+
+// PriceProcess is a stochastic process of log prices with annualised parameters
+type PriceProcess interface {
+	// Step returns the log return over dt years
+	Step(rng *rand.Rand, dt float64) float64
+}
+
+// GBM is geometric Brownian motion with drift Mu & volatility Sigma
+type GBM struct {
+	Mu    float64
+	Sigma float64
+}
+
+// Step returns the log return over dt years
+func (g *GBM) Step(rng *rand.Rand, dt float64) float64 {
+	return (g.Mu-0.5*g.Sigma*g.Sigma)*dt + g.Sigma*math.Sqrt(dt)*rng.NormFloat64()
+}
+
+// Heston is a stochastic volatility process whose variance reverts to Theta at rate Kappa with volatility of variance
+// Xi & correlation Rho to the price, simulated with a full truncation Euler scheme
+type Heston struct {
+	Mu       float64
+	Kappa    float64
+	Theta    float64
+	Xi       float64
+	Rho      float64
+	variance float64
+}
+
+// Step returns the log return over dt years & evolves the variance
+func (h *Heston) Step(rng *rand.Rand, dt float64) float64 {
+	variance := math.Max(h.variance, 0)
+	priceShock := rng.NormFloat64()
+	varianceShock := h.Rho*priceShock + math.Sqrt(1-h.Rho*h.Rho)*rng.NormFloat64()
+
+	logReturn := (h.Mu-0.5*variance)*dt + math.Sqrt(variance*dt)*priceShock
+	h.variance += h.Kappa*(h.Theta-variance)*dt + h.Xi*math.Sqrt(variance*dt)*varianceShock
+	return logReturn
+}
+
+// JumpDiffusion is the Merton jump-diffusion process - GBM plus jumps arriving at Lambda per year with normally
+// distributed log sizes, compensated so the expected return remains Mu
+type JumpDiffusion struct {
+	Mu        float64
+	Sigma     float64
+	Lambda    float64
+	JumpMean  float64
+	JumpStdev float64
+}
+
+// Step returns the log return over dt years
+func (j *JumpDiffusion) Step(rng *rand.Rand, dt float64) float64 {
+	compensator := j.Lambda * (math.Exp(j.JumpMean+0.5*j.JumpStdev*j.JumpStdev) - 1)
+	logReturn := (j.Mu-0.5*j.Sigma*j.Sigma-compensator)*dt + j.Sigma*math.Sqrt(dt)*rng.NormFloat64()
+	for jumps := poisson(rng, j.Lambda*dt); jumps > 0; jumps-- {
+		logReturn += j.JumpMean + j.JumpStdev*rng.NormFloat64()
+	}
+	return logReturn
+}
+
+// RegimeSwitching is GBM whose drift & volatility switch between two regimes, leaving each regime at its annual Rate
+type RegimeSwitching struct {
+	Regimes [2]GBM
+	Rates   [2]float64
+	regime  int
+}
+
+// Step returns the log return over dt years in the current regime, then possibly switches regime
+func (rs *RegimeSwitching) Step(rng *rand.Rand, dt float64) float64 {
+	logReturn := rs.Regimes[rs.regime].Step(rng, dt)
+	if rng.Float64() < 1-math.Exp(-rs.Rates[rs.regime]*dt) {
+		rs.regime = 1 - rs.regime
+	}
+	return logReturn
+}
+
+// poisson samples a Poisson distributed count with the provided mean using Knuth's algorithm
+func poisson(rng *rand.Rand, mean float64) int {
+	limit := math.Exp(-mean)
+	count := 0
+	for product := rng.Float64(); product > limit; product *= rng.Float64() {
+		count++
+	}
+	return count
+}
+
+// NewPriceProcess constructs a PriceProcess from a specification in the format "gbm:mu:sigma",
+// "heston:mu:kappa:theta:xi:rho:v0", "jump:mu:sigma:lambda:jumpMean:jumpStdev" or
+// "regime:mu1:sigma1:mu2:sigma2:rate12:rate21", with every parameter annualised eg/ "gbm:0.1:0.8"
+func NewPriceProcess(specification string) (PriceProcess, error) {
+	fields := strings.Split(strings.TrimSpace(specification), ":")
+	expectedParams := map[string]int{SynthProcessGBM: 2, SynthProcessHeston: 6, SynthProcessJump: 5, SynthProcessRegime: 6}
+	count, isSupported := expectedParams[fields[0]]
+	if !isSupported {
+		return nil, errors.New(fmt.Sprintf("unsupported price process %s", specification))
+	}
+	if len(fields)-1 != count {
+		return nil, errors.New(fmt.Sprintf("price process %s requires %v parameters, got %v", fields[0], count, len(fields)-1))
+	}
+
+	params := make([]float64, count)
+	for index, field := range fields[1:] {
+		param, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse parameter %v of price process %s", index+1, fields[0]))
+		}
+		params[index] = param
+	}
+	nonNegativeParams := map[string][]int{
+		SynthProcessGBM:    {1},
+		SynthProcessHeston: {1, 2, 3, 5},
+		SynthProcessJump:   {1, 2, 4},
+		SynthProcessRegime: {1, 3, 4, 5},
+	}
+	for _, index := range nonNegativeParams[fields[0]] {
+		if params[index] < 0 {
+			return nil, errors.New(fmt.Sprintf("price process %s volatility, rate & variance parameters cannot be negative", specification))
+		}
+	}
+
+	switch fields[0] {
+	case SynthProcessGBM:
+		return &GBM{Mu: params[0], Sigma: params[1]}, nil
+	case SynthProcessHeston:
+		if params[4] < -1 || params[4] > 1 {
+			return nil, errors.New(fmt.Sprintf("heston correlation %v must be between -1 & 1", params[4]))
+		}
+		return &Heston{Mu: params[0], Kappa: params[1], Theta: params[2], Xi: params[3], Rho: params[4], variance: params[5]}, nil
+	case SynthProcessJump:
+		return &JumpDiffusion{Mu: params[0], Sigma: params[1], Lambda: params[2], JumpMean: params[3], JumpStdev: params[4]}, nil
+	default:
+		return &RegimeSwitching{
+			Regimes: [2]GBM{{Mu: params[0], Sigma: params[1]}, {Mu: params[2], Sigma: params[3]}},
+			Rates:   [2]float64{params[4], params[5]},
+		}, nil
+	}
+}
+
+// SynthesiseSymbolData generates bars of the symbol's timeframe from the price process specification, starting at the
+// provided timestamp & price. Each bar's High & Low are the extremes of the path simulated within it, and its Volume
+// grows with the size of its move. The path is reproducible from the seed & symbol, so symbols sharing a seed differ.
+func SynthesiseSymbolData(specification string, seed int64, symbol string, timeframe string, start time.Time,
+	startPrice float64, bars int) (model.SymbolData, error) {
+	process, err := NewPriceProcess(specification)
+	if err != nil {
+		return model.SymbolData{}, err
+	}
+	interval, err := ParseTimeframe(timeframe)
+	if err != nil {
+		return model.SymbolData{}, err
+	}
+	if bars <= 0 || startPrice <= 0 {
+		return model.SymbolData{}, errors.New(fmt.Sprintf("synthesised bars %v & start price %v must be positive", bars, startPrice))
+	}
+
+	symbolHash := fnv.New64a()
+	symbolHash.Write([]byte(symbol))
+	rng := rand.New(rand.NewSource(seed ^ int64(symbolHash.Sum64())))
+	dt := float64(interval) / float64(synthYear) / synthSubsteps
+
+	symbolData := model.SymbolData{Indicators: make(map[string][]interface{})}
+	price := startPrice
+	for index := 0; index < bars; index++ {
+		open, high, low := price, price, price
+		for step := 0; step < synthSubsteps; step++ {
+			price *= math.Exp(process.Step(rng, dt))
+			high, low = math.Max(high, price), math.Min(low, price)
+		}
+		move := math.Abs(math.Log(price / open))
+		volume := synthBaseVolume * math.Exp(0.5*rng.NormFloat64()) * (1 + 20*move)
+
+		symbolData.AddBar(model.Bar{
+			Timestamp: start.Add(time.Duration(index) * interval),
+			Open:      open,
+			High:      high,
+			Low:       low,
+			Close:     price,
+			Volume:    volume,
+		})
+	}
+	return symbolData, nil
+}
+
+// NewSyntheticHandler returns a Handler for backtesting with bars synthesised from SYNTH_MODEL rather than loaded
+// from a historic data file
+func NewSyntheticHandler(cfg config.Trader, eventQ *queue.Queue) (*historicHandler, error) {
+	allSymbolData, err := SynthesiseSymbolData(cfg.SynthModel, cfg.SynthSeed, cfg.Symbol, cfg.Timeframe, cfg.SynthStart,
+		cfg.SynthStartPrice, cfg.SynthBars)
+	if err != nil {
+		return &historicHandler{}, errors.Wrap(err, "failed to synthesise data")
+	}
+
+	return &historicHandler{
+		log:               cfg.Log,
+		eventQ:            eventQ,
+		symbol:            cfg.Symbol,
+		allSymbolData:     allSymbolData,
+		currentSymbolData: model.SymbolData{},
+		latestBarIndex:    -1,
+	}, nil
+}
+
+// WriteCSVSymbolData writes bars in the historic data file format "Date,Open,High,Low,Close,Adj Close,Volume", with
+// ISO dates for daily timeframes & RFC3339 timestamps for intraday timeframes
+func WriteCSVSymbolData(w io.Writer, symbolData model.SymbolData, timeframe string) error {
+	interval, err := ParseTimeframe(timeframe)
+	if err != nil {
+		return err
+	}
+	layout := time.RFC3339
+	if interval%(24*time.Hour) == 0 {
+		layout = timestampLayoutIso
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"Date", "Open", "High", "Low", "Close", "Adj Close", "Volume"}); err != nil {
+		return err
+	}
+	for index := range symbolData.Timestamps {
+		bar := symbolData.GetBar(int64(index))
+		close := formatFloat(bar.Close)
+		record := []string{bar.Timestamp.UTC().Format(layout), formatFloat(bar.Open), formatFloat(bar.High),
+			formatFloat(bar.Low), close, close, formatFloat(bar.Volume)}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
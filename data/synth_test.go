@@ -0,0 +1,141 @@
+package data
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSynthesiseSymbolData(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		specification string
+		bars          int
+		expectedError bool
+	}{
+		{name: "TestSynthesiseSymbolData_gbm", specification: "gbm:0.1:0.8", bars: 500},
+		{name: "TestSynthesiseSymbolData_heston", specification: "heston:0.05:2:0.5:0.6:-0.7:0.5", bars: 500},
+		{name: "TestSynthesiseSymbolData_jump", specification: "jump:0:0.5:10:-0.05:0.1", bars: 500},
+		{name: "TestSynthesiseSymbolData_regime", specification: "regime:0.5:0.4:-0.5:1.2:4:8", bars: 500},
+		{name: "TestSynthesiseSymbolData_unsupported", specification: "brownian:0.1", bars: 10, expectedError: true},
+		{name: "TestSynthesiseSymbolData_wrongParams", specification: "gbm:0.1", bars: 10, expectedError: true},
+		{name: "TestSynthesiseSymbolData_negativeVol", specification: "gbm:0.1:-0.8", bars: 10, expectedError: true},
+		{name: "TestSynthesiseSymbolData_badCorrelation", specification: "heston:0:2:0.5:0.6:-1.5:0.5", bars: 10, expectedError: true},
+		{name: "TestSynthesiseSymbolData_noBars", specification: "gbm:0.1:0.8", bars: 0, expectedError: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			symbolData, err := SynthesiseSymbolData(testCase.specification, 42, "SYN-USD", "1D", start, 100, testCase.bars)
+			if testCase.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error synthesising %s", testCase.specification)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to synthesise %s: %s", testCase.specification, err)
+			}
+			if len(symbolData.Timestamps) != testCase.bars {
+				t.Fatalf("expected %v bars, got %v", testCase.bars, len(symbolData.Timestamps))
+			}
+
+			// Same seed & symbol reproduces the path, a different seed or symbol does not
+			repeated, _ := SynthesiseSymbolData(testCase.specification, 42, "SYN-USD", "1D", start, 100, testCase.bars)
+			if !reflect.DeepEqual(symbolData, repeated) {
+				t.Errorf("expected the same seed to reproduce the bars")
+			}
+			reseeded, _ := SynthesiseSymbolData(testCase.specification, 43, "SYN-USD", "1D", start, 100, testCase.bars)
+			otherSymbol, _ := SynthesiseSymbolData(testCase.specification, 42, "ALT-USD", "1D", start, 100, testCase.bars)
+			if reflect.DeepEqual(symbolData.Closes, reseeded.Closes) || reflect.DeepEqual(symbolData.Closes, otherSymbol.Closes) {
+				t.Errorf("expected a different seed or symbol to change the bars")
+			}
+
+			for index := range symbolData.Timestamps {
+				bar := symbolData.GetBar(int64(index))
+				if !bar.Timestamp.Equal(start.AddDate(0, 0, index)) {
+					t.Fatalf("expected bar %v at %s, got %s", index, start.AddDate(0, 0, index), bar.Timestamp)
+				}
+				if bar.Low <= 0 || bar.High < math.Max(bar.Open, bar.Close) || bar.Low > math.Min(bar.Open, bar.Close) {
+					t.Fatalf("bar %v has inconsistent OHLC %+v", index, bar)
+				}
+				if index > 0 && bar.Open != symbolData.Closes[index-1] {
+					t.Fatalf("expected bar %v to open at the previous close", index)
+				}
+			}
+		})
+	}
+}
+
+func TestSynthesiseSymbolData_gbmMoments(t *testing.T) {
+	mu, sigma := 0.2, 0.6
+	symbolData, err := SynthesiseSymbolData("gbm:0.2:0.6", 7, "SYN-USD", "1D", time.Now(), 100, 20000)
+	if err != nil {
+		t.Fatalf("failed to synthesise gbm: %s", err)
+	}
+
+	var sum, sumSquares float64
+	for index := range symbolData.Closes {
+		logReturn := math.Log(symbolData.Closes[index] / symbolData.Opens[index])
+		sum += logReturn
+		sumSquares += logReturn * logReturn
+	}
+	count := float64(len(symbolData.Closes))
+	mean, variance := sum/count, sumSquares/count-(sum/count)*(sum/count)
+
+	dt := 1.0 / 365
+	expectedMean, expectedVariance := (mu-0.5*sigma*sigma)*dt, sigma*sigma*dt
+	// Allow 4 standard errors of the sample mean & 5% of the variance
+	if math.Abs(mean-expectedMean) > 4*math.Sqrt(expectedVariance/count) {
+		t.Errorf("expected mean daily log return near %v, got %v", expectedMean, mean)
+	}
+	if math.Abs(variance-expectedVariance) > 0.05*expectedVariance {
+		t.Errorf("expected daily log return variance near %v, got %v", expectedVariance, variance)
+	}
+}
+
+func TestWriteCSVSymbolData(t *testing.T) {
+	testCases := []struct {
+		name      string
+		timeframe string
+	}{
+		{name: "TestWriteCSVSymbolData_daily", timeframe: "1D"},
+		{name: "TestWriteCSVSymbolData_intraday", timeframe: "15m"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			symbolData, err := SynthesiseSymbolData("gbm:0:0.8", 1, "SYN-USD", testCase.timeframe, start, 100, 50)
+			if err != nil {
+				t.Fatalf("failed to synthesise data: %s", err)
+			}
+			var buffer bytes.Buffer
+			if err := WriteCSVSymbolData(&buffer, symbolData, testCase.timeframe); err != nil {
+				t.Fatalf("failed to write CSV: %s", err)
+			}
+
+			// The written file loads back as the synthesised bars
+			filePath := filepath.Join(t.TempDir(), "SYN-USD.csv")
+			if err := ioutil.WriteFile(filePath, buffer.Bytes(), 0644); err != nil {
+				t.Fatalf("failed to write file: %s", err)
+			}
+			loaded, err := loadCSVSymbolData(filePath, DefaultCSVSchema())
+			if err != nil {
+				t.Fatalf("failed to load written CSV: %s", err)
+			}
+			for index := range symbolData.Timestamps {
+				expected, actual := symbolData.GetBar(int64(index)), loaded.GetBar(int64(index))
+				if !expected.Timestamp.Equal(actual.Timestamp) || expected.Close != actual.Close || expected.Volume != actual.Volume {
+					t.Fatalf("expected bar %v to load as %+v, got %+v", index, expected, actual)
+				}
+			}
+		})
+	}
+}
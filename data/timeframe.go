@@ -0,0 +1,44 @@
+package data
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeframeUnits maps the unit of a timeframe to its duration
+var timeframeUnits = map[string]time.Duration{
+	"m": time.Minute,
+	"H": time.Hour,
+	"D": 24 * time.Hour,
+	"W": 7 * 24 * time.Hour,
+}
+
+// ParseTimeframe returns the duration of a timeframe in the format "<count><unit>", where the unit is m (minutes),
+// H (hours), D (days) or W (weeks), eg/ "15m", "4H" or "1D"
+func ParseTimeframe(timeframe string) (time.Duration, error) {
+	if len(timeframe) < 2 {
+		return 0, errors.New(fmt.Sprintf("failed to parse timeframe %s", timeframe))
+	}
+	count, err := strconv.Atoi(timeframe[:len(timeframe)-1])
+	if err != nil || count <= 0 {
+		return 0, errors.New(fmt.Sprintf("failed to parse timeframe count of %s", timeframe))
+	}
+	unit, isSupported := timeframeUnits[timeframe[len(timeframe)-1:]]
+	if !isSupported {
+		return 0, errors.New(fmt.Sprintf("unsupported timeframe unit of %s", timeframe))
+	}
+	return time.Duration(count) * unit, nil
+}
+
+// BinanceSymbol converts a symbol in the format "BASE-QUOTE" to the Binance format "BASEQUOTE"
+func BinanceSymbol(symbol string) string {
+	return strings.ToUpper(strings.ReplaceAll(symbol, "-", ""))
+}
+
+// binanceInterval converts a timeframe to a Binance kline interval, eg/ "4H" to "4h"
+func binanceInterval(timeframe string) string {
+	return strings.ToLower(timeframe)
+}
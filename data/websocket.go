@@ -0,0 +1,284 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	websocketGUID           = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	websocketMaxMessageSize = 1 << 20
+	websocketDialTimeout    = 10 * time.Second
+)
+
+const (
+	opcodeContinuation = 0x0
+	opcodeText         = 0x1
+	opcodeClose        = 0x8
+	opcodePing         = 0x9
+	opcodePong         = 0xA
+)
+
+var errWebsocketClosed = errors.New("websocket closed by peer")
+
+// websocketConn is a minimal RFC 6455 WebSocket connection, sufficient for streaming market data messages
+type websocketConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	isClient   bool // Clients mask the frames they send, servers do not
+	writeMutex sync.Mutex
+}
+
+// ReadMessage returns the next text or binary message, answering pings whilst waiting for it
+func (wc *websocketConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		isFinal, opcode, payload, err := wc.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opcodePing:
+			if err := wc.writeFrame(opcodePong, payload); err != nil {
+				return nil, err
+			}
+		case opcodePong:
+		case opcodeClose:
+			wc.writeFrame(opcodeClose, payload)
+			return nil, errWebsocketClosed
+		default:
+			message = append(message, payload...)
+			if len(message) > websocketMaxMessageSize {
+				return nil, errors.New(fmt.Sprintf("websocket message exceeds %v bytes", websocketMaxMessageSize))
+			}
+			if isFinal {
+				return message, nil
+			}
+		}
+	}
+}
+
+// WriteMessage sends a text message
+func (wc *websocketConn) WriteMessage(message []byte) error {
+	return wc.writeFrame(opcodeText, message)
+}
+
+// SetReadDeadline sets the time after which a ReadMessage waiting on the peer fails
+func (wc *websocketConn) SetReadDeadline(deadline time.Time) error {
+	return wc.conn.SetReadDeadline(deadline)
+}
+
+// Close sends a normal closure frame & closes the underlying connection
+func (wc *websocketConn) Close() error {
+	wc.writeFrame(opcodeClose, []byte{0x03, 0xE8})
+	return wc.conn.Close()
+}
+
+// readFrame reads a single frame, unmasking its payload
+func (wc *websocketConn) readFrame() (bool, byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(wc.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	isFinal := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	isMasked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(wc.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(wc.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > websocketMaxMessageSize {
+		return false, 0, nil, errors.New(fmt.Sprintf("websocket frame of %v bytes exceeds %v bytes", length, websocketMaxMessageSize))
+	}
+
+	var mask [4]byte
+	if isMasked {
+		if _, err := io.ReadFull(wc.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(wc.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if isMasked {
+		for index := range payload {
+			payload[index] ^= mask[index%4]
+		}
+	}
+	return isFinal, opcode, payload, nil
+}
+
+// writeFrame sends the payload as a single final frame, masked if sent by a client
+func (wc *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	wc.writeMutex.Lock()
+	defer wc.writeMutex.Unlock()
+
+	var maskBit byte
+	if wc.isClient {
+		maskBit = 0x80
+	}
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(length))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+
+	if wc.isClient {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return errors.Wrap(err, "failed to generate websocket mask")
+		}
+		frame = append(frame, mask[:]...)
+		for index, value := range payload {
+			frame = append(frame, value^mask[index%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := wc.conn.Write(frame)
+	return err
+}
+
+// dialWebsocket opens a client WebSocket connection to a "ws://" or "wss://" URL
+func dialWebsocket(ctx context.Context, rawURL string) (*websocketConn, error) {
+	streamURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse websocket URL %s", rawURL))
+	}
+	address := streamURL.Host
+	switch streamURL.Scheme {
+	case "ws":
+		if streamURL.Port() == "" {
+			address = net.JoinHostPort(streamURL.Hostname(), "80")
+		}
+	case "wss":
+		if streamURL.Port() == "" {
+			address = net.JoinHostPort(streamURL.Hostname(), "443")
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported websocket scheme %s", streamURL.Scheme))
+	}
+
+	dialer := net.Dialer{Timeout: websocketDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to dial %s", address))
+	}
+	conn.SetDeadline(time.Now().Add(websocketDialTimeout))
+	if streamURL.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: streamURL.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "failed TLS handshake")
+		}
+		conn = tlsConn
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to generate websocket key")
+	}
+	encodedKey := base64.StdEncoding.EncodeToString(key)
+	request := &http.Request{
+		Method: http.MethodGet,
+		URL:    streamURL,
+		Host:   streamURL.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {encodedKey},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if err := request.Write(conn); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to send websocket handshake")
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to read websocket handshake")
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, errors.New(fmt.Sprintf("websocket handshake responded with status %s", response.Status))
+	}
+	if response.Header.Get("Sec-WebSocket-Accept") != websocketAcceptKey(encodedKey) {
+		conn.Close()
+		return nil, errors.New("websocket handshake returned an invalid accept key")
+	}
+
+	conn.SetDeadline(time.Time{})
+	return &websocketConn{conn: conn, reader: reader, isClient: true}, nil
+}
+
+// acceptWebsocket upgrades an HTTP request to a server WebSocket connection
+func acceptWebsocket(w http.ResponseWriter, r *http.Request) (*websocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "expected a websocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("request is not a websocket upgrade")
+	}
+	hijacker, isHijacker := w.(http.Hijacker)
+	if !isHijacker {
+		http.Error(w, "websocket upgrade unsupported", http.StatusInternalServerError)
+		return nil, errors.New("response writer cannot be hijacked")
+	}
+
+	conn, readWriter, err := hijacker.Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to hijack connection")
+	}
+	handshake := fmt.Sprintf("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", websocketAcceptKey(key))
+	if _, err := conn.Write([]byte(handshake)); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "failed to send websocket handshake")
+	}
+	return &websocketConn{conn: conn, reader: readWriter.Reader}, nil
+}
+
+// websocketAcceptKey returns the Sec-WebSocket-Accept of a handshake's Sec-WebSocket-Key
+func websocketAcceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,275 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/google/go-cmp/cmp"
+	"net"
+	"testing"
+	"time"
+)
+
+// bufferConn is a net.Conn that reads from a fixed input & records everything written to it
+type bufferConn struct {
+	input  *bytes.Reader
+	output bytes.Buffer
+}
+
+func (b *bufferConn) Read(p []byte) (int, error)         { return b.input.Read(p) }
+func (b *bufferConn) Write(p []byte) (int, error)        { return b.output.Write(p) }
+func (b *bufferConn) Close() error                       { return nil }
+func (b *bufferConn) LocalAddr() net.Addr                { return nil }
+func (b *bufferConn) RemoteAddr() net.Addr               { return nil }
+func (b *bufferConn) SetDeadline(t time.Time) error      { return nil }
+func (b *bufferConn) SetReadDeadline(t time.Time) error  { return nil }
+func (b *bufferConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// newBufferWebsocket returns a websocketConn reading the input frames & the bufferConn recording its writes
+func newBufferWebsocket(input []byte, isClient bool) (*websocketConn, *bufferConn) {
+	conn := &bufferConn{input: bytes.NewReader(input)}
+	return &websocketConn{conn: conn, reader: bufio.NewReader(conn), isClient: isClient}, conn
+}
+
+// concat joins byte slices into a single frame
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestWebsocketConn_readFrame(t *testing.T) {
+	hello := []byte("Hello")
+	large := bytes.Repeat([]byte{0xAB}, 256)
+	huge := bytes.Repeat([]byte{0xCD}, 65536)
+
+	testCases := []struct {
+		name            string
+		input           []byte
+		expectedFinal   bool
+		expectedOpcode  byte
+		expectedPayload []byte
+		expectedError   bool
+	}{
+		// Examples from RFC 6455 section 5.7
+		{
+			name:            "TestWebsocketConn_readFrame_unmaskedText",
+			input:           []byte{0x81, 0x05, 0x48, 0x65, 0x6c, 0x6c, 0x6f},
+			expectedFinal:   true,
+			expectedOpcode:  opcodeText,
+			expectedPayload: hello,
+		},
+		{
+			name:            "TestWebsocketConn_readFrame_maskedText",
+			input:           []byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58},
+			expectedFinal:   true,
+			expectedOpcode:  opcodeText,
+			expectedPayload: hello,
+		},
+		{
+			name:            "TestWebsocketConn_readFrame_firstFragment",
+			input:           []byte{0x01, 0x03, 0x48, 0x65, 0x6c},
+			expectedFinal:   false,
+			expectedOpcode:  opcodeText,
+			expectedPayload: []byte("Hel"),
+		},
+		{
+			name:            "TestWebsocketConn_readFrame_ping",
+			input:           []byte{0x89, 0x05, 0x48, 0x65, 0x6c, 0x6c, 0x6f},
+			expectedFinal:   true,
+			expectedOpcode:  opcodePing,
+			expectedPayload: hello,
+		},
+		{
+			name:            "TestWebsocketConn_readFrame_maskedPong",
+			input:           []byte{0x8a, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58},
+			expectedFinal:   true,
+			expectedOpcode:  opcodePong,
+			expectedPayload: hello,
+		},
+		{
+			name:            "TestWebsocketConn_readFrame_16BitLength",
+			input:           concat([]byte{0x82, 0x7E, 0x01, 0x00}, large),
+			expectedFinal:   true,
+			expectedOpcode:  0x2,
+			expectedPayload: large,
+		},
+		{
+			name:            "TestWebsocketConn_readFrame_64BitLength",
+			input:           concat([]byte{0x82, 0x7F, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}, huge),
+			expectedFinal:   true,
+			expectedOpcode:  0x2,
+			expectedPayload: huge,
+		},
+		{
+			name:            "TestWebsocketConn_readFrame_emptyClose",
+			input:           []byte{0x88, 0x00},
+			expectedFinal:   true,
+			expectedOpcode:  opcodeClose,
+			expectedPayload: []byte{},
+		},
+		{
+			name:          "TestWebsocketConn_readFrame_exceedsMaxSize",
+			input:         []byte{0x82, 0x7F, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00},
+			expectedError: true,
+		},
+		{
+			name:          "TestWebsocketConn_readFrame_truncatedPayload",
+			input:         []byte{0x81, 0x05, 0x48, 0x65},
+			expectedError: true,
+		},
+		{
+			name:          "TestWebsocketConn_readFrame_truncatedExtendedLength",
+			input:         []byte{0x82, 0x7E, 0x01},
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			websocket, _ := newBufferWebsocket(testCase.input, false)
+
+			isFinal, opcode, payload, err := websocket.readFrame()
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if testCase.expectedError {
+				return
+			}
+			if isFinal != testCase.expectedFinal || opcode != testCase.expectedOpcode {
+				t.Fatalf("expected final %v & opcode %#x, got %v & %#x", testCase.expectedFinal,
+					testCase.expectedOpcode, isFinal, opcode)
+			}
+			if !bytes.Equal(payload, testCase.expectedPayload) {
+				t.Fatalf("expected payload of %v bytes, got %v bytes: %q", len(testCase.expectedPayload), len(payload),
+					payload)
+			}
+		})
+	}
+}
+
+func TestWebsocketConn_writeFrame(t *testing.T) {
+	testCases := []struct {
+		name           string
+		opcode         byte
+		payloadLength  int
+		expectedHeader []byte // Header of the unmasked server frame
+	}{
+		{name: "TestWebsocketConn_writeFrame_empty", opcode: opcodeText, payloadLength: 0, expectedHeader: []byte{0x81, 0x00}},
+		{name: "TestWebsocketConn_writeFrame_7BitLength", opcode: opcodeText, payloadLength: 125, expectedHeader: []byte{0x81, 0x7D}},
+		{
+			name:           "TestWebsocketConn_writeFrame_16BitLengthMin",
+			opcode:         opcodeText,
+			payloadLength:  126,
+			expectedHeader: []byte{0x81, 0x7E, 0x00, 0x7E},
+		},
+		{
+			name:           "TestWebsocketConn_writeFrame_16BitLengthMax",
+			opcode:         opcodeText,
+			payloadLength:  65535,
+			expectedHeader: []byte{0x81, 0x7E, 0xFF, 0xFF},
+		},
+		{
+			name:           "TestWebsocketConn_writeFrame_64BitLength",
+			opcode:         opcodeText,
+			payloadLength:  65536,
+			expectedHeader: []byte{0x81, 0x7F, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00},
+		},
+		{name: "TestWebsocketConn_writeFrame_ping", opcode: opcodePing, payloadLength: 5, expectedHeader: []byte{0x89, 0x05}},
+		{name: "TestWebsocketConn_writeFrame_pong", opcode: opcodePong, payloadLength: 5, expectedHeader: []byte{0x8A, 0x05}},
+		{name: "TestWebsocketConn_writeFrame_close", opcode: opcodeClose, payloadLength: 2, expectedHeader: []byte{0x88, 0x02}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			payload := make([]byte, testCase.payloadLength)
+			for index := range payload {
+				payload[index] = byte(index)
+			}
+
+			// Servers send the payload unmasked
+			server, serverConn := newBufferWebsocket(nil, false)
+			if err := server.writeFrame(testCase.opcode, payload); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(concat(testCase.expectedHeader, payload), serverConn.output.Bytes()); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+
+			// Clients set the mask bit & add a masking key, and the frame decodes back to the payload
+			client, clientConn := newBufferWebsocket(nil, true)
+			if err := client.writeFrame(testCase.opcode, payload); err != nil {
+				t.Fatal(err)
+			}
+			frame := clientConn.output.Bytes()
+			expectedHeader := append([]byte{}, testCase.expectedHeader...)
+			expectedHeader[1] |= 0x80
+			if !bytes.Equal(frame[:len(expectedHeader)], expectedHeader) {
+				t.Fatalf("expected masked header %x, got %x", expectedHeader, frame[:len(expectedHeader)])
+			}
+			if len(frame) != len(expectedHeader)+4+len(payload) {
+				t.Fatalf("expected a 4 byte masking key, got a frame of %v bytes", len(frame))
+			}
+			decoder, _ := newBufferWebsocket(frame, false)
+			isFinal, opcode, decoded, err := decoder.readFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isFinal || opcode != testCase.opcode || !bytes.Equal(decoded, payload) {
+				t.Fatalf("expected final %#x frame of %v bytes, got final %v %#x frame of %v bytes", testCase.opcode,
+					len(payload), isFinal, opcode, len(decoded))
+			}
+		})
+	}
+}
+
+func TestWebsocketConn_ReadMessage(t *testing.T) {
+	testCases := []struct {
+		name            string
+		input           []byte
+		expectedMessage string
+		expectedError   error
+		expectedWritten []byte // Control frames the server answers with
+	}{
+		{
+			name:            "TestWebsocketConn_ReadMessage_single",
+			input:           []byte{0x81, 0x05, 0x48, 0x65, 0x6c, 0x6c, 0x6f},
+			expectedMessage: "Hello",
+		},
+		{
+			name: "TestWebsocketConn_ReadMessage_fragmentedWithPing",
+			input: concat(
+				[]byte{0x01, 0x03, 0x48, 0x65, 0x6c},
+				[]byte{0x89, 0x02, 0x68, 0x69}, // Control frames may be interleaved with fragments
+				[]byte{0x8A, 0x00},             // Unsolicited pongs are ignored
+				[]byte{0x80, 0x02, 0x6c, 0x6f},
+			),
+			expectedMessage: "Hello",
+			expectedWritten: []byte{0x8A, 0x02, 0x68, 0x69},
+		},
+		{
+			name:            "TestWebsocketConn_ReadMessage_close",
+			input:           []byte{0x88, 0x02, 0x03, 0xE8},
+			expectedError:   errWebsocketClosed,
+			expectedWritten: []byte{0x88, 0x02, 0x03, 0xE8},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			websocket, conn := newBufferWebsocket(testCase.input, false)
+
+			message, err := websocket.ReadMessage()
+			if err != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if string(message) != testCase.expectedMessage {
+				t.Fatalf("expected message %q, got %q", testCase.expectedMessage, message)
+			}
+			if !bytes.Equal(conn.output.Bytes(), testCase.expectedWritten) {
+				t.Fatalf("expected to write %x, got %x", testCase.expectedWritten, conn.output.Bytes())
+			}
+		})
+	}
+}
+
+func TestWebsocketAcceptKey(t *testing.T) {
+	// Example handshake from RFC 6455 section 1.3
+	if actual := websocketAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); actual != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("expected accept key s3pPLMBiTxaQ9kYGzzhZRbK+xOo=, got %s", actual)
+	}
+}
@@ -0,0 +1,54 @@
+package data
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"sort"
+	"time"
+)
+
+// WindowSymbolData returns the bars timestamped from start (inclusive) to end (exclusive), preceded by up to warmupBars
+// earlier bars to warm up indicators, and the number of warm-up bars included. A zero start or end leaves that side of
+// the window open.
+func WindowSymbolData(symbolData model.SymbolData, start time.Time, end time.Time, warmupBars int) (model.SymbolData, int, error) {
+	if warmupBars < 0 {
+		return model.SymbolData{}, 0, errors.New(fmt.Sprintf("warm-up bars %v cannot be negative", warmupBars))
+	}
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return model.SymbolData{}, 0, errors.New(fmt.Sprintf("backtest end %s must be after the start %s",
+			end.Format(time.RFC3339), start.Format(time.RFC3339)))
+	}
+
+	timestamps := symbolData.Timestamps
+	startIndex := 0
+	if !start.IsZero() {
+		startIndex = sort.Search(len(timestamps), func(i int) bool { return !timestamps[i].Before(start) })
+	}
+	endIndex := len(timestamps)
+	if !end.IsZero() {
+		endIndex = sort.Search(len(timestamps), func(i int) bool { return !timestamps[i].Before(end) })
+	}
+	if startIndex >= endIndex {
+		return model.SymbolData{}, 0, errors.New(fmt.Sprintf("no bars between %s & %s", formatBound(start), formatBound(end)))
+	}
+
+	warmupIndex := startIndex - warmupBars
+	if warmupIndex < 0 {
+		warmupIndex = 0
+	}
+
+	windowed := model.SymbolData{Indicators: make(map[string][]interface{})}
+	for index := warmupIndex; index < endIndex; index++ {
+		windowed.AddBar(symbolData.GetBar(int64(index)))
+	}
+	return windowed, startIndex - warmupIndex, nil
+}
+
+// formatBound formats a window bound for errors, describing a zero bound as open
+func formatBound(bound time.Time) string {
+	if bound.IsZero() {
+		return "open"
+	}
+	return bound.Format(time.RFC3339)
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"testing"
+	"time"
+)
+
+func TestWindowSymbolData(t *testing.T) {
+	day := func(offset int) time.Time {
+		return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, offset)
+	}
+	symbolData := model.SymbolData{}
+	for offset := 0; offset < 10; offset++ {
+		price := float64(100 + offset)
+		symbolData.AddBar(model.Bar{Timestamp: day(offset), Open: price, High: price, Low: price, Close: price, Volume: 10})
+	}
+
+	testCases := []struct {
+		name               string
+		start              time.Time
+		end                time.Time
+		warmupBars         int
+		expectedError      bool
+		expectedFirst      time.Time
+		expectedBars       int
+		expectedWarmupBars int
+	}{
+		{
+			name:          "TestWindowSymbolData_open",
+			expectedFirst: day(0),
+			expectedBars:  10,
+		},
+		{
+			name:               "TestWindowSymbolData_startWithWarmup",
+			start:              day(5),
+			warmupBars:         3,
+			expectedFirst:      day(2),
+			expectedBars:       8,
+			expectedWarmupBars: 3,
+		},
+		{
+			name:          "TestWindowSymbolData_endExclusive",
+			start:         day(2),
+			end:           day(6),
+			expectedFirst: day(2),
+			expectedBars:  4,
+		},
+		{
+			name:               "TestWindowSymbolData_warmupTruncated",
+			start:              day(2),
+			end:                day(4),
+			warmupBars:         5,
+			expectedFirst:      day(0),
+			expectedBars:       4,
+			expectedWarmupBars: 2,
+		},
+		{
+			name:          "TestWindowSymbolData_noBars",
+			start:         day(20),
+			expectedError: true,
+		},
+		{
+			name:          "TestWindowSymbolData_endBeforeStart",
+			start:         day(5),
+			end:           day(5),
+			expectedError: true,
+		},
+		{
+			name:          "TestWindowSymbolData_negativeWarmup",
+			warmupBars:    -1,
+			expectedError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			windowed, warmupBars, err := WindowSymbolData(symbolData, testCase.start, testCase.end, testCase.warmupBars)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if testCase.expectedError {
+				return
+			}
+			if len(windowed.Timestamps) != testCase.expectedBars {
+				t.Errorf("expected %v bars, got %v", testCase.expectedBars, len(windowed.Timestamps))
+			}
+			if !windowed.Timestamps[0].Equal(testCase.expectedFirst) {
+				t.Errorf("expected first bar at %s, got %s", testCase.expectedFirst, windowed.Timestamps[0])
+			}
+			if warmupBars != testCase.expectedWarmupBars {
+				t.Errorf("expected %v warm-up bars, got %v", testCase.expectedWarmupBars, warmupBars)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package execution
+
+import (
+	"fmt"
+	"github.com/eapache/queue"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ammExecution is an Execution that simulates swapping against a Uniswap-v2-style constant-product pool
+type ammExecution struct {
+	log             *zap.Logger
+	eventQ          *queue.Queue
+	exchange        string
+	poolFee         float64 // LP fee as a fraction of the swap input, eg/ 0.003
+	reserves        model.PoolReserves
+	networkFeeModel NetworkFeeModel
+	fillTiming      string
+	pendingOrders   []model.OrderEvent
+}
+
+// swapResult is the outcome of swapping against the pool, with all values denominated in the quote currency
+type swapResult struct {
+	quantity    float64 // +ve or -ve base Quantity filled
+	spotPrice   float64 // Pool price before the swap
+	fillPrice   float64 // Effective price per unit including the LP fee & price impact
+	lpFee       float64 // LP fee paid
+	priceImpact float64 // Cost of moving the pool price, excluding the LP fee
+}
+
+// UpdateFromMarket swaps the pending orders that were waiting for the arrival of the new bar
+func (ae *ammExecution) UpdateFromMarket(market model.MarketEvent) error {
+	pendingOrders := ae.pendingOrders
+	ae.pendingOrders = nil
+	for _, order := range pendingOrders {
+		if err := ae.swap(order, market.Timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateFills takes an OrderEvent, swaps it against the pool, and produces a FillEvent that is appended to the
+// event queue
+func (ae *ammExecution) GenerateFills(order model.OrderEvent) error {
+	addOrderUpdate(ae.eventQ, order, order.Timestamp, model.OrderStatusNew, 0.0, "")
+
+	// Swaps execute immediately, so there is no order book for resting orders
+	if order.OrderType != model.OrderTypeMarket {
+		addOrderUpdate(ae.eventQ, order, order.Timestamp, model.OrderStatusCancelled, 0.0,
+			fmt.Sprintf("AMM execution does not support %s orders", order.OrderType))
+		return nil
+	}
+
+	// Protective exits swap on the bar that triggered them - the pool has no order book to honour the exit's Price, so
+	// they swap at that bar's reserves. Other orders not swapped on the current bar wait for the next bar to arrive.
+	if order.Price == 0 && ae.fillTiming != FillTimingClose {
+		ae.pendingOrders = append(ae.pendingOrders, order)
+		return nil
+	}
+	return ae.swap(order, order.Timestamp)
+}
+
+// CancelOrder removes the pending order from the orders waiting for the next bar & appends its CANCELLED
+// OrderUpdateEvent - orders that have already been swapped are left as they are
+func (ae *ammExecution) CancelOrder(cancel model.CancelEvent) error {
+	for index, order := range ae.pendingOrders {
+		if order.OrderId != cancel.OrderId {
+			continue
+		}
+		addOrderUpdate(ae.eventQ, order, cancel.Timestamp, model.OrderStatusCancelled, 0.0, cancel.Reason)
+		ae.pendingOrders = append(ae.pendingOrders[:index:index], ae.pendingOrders[index+1:]...)
+		return nil
+	}
+	return nil
+}
+
+// swap fills the OrderEvent against the pool reserves at the provided timestamp & appends the FillEvent to the queue
+func (ae *ammExecution) swap(order model.OrderEvent, timestamp time.Time) error {
+	baseReserve, quoteReserve, ok := ae.reserves.ReservesAt(timestamp)
+	if !ok {
+		return errors.New(fmt.Sprintf("no pool reserves available for %s at %s", order.Symbol, timestamp))
+	}
+
+	result, err := calculateSwap(order, baseReserve, quoteReserve, ae.poolFee)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to swap order: %+v", order))
+	}
+
+	fill := model.FillEvent{
+		TraceId:    order.TraceId,
+		OrderId:    order.OrderId,
+		Timestamp:  timestamp,
+		Symbol:     order.Symbol,
+		Exchange:   ae.exchange,
+		Quantity:   result.quantity,
+		Decision:   order.Decision,
+		ExitReason: order.ExitReason,
+	}
+	fill.FillValueGross = fill.CalculateFillValueGross(result.spotPrice)
+	fill.FillPrice = result.fillPrice
+	fill.ExchangeFee = result.lpFee
+	fill.SlippageFee = result.priceImpact
+	fill.NetworkFee, err = ae.networkFeeModel.CalculateNetworkFee(fill)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to calculate network fee of order: %+v", order))
+	}
+
+	ae.eventQ.Add(fill)
+	addOrderUpdate(ae.eventQ, order, timestamp, model.OrderStatusFilled, fill.Quantity, "")
+	return nil
+}
+
+// calculateSwap determines the fill of an OrderEvent against a constant-product pool. New LONG positions spend the
+// order's value at the spot price (exact input), so the filled quantity is reduced by the LP fee & price impact. Sells
+// swap exactly the order quantity, and CLOSE_SHORT buys back exactly the order quantity (exact output), so exits
+// always close the whole Position.
+func calculateSwap(order model.OrderEvent, baseReserve float64, quoteReserve float64, poolFee float64) (swapResult, error) {
+	if baseReserve <= 0 || quoteReserve <= 0 {
+		return swapResult{}, errors.New("pool reserves must be positive")
+	}
+	spotPrice := quoteReserve / baseReserve
+	quantity := math.Abs(order.Quantity)
+
+	result := swapResult{spotPrice: spotPrice}
+	switch {
+	case order.Decision == model.DecisionLong:
+		// Exact quote input -> base output
+		quoteIn := quantity * spotPrice
+		quoteInAfterFee := quoteIn * (1 - poolFee)
+		baseOut := quoteInAfterFee * baseReserve / (quoteReserve + quoteInAfterFee)
+		result.quantity = baseOut
+		result.fillPrice = quoteIn / baseOut
+		result.lpFee = quoteIn * poolFee
+		result.priceImpact = quoteIn - result.lpFee - baseOut*spotPrice
+
+	case order.Decision == model.DecisionCloseShort:
+		// Exact base output <- quote input
+		if quantity >= baseReserve {
+			return swapResult{}, errors.New(fmt.Sprintf("order quantity %v exceeds base reserve %v", quantity, baseReserve))
+		}
+		quoteInAfterFee := quoteReserve * quantity / (baseReserve - quantity)
+		quoteIn := quoteInAfterFee / (1 - poolFee)
+		result.quantity = quantity
+		result.fillPrice = quoteIn / quantity
+		result.lpFee = quoteIn * poolFee
+		result.priceImpact = quoteInAfterFee - quantity*spotPrice
+
+	default:
+		// SHORT & CLOSE_LONG: exact base input -> quote output
+		baseInAfterFee := quantity * (1 - poolFee)
+		quoteOut := baseInAfterFee * quoteReserve / (baseReserve + baseInAfterFee)
+		result.quantity = -quantity
+		result.fillPrice = quoteOut / quantity
+		result.lpFee = quantity * poolFee * spotPrice
+		result.priceImpact = quantity*spotPrice - result.lpFee - quoteOut
+	}
+
+	return result, nil
+}
+
+// parsePoolFee returns the LP fee configured for the exchange in an AMM_POOLS specification in the format
+// "exchange=lpFee;exchange=lpFee", eg/ "uniswap=0.003", and false if the exchange is not an AMM
+func parsePoolFee(specification string, exchange string) (float64, bool, error) {
+	for _, exchangeSpecification := range strings.Split(specification, ";") {
+		exchangeSpecification = strings.TrimSpace(exchangeSpecification)
+		if exchangeSpecification == "" {
+			continue
+		}
+
+		nameAndFee := strings.SplitN(exchangeSpecification, "=", 2)
+		if len(nameAndFee) != 2 {
+			return 0.0, false, errors.New(fmt.Sprintf("failed to parse AMM pool specification %s", exchangeSpecification))
+		}
+		if !strings.EqualFold(strings.TrimSpace(nameAndFee[0]), exchange) {
+			continue
+		}
+
+		poolFee, err := strconv.ParseFloat(strings.TrimSpace(nameAndFee[1]), 64)
+		if err != nil {
+			return 0.0, false, errors.Wrap(err, fmt.Sprintf("failed to parse AMM pool fee %s", nameAndFee[1]))
+		}
+		if poolFee < 0 || poolFee >= 1 {
+			return 0.0, false, errors.New(fmt.Sprintf("AMM pool fee %v must be in the range [0, 1)", poolFee))
+		}
+		return poolFee, true, nil
+	}
+	return 0.0, false, nil
+}
+
+// NewAMMExecution constructs an Execution instance that swaps against the symbol's historical pool reserves
+func NewAMMExecution(cfg config.Trader, eventQ *queue.Queue, poolFee float64) (*ammExecution, error) {
+	// Pool reserves are snapshots rather than OHLC bars, so there is no intra-bar path to approximate a VWAP from
+	switch cfg.FillTiming {
+	case FillTimingClose, FillTimingNextOpen:
+	case FillTimingNextVWAP:
+		return &ammExecution{}, errors.New(fmt.Sprintf("fill timing %s is not supported by AMM exchanges", cfg.FillTiming))
+	default:
+		return &ammExecution{}, errors.New(fmt.Sprintf("unsupported fill timing %s", cfg.FillTiming))
+	}
+
+	reserves, err := data.LoadCSVPoolReserves(cfg.Symbol, cfg.Timeframe)
+	if err != nil {
+		return &ammExecution{}, errors.Wrap(err, "failed to load pool reserves")
+	}
+
+	networkFeeModel, err := NewNetworkFeeModel(cfg.NetworkFees, cfg.Exchange, cfg.Timeframe, cfg.CSVSchemas)
+	if err != nil {
+		return &ammExecution{}, errors.Wrap(err, "failed to init network fee model")
+	}
+
+	return &ammExecution{
+		log:             cfg.Log,
+		eventQ:          eventQ,
+		exchange:        cfg.Exchange,
+		poolFee:         poolFee,
+		reserves:        reserves,
+		networkFeeModel: networkFeeModel,
+		fillTiming:      cfg.FillTiming,
+	}, nil
+}
+
+// NewExecution constructs the Execution instance for the trader's exchange - exchanges configured in AMM_POOLS swap
+// against a constant-product pool, all other exchanges use the simulated order book execution charging the exchange's
+// fee model from feeModels
+func NewExecution(cfg config.Trader, eventQ *queue.Queue, data data.Handler, feeModels FeeModels) (Execution, error) {
+	poolFee, isAMM, err := parsePoolFee(cfg.AMMPools, cfg.Exchange)
+	if err != nil {
+		return nil, err
+	}
+	if isAMM {
+		return NewAMMExecution(cfg, eventQ, poolFee)
+	}
+	return NewSimulatedExecution(cfg, eventQ, data, feeModels)
+}
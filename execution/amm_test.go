@@ -0,0 +1,204 @@
+package execution
+
+import (
+	"github.com/eapache/queue"
+	"github.com/google/go-cmp/cmp"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCalculateSwap(t *testing.T) {
+	baseReserve, quoteReserve, poolFee := 1000.0, 1000000.0, 0.003 // Spot price 1000
+
+	testCases := []struct {
+		name     string
+		order    model.OrderEvent
+		expected swapResult
+	}{
+		{
+			name:  "TestCalculateSwap_longExactInput",
+			order: model.OrderEvent{Decision: model.DecisionLong, Quantity: 10},
+			expected: swapResult{
+				quantity:    9.871580343970614, // 9970 * 1000 / (1000000 + 9970)
+				spotPrice:   1000,
+				fillPrice:   1013.0090270812436, // 10000 / 9.871580343970614
+				lpFee:       30,
+				priceImpact: 98.41965602938622,
+			},
+		},
+		{
+			name:  "TestCalculateSwap_closeLongExactInput",
+			order: model.OrderEvent{Decision: model.DecisionCloseLong, Quantity: -10},
+			expected: swapResult{
+				quantity:    -10,
+				spotPrice:   1000,
+				fillPrice:   987.1580343970612, // 9.97 * 1000000 / (1000 + 9.97) / 10
+				lpFee:       30,
+				priceImpact: 98.41965602938776,
+			},
+		},
+		{
+			name:  "TestCalculateSwap_closeShortExactOutput",
+			order: model.OrderEvent{Decision: model.DecisionCloseShort, Quantity: 10},
+			expected: swapResult{
+				quantity:    10,
+				spotPrice:   1000,
+				fillPrice:   1013.1404313951956, // (10 * 1000000 / 990) / 0.997 / 10
+				lpFee:       30.39421294185587,
+				priceImpact: 101.0101010101007,
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := calculateSwap(testCase.order, baseReserve, quoteReserve, poolFee)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, values := range [][2]float64{
+				{testCase.expected.quantity, actual.quantity},
+				{testCase.expected.spotPrice, actual.spotPrice},
+				{testCase.expected.fillPrice, actual.fillPrice},
+				{testCase.expected.lpFee, actual.lpFee},
+				{testCase.expected.priceImpact, actual.priceImpact},
+			} {
+				if math.Abs(values[0]-values[1]) > 1e-6 {
+					t.Fatalf("expected %+v, got %+v", testCase.expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePoolFee(t *testing.T) {
+	testCases := []struct {
+		name          string
+		specification string
+		expected      float64
+		expectedAMM   bool
+		expectedError bool
+	}{
+		{
+			name:          "TestParsePoolFee_configured",
+			specification: "sushiswap=0.0025;uniswap=0.003",
+			expected:      0.003,
+			expectedAMM:   true,
+		},
+		{
+			name:          "TestParsePoolFee_notConfigured",
+			specification: "sushiswap=0.0025",
+		},
+		{
+			name:          "TestParsePoolFee_zero",
+			specification: "uniswap=0",
+			expectedAMM:   true,
+		},
+		{
+			name:          "TestParsePoolFee_negative",
+			specification: "uniswap=-0.003",
+			expectedError: true,
+		},
+		{
+			name:          "TestParsePoolFee_one",
+			specification: "uniswap=1",
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, isAMM, err := parsePoolFee(testCase.specification, "uniswap")
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if actual != testCase.expected || isAMM != testCase.expectedAMM {
+				t.Fatalf("expected %v %v, got %v %v", testCase.expected, testCase.expectedAMM, actual, isAMM)
+			}
+		})
+	}
+}
+
+func TestNewAMMExecution_nextVWAP(t *testing.T) {
+	cfg := config.Trader{Symbol: "ETH-USD", Timeframe: "1d", Exchange: "uniswap", FillTiming: FillTimingNextVWAP}
+	if _, err := NewAMMExecution(cfg, queue.New(), 0.003); err == nil {
+		t.Fatal("expected an error for NEXT_VWAP fill timing")
+	}
+}
+
+func TestAMMExecution_GenerateFills(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	reserves := model.PoolReserves{
+		Timestamps:    []time.Time{testTimestamp, testTimestamp.Add(24 * time.Hour)},
+		BaseReserves:  []float64{1000, 1000},
+		QuoteReserves: []float64{1000000, 900000},
+	}
+
+	testCases := []struct {
+		name             string
+		order            model.OrderEvent
+		expectedStatuses []string
+		expectedFills    int
+		expectedPending  int
+	}{
+		{
+			name:             "TestAMMExecution_GenerateFills_nextOpenEntryPending",
+			order:            model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: 1, Decision: model.DecisionLong},
+			expectedStatuses: []string{model.OrderStatusNew},
+			expectedPending:  1,
+		},
+		{
+			name: "TestAMMExecution_GenerateFills_protectiveExitTriggeringBar",
+			order: model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: -1, Decision: model.DecisionCloseLong,
+				Price: 950, ExitReason: model.ExitReasonStopLoss},
+			expectedStatuses: []string{model.OrderStatusNew, model.OrderStatusFilled},
+			expectedFills:    1,
+		},
+		{
+			name: "TestAMMExecution_GenerateFills_unsupportedLimit",
+			order: model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: 1, Decision: model.DecisionLong,
+				Price: 990},
+			expectedStatuses: []string{model.OrderStatusNew, model.OrderStatusCancelled},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			eventQ := queue.New()
+			ae := &ammExecution{eventQ: eventQ, exchange: "uniswap", poolFee: 0.003, reserves: reserves,
+				networkFeeModel: &NoNetworkFee{}, fillTiming: FillTimingNextOpen}
+			order := testCase.order
+			order.Timestamp = testTimestamp
+			order.Symbol = "ETH-USD"
+
+			if err := ae.GenerateFills(order); err != nil {
+				t.Fatal(err)
+			}
+
+			var statuses []string
+			var fills []model.FillEvent
+			for eventQ.Length() > 0 {
+				switch event := eventQ.Remove().(type) {
+				case model.OrderUpdateEvent:
+					statuses = append(statuses, event.Status)
+				case model.FillEvent:
+					fills = append(fills, event)
+				}
+			}
+			if diff := cmp.Diff(testCase.expectedStatuses, statuses); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+			if len(fills) != testCase.expectedFills || len(ae.pendingOrders) != testCase.expectedPending {
+				t.Fatalf("expected %v fills & %v pending orders, got %v & %v", testCase.expectedFills,
+					testCase.expectedPending, len(fills), len(ae.pendingOrders))
+			}
+			// Exits swap at the triggering bar's reserves rather than the next bar's
+			for _, fill := range fills {
+				if !fill.Timestamp.Equal(testTimestamp) || fill.FillValueGross != 1000 {
+					t.Fatalf("expected a fill of value 1000 at %s, got %+v", testTimestamp, fill)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package execution
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExchangeBinance = "binance"
+
+	binanceRecvWindow = "5000" // Milliseconds a signed request remains valid for after its timestamp
+)
+
+// binanceOrderTypes maps OrderTypes to the Binance spot order types
+var binanceOrderTypes = map[string]string{
+	model.OrderTypeMarket:    "MARKET",
+	model.OrderTypeLimit:     "LIMIT",
+	model.OrderTypeStop:      "STOP_LOSS",
+	model.OrderTypeStopLimit: "STOP_LOSS_LIMIT",
+}
+
+// binanceOrderStatuses maps the Binance order statuses to OrderStatuses
+var binanceOrderStatuses = map[string]string{
+	"NEW":              model.OrderStatusNew,
+	"PENDING_CANCEL":   model.OrderStatusNew,
+	"PARTIALLY_FILLED": model.OrderStatusPartiallyFilled,
+	"FILLED":           model.OrderStatusFilled,
+	"CANCELED":         model.OrderStatusCancelled,
+	"REJECTED":         model.OrderStatusCancelled,
+	"EXPIRED":          model.OrderStatusExpired,
+}
+
+// binanceOrder is an order returned by the Binance order endpoints, numbers are encoded as strings
+type binanceOrder struct {
+	Symbol              string `json:"symbol"`
+	OrderId             int64  `json:"orderId"`
+	ClientOrderId       string `json:"clientOrderId"`
+	TransactTime        int64  `json:"transactTime"`
+	UpdateTime          int64  `json:"updateTime"`
+	ExecutedQty         string `json:"executedQty"`
+	CummulativeQuoteQty string `json:"cummulativeQuoteQty"`
+	Status              string `json:"status"`
+}
+
+// binanceAccount is the account returned by the Binance account endpoint
+type binanceAccount struct {
+	Balances []struct {
+		Asset  string `json:"asset"`
+		Free   string `json:"free"`
+		Locked string `json:"locked"`
+	} `json:"balances"`
+}
+
+// binanceError is the body of a failed Binance request
+type binanceError struct {
+	Code    int    `json:"code"`
+	Message string `json:"msg"`
+}
+
+// binanceClient is an ExchangeClient for the Binance spot REST API, or any exchange implementing the same API.
+// Requests are signed with an HMAC-SHA256 of their query string keyed by the API secret.
+type binanceClient struct {
+	client    *http.Client
+	baseURL   string
+	apiKey    string
+	apiSecret string
+	now       func() time.Time
+}
+
+// PlaceOrder places an order, returning its state once the exchange has processed it
+func (bc *binanceClient) PlaceOrder(ctx context.Context, request ExchangeOrderRequest) (ExchangeOrder, error) {
+	orderType, isSupported := binanceOrderTypes[request.OrderType]
+	if !isSupported {
+		return ExchangeOrder{}, errors.New(fmt.Sprintf("unsupported order type %s", request.OrderType))
+	}
+
+	params := url.Values{}
+	params.Set("symbol", data.BinanceSymbol(request.Symbol))
+	params.Set("side", request.Side)
+	params.Set("type", orderType)
+	params.Set("quantity", formatDecimal(request.Quantity))
+	params.Set("newClientOrderId", request.ClientOrderId)
+	params.Set("newOrderRespType", "RESULT")
+	if request.OrderType == model.OrderTypeLimit || request.OrderType == model.OrderTypeStopLimit {
+		params.Set("price", formatDecimal(request.Price))
+		params.Set("timeInForce", request.TimeInForce)
+	}
+	if request.OrderType == model.OrderTypeStop || request.OrderType == model.OrderTypeStopLimit {
+		params.Set("stopPrice", formatDecimal(request.StopPrice))
+	}
+
+	var order binanceOrder
+	if err := bc.do(ctx, http.MethodPost, "/api/v3/order", params, &order); err != nil {
+		return ExchangeOrder{}, errors.Wrap(err, fmt.Sprintf("failed to place order %s", request.ClientOrderId))
+	}
+	return order.toExchangeOrder(request.Symbol)
+}
+
+// CancelOrder cancels an open order, returning its final state
+func (bc *binanceClient) CancelOrder(ctx context.Context, symbol string, clientOrderId string) (ExchangeOrder, error) {
+	params := url.Values{}
+	params.Set("symbol", data.BinanceSymbol(symbol))
+	params.Set("origClientOrderId", clientOrderId)
+
+	var order binanceOrder
+	if err := bc.do(ctx, http.MethodDelete, "/api/v3/order", params, &order); err != nil {
+		return ExchangeOrder{}, errors.Wrap(err, fmt.Sprintf("failed to cancel order %s", clientOrderId))
+	}
+	return order.toExchangeOrder(symbol)
+}
+
+// GetOrder returns the current state of an order
+func (bc *binanceClient) GetOrder(ctx context.Context, symbol string, clientOrderId string) (ExchangeOrder, error) {
+	params := url.Values{}
+	params.Set("symbol", data.BinanceSymbol(symbol))
+	params.Set("origClientOrderId", clientOrderId)
+
+	var order binanceOrder
+	if err := bc.do(ctx, http.MethodGet, "/api/v3/order", params, &order); err != nil {
+		return ExchangeOrder{}, errors.Wrap(err, fmt.Sprintf("failed to get order %s", clientOrderId))
+	}
+	return order.toExchangeOrder(symbol)
+}
+
+// GetBalances returns the free & locked amount of every asset held in the account
+func (bc *binanceClient) GetBalances(ctx context.Context) (map[string]Balance, error) {
+	var account binanceAccount
+	if err := bc.do(ctx, http.MethodGet, "/api/v3/account", url.Values{}, &account); err != nil {
+		return nil, errors.Wrap(err, "failed to get account balances")
+	}
+
+	balances := make(map[string]Balance)
+	for _, balance := range account.Balances {
+		free, err := strconv.ParseFloat(balance.Free, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse free balance of %s", balance.Asset))
+		}
+		locked, err := strconv.ParseFloat(balance.Locked, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse locked balance of %s", balance.Asset))
+		}
+		balances[balance.Asset] = Balance{Free: free, Locked: locked}
+	}
+	return balances, nil
+}
+
+// do sends a signed request & decodes the JSON response into result
+func (bc *binanceClient) do(ctx context.Context, method string, path string, params url.Values, result interface{}) error {
+	params.Set("timestamp", strconv.FormatInt(bc.now().UnixNano()/int64(time.Millisecond), 10))
+	params.Set("recvWindow", binanceRecvWindow)
+	query := params.Encode()
+	query += "&signature=" + sign(query, bc.apiSecret)
+
+	request, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s%s?%s", bc.baseURL, path, query), nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to build request")
+	}
+	request.Header.Set("X-MBX-APIKEY", bc.apiKey)
+
+	response, err := bc.client.Do(request)
+	if err != nil {
+		return errors.Wrap(err, "failed to send request")
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response")
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var apiError binanceError
+		if json.Unmarshal(body, &apiError) == nil && apiError.Message != "" {
+			return errors.New(fmt.Sprintf("exchange error %v: %s", apiError.Code, apiError.Message))
+		}
+		return errors.New(fmt.Sprintf("exchange responded with status %s", response.Status))
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return errors.Wrap(err, "failed to decode response")
+	}
+	return nil
+}
+
+// toExchangeOrder converts a Binance order into an ExchangeOrder of the trader's symbol
+func (bo binanceOrder) toExchangeOrder(symbol string) (ExchangeOrder, error) {
+	status, isSupported := binanceOrderStatuses[bo.Status]
+	if !isSupported {
+		return ExchangeOrder{}, errors.New(fmt.Sprintf("unsupported order status %s", bo.Status))
+	}
+	executedQuantity, err := strconv.ParseFloat(bo.ExecutedQty, 64)
+	if err != nil {
+		return ExchangeOrder{}, errors.Wrap(err, "failed to parse executed quantity")
+	}
+	executedValue, err := strconv.ParseFloat(bo.CummulativeQuoteQty, 64)
+	if err != nil {
+		return ExchangeOrder{}, errors.Wrap(err, "failed to parse executed value")
+	}
+
+	// New orders report their TransactTime, existing orders their UpdateTime
+	updateTime := bo.UpdateTime
+	if updateTime == 0 {
+		updateTime = bo.TransactTime
+	}
+
+	return ExchangeOrder{
+		ClientOrderId:    bo.ClientOrderId,
+		ExchangeOrderId:  strconv.FormatInt(bo.OrderId, 10),
+		Symbol:           symbol,
+		Status:           status,
+		ExecutedQuantity: executedQuantity,
+		ExecutedValue:    executedValue,
+		UpdateTimestamp:  time.Unix(0, updateTime*int64(time.Millisecond)).UTC(),
+	}, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 signature of a query string
+func sign(query string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(query))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// formatDecimal formats a float without an exponent
+func formatDecimal(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// NewBinanceClient constructs an ExchangeClient for the Binance-style REST API at the provided base URL
+func NewBinanceClient(baseURL string, apiKey string, apiSecret string) *binanceClient {
+	return &binanceClient{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		now:       time.Now,
+	}
+}
@@ -0,0 +1,90 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBinanceClient(t *testing.T) {
+	const apiKey, apiSecret = "key", "secret"
+
+	// Mock exchange verifying the API key & HMAC signature of every request
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.RawQuery
+		index := strings.LastIndex(query, "&signature=")
+		if r.Header.Get("X-MBX-APIKEY") != apiKey || index < 0 || query[index+len("&signature="):] != sign(query[:index], apiSecret) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"code":-1022,"msg":"Signature for this request is not valid."}`)
+			return
+		}
+		requests = append(requests, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, r.URL.Query().Get("type")))
+
+		switch {
+		case r.URL.Path == "/api/v3/account":
+			fmt.Fprint(w, `{"balances":[{"asset":"ETH","free":"1.5","locked":"0.25"}]}`)
+		case r.URL.Query().Get("quantity") == "1000":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"code":-2010,"msg":"Account has insufficient balance for requested action."}`)
+		default:
+			fmt.Fprintf(w, `{"symbol":"%s","orderId":42,"clientOrderId":"%s","transactTime":1609459200000,`+
+				`"executedQty":"0.5","cummulativeQuoteQty":"370.25","status":"PARTIALLY_FILLED"}`,
+				r.URL.Query().Get("symbol"), r.URL.Query().Get("newClientOrderId")+r.URL.Query().Get("origClientOrderId"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewBinanceClient(server.URL, apiKey, apiSecret)
+	ctx := context.Background()
+
+	order, err := client.PlaceOrder(ctx, ExchangeOrderRequest{ClientOrderId: "order-1", Symbol: "ETH-USDT", Side: SideBuy,
+		OrderType: model.OrderTypeLimit, Quantity: 1, Price: 740.5, TimeInForce: model.TimeInForceGTC})
+	if err != nil {
+		t.Fatalf("unexpected error placing order: %s", err)
+	}
+	expected := ExchangeOrder{ClientOrderId: "order-1", ExchangeOrderId: "42", Symbol: "ETH-USDT",
+		Status: model.OrderStatusPartiallyFilled, ExecutedQuantity: 0.5, ExecutedValue: 370.25,
+		UpdateTimestamp: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if order != expected {
+		t.Errorf("expected order %+v, got: %+v", expected, order)
+	}
+
+	if _, err := client.GetOrder(ctx, "ETH-USDT", "order-1"); err != nil {
+		t.Errorf("unexpected error getting order: %s", err)
+	}
+	if _, err := client.CancelOrder(ctx, "ETH-USDT", "order-1"); err != nil {
+		t.Errorf("unexpected error cancelling order: %s", err)
+	}
+
+	balances, err := client.GetBalances(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting balances: %s", err)
+	}
+	if balances["ETH"] != (Balance{Free: 1.5, Locked: 0.25}) {
+		t.Errorf("expected ETH balance {1.5 0.25}, got: %+v", balances["ETH"])
+	}
+
+	_, err = client.PlaceOrder(ctx, ExchangeOrderRequest{ClientOrderId: "order-2", Symbol: "ETH-USDT", Side: SideBuy,
+		OrderType: model.OrderTypeMarket, Quantity: 1000})
+	if err == nil || !strings.Contains(err.Error(), "insufficient balance") {
+		t.Errorf("expected the exchange error, got: %v", err)
+	}
+
+	_, err = NewBinanceClient(server.URL, apiKey, "wrong").GetBalances(ctx)
+	if err == nil || !strings.Contains(err.Error(), "Signature") {
+		t.Errorf("expected a signature error, got: %v", err)
+	}
+
+	expectedRequests := []string{"POST /api/v3/order LIMIT", "GET /api/v3/order ", "DELETE /api/v3/order ", "GET /api/v3/account "}
+	for index, expectedRequest := range expectedRequests {
+		if requests[index] != expectedRequest {
+			t.Errorf("expected request %s, got: %s", expectedRequest, requests[index])
+		}
+	}
+}
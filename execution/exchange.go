@@ -0,0 +1,64 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"time"
+)
+
+const (
+	SideBuy  = "BUY"
+	SideSell = "SELL"
+)
+
+// ExchangeClient places & manages orders on a live exchange, orders are identified by the ClientOrderId assigned to
+// them when placed
+type ExchangeClient interface {
+	PlaceOrder(ctx context.Context, request ExchangeOrderRequest) (ExchangeOrder, error)
+	CancelOrder(ctx context.Context, symbol string, clientOrderId string) (ExchangeOrder, error)
+	GetOrder(ctx context.Context, symbol string, clientOrderId string) (ExchangeOrder, error)
+	GetBalances(ctx context.Context) (map[string]Balance, error)
+}
+
+// ExchangeOrderRequest is an order to place on a live exchange
+type ExchangeOrderRequest struct {
+	ClientOrderId string
+	Symbol        string
+	Side          string  // BUY or SELL
+	OrderType     string  // MARKET, LIMIT, STOP or STOP_LIMIT
+	Quantity      float64 // Absolute Quantity to buy or sell
+	Price         float64 // Limit price of LIMIT & STOP_LIMIT orders
+	StopPrice     float64 // Trigger price of STOP & STOP_LIMIT orders
+	TimeInForce   string  // GTC, IOC or FOK
+}
+
+// ExchangeOrder is the state of an order on a live exchange
+type ExchangeOrder struct {
+	ClientOrderId    string
+	ExchangeOrderId  string
+	Symbol           string
+	Status           string    // NEW, PARTIALLY_FILLED, FILLED, CANCELLED or EXPIRED
+	ExecutedQuantity float64   // Absolute Quantity filled to date
+	ExecutedValue    float64   // Quote value of the Quantity filled to date
+	UpdateTimestamp  time.Time // Time of the latest change to the order
+}
+
+// Balance is the amount of an asset held on a live exchange
+type Balance struct {
+	Free   float64
+	Locked float64
+}
+
+// NewExchangeClient constructs the ExchangeClient adapter for the trader's exchange
+func NewExchangeClient(cfg config.Trader) (ExchangeClient, error) {
+	if cfg.ExchangeAPIKey == "" || cfg.ExchangeAPISecret == "" {
+		return nil, errors.New(fmt.Sprintf("EXCHANGE_API_KEY & EXCHANGE_API_SECRET are required to trade %s live", cfg.Exchange))
+	}
+	switch cfg.Exchange {
+	case ExchangeBinance:
+		return NewBinanceClient(cfg.ExchangeAPIURL, cfg.ExchangeAPIKey, cfg.ExchangeAPISecret), nil
+	}
+	return nil, errors.New(fmt.Sprintf("no live exchange adapter for %s", cfg.Exchange))
+}
@@ -1,50 +1,296 @@
 package execution
 
 import (
+	"fmt"
 	"github.com/eapache/queue"
+	"github.com/pkg/errors"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
 	"go.uber.org/zap"
+	"math"
 	"time"
 )
 
+const (
+	FillTimingClose    = "CLOSE"     // Fill at the close of the bar the order was generated on (legacy, look-ahead bias)
+	FillTimingNextOpen = "NEXT_OPEN" // Fill at the open of the bar following the order
+	FillTimingNextVWAP = "NEXT_VWAP" // Fill at the VWAP of the bar following the order, approximated from its OHLC
+)
+
 type Execution interface {
+	UpdateFromMarket(model.MarketEvent) error
 	GenerateFills(model.OrderEvent) error
+	CancelOrder(model.CancelEvent) error
 }
 
 type simulatedExecution struct {
-	log      *zap.Logger
-	eventQ   *queue.Queue
-	exchange string
+	log               *zap.Logger
+	eventQ            *queue.Queue
+	data              data.Handler
+	exchange          string
+	feeModel          FeeModel
+	slippageModel     SlippageModel
+	networkFeeModel   NetworkFeeModel
+	fillTiming        string
+	maxVolumeFraction float64         // Fraction of the bar's Volume a fill is capped at, zero disables the cap
+	pendingOrders     []*restingOrder // MARKET orders, or their unfilled remainder, waiting for the next bar
+	restingOrders     []*restingOrder // LIMIT, STOP & STOP_LIMIT orders on the order book
+}
+
+// UpdateFromMarket fills the pending MARKET orders that were waiting for the arrival of the new bar, then matches the
+// resting orders against the new bar's range
+func (se *simulatedExecution) UpdateFromMarket(market model.MarketEvent) error {
+	if len(se.pendingOrders) == 0 && len(se.restingOrders) == 0 {
+		return nil
+	}
+
+	currentData, latestBarIndex := se.data.GetLatestData()
+	latestBar := currentData.GetBar(latestBarIndex)
+
+	// Pending MARKET orders - the remainder of orders first filled at a CLOSE continue to fill at later closes
+	var price float64
+	switch se.fillTiming {
+	case FillTimingClose:
+		price = latestBar.Close
+	case FillTimingNextOpen:
+		price = latestBar.Open
+	case FillTimingNextVWAP:
+		price = (latestBar.Open + latestBar.High + latestBar.Low + latestBar.Close) / 4
+	}
+	var stillPending []*restingOrder
+	for _, pending := range se.pendingOrders {
+		if pending.hasExpired(latestBar.Timestamp) {
+			se.expire(pending, latestBar.Timestamp)
+			continue
+		}
+		isWorking, err := se.work(pending, latestBar, price, LiquidityTaker)
+		if err != nil {
+			return err
+		}
+		if isWorking {
+			stillPending = append(stillPending, pending)
+		}
+	}
+	se.pendingOrders = stillPending
+
+	// Resting orders
+	var stillResting []*restingOrder
+	for _, resting := range se.restingOrders {
+		if resting.hasExpired(latestBar.Timestamp) {
+			se.expire(resting, latestBar.Timestamp)
+			continue
+		}
+
+		if fillPrice, liquidity, filled := resting.match(latestBar); filled {
+			isWorking, err := se.work(resting, latestBar, fillPrice, liquidity)
+			if err != nil {
+				return err
+			}
+			if isWorking {
+				stillResting = append(stillResting, resting)
+			}
+			continue
+		}
+
+		if resting.isImmediate() {
+			se.cancel(resting, latestBar.Timestamp, "not filled on the first bar")
+			continue
+		}
+		stillResting = append(stillResting, resting)
+	}
+	se.restingOrders = stillResting
+
+	return nil
 }
 
 // GenerateFills takes an OrderEvent, executes it, and produces a FillEvent that is appended to the event queue
 func (se *simulatedExecution) GenerateFills(order model.OrderEvent) error {
-	// Todo: Add latency, slippage, etc
+	// Todo: Add latency
+
+	// Acknowledge the order
+	addOrderUpdate(se.eventQ, order, order.Timestamp, model.OrderStatusNew, 0.0, "")
+
+	// Non-MARKET orders rest on the order book until a later bar reaches their price
+	if order.OrderType != model.OrderTypeMarket {
+		se.restingOrders = append(se.restingOrders, &restingOrder{order: order})
+		return nil
+	}
+
+	// Orders not filled on the current bar wait for the next bar to arrive - protective exits were triggered within the
+	// current bar, so they fill on it at their triggered level
+	pending := &restingOrder{order: order}
+	if se.fillTiming != FillTimingClose && order.Price == 0 {
+		se.pendingOrders = append(se.pendingOrders, pending)
+		return nil
+	}
 
 	// Assume all orders are filled at the market price
+	currentData, latestBarIndex := se.data.GetLatestData()
+	price := currentData.Closes[latestBarIndex]
+	if order.Price != 0 {
+		price = order.Price
+	}
+	isWorking, err := se.work(pending, currentData.GetBar(latestBarIndex), price, LiquidityTaker)
+	if err != nil {
+		return err
+	}
+	if isWorking {
+		se.pendingOrders = append(se.pendingOrders, pending)
+	}
+
+	return nil
+}
+
+// CancelOrder removes the pending or resting order from the order book & appends its CANCELLED OrderUpdateEvent -
+// orders that have already completed are left as they are
+func (se *simulatedExecution) CancelOrder(cancel model.CancelEvent) error {
+	var isCancelled bool
+	se.pendingOrders, isCancelled = se.removeOrder(se.pendingOrders, cancel)
+	if !isCancelled {
+		se.restingOrders, _ = se.removeOrder(se.restingOrders, cancel)
+	}
+	return nil
+}
+
+// removeOrder cancels the working order of the CancelEvent, returning the remaining working orders & true if it was
+// found
+func (se *simulatedExecution) removeOrder(working []*restingOrder, cancel model.CancelEvent) ([]*restingOrder, bool) {
+	for index, order := range working {
+		if order.order.OrderId != cancel.OrderId {
+			continue
+		}
+		se.cancel(order, cancel.Timestamp, cancel.Reason)
+		return append(working[:index:index], working[index+1:]...), true
+	}
+	return working, false
+}
+
+// work fills as much of the order as the bar's liquidity allows, returning true if the unfilled remainder should keep
+// working on later bars - IOC & FOK orders are cancelled rather than carried over
+func (se *simulatedExecution) work(working *restingOrder, bar model.Bar, price float64, liquidity string) (bool, error) {
+	isComplete, err := se.fill(working, bar, price, liquidity)
+	if err != nil || isComplete {
+		return false, err
+	}
+	if working.isImmediate() {
+		se.cancel(working, bar.Timestamp, "unfilled Quantity cancelled after the first bar")
+		return false, nil
+	}
+	return true, nil
+}
+
+// fill produces a FillEvent for the order's remaining Quantity, capped at the bar's available liquidity, at the
+// provided reference price & appends it to the event queue, followed by the FILLED or PARTIALLY_FILLED
+// OrderUpdateEvent. Slippage moves the effective FillPrice of orders that take liquidity against them, and is charged
+// as a SlippageFee. Returns true once the order is completely filled.
+func (se *simulatedExecution) fill(working *restingOrder, bar model.Bar, price float64, liquidity string) (bool, error) {
+	order := working.order
+	remainingQuantity := working.remainingQuantity()
+	quantity := se.capQuantity(remainingQuantity, bar)
+	if quantity == 0 {
+		return false, nil
+	}
+	isComplete := math.Abs(quantity) >= math.Abs(remainingQuantity)
+
+	// FOK orders fill their entire Quantity at once, or not at all
+	if order.TimeInForce == model.TimeInForceFOK && !isComplete {
+		return false, nil
+	}
+
 	fill := model.FillEvent{
-		TraceId: order.TraceId,
-		Timestamp: time.Now().Truncate(time.Nanosecond),
-		Symbol:    order.Symbol,
-		Exchange:  se.exchange,
-		Quantity:  order.Quantity,
-		Decision: order.Decision,
-	}
-	fill.ExchangeFee = fill.CalculateExchangeFee() 		 // 0.0
-	fill.SlippageFee = fill.CalculateSlippageFee()		 // 0.0
-	fill.NetworkFee = fill.CalculateNetworkFee()		 // 0.0
-	fill.FillValueGross = fill.CalculateFillValueGross() // 0.0
+		TraceId:    order.TraceId,
+		OrderId:    order.OrderId,
+		Timestamp:  bar.Timestamp,
+		Symbol:     order.Symbol,
+		Exchange:   se.exchange,
+		Quantity:   quantity,
+		Decision:   order.Decision,
+		ExitReason: order.ExitReason,
+	}
+	fill.FillValueGross = fill.CalculateFillValueGross(price)
+	fill.ExchangeFee = se.feeModel.CalculateExchangeFee(fill, liquidity)
+	networkFee, err := se.networkFeeModel.CalculateNetworkFee(fill)
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("failed to calculate network fee of order: %+v", order))
+	}
+	fill.NetworkFee = networkFee
+
+	// Slippage
+	var slippage float64
+	if liquidity == LiquidityTaker {
+		slippage = se.slippageModel.CalculateSlippage(quantity, price, bar)
+	}
+	fill.FillPrice = price + math.Copysign(slippage, quantity)
+	fill.SlippageFee = math.Abs(fill.Quantity) * slippage
 
 	se.eventQ.Add(fill)
-	return nil
+
+	status := model.OrderStatusPartiallyFilled
+	working.filledQuantity += quantity
+	if isComplete {
+		status = model.OrderStatusFilled
+		working.filledQuantity = order.Quantity
+	}
+	addOrderUpdate(se.eventQ, order, bar.Timestamp, status, working.filledQuantity, "")
+
+	return isComplete, nil
 }
 
-// NewSimulatedExecution constructs an Execution instance
-func NewSimulatedExecution(cfg config.Trader, eventQ *queue.Queue) *simulatedExecution {
-	return &simulatedExecution{
-		log:      cfg.Log,
-		eventQ:   eventQ,
-		exchange: cfg.Exchange,
+// capQuantity limits the +ve or -ve quantity to the configured fraction of the bar's Volume
+func (se *simulatedExecution) capQuantity(quantity float64, bar model.Bar) float64 {
+	if se.maxVolumeFraction <= 0 {
+		return quantity
 	}
-}
\ No newline at end of file
+	liquidity := se.maxVolumeFraction * bar.Volume
+	return math.Copysign(math.Min(math.Abs(quantity), liquidity), quantity)
+}
+
+// cancel appends the CANCELLED OrderUpdateEvent of an order that can no longer be filled
+func (se *simulatedExecution) cancel(working *restingOrder, timestamp time.Time, reason string) {
+	addOrderUpdate(se.eventQ, working.order, timestamp, model.OrderStatusCancelled, working.filledQuantity, reason)
+}
+
+// expire appends the EXPIRED OrderUpdateEvent of a GTD order that has passed its ExpireTimestamp
+func (se *simulatedExecution) expire(working *restingOrder, timestamp time.Time) {
+	addOrderUpdate(se.eventQ, working.order, timestamp, model.OrderStatusExpired, working.filledQuantity, "GTD expire timestamp passed")
+}
+
+// NewSimulatedExecution constructs an Execution instance charging the exchange's fee model from feeModels
+func NewSimulatedExecution(cfg config.Trader, eventQ *queue.Queue, data data.Handler, feeModels FeeModels) (*simulatedExecution, error) {
+	switch cfg.FillTiming {
+	case FillTimingClose, FillTimingNextOpen, FillTimingNextVWAP:
+	default:
+		return &simulatedExecution{}, errors.New(fmt.Sprintf("unsupported fill timing %s", cfg.FillTiming))
+	}
+	if cfg.MaxVolumeFraction < 0 {
+		return &simulatedExecution{}, errors.New(fmt.Sprintf("max volume fraction %v cannot be negative", cfg.MaxVolumeFraction))
+	}
+
+	feeModel, err := feeModels.Get(cfg.ExchangeFees, cfg.Exchange)
+	if err != nil {
+		return &simulatedExecution{}, errors.Wrap(err, "failed to init fee model")
+	}
+
+	slippageModel, err := NewSlippageModel(cfg.SlippageModel)
+	if err != nil {
+		return &simulatedExecution{}, errors.Wrap(err, "failed to init slippage model")
+	}
+
+	networkFeeModel, err := NewNetworkFeeModel(cfg.NetworkFees, cfg.Exchange, cfg.Timeframe, cfg.CSVSchemas)
+	if err != nil {
+		return &simulatedExecution{}, errors.Wrap(err, "failed to init network fee model")
+	}
+
+	return &simulatedExecution{
+		log:               cfg.Log,
+		eventQ:            eventQ,
+		data:              data,
+		exchange:          cfg.Exchange,
+		feeModel:          feeModel,
+		slippageModel:     slippageModel,
+		networkFeeModel:   networkFeeModel,
+		fillTiming:        cfg.FillTiming,
+		maxVolumeFraction: cfg.MaxVolumeFraction,
+	}, nil
+}
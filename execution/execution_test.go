@@ -0,0 +1,260 @@
+package execution
+
+import (
+	"github.com/eapache/queue"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"testing"
+)
+
+func TestSimulatedExecution_fill(t *testing.T) {
+	bar := model.Bar{Open: 100, High: 110, Low: 90, Close: 105, Volume: 100}
+
+	testCases := []struct {
+		name              string
+		order             model.OrderEvent
+		maxVolumeFraction float64
+		expectedFills     []float64
+		expectedStatus    string
+	}{
+		{
+			name:              "TestSimulatedExecution_fill_uncapped",
+			order:             model.OrderEvent{Quantity: 50, TimeInForce: model.TimeInForceGTC},
+			maxVolumeFraction: 0,
+			expectedFills:     []float64{50},
+			expectedStatus:    model.OrderStatusFilled,
+		},
+		{
+			name:              "TestSimulatedExecution_fill_cappedRemainderCarriedOver",
+			order:             model.OrderEvent{Quantity: -25, TimeInForce: model.TimeInForceGTC},
+			maxVolumeFraction: 0.1,
+			expectedFills:     []float64{-10, -10, -5},
+			expectedStatus:    model.OrderStatusFilled,
+		},
+		{
+			name:              "TestSimulatedExecution_fill_cappedIOCCancelled",
+			order:             model.OrderEvent{Quantity: 25, TimeInForce: model.TimeInForceIOC},
+			maxVolumeFraction: 0.1,
+			expectedFills:     []float64{10},
+			expectedStatus:    model.OrderStatusCancelled,
+		},
+		{
+			name:              "TestSimulatedExecution_fill_cappedFOKKilled",
+			order:             model.OrderEvent{Quantity: 25, TimeInForce: model.TimeInForceFOK},
+			maxVolumeFraction: 0.1,
+			expectedFills:     nil,
+			expectedStatus:    model.OrderStatusCancelled,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			eventQ := queue.New()
+			se := &simulatedExecution{
+				eventQ:            eventQ,
+				feeModel:          &FlatFee{},
+				slippageModel:     &NoSlippage{},
+				networkFeeModel:   &NoNetworkFee{},
+				maxVolumeFraction: testCase.maxVolumeFraction,
+			}
+
+			working := &restingOrder{order: testCase.order}
+			for {
+				isWorking, err := se.work(working, bar, bar.Open, LiquidityTaker)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !isWorking {
+					break
+				}
+			}
+
+			var fills []float64
+			var status string
+			for eventQ.Length() > 0 {
+				switch event := eventQ.Remove().(type) {
+				case model.FillEvent:
+					fills = append(fills, event.Quantity)
+				case model.OrderUpdateEvent:
+					status = event.Status
+				}
+			}
+
+			if len(fills) != len(testCase.expectedFills) {
+				t.Fatalf("expected fills %v, got %v", testCase.expectedFills, fills)
+			}
+			for index := range fills {
+				if fills[index] != testCase.expectedFills[index] {
+					t.Fatalf("expected fills %v, got %v", testCase.expectedFills, fills)
+				}
+			}
+			if status != testCase.expectedStatus {
+				t.Fatalf("expected status %s, got %s", testCase.expectedStatus, status)
+			}
+		})
+	}
+}
+
+func TestSimulatedExecution_GenerateFills_fillTiming(t *testing.T) {
+	bars := []model.Bar{
+		{Open: 100, High: 110, Low: 90, Close: 105, Volume: 1000},
+		{Open: 106, High: 112, Low: 102, Close: 108, Volume: 1000},
+	}
+
+	testCases := []struct {
+		name                  string
+		fillTiming            string
+		order                 model.OrderEvent
+		expectedImmediateFill bool // Filled on the bar the order was generated on, rather than waiting for the next bar
+		expectedPrice         float64
+	}{
+		{
+			name:                  "TestSimulatedExecution_GenerateFills_fillTiming_close",
+			fillTiming:            FillTimingClose,
+			order:                 model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: 10, Decision: model.DecisionLong},
+			expectedImmediateFill: true,
+			expectedPrice:         105,
+		},
+		{
+			name:          "TestSimulatedExecution_GenerateFills_fillTiming_nextOpen",
+			fillTiming:    FillTimingNextOpen,
+			order:         model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: 10, Decision: model.DecisionLong},
+			expectedPrice: 106,
+		},
+		{
+			name:          "TestSimulatedExecution_GenerateFills_fillTiming_nextVWAP",
+			fillTiming:    FillTimingNextVWAP,
+			order:         model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: 10, Decision: model.DecisionLong},
+			expectedPrice: 107, // (106 + 112 + 102 + 108) / 4
+		},
+		{
+			name:       "TestSimulatedExecution_GenerateFills_fillTiming_nextOpenProtectiveExit",
+			fillTiming: FillTimingNextOpen,
+			order: model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: -10, Decision: model.DecisionCloseLong,
+				Price: 95, ExitReason: model.ExitReasonStopLoss},
+			expectedImmediateFill: true,
+			expectedPrice:         95,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			eventQ := queue.New()
+			handler := newBarHandler(bars)
+			se := &simulatedExecution{
+				eventQ:          eventQ,
+				data:            handler,
+				feeModel:        &FlatFee{},
+				slippageModel:   &NoSlippage{},
+				networkFeeModel: &NoNetworkFee{},
+				fillTiming:      testCase.fillTiming,
+			}
+
+			order := testCase.order
+			order.Timestamp = handler.symbolData.Timestamps[0]
+			order.TimeInForce = model.TimeInForceGTC
+			if err := se.GenerateFills(order); err != nil {
+				t.Fatal(err)
+			}
+			immediateFills := fillEvents(eventQ)
+			if testCase.expectedImmediateFill != (len(immediateFills) == 1) {
+				t.Fatalf("expected immediate fill %v, got %v fills", testCase.expectedImmediateFill, len(immediateFills))
+			}
+
+			handler.UpdateData()
+			if err := se.UpdateFromMarket(model.MarketEvent{Timestamp: handler.symbolData.Timestamps[1]}); err != nil {
+				t.Fatal(err)
+			}
+			fills := append(immediateFills, fillEvents(eventQ)...)
+			if len(fills) != 1 {
+				t.Fatalf("expected 1 fill, got %v", len(fills))
+			}
+
+			expectedTimestamp := handler.symbolData.Timestamps[1]
+			if testCase.expectedImmediateFill {
+				expectedTimestamp = handler.symbolData.Timestamps[0]
+			}
+			if fills[0].FillPrice != testCase.expectedPrice || !fills[0].Timestamp.Equal(expectedTimestamp) {
+				t.Fatalf("expected fill at %v on %s, got %v on %s", testCase.expectedPrice, expectedTimestamp,
+					fills[0].FillPrice, fills[0].Timestamp)
+			}
+		})
+	}
+}
+
+// fillEvents removes every event from the queue, returning the FillEvents
+func fillEvents(eventQ *queue.Queue) []model.FillEvent {
+	var fills []model.FillEvent
+	for eventQ.Length() > 0 {
+		if fill, isFill := eventQ.Remove().(model.FillEvent); isFill {
+			fills = append(fills, fill)
+		}
+	}
+	return fills
+}
+
+func TestSimulatedExecution_CancelOrder(t *testing.T) {
+	bars := []model.Bar{
+		{Open: 100, High: 101, Low: 99, Close: 100, Volume: 100},
+		{Open: 100, High: 111, Low: 89, Close: 100, Volume: 100},
+	}
+
+	testCases := []struct {
+		name             string
+		order            model.OrderEvent
+		expectedStatuses []string
+	}{
+		{
+			name: "TestSimulatedExecution_CancelOrder_restingLimit",
+			order: model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: -10, Price: 110,
+				TimeInForce: model.TimeInForceGTC},
+			expectedStatuses: []string{model.OrderStatusNew, model.OrderStatusCancelled},
+		},
+		{
+			name:             "TestSimulatedExecution_CancelOrder_pendingMarket",
+			order:            model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: 10, TimeInForce: model.TimeInForceGTC},
+			expectedStatuses: []string{model.OrderStatusNew, model.OrderStatusCancelled},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			eventQ := queue.New()
+			handler := newBarHandler(bars)
+			se := &simulatedExecution{
+				eventQ:          eventQ,
+				data:            handler,
+				feeModel:        &FlatFee{},
+				slippageModel:   &NoSlippage{},
+				networkFeeModel: &NoNetworkFee{},
+				fillTiming:      FillTimingNextOpen,
+			}
+
+			order := testCase.order
+			order.OrderId = uuid.New()
+			order.Timestamp = handler.symbolData.Timestamps[0]
+			if err := se.GenerateFills(order); err != nil {
+				t.Fatal(err)
+			}
+			if err := se.CancelOrder(model.CancelEvent{OrderId: order.OrderId, Timestamp: order.Timestamp}); err != nil {
+				t.Fatal(err)
+			}
+			// The cancelled order no longer fills on the next bar, even though the bar reaches its price
+			handler.UpdateData()
+			if err := se.UpdateFromMarket(model.MarketEvent{Timestamp: handler.symbolData.Timestamps[1]}); err != nil {
+				t.Fatal(err)
+			}
+
+			var statuses []string
+			for eventQ.Length() > 0 {
+				switch event := eventQ.Remove().(type) {
+				case model.FillEvent:
+					t.Fatalf("expected no fills, got %+v", event)
+				case model.OrderUpdateEvent:
+					statuses = append(statuses, event.Status)
+				}
+			}
+			if diff := cmp.Diff(testCase.expectedStatuses, statuses); diff != "" {
+				t.Fatalf("statuses (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
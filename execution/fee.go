@@ -0,0 +1,206 @@
+package execution
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FeeModelFlat       = "flat"
+	FeeModelMakerTaker = "maker_taker"
+	FeeModelTiered     = "tiered"
+
+	LiquidityMaker = "MAKER" // Order rested on the order book & added liquidity
+	LiquidityTaker = "TAKER" // Order executed immediately & removed liquidity
+
+	tieredVolumeWindow = 30 * 24 * time.Hour
+)
+
+// FeeModel determines the exchange fee charged on a FillEvent
+type FeeModel interface {
+	CalculateExchangeFee(fill model.FillEvent, liquidity string) float64
+}
+
+// FlatFee charges the same percentage of the FillValueGross on every FillEvent
+type FlatFee struct {
+	Rate float64
+}
+
+// CalculateExchangeFee returns the flat percentage of the FillValueGross
+func (f *FlatFee) CalculateExchangeFee(fill model.FillEvent, liquidity string) float64 {
+	return fill.FillValueGross * f.Rate
+}
+
+// MakerTakerFee charges a different percentage of the FillValueGross for maker & taker FillEvents
+type MakerTakerFee struct {
+	MakerRate float64
+	TakerRate float64
+}
+
+// CalculateExchangeFee returns the maker or taker percentage of the FillValueGross
+func (f *MakerTakerFee) CalculateExchangeFee(fill model.FillEvent, liquidity string) float64 {
+	if liquidity == LiquidityMaker {
+		return fill.FillValueGross * f.MakerRate
+	}
+	return fill.FillValueGross * f.TakerRate
+}
+
+// FeeTier is the maker & taker rates charged once the 30-day traded volume reaches MinVolume
+type FeeTier struct {
+	MinVolume float64
+	MakerRate float64
+	TakerRate float64
+}
+
+// volumeRecord is the value traded by a historic FillEvent
+type volumeRecord struct {
+	timestamp time.Time
+	value     float64
+}
+
+// TieredFee charges maker & taker rates determined by the volume traded over the preceding 30 days
+type TieredFee struct {
+	Tiers   []FeeTier // Ordered by ascending MinVolume
+	history []volumeRecord
+}
+
+// CalculateExchangeFee returns the maker or taker percentage of the FillValueGross for the current volume tier, and
+// records the FillEvent's value towards the 30-day volume of future fills
+func (f *TieredFee) CalculateExchangeFee(fill model.FillEvent, liquidity string) float64 {
+	// Drop fills that are older than the volume window
+	windowStart := fill.Timestamp.Add(-tieredVolumeWindow)
+	for len(f.history) > 0 && !f.history[0].timestamp.After(windowStart) {
+		f.history = f.history[1:]
+	}
+
+	var volume float64
+	for _, record := range f.history {
+		volume += record.value
+	}
+	f.history = append(f.history, volumeRecord{timestamp: fill.Timestamp, value: fill.FillValueGross})
+
+	// Find the highest tier the volume qualifies for
+	var tier FeeTier
+	for _, candidate := range f.Tiers {
+		if volume >= candidate.MinVolume {
+			tier = candidate
+		}
+	}
+
+	if liquidity == LiquidityMaker {
+		return fill.FillValueGross * tier.MakerRate
+	}
+	return fill.FillValueGross * tier.TakerRate
+}
+
+// FeeModels holds the FeeModel of each exchange, shared by the executions of every market of a trader on the exchange
+// so that a TieredFee reaches its tiers on their combined volume
+type FeeModels map[string]FeeModel
+
+// Get returns the FeeModel configured for the exchange, constructing it from the EXCHANGE_FEES specification the first
+// time the exchange is requested
+func (f FeeModels) Get(specification string, exchange string) (FeeModel, error) {
+	key := strings.ToLower(exchange)
+	if feeModel, isConstructed := f[key]; isConstructed {
+		return feeModel, nil
+	}
+
+	feeModel, err := NewFeeModel(specification, exchange)
+	if err != nil {
+		return nil, err
+	}
+	f[key] = feeModel
+	return feeModel, nil
+}
+
+// NewFeeModel constructs the FeeModel configured for the exchange from an EXCHANGE_FEES specification in the format
+// "exchange=model:params;exchange=model:params", eg/ "binance=maker_taker:0.001:0.001;coinbase=flat:0.005" or
+// "kraken=tiered:0:0.0016:0.0026,50000:0.0014:0.0024". Exchanges without a specification are charged no fees.
+func NewFeeModel(specification string, exchange string) (FeeModel, error) {
+	for _, exchangeSpecification := range strings.Split(specification, ";") {
+		exchangeSpecification = strings.TrimSpace(exchangeSpecification)
+		if exchangeSpecification == "" {
+			continue
+		}
+
+		nameAndModel := strings.SplitN(exchangeSpecification, "=", 2)
+		if len(nameAndModel) != 2 {
+			return nil, errors.New(fmt.Sprintf("failed to parse fee model specification %s", exchangeSpecification))
+		}
+		if !strings.EqualFold(strings.TrimSpace(nameAndModel[0]), exchange) {
+			continue
+		}
+
+		feeModel, err := parseFeeModel(strings.TrimSpace(nameAndModel[1]))
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse fee model for exchange %s", exchange))
+		}
+		return feeModel, nil
+	}
+
+	return &FlatFee{Rate: 0.0}, nil
+}
+
+// parseFeeModel parses a single "model:params" fee model specification
+func parseFeeModel(specification string) (FeeModel, error) {
+	modelAndParams := strings.SplitN(specification, ":", 2)
+	if len(modelAndParams) != 2 {
+		return nil, errors.New(fmt.Sprintf("missing parameters in fee model %s", specification))
+	}
+
+	switch modelAndParams[0] {
+	case FeeModelFlat:
+		rates, err := parseRates(modelAndParams[1], 1)
+		if err != nil {
+			return nil, err
+		}
+		return &FlatFee{Rate: rates[0]}, nil
+
+	case FeeModelMakerTaker:
+		rates, err := parseRates(modelAndParams[1], 2)
+		if err != nil {
+			return nil, err
+		}
+		return &MakerTakerFee{MakerRate: rates[0], TakerRate: rates[1]}, nil
+
+	case FeeModelTiered:
+		var tiers []FeeTier
+		for _, tierSpecification := range strings.Split(modelAndParams[1], ",") {
+			rates, err := parseRates(tierSpecification, 3)
+			if err != nil {
+				return nil, err
+			}
+			tiers = append(tiers, FeeTier{MinVolume: rates[0], MakerRate: rates[1], TakerRate: rates[2]})
+		}
+		sort.Slice(tiers, func(i, j int) bool {
+			return tiers[i].MinVolume < tiers[j].MinVolume
+		})
+		return &TieredFee{Tiers: tiers}, nil
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported fee model %s", modelAndParams[0]))
+	}
+}
+
+// parseRates parses a colon separated list of the expected number of floats
+func parseRates(specification string, expected int) ([]float64, error) {
+	fields := strings.Split(specification, ":")
+	if len(fields) != expected {
+		return nil, errors.New(fmt.Sprintf("expected %v values in %s but got %v", expected, specification, len(fields)))
+	}
+
+	rates := make([]float64, 0, expected)
+	for _, field := range fields {
+		rate, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse value %s", field))
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
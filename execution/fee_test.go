@@ -0,0 +1,144 @@
+package execution
+
+import (
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"testing"
+	"time"
+)
+
+func TestNewFeeModel(t *testing.T) {
+	specification := "binance=maker_taker:0.001:0.002;coinbase=flat:0.005;kraken=tiered:1000:0.001:0.002,0:0.003:0.004"
+	fill := model.FillEvent{FillValueGross: 1000}
+
+	testCases := []struct {
+		name      string
+		exchange  string
+		liquidity string
+		expected  float64
+	}{
+		{
+			name:      "TestNewFeeModel_makerTakerMaker",
+			exchange:  "binance",
+			liquidity: LiquidityMaker,
+			expected:  1,
+		},
+		{
+			name:      "TestNewFeeModel_makerTakerTaker",
+			exchange:  "binance",
+			liquidity: LiquidityTaker,
+			expected:  2,
+		},
+		{
+			name:      "TestNewFeeModel_flat",
+			exchange:  "coinbase",
+			liquidity: LiquidityMaker,
+			expected:  5,
+		},
+		{
+			name:      "TestNewFeeModel_tieredLowestTier",
+			exchange:  "kraken",
+			liquidity: LiquidityTaker,
+			expected:  4,
+		},
+		{
+			name:      "TestNewFeeModel_unconfiguredExchange",
+			exchange:  "ftx",
+			liquidity: LiquidityTaker,
+			expected:  0,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			feeModel, err := NewFeeModel(specification, testCase.exchange)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual := feeModel.CalculateExchangeFee(fill, testCase.liquidity); actual != testCase.expected {
+				t.Fatalf("expected fee %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTieredFee_CalculateExchangeFee(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	feeModel := &TieredFee{Tiers: []FeeTier{
+		{MinVolume: 0, MakerRate: 0.01, TakerRate: 0.01},
+		{MinVolume: 1000, MakerRate: 0.001, TakerRate: 0.001},
+	}}
+
+	testCases := []struct {
+		name     string
+		fill     model.FillEvent
+		expected float64
+	}{
+		{
+			name:     "TestTieredFee_CalculateExchangeFee_noHistoricVolume",
+			fill:     model.FillEvent{Timestamp: testTimestamp, FillValueGross: 1000},
+			expected: 10,
+		},
+		{
+			name:     "TestTieredFee_CalculateExchangeFee_volumeQualifiesForNextTier",
+			fill:     model.FillEvent{Timestamp: testTimestamp.Add(24 * time.Hour), FillValueGross: 1000},
+			expected: 1,
+		},
+		{
+			name:     "TestTieredFee_CalculateExchangeFee_volumeExpiredFromWindow",
+			fill:     model.FillEvent{Timestamp: testTimestamp.Add(60 * 24 * time.Hour), FillValueGross: 1000},
+			expected: 10,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := feeModel.CalculateExchangeFee(testCase.fill, LiquidityTaker); actual != testCase.expected {
+				t.Fatalf("expected fee %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFeeModels_Get(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	specification := "kraken=tiered:0:0.01:0.01,1000:0.001:0.001;binance=tiered:0:0.01:0.01,1000:0.001:0.001"
+
+	testCases := []struct {
+		name           string
+		firstExchange  string
+		secondExchange string
+		expectedSecond float64 // Fee of the second market's fill after the first market traded 1000
+	}{
+		{
+			name:           "TestFeeModels_Get_sameExchangeCombinesVolume",
+			firstExchange:  "kraken",
+			secondExchange: "Kraken",
+			expectedSecond: 1,
+		},
+		{
+			name:           "TestFeeModels_Get_otherExchangeSeparateVolume",
+			firstExchange:  "kraken",
+			secondExchange: "binance",
+			expectedSecond: 10,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			feeModels := FeeModels{}
+			first, err := feeModels.Get(specification, testCase.firstExchange)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := feeModels.Get(specification, testCase.secondExchange)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first.CalculateExchangeFee(model.FillEvent{Timestamp: testTimestamp, Symbol: "ETH-USD", FillValueGross: 1000},
+				LiquidityTaker)
+			fill := model.FillEvent{Timestamp: testTimestamp.Add(time.Hour), Symbol: "BTC-USD", FillValueGross: 1000}
+			if actual := second.CalculateExchangeFee(fill, LiquidityTaker); actual != testCase.expectedSecond {
+				t.Fatalf("expected fee %v, got %v", testCase.expectedSecond, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"github.com/eapache/queue"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"math"
+	"time"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Poller is an Execution whose orders are worked on a live exchange, polled on the trader's heartbeat
+type Poller interface {
+	Poll(ctx context.Context) error
+}
+
+// liveOrder is an OrderEvent placed on the exchange & the Quantity & value filled to date
+type liveOrder struct {
+	order          model.OrderEvent
+	filledQuantity float64 // +ve or -ve Quantity filled to date
+	filledValue    float64 // Quote value of the Quantity filled to date
+}
+
+// clientOrderId returns the identifier of the order on the exchange
+func (lo *liveOrder) clientOrderId() string {
+	return lo.order.OrderId.String()
+}
+
+// liveExecution is an Execution placing orders on a live exchange through an ExchangeClient. The exchange's
+// executions are polled & turned into FillEvents, with the ExchangeFee estimated by the configured fee model.
+type liveExecution struct {
+	log        *zap.Logger
+	eventQ     *queue.Queue
+	client     ExchangeClient
+	exchange   string
+	feeModel   FeeModel
+	now        func() time.Time
+	openOrders []*liveOrder
+}
+
+// UpdateFromMarket polls the state of the open orders on the arrival of a new bar
+func (le *liveExecution) UpdateFromMarket(market model.MarketEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := le.Poll(ctx); err != nil {
+		le.log.Warn(fmt.Sprintf("failed to poll open orders: %s", err))
+	}
+	return nil
+}
+
+// GenerateFills places the OrderEvent on the exchange - orders the exchange rejects are CANCELLED, whilst orders the
+// exchange accepts are acknowledged & filled as the exchange executes them
+func (le *liveExecution) GenerateFills(order model.OrderEvent) error {
+	working := &liveOrder{order: order}
+	request := ExchangeOrderRequest{
+		ClientOrderId: working.clientOrderId(),
+		Symbol:        order.Symbol,
+		Side:          SideSell,
+		OrderType:     order.OrderType,
+		Quantity:      math.Abs(order.Quantity),
+		Price:         order.Price,
+		StopPrice:     order.StopPrice,
+		TimeInForce:   order.TimeInForce,
+	}
+	if order.IsBuy() {
+		request.Side = SideBuy
+	}
+	// Exchanges rarely support GTD, so GTD orders are placed as GTC & cancelled once they expire
+	if order.TimeInForce == model.TimeInForceGTD {
+		request.TimeInForce = model.TimeInForceGTC
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	exchangeOrder, err := le.client.PlaceOrder(ctx, request)
+	if err != nil {
+		// A request that failed in transit may still have placed the order
+		var lookupErr error
+		if exchangeOrder, lookupErr = le.client.GetOrder(ctx, order.Symbol, request.ClientOrderId); lookupErr != nil {
+			le.log.Warn(fmt.Sprintf("order %s rejected: %s", request.ClientOrderId, err))
+			addOrderUpdate(le.eventQ, order, le.now(), model.OrderStatusCancelled, 0.0, fmt.Sprintf("rejected by exchange: %s", err))
+			return nil
+		}
+	}
+
+	addOrderUpdate(le.eventQ, order, exchangeOrder.UpdateTimestamp, model.OrderStatusNew, 0.0, "")
+	if le.reconcile(working, exchangeOrder) {
+		le.openOrders = append(le.openOrders, working)
+	}
+	return nil
+}
+
+// CancelOrder cancels the open order on the exchange, producing FillEvents for any Quantity it executed before the
+// cancel & the order's final OrderUpdateEvent
+func (le *liveExecution) CancelOrder(cancel model.CancelEvent) error {
+	for index, working := range le.openOrders {
+		if working.order.OrderId != cancel.OrderId {
+			continue
+		}
+
+		ctx, cancelRequest := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancelRequest()
+		exchangeOrder, err := le.client.CancelOrder(ctx, cancel.Symbol, working.clientOrderId())
+		if err != nil {
+			// The order stays open & is reconciled by the next poll
+			le.log.Warn(fmt.Sprintf("failed to cancel order %s: %s", working.clientOrderId(), err))
+			return nil
+		}
+		if !le.reconcile(working, exchangeOrder) {
+			le.openOrders = append(le.openOrders[:index:index], le.openOrders[index+1:]...)
+		}
+		return nil
+	}
+	return nil
+}
+
+// Poll fetches the state of every open order from the exchange, producing FillEvents for their new executions &
+// cancelling GTD orders that have passed their ExpireTimestamp
+func (le *liveExecution) Poll(ctx context.Context) error {
+	var pollErr error
+	var stillOpen []*liveOrder
+	for _, working := range le.openOrders {
+		order := working.order
+		hasExpired := order.TimeInForce == model.TimeInForceGTD && le.now().After(order.ExpireTimestamp)
+
+		var exchangeOrder ExchangeOrder
+		var err error
+		if hasExpired {
+			exchangeOrder, err = le.client.CancelOrder(ctx, order.Symbol, working.clientOrderId())
+		} else {
+			exchangeOrder, err = le.client.GetOrder(ctx, order.Symbol, working.clientOrderId())
+		}
+		if err != nil {
+			pollErr = err
+			stillOpen = append(stillOpen, working)
+			continue
+		}
+
+		if hasExpired && exchangeOrder.Status == model.OrderStatusCancelled {
+			exchangeOrder.Status = model.OrderStatusExpired
+		}
+		if le.reconcile(working, exchangeOrder) {
+			stillOpen = append(stillOpen, working)
+		}
+	}
+	le.openOrders = stillOpen
+	return pollErr
+}
+
+// reconcile appends a FillEvent for the Quantity the exchange executed since the order was last reconciled, followed
+// by the OrderUpdateEvent of its new status. Returns true whilst the order remains open on the exchange.
+func (le *liveExecution) reconcile(working *liveOrder, exchangeOrder ExchangeOrder) bool {
+	order := working.order
+	executedQuantity := math.Copysign(exchangeOrder.ExecutedQuantity, order.Quantity)
+
+	if quantity := executedQuantity - working.filledQuantity; math.Abs(quantity) > 0 {
+		fill := model.FillEvent{
+			TraceId:    order.TraceId,
+			OrderId:    order.OrderId,
+			Timestamp:  exchangeOrder.UpdateTimestamp,
+			Symbol:     order.Symbol,
+			Exchange:   le.exchange,
+			Quantity:   quantity,
+			Decision:   order.Decision,
+			ExitReason: order.ExitReason,
+		}
+		fill.FillPrice = (exchangeOrder.ExecutedValue - working.filledValue) / math.Abs(quantity)
+		fill.FillValueGross = fill.CalculateFillValueGross(fill.FillPrice)
+		fill.ExchangeFee = le.feeModel.CalculateExchangeFee(fill, liquidityOf(order))
+		le.eventQ.Add(fill)
+
+		working.filledQuantity = executedQuantity
+		working.filledValue = exchangeOrder.ExecutedValue
+		if exchangeOrder.Status != model.OrderStatusFilled {
+			addOrderUpdate(le.eventQ, order, exchangeOrder.UpdateTimestamp, model.OrderStatusPartiallyFilled, working.filledQuantity, "")
+		}
+	}
+
+	switch exchangeOrder.Status {
+	case model.OrderStatusFilled:
+		addOrderUpdate(le.eventQ, order, exchangeOrder.UpdateTimestamp, model.OrderStatusFilled, working.filledQuantity, "")
+		return false
+	case model.OrderStatusCancelled:
+		addOrderUpdate(le.eventQ, order, exchangeOrder.UpdateTimestamp, model.OrderStatusCancelled, working.filledQuantity, "cancelled by exchange")
+		return false
+	case model.OrderStatusExpired:
+		addOrderUpdate(le.eventQ, order, exchangeOrder.UpdateTimestamp, model.OrderStatusExpired, working.filledQuantity, "expired on exchange")
+		return false
+	}
+	return true
+}
+
+// liquidityOf estimates if an order took liquidity - orders with a limit price are assumed to have rested on the book
+func liquidityOf(order model.OrderEvent) string {
+	if order.OrderType == model.OrderTypeLimit || order.OrderType == model.OrderTypeStopLimit {
+		return LiquidityMaker
+	}
+	return LiquidityTaker
+}
+
+// NewLiveExecution constructs an Execution placing orders on a live exchange, querying the account balances to verify
+// the client's credentials
+func NewLiveExecution(cfg config.Trader, eventQ *queue.Queue, client ExchangeClient, feeModels FeeModels) (*liveExecution, error) {
+	feeModel, err := feeModels.Get(cfg.ExchangeFees, cfg.Exchange)
+	if err != nil {
+		return &liveExecution{}, errors.Wrap(err, "failed to init fee model")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	balances, err := client.GetBalances(ctx)
+	if err != nil {
+		return &liveExecution{}, errors.Wrap(err, fmt.Sprintf("failed to query %s balances", cfg.Exchange))
+	}
+	for asset, balance := range balances {
+		if balance.Free > 0 || balance.Locked > 0 {
+			cfg.Log.Info(fmt.Sprintf("%s balance %s: free %v, locked %v", cfg.Exchange, asset, balance.Free, balance.Locked))
+		}
+	}
+
+	return &liveExecution{
+		log:      cfg.Log,
+		eventQ:   eventQ,
+		client:   client,
+		exchange: cfg.Exchange,
+		feeModel: feeModel,
+		now:      time.Now,
+	}, nil
+}
@@ -0,0 +1,129 @@
+package execution
+
+import (
+	"context"
+	"github.com/eapache/queue"
+	"github.com/google/uuid"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// fakeExchange is an ExchangeClient returning a scripted sequence of states for a single order
+type fakeExchange struct {
+	states []ExchangeOrder
+}
+
+func (f *fakeExchange) next() (ExchangeOrder, error) {
+	state := f.states[0]
+	if len(f.states) > 1 {
+		f.states = f.states[1:]
+	}
+	return state, nil
+}
+
+func (f *fakeExchange) PlaceOrder(ctx context.Context, request ExchangeOrderRequest) (ExchangeOrder, error) {
+	return f.next()
+}
+
+func (f *fakeExchange) CancelOrder(ctx context.Context, symbol string, clientOrderId string) (ExchangeOrder, error) {
+	state, err := f.next()
+	state.Status = model.OrderStatusCancelled
+	return state, err
+}
+
+func (f *fakeExchange) GetOrder(ctx context.Context, symbol string, clientOrderId string) (ExchangeOrder, error) {
+	return f.next()
+}
+
+func (f *fakeExchange) GetBalances(ctx context.Context) (map[string]Balance, error) {
+	return map[string]Balance{}, nil
+}
+
+func TestLiveExecution_Poll(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name             string
+		order            model.OrderEvent
+		states           []ExchangeOrder
+		expectedFills    []float64
+		expectedPrices   []float64
+		expectedStatuses []string
+	}{
+		{
+			name:  "TestLiveExecution_Poll_partialThenFilled",
+			order: model.OrderEvent{Quantity: -2, OrderType: model.OrderTypeMarket, TimeInForce: model.TimeInForceGTC},
+			states: []ExchangeOrder{
+				{Status: model.OrderStatusNew},
+				{Status: model.OrderStatusPartiallyFilled, ExecutedQuantity: 0.5, ExecutedValue: 50},
+				{Status: model.OrderStatusFilled, ExecutedQuantity: 2, ExecutedValue: 206},
+			},
+			expectedFills:    []float64{-0.5, -1.5},
+			expectedPrices:   []float64{100, 104},
+			expectedStatuses: []string{model.OrderStatusNew, model.OrderStatusPartiallyFilled, model.OrderStatusFilled},
+		},
+		{
+			name: "TestLiveExecution_Poll_gtdExpired",
+			order: model.OrderEvent{Quantity: 1, OrderType: model.OrderTypeLimit, TimeInForce: model.TimeInForceGTD,
+				ExpireTimestamp: now.Add(-time.Minute)},
+			states: []ExchangeOrder{
+				{Status: model.OrderStatusNew},
+				{Status: model.OrderStatusPartiallyFilled, ExecutedQuantity: 0.25, ExecutedValue: 25},
+			},
+			expectedFills:    []float64{0.25},
+			expectedPrices:   []float64{100},
+			expectedStatuses: []string{model.OrderStatusNew, model.OrderStatusPartiallyFilled, model.OrderStatusExpired},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			eventQ := queue.New()
+			le := &liveExecution{
+				log:      zap.NewNop(),
+				eventQ:   eventQ,
+				client:   &fakeExchange{states: testCase.states},
+				feeModel: &FlatFee{},
+				now:      func() time.Time { return now },
+			}
+
+			testCase.order.OrderId = uuid.New()
+			if err := le.GenerateFills(testCase.order); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for len(le.openOrders) > 0 {
+				if err := le.Poll(context.Background()); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			}
+
+			var fills, prices []float64
+			var statuses []string
+			for eventQ.Length() > 0 {
+				switch e := eventQ.Remove().(type) {
+				case model.FillEvent:
+					fills = append(fills, e.Quantity)
+					prices = append(prices, e.FillPrice)
+				case model.OrderUpdateEvent:
+					statuses = append(statuses, e.Status)
+				}
+			}
+			if len(fills) != len(testCase.expectedFills) || len(statuses) != len(testCase.expectedStatuses) {
+				t.Fatalf("expected fills %v & statuses %v, got: %v & %v", testCase.expectedFills,
+					testCase.expectedStatuses, fills, statuses)
+			}
+			for index := range fills {
+				if fills[index] != testCase.expectedFills[index] || prices[index] != testCase.expectedPrices[index] {
+					t.Errorf("expected fills %v at %v, got: %v at %v", testCase.expectedFills, testCase.expectedPrices,
+						fills, prices)
+				}
+			}
+			for index := range statuses {
+				if statuses[index] != testCase.expectedStatuses[index] {
+					t.Errorf("expected statuses %v, got: %v", testCase.expectedStatuses, statuses)
+				}
+			}
+		})
+	}
+}
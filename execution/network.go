@@ -0,0 +1,104 @@
+package execution
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"strconv"
+	"strings"
+)
+
+const (
+	gweiToNative = 1e-9
+)
+
+// NetworkFeeModel determines the network fee (eg/ DEX gas) charged on a FillEvent
+type NetworkFeeModel interface {
+	CalculateNetworkFee(fill model.FillEvent) (float64, error)
+}
+
+// NoNetworkFee is used for exchanges that do not settle on-chain
+type NoNetworkFee struct{}
+
+// CalculateNetworkFee returns zero network fees
+func (n *NoNetworkFee) CalculateNetworkFee(fill model.FillEvent) (float64, error) {
+	return 0.0, nil
+}
+
+// GasNetworkFee charges the gas cost of a swap, converted to the quote currency with the native token price
+type GasNetworkFee struct {
+	GasUnitsPerSwap float64
+	GasPrices       model.TimeSeries // Gas price in gwei
+	NativePrices    model.TimeSeries // Native token price in the quote currency
+}
+
+// CalculateNetworkFee returns GasUnitsPerSwap * gas price * native token price at the time of the FillEvent, or an
+// error if either series has no value at or before it
+func (g *GasNetworkFee) CalculateNetworkFee(fill model.FillEvent) (float64, error) {
+	gasPrice, ok := g.GasPrices.ValueAt(fill.Timestamp)
+	if !ok {
+		return 0.0, errors.New(fmt.Sprintf("no gas price available at %s", fill.Timestamp))
+	}
+	nativePrice, ok := g.NativePrices.ValueAt(fill.Timestamp)
+	if !ok {
+		return 0.0, errors.New(fmt.Sprintf("no native token price available at %s", fill.Timestamp))
+	}
+	return g.GasUnitsPerSwap * gasPrice * gweiToNative * nativePrice, nil
+}
+
+// NewNetworkFeeModel constructs the NetworkFeeModel configured for the exchange from a NETWORK_FEES specification in
+// the format "exchange=chain:gasUnitsPerSwap:nativeSymbol;...", eg/ "uniswap=ethereum:150000:ETH-USD". The chain's gas
+// prices are loaded from "data/gas/chain.csv" & the native token prices from the nativeSymbol data file of the
+// provided timeframe, read with the exchange's schema from the CSV_SCHEMAS csvSchemas. Exchanges without a
+// specification are charged no network fees.
+func NewNetworkFeeModel(specification string, exchange string, timeframe string, csvSchemas string) (NetworkFeeModel, error) {
+	for _, exchangeSpecification := range strings.Split(specification, ";") {
+		exchangeSpecification = strings.TrimSpace(exchangeSpecification)
+		if exchangeSpecification == "" {
+			continue
+		}
+
+		nameAndModel := strings.SplitN(exchangeSpecification, "=", 2)
+		if len(nameAndModel) != 2 {
+			return nil, errors.New(fmt.Sprintf("failed to parse network fee specification %s", exchangeSpecification))
+		}
+		if !strings.EqualFold(strings.TrimSpace(nameAndModel[0]), exchange) {
+			continue
+		}
+
+		fields := strings.Split(strings.TrimSpace(nameAndModel[1]), ":")
+		if len(fields) != 3 {
+			return nil, errors.New(fmt.Sprintf("expected chain:gasUnitsPerSwap:nativeSymbol in %s", nameAndModel[1]))
+		}
+		chain, nativeSymbol := fields[0], fields[2]
+
+		gasUnitsPerSwap, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse gas units per swap %s", fields[1]))
+		}
+		if gasUnitsPerSwap <= 0 {
+			return nil, errors.New(fmt.Sprintf("gas units per swap %v must be positive", gasUnitsPerSwap))
+		}
+		gasPrices, err := data.LoadCSVGasPriceSeries(chain)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to load gas prices for chain %s", chain))
+		}
+		schema, err := data.CSVSchemaForExchange(csvSchemas, exchange)
+		if err != nil {
+			return nil, err
+		}
+		nativePrices, err := data.LoadCSVCloseSeries(nativeSymbol, timeframe, schema)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to load native token prices for %s", nativeSymbol))
+		}
+
+		return &GasNetworkFee{
+			GasUnitsPerSwap: gasUnitsPerSwap,
+			GasPrices:       gasPrices,
+			NativePrices:    nativePrices,
+		}, nil
+	}
+
+	return &NoNetworkFee{}, nil
+}
@@ -0,0 +1,85 @@
+package execution
+
+import (
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"testing"
+	"time"
+)
+
+func TestGasNetworkFee_CalculateNetworkFee(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	networkFeeModel := &GasNetworkFee{
+		GasUnitsPerSwap: 100000,
+		GasPrices: model.TimeSeries{
+			Timestamps: []time.Time{testTimestamp, testTimestamp.Add(day)},
+			Values:     []float64{50, 100},
+		},
+		NativePrices: model.TimeSeries{
+			Timestamps: []time.Time{testTimestamp, testTimestamp.Add(day)},
+			Values:     []float64{1000, 2000},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		timestamp     time.Time
+		expected      float64
+		expectedError bool
+	}{
+		{
+			name:          "TestGasNetworkFee_CalculateNetworkFee_beforeSeries",
+			timestamp:     testTimestamp.Add(-time.Hour),
+			expectedError: true,
+		},
+		{
+			name:      "TestGasNetworkFee_CalculateNetworkFee_exactTimestamp",
+			timestamp: testTimestamp,
+			expected:  5, // 100000 * 50 gwei * 1e-9 * 1000
+		},
+		{
+			name:      "TestGasNetworkFee_CalculateNetworkFee_betweenTimestamps",
+			timestamp: testTimestamp.Add(time.Hour),
+			expected:  5, // 100000 * 50 gwei * 1e-9 * 1000
+		},
+		{
+			name:      "TestGasNetworkFee_CalculateNetworkFee_afterLastTimestamp",
+			timestamp: testTimestamp.Add(day + time.Hour),
+			expected:  20, // 100000 * 100 gwei * 1e-9 * 2000
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := networkFeeModel.CalculateNetworkFee(model.FillEvent{Timestamp: testCase.timestamp})
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if diff := actual - testCase.expected; diff > 1e-9 || diff < -1e-9 {
+				t.Fatalf("expected network fee %v, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNewNetworkFeeModel_invalidGasUnits(t *testing.T) {
+	testCases := []struct {
+		name          string
+		specification string
+	}{
+		{
+			name:          "TestNewNetworkFeeModel_invalidGasUnits_zero",
+			specification: "uniswap=ethereum:0:ETH-USD",
+		},
+		{
+			name:          "TestNewNetworkFeeModel_invalidGasUnits_negative",
+			specification: "uniswap=ethereum:-150000:ETH-USD",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if _, err := NewNetworkFeeModel(testCase.specification, "uniswap", "1d", ""); err == nil {
+				t.Fatalf("expected an error for %s", testCase.specification)
+			}
+		})
+	}
+}
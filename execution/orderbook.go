@@ -0,0 +1,111 @@
+package execution
+
+import (
+	"github.com/eapache/queue"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"math"
+	"time"
+)
+
+// restingOrder is an OrderEvent waiting on the order book to be matched against new bars - a LIMIT, STOP or
+// STOP_LIMIT order, or the unfilled remainder of a MARKET order
+type restingOrder struct {
+	order          model.OrderEvent
+	triggered      bool    // STOP price has been reached & the order now fills as a MARKET, or rests as a LIMIT for STOP_LIMIT
+	filledQuantity float64 // +ve or -ve Quantity filled to date
+}
+
+// remainingQuantity returns the +ve or -ve Quantity of the order still to be filled
+func (ro *restingOrder) remainingQuantity() float64 {
+	return ro.order.Quantity - ro.filledQuantity
+}
+
+// match determines if the resting order fills against the bar's range, returning the fill price & the liquidity the
+// fill provided. Resting orders fill at their limit or stop price, or at the bar open if the price gapped through it.
+func (ro *restingOrder) match(bar model.Bar) (float64, string, bool) {
+	order := ro.order
+	switch order.OrderType {
+	case model.OrderTypeLimit:
+		return matchLimit(order.IsBuy(), order.Price, bar)
+
+	case model.OrderTypeStop:
+		// The remainder of a triggered STOP is a MARKET order
+		if ro.triggered {
+			return bar.Open, LiquidityTaker, true
+		}
+		triggerPrice, liquidity, triggered := matchStop(order.IsBuy(), order.StopPrice, bar)
+		ro.triggered = triggered
+		return triggerPrice, liquidity, triggered
+
+	case model.OrderTypeStopLimit:
+		if ro.triggered {
+			return matchLimit(order.IsBuy(), order.Price, bar)
+		}
+		triggerPrice, _, triggered := matchStop(order.IsBuy(), order.StopPrice, bar)
+		if !triggered {
+			return 0.0, "", false
+		}
+		ro.triggered = true
+
+		// Fill immediately if the trigger price is within the limit, otherwise rest as a LIMIT from the next bar
+		if (order.IsBuy() && triggerPrice <= order.Price) || (!order.IsBuy() && triggerPrice >= order.Price) {
+			return triggerPrice, LiquidityTaker, true
+		}
+		return 0.0, "", false
+	}
+
+	return 0.0, "", false
+}
+
+// hasExpired determines if a GTD order has passed its ExpireTimestamp by the provided timestamp
+func (ro *restingOrder) hasExpired(timestamp time.Time) bool {
+	return ro.order.TimeInForce == model.TimeInForceGTD && timestamp.After(ro.order.ExpireTimestamp)
+}
+
+// isImmediate determines if the order must be cancelled if it does not fill on the first bar it is matched against
+func (ro *restingOrder) isImmediate() bool {
+	return ro.order.TimeInForce == model.TimeInForceIOC || ro.order.TimeInForce == model.TimeInForceFOK
+}
+
+// matchLimit fills a buy limit if the bar trades at or below the limit price, and a sell limit at or above it. A bar
+// opening through the limit price fills at the open, taking liquidity, whilst a limit reached within the bar fills at
+// the limit price as a resting maker order.
+func matchLimit(isBuy bool, limitPrice float64, bar model.Bar) (float64, string, bool) {
+	if isBuy && bar.Open <= limitPrice {
+		return bar.Open, LiquidityTaker, true
+	}
+	if !isBuy && bar.Open >= limitPrice {
+		return bar.Open, LiquidityTaker, true
+	}
+	if isBuy && bar.Low <= limitPrice {
+		return limitPrice, LiquidityMaker, true
+	}
+	if !isBuy && bar.High >= limitPrice {
+		return limitPrice, LiquidityMaker, true
+	}
+	return 0.0, "", false
+}
+
+// matchStop triggers a buy stop if the bar trades at or above the stop price, and a sell stop at or below it
+func matchStop(isBuy bool, stopPrice float64, bar model.Bar) (float64, string, bool) {
+	if isBuy && bar.High >= stopPrice {
+		return math.Max(bar.Open, stopPrice), LiquidityTaker, true
+	}
+	if !isBuy && bar.Low <= stopPrice {
+		return math.Min(bar.Open, stopPrice), LiquidityTaker, true
+	}
+	return 0.0, "", false
+}
+
+// addOrderUpdate appends an OrderUpdateEvent recording the OrderEvent's status transition to the event queue
+func addOrderUpdate(eventQ *queue.Queue, order model.OrderEvent, timestamp time.Time, status string, filledQuantity float64, reason string) {
+	eventQ.Add(model.OrderUpdateEvent{
+		TraceId:        order.TraceId,
+		OrderId:        order.OrderId,
+		Timestamp:      timestamp,
+		Symbol:         order.Symbol,
+		Status:         status,
+		FilledQuantity: filledQuantity,
+		Reason:         reason,
+	})
+}
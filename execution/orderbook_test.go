@@ -0,0 +1,222 @@
+package execution
+
+import (
+	"github.com/eapache/queue"
+	"github.com/google/go-cmp/cmp"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"testing"
+	"time"
+)
+
+func TestRestingOrder_match(t *testing.T) {
+	bar := model.Bar{Open: 100, High: 110, Low: 90, Close: 105}
+
+	testCases := []struct {
+		name              string
+		order             model.OrderEvent
+		expectedPrice     float64
+		expectedLiquidity string
+		expectedFilled    bool
+	}{
+		{
+			name:              "TestRestingOrder_match_buyLimitReached",
+			order:             model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: 1, Price: 95},
+			expectedPrice:     95,
+			expectedLiquidity: LiquidityMaker,
+			expectedFilled:    true,
+		},
+		{
+			name:              "TestRestingOrder_match_buyLimitGappedThrough",
+			order:             model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: 1, Price: 102},
+			expectedPrice:     100,
+			expectedLiquidity: LiquidityTaker,
+			expectedFilled:    true,
+		},
+		{
+			name:              "TestRestingOrder_match_sellLimitGappedThrough",
+			order:             model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: -1, Price: 98},
+			expectedPrice:     100,
+			expectedLiquidity: LiquidityTaker,
+			expectedFilled:    true,
+		},
+		{
+			name:              "TestRestingOrder_match_sellLimitReached",
+			order:             model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: -1, Price: 108},
+			expectedPrice:     108,
+			expectedLiquidity: LiquidityMaker,
+			expectedFilled:    true,
+		},
+		{
+			name:           "TestRestingOrder_match_sellLimitNotReached",
+			order:          model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: -1, Price: 115},
+			expectedFilled: false,
+		},
+		{
+			name:              "TestRestingOrder_match_sellStopTriggered",
+			order:             model.OrderEvent{OrderType: model.OrderTypeStop, Quantity: -1, StopPrice: 92},
+			expectedPrice:     92,
+			expectedLiquidity: LiquidityTaker,
+			expectedFilled:    true,
+		},
+		{
+			name:              "TestRestingOrder_match_buyStopLimitWithinLimit",
+			order:             model.OrderEvent{OrderType: model.OrderTypeStopLimit, Quantity: 1, StopPrice: 108, Price: 109},
+			expectedPrice:     108,
+			expectedLiquidity: LiquidityTaker,
+			expectedFilled:    true,
+		},
+		{
+			name:           "TestRestingOrder_match_buyStopLimitGappedAboveLimit",
+			order:          model.OrderEvent{OrderType: model.OrderTypeStopLimit, Quantity: 1, StopPrice: 95, Price: 96},
+			expectedFilled: false,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			resting := &restingOrder{order: testCase.order}
+			price, liquidity, filled := resting.match(bar)
+
+			if filled != testCase.expectedFilled || price != testCase.expectedPrice || liquidity != testCase.expectedLiquidity {
+				t.Fatalf("expected (%v, %s, %v), got (%v, %s, %v)", testCase.expectedPrice, testCase.expectedLiquidity,
+					testCase.expectedFilled, price, liquidity, filled)
+			}
+		})
+	}
+}
+
+// barHandler serves a fixed series of bars, advancing one bar per UpdateData
+type barHandler struct {
+	symbolData     model.SymbolData
+	latestBarIndex int64
+}
+
+func (b *barHandler) ShouldContinue() bool {
+	return b.latestBarIndex < int64(len(b.symbolData.Timestamps))-1
+}
+
+func (b *barHandler) UpdateData() {
+	b.latestBarIndex++
+}
+
+func (b *barHandler) GetLatestData() (*model.SymbolData, int64) {
+	return &b.symbolData, b.latestBarIndex
+}
+
+func (b *barHandler) NextTimestamp() time.Time {
+	return b.symbolData.Timestamps[b.latestBarIndex+1]
+}
+
+// newBarHandler returns a barHandler of daily bars at its first bar
+func newBarHandler(bars []model.Bar) *barHandler {
+	handler := &barHandler{}
+	for index, bar := range bars {
+		bar.Timestamp = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, index)
+		handler.symbolData.AddBar(bar)
+	}
+	return handler
+}
+
+func TestSimulatedExecution_lifecycle(t *testing.T) {
+	day := func(offset int) time.Time {
+		return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, offset)
+	}
+	bars := []model.Bar{
+		{Open: 100, High: 101, Low: 99, Close: 100, Volume: 100},
+		{Open: 100, High: 102, Low: 98, Close: 101, Volume: 100},
+		{Open: 101, High: 103, Low: 94, Close: 96, Volume: 100},
+	}
+
+	testCases := []struct {
+		name              string
+		order             model.OrderEvent
+		maxVolumeFraction float64
+		expectedStatuses  []string
+		expectedFills     []float64
+	}{
+		{
+			name: "TestSimulatedExecution_lifecycle_gtdExpired",
+			order: model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: 10, Price: 95,
+				TimeInForce: model.TimeInForceGTD, ExpireTimestamp: day(1)},
+			expectedStatuses: []string{model.OrderStatusNew, model.OrderStatusExpired},
+		},
+		{
+			name: "TestSimulatedExecution_lifecycle_gtdFilledBeforeExpiry",
+			order: model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: 10, Price: 95,
+				TimeInForce: model.TimeInForceGTD, ExpireTimestamp: day(2)},
+			expectedStatuses: []string{model.OrderStatusNew, model.OrderStatusFilled},
+			expectedFills:    []float64{10},
+		},
+		{
+			name:              "TestSimulatedExecution_lifecycle_gtcPartiallyFilledOverBars",
+			order:             model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: 15, TimeInForce: model.TimeInForceGTC},
+			maxVolumeFraction: 0.1,
+			expectedStatuses:  []string{model.OrderStatusNew, model.OrderStatusPartiallyFilled, model.OrderStatusFilled},
+			expectedFills:     []float64{10, 5},
+		},
+		{
+			name:              "TestSimulatedExecution_lifecycle_iocRemainderCancelled",
+			order:             model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: 25, TimeInForce: model.TimeInForceIOC},
+			maxVolumeFraction: 0.1,
+			expectedStatuses:  []string{model.OrderStatusNew, model.OrderStatusPartiallyFilled, model.OrderStatusCancelled},
+			expectedFills:     []float64{10},
+		},
+		{
+			name: "TestSimulatedExecution_lifecycle_iocLimitRemainderCancelled",
+			order: model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: -25, Price: 102,
+				TimeInForce: model.TimeInForceIOC},
+			maxVolumeFraction: 0.1,
+			expectedStatuses:  []string{model.OrderStatusNew, model.OrderStatusPartiallyFilled, model.OrderStatusCancelled},
+			expectedFills:     []float64{-10},
+		},
+		{
+			name: "TestSimulatedExecution_lifecycle_iocLimitNotReachedCancelled",
+			order: model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: 10, Price: 95,
+				TimeInForce: model.TimeInForceIOC},
+			expectedStatuses: []string{model.OrderStatusNew, model.OrderStatusCancelled},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			eventQ := queue.New()
+			handler := newBarHandler(bars)
+			se := &simulatedExecution{
+				eventQ:            eventQ,
+				data:              handler,
+				feeModel:          &FlatFee{},
+				slippageModel:     &NoSlippage{},
+				networkFeeModel:   &NoNetworkFee{},
+				fillTiming:        FillTimingNextOpen,
+				maxVolumeFraction: testCase.maxVolumeFraction,
+			}
+
+			order := testCase.order
+			order.Timestamp = day(0)
+			if err := se.GenerateFills(order); err != nil {
+				t.Fatal(err)
+			}
+			for handler.ShouldContinue() {
+				handler.UpdateData()
+				if err := se.UpdateFromMarket(model.MarketEvent{Timestamp: handler.symbolData.Timestamps[handler.latestBarIndex]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var statuses []string
+			var fills []float64
+			for eventQ.Length() > 0 {
+				switch event := eventQ.Remove().(type) {
+				case model.FillEvent:
+					fills = append(fills, event.Quantity)
+				case model.OrderUpdateEvent:
+					statuses = append(statuses, event.Status)
+				}
+			}
+			if diff := cmp.Diff(testCase.expectedStatuses, statuses); diff != "" {
+				t.Errorf("statuses (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(testCase.expectedFills, fills); diff != "" {
+				t.Errorf("fills (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package execution
+
+import (
+	"github.com/eapache/queue"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
+)
+
+// NewPaperExecution constructs the Execution of a dry run - no orders are sent to the exchange, they are simulated by
+// the order book execution with its fees, slippage & liquidity caps. The next bar of a live feed is a whole timeframe
+// away, so MARKET orders fill immediately at the live price (the latest bar's close).
+func NewPaperExecution(cfg config.Trader, eventQ *queue.Queue, data data.Handler, feeModels FeeModels) (Execution, error) {
+	cfg.FillTiming = FillTimingClose
+	return NewSimulatedExecution(cfg, eventQ, data, feeModels)
+}
@@ -0,0 +1,97 @@
+package execution
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	SlippageModelFixedBasisPoints = "fixed_bps"
+	SlippageModelRange            = "range"
+	SlippageModelSquareRootImpact = "sqrt_impact"
+)
+
+// SlippageModel determines the adverse price movement per unit incurred when filling a quantity at a price
+type SlippageModel interface {
+	CalculateSlippage(quantity float64, price float64, bar model.Bar) float64
+}
+
+// NoSlippage fills every order at the exact reference price
+type NoSlippage struct{}
+
+// CalculateSlippage returns zero slippage
+func (s *NoSlippage) CalculateSlippage(quantity float64, price float64, bar model.Bar) float64 {
+	return 0.0
+}
+
+// FixedBasisPointsSlippage moves the fill price by a fixed number of basis points of the reference price
+type FixedBasisPointsSlippage struct {
+	BasisPoints float64
+}
+
+// CalculateSlippage returns the fixed basis points of the price
+func (s *FixedBasisPointsSlippage) CalculateSlippage(quantity float64, price float64, bar model.Bar) float64 {
+	return price * s.BasisPoints / 10000
+}
+
+// RangeSlippage moves the fill price by a percentage of the bar's high-low range
+type RangeSlippage struct {
+	Fraction float64
+}
+
+// CalculateSlippage returns the fraction of the bar's high-low range
+func (s *RangeSlippage) CalculateSlippage(quantity float64, price float64, bar model.Bar) float64 {
+	return (bar.High - bar.Low) * s.Fraction
+}
+
+// SquareRootImpactSlippage models market impact as the bar's volatility scaled by the square root of the order's
+// participation in the bar's volume: Coefficient * (High - Low) * sqrt(abs(quantity) / Volume)
+type SquareRootImpactSlippage struct {
+	Coefficient float64
+}
+
+// CalculateSlippage returns the square-root market impact of the quantity
+func (s *SquareRootImpactSlippage) CalculateSlippage(quantity float64, price float64, bar model.Bar) float64 {
+	// Without volume there is no liquidity to absorb the order, so assume the full range is crossed
+	participation := 1.0
+	if bar.Volume > 0 {
+		participation = math.Min(math.Abs(quantity)/bar.Volume, 1.0)
+	}
+	return s.Coefficient * (bar.High - bar.Low) * math.Sqrt(participation)
+}
+
+// NewSlippageModel constructs a SlippageModel from a SLIPPAGE_MODEL specification in the format "model:param", eg/
+// "fixed_bps:5", "range:0.1" or "sqrt_impact:1". An empty specification applies no slippage, and negative parameters
+// are rejected as they would improve the fill price.
+func NewSlippageModel(specification string) (SlippageModel, error) {
+	if strings.TrimSpace(specification) == "" {
+		return &NoSlippage{}, nil
+	}
+
+	modelAndParam := strings.SplitN(strings.TrimSpace(specification), ":", 2)
+	if len(modelAndParam) != 2 {
+		return nil, errors.New(fmt.Sprintf("missing parameter in slippage model %s", specification))
+	}
+	param, err := strconv.ParseFloat(strings.TrimSpace(modelAndParam[1]), 64)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to parse slippage model parameter %s", modelAndParam[1]))
+	}
+	if param < 0 {
+		return nil, errors.New(fmt.Sprintf("slippage model parameter %v cannot be negative", param))
+	}
+
+	switch modelAndParam[0] {
+	case SlippageModelFixedBasisPoints:
+		return &FixedBasisPointsSlippage{BasisPoints: param}, nil
+	case SlippageModelRange:
+		return &RangeSlippage{Fraction: param}, nil
+	case SlippageModelSquareRootImpact:
+		return &SquareRootImpactSlippage{Coefficient: param}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported slippage model %s", modelAndParam[0]))
+	}
+}
@@ -0,0 +1,177 @@
+package execution
+
+import (
+	"github.com/eapache/queue"
+	"github.com/google/go-cmp/cmp"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"testing"
+)
+
+func TestSlippageModel_fill(t *testing.T) {
+	bar := model.Bar{Open: 100, High: 110, Low: 90, Close: 105, Volume: 100}
+
+	// fillPrices are the FillPrice & SlippageFee of a fill
+	type fillPrices struct {
+		FillPrice   float64
+		SlippageFee float64
+	}
+
+	testCases := []struct {
+		name          string
+		specification string
+		quantity      float64
+		liquidity     string
+		volume        float64
+		expected      fillPrices
+	}{
+		{
+			name:          "TestSlippageModel_fill_noneBuy",
+			specification: "",
+			quantity:      25,
+			liquidity:     LiquidityTaker,
+			volume:        100,
+			expected:      fillPrices{FillPrice: 100, SlippageFee: 0},
+		},
+		{
+			name:          "TestSlippageModel_fill_fixedBasisPointsBuy",
+			specification: "fixed_bps:50",
+			quantity:      25,
+			liquidity:     LiquidityTaker,
+			volume:        100,
+			expected:      fillPrices{FillPrice: 100.5, SlippageFee: 12.5},
+		},
+		{
+			name:          "TestSlippageModel_fill_fixedBasisPointsSell",
+			specification: "fixed_bps:50",
+			quantity:      -25,
+			liquidity:     LiquidityTaker,
+			volume:        100,
+			expected:      fillPrices{FillPrice: 99.5, SlippageFee: 12.5},
+		},
+		{
+			name:          "TestSlippageModel_fill_rangeBuy",
+			specification: "range:0.1",
+			quantity:      25,
+			liquidity:     LiquidityTaker,
+			volume:        100,
+			expected:      fillPrices{FillPrice: 102, SlippageFee: 50},
+		},
+		{
+			name:          "TestSlippageModel_fill_rangeSell",
+			specification: "range:0.1",
+			quantity:      -25,
+			liquidity:     LiquidityTaker,
+			volume:        100,
+			expected:      fillPrices{FillPrice: 98, SlippageFee: 50},
+		},
+		{
+			name:          "TestSlippageModel_fill_rangeZeroVolume",
+			specification: "range:0.1",
+			quantity:      25,
+			liquidity:     LiquidityTaker,
+			volume:        0,
+			expected:      fillPrices{FillPrice: 102, SlippageFee: 50},
+		},
+		{
+			name:          "TestSlippageModel_fill_squareRootImpactBuy",
+			specification: "sqrt_impact:1",
+			quantity:      25,
+			liquidity:     LiquidityTaker,
+			volume:        100,
+			expected:      fillPrices{FillPrice: 110, SlippageFee: 250},
+		},
+		{
+			name:          "TestSlippageModel_fill_squareRootImpactSell",
+			specification: "sqrt_impact:1",
+			quantity:      -25,
+			liquidity:     LiquidityTaker,
+			volume:        100,
+			expected:      fillPrices{FillPrice: 90, SlippageFee: 250},
+		},
+		{
+			// Without volume the full range is crossed
+			name:          "TestSlippageModel_fill_squareRootImpactZeroVolume",
+			specification: "sqrt_impact:1",
+			quantity:      -25,
+			liquidity:     LiquidityTaker,
+			volume:        0,
+			expected:      fillPrices{FillPrice: 80, SlippageFee: 500},
+		},
+		{
+			// Participation is capped at the whole bar's volume
+			name:          "TestSlippageModel_fill_squareRootImpactAboveVolume",
+			specification: "sqrt_impact:0.5",
+			quantity:      400,
+			liquidity:     LiquidityTaker,
+			volume:        100,
+			expected:      fillPrices{FillPrice: 110, SlippageFee: 4000},
+		},
+		{
+			name:          "TestSlippageModel_fill_makerNoSlippage",
+			specification: "sqrt_impact:1",
+			quantity:      25,
+			liquidity:     LiquidityMaker,
+			volume:        100,
+			expected:      fillPrices{FillPrice: 100, SlippageFee: 0},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			slippageModel, err := NewSlippageModel(testCase.specification)
+			if err != nil {
+				t.Fatal(err)
+			}
+			eventQ := queue.New()
+			se := &simulatedExecution{
+				eventQ:          eventQ,
+				feeModel:        &FlatFee{},
+				slippageModel:   slippageModel,
+				networkFeeModel: &NoNetworkFee{},
+			}
+
+			fillBar := bar
+			fillBar.Volume = testCase.volume
+			order := model.OrderEvent{Quantity: testCase.quantity, TimeInForce: model.TimeInForceGTC}
+			if _, err := se.fill(&restingOrder{order: order}, fillBar, bar.Open, testCase.liquidity); err != nil {
+				t.Fatal(err)
+			}
+
+			fill := eventQ.Remove().(model.FillEvent)
+			actual := fillPrices{FillPrice: fill.FillPrice, SlippageFee: fill.SlippageFee}
+			if diff := cmp.Diff(testCase.expected, actual); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewSlippageModel(t *testing.T) {
+	testCases := []struct {
+		name          string
+		specification string
+		expected      SlippageModel
+		expectedError bool
+	}{
+		{name: "TestNewSlippageModel_empty", specification: " ", expected: &NoSlippage{}},
+		{name: "TestNewSlippageModel_fixedBasisPoints", specification: "fixed_bps:5", expected: &FixedBasisPointsSlippage{BasisPoints: 5}},
+		{name: "TestNewSlippageModel_range", specification: "range: 0.1", expected: &RangeSlippage{Fraction: 0.1}},
+		{name: "TestNewSlippageModel_squareRootImpact", specification: "sqrt_impact:1", expected: &SquareRootImpactSlippage{Coefficient: 1}},
+		{name: "TestNewSlippageModel_missingParameter", specification: "range", expectedError: true},
+		{name: "TestNewSlippageModel_invalidParameter", specification: "range:wide", expectedError: true},
+		{name: "TestNewSlippageModel_unsupported", specification: "linear:1", expectedError: true},
+		{name: "TestNewSlippageModel_negativeBasisPoints", specification: "fixed_bps:-5", expectedError: true},
+		{name: "TestNewSlippageModel_negativeRange", specification: "range:-0.1", expectedError: true},
+		{name: "TestNewSlippageModel_negativeImpact", specification: "sqrt_impact:-1", expectedError: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			slippageModel, err := NewSlippageModel(testCase.specification)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if diff := cmp.Diff(testCase.expected, slippageModel); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
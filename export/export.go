@@ -0,0 +1,216 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	timestampLayout = time.RFC3339
+)
+
+// WriteSnapshotsCSV writes the portfolio Snapshots as CSV with one exposure column per Symbol
+func WriteSnapshotsCSV(w io.Writer, snapshots []model.Snapshot) error {
+	symbols := snapshotSymbols(snapshots)
+
+	header := []string{"timestamp", "cash", "market_value", "total_value", "unreal_profit_loss", "real_profit_loss"}
+	for _, symbol := range symbols {
+		header = append(header, fmt.Sprintf("exposure_%s", symbol))
+	}
+
+	records := [][]string{header}
+	for _, snapshot := range snapshots {
+		record := []string{
+			snapshot.Timestamp.Format(timestampLayout),
+			formatFloat(snapshot.Cash),
+			formatFloat(snapshot.MarketValue),
+			formatFloat(snapshot.TotalValue),
+			formatFloat(snapshot.UnrealProfitLoss),
+			formatFloat(snapshot.RealProfitLoss),
+		}
+		for _, symbol := range symbols {
+			record = append(record, formatFloat(snapshot.Exposures[symbol]))
+		}
+		records = append(records, record)
+	}
+
+	return writeCSV(w, records)
+}
+
+// WriteOrdersCSV writes the order book as CSV, one OrderEvent per row
+func WriteOrdersCSV(w io.Writer, orders []model.OrderEvent) error {
+	records := [][]string{{"trace_id", "order_id", "timestamp", "symbol", "order_type", "quantity", "decision",
+		"price", "stop_price", "time_in_force", "status", "exit_reason"}}
+	for _, order := range orders {
+		records = append(records, []string{
+			order.TraceId.String(),
+			order.OrderId.String(),
+			order.Timestamp.Format(timestampLayout),
+			order.Symbol,
+			order.OrderType,
+			formatFloat(order.Quantity),
+			order.Decision,
+			formatFloat(order.Price),
+			formatFloat(order.StopPrice),
+			order.TimeInForce,
+			order.Status,
+			order.ExitReason,
+		})
+	}
+	return writeCSV(w, records)
+}
+
+// WriteFillsCSV writes the fill journal as CSV, one FillEvent per row
+func WriteFillsCSV(w io.Writer, fills []model.FillEvent) error {
+	records := [][]string{{"trace_id", "order_id", "timestamp", "symbol", "exchange", "quantity", "decision",
+		"fill_value_gross", "fill_price", "exchange_fee", "slippage_fee", "network_fee"}}
+	for _, fill := range fills {
+		records = append(records, []string{
+			fill.TraceId.String(),
+			fill.OrderId.String(),
+			fill.Timestamp.Format(timestampLayout),
+			fill.Symbol,
+			fill.Exchange,
+			formatFloat(fill.Quantity),
+			fill.Decision,
+			formatFloat(fill.FillValueGross),
+			formatFloat(fill.FillPrice),
+			formatFloat(fill.ExchangeFee),
+			formatFloat(fill.SlippageFee),
+			formatFloat(fill.NetworkFee),
+		})
+	}
+	return writeCSV(w, records)
+}
+
+// WritePositionsCSV writes the closed position ledger as CSV, one Position per row ordered by EnterTimestamp
+func WritePositionsCSV(w io.Writer, historicPositions map[string][]model.Position) error {
+	records := [][]string{{"symbol", "direction", "quantity", "enter_timestamp", "enter_avg_price_gross",
+		"enter_fill_value_gross", "enter_exchange_fee", "enter_slippage_fee", "enter_network_fee", "enter_total_fees",
+		"exit_timestamp", "exit_avg_price_gross", "exit_fill_value_gross", "exit_exchange_fee", "exit_slippage_fee",
+		"exit_network_fee", "exit_total_fees", "result_profit_loss", "exit_reason"}}
+	for _, position := range sortPositions(historicPositions) {
+		records = append(records, []string{
+			position.Symbol,
+			position.Direction,
+			formatFloat(position.Quantity),
+			position.EnterTimestamp.Format(timestampLayout),
+			formatFloat(position.EnterAvgPriceGross),
+			formatFloat(position.EnterFillValueGross),
+			formatFloat(position.EnterFillFees["ExchangeFee"]),
+			formatFloat(position.EnterFillFees["SlippageFee"]),
+			formatFloat(position.EnterFillFees["NetworkFee"]),
+			formatFloat(position.EnterFillFees["TotalFees"]),
+			position.ExitTimestamp.Format(timestampLayout),
+			formatFloat(position.ExitAvgPriceGross),
+			formatFloat(position.ExitFillValueGross),
+			formatFloat(position.ExitFillFees["ExchangeFee"]),
+			formatFloat(position.ExitFillFees["SlippageFee"]),
+			formatFloat(position.ExitFillFees["NetworkFee"]),
+			formatFloat(position.ExitFillFees["TotalFees"]),
+			formatFloat(position.ResultProfitLoss),
+			position.ExitReason,
+		})
+	}
+	return writeCSV(w, records)
+}
+
+// WriteJSONLines writes each element of items as a line of JSON - items must be a slice
+func WriteJSONLines(w io.Writer, items interface{}) error {
+	values := reflect.ValueOf(items)
+	if values.Kind() != reflect.Slice {
+		return errors.New(fmt.Sprintf("failed to write JSON Lines, expected a slice but got %T", items))
+	}
+
+	encoder := json.NewEncoder(w)
+	for index := 0; index < values.Len(); index++ {
+		if err := encoder.Encode(values.Index(index).Interface()); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to encode item at index %v", index))
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the value as indented JSON
+func WriteJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return errors.Wrap(err, "failed to encode JSON")
+	}
+	return nil
+}
+
+// WriteFile creates the file at filePath, including any missing directories, & writes to it with the provided writeFunc
+func WriteFile(filePath string, writeFunc func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to create directory for %s", filePath))
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to create %s", filePath))
+	}
+
+	if err := writeFunc(file); err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, fmt.Sprintf("failed to write %s", filePath))
+	}
+	return file.Close()
+}
+
+// sortPositions flattens the historic Positions of every Symbol into a single slice ordered by EnterTimestamp
+func sortPositions(historicPositions map[string][]model.Position) []model.Position {
+	var positions []model.Position
+	for _, symbolPositions := range historicPositions {
+		positions = append(positions, symbolPositions...)
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		if positions[i].EnterTimestamp.Equal(positions[j].EnterTimestamp) {
+			return positions[i].Symbol < positions[j].Symbol
+		}
+		return positions[i].EnterTimestamp.Before(positions[j].EnterTimestamp)
+	})
+	return positions
+}
+
+// snapshotSymbols returns the sorted set of Symbols with an exposure in any of the Snapshots
+func snapshotSymbols(snapshots []model.Snapshot) []string {
+	symbolSet := make(map[string]bool)
+	for _, snapshot := range snapshots {
+		for symbol := range snapshot.Exposures {
+			symbolSet[symbol] = true
+		}
+	}
+
+	var symbols []string
+	for symbol := range symbolSet {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// writeCSV writes all records to the writer & flushes it
+func writeCSV(w io.Writer, records [][]string) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.WriteAll(records); err != nil {
+		return errors.Wrap(err, "failed to write CSV records")
+	}
+	return nil
+}
+
+// formatFloat formats a float64 with the minimum precision required to represent it exactly
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
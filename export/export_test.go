@@ -0,0 +1,191 @@
+package export
+
+import (
+	"bytes"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCSV(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	traceId := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	orderId := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+
+	testCases := []struct {
+		name      string
+		writeFunc func(buffer *bytes.Buffer) error
+		expected  []string
+	}{
+		{
+			name: "TestWriteCSV_snapshots",
+			writeFunc: func(buffer *bytes.Buffer) error {
+				return WriteSnapshotsCSV(buffer, []model.Snapshot{
+					{Timestamp: testTimestamp, Cash: 10000, TotalValue: 10000},
+					{Timestamp: testTimestamp.AddDate(0, 0, 1), Cash: 9000, MarketValue: 1100.5, TotalValue: 10100.5,
+						Exposures: map[string]float64{"ETH-USD": 1100.5, "BTC-USD": -200}, UnrealProfitLoss: 100.5},
+				})
+			},
+			expected: []string{
+				"timestamp,cash,market_value,total_value,unreal_profit_loss,real_profit_loss,exposure_BTC-USD,exposure_ETH-USD",
+				"2021-01-01T00:00:00Z,10000,0,10000,0,0,0,0",
+				"2021-01-02T00:00:00Z,9000,1100.5,10100.5,100.5,0,-200,1100.5",
+			},
+		},
+		{
+			name: "TestWriteCSV_orders",
+			writeFunc: func(buffer *bytes.Buffer) error {
+				return WriteOrdersCSV(buffer, []model.OrderEvent{{TraceId: traceId, OrderId: orderId,
+					Timestamp: testTimestamp, Symbol: "ETH-USD", OrderType: model.OrderTypeLimit, Quantity: 2.5,
+					Decision: model.DecisionLong, Price: 700.25, TimeInForce: "GTC", Status: "FILLED"}})
+			},
+			expected: []string{
+				"trace_id,order_id,timestamp,symbol,order_type,quantity,decision,price,stop_price,time_in_force,status,exit_reason",
+				"00000000-0000-0000-0000-000000000001,00000000-0000-0000-0000-000000000002,2021-01-01T00:00:00Z,ETH-USD," +
+					"LIMIT,2.5,LONG,700.25,0,GTC,FILLED,",
+			},
+		},
+		{
+			name: "TestWriteCSV_fills",
+			writeFunc: func(buffer *bytes.Buffer) error {
+				return WriteFillsCSV(buffer, []model.FillEvent{{TraceId: traceId, OrderId: orderId,
+					Timestamp: testTimestamp, Symbol: "ETH-USD", Exchange: "binance", Quantity: -2.5,
+					Decision: model.DecisionCloseLong, FillValueGross: 2000, FillPrice: 800, ExchangeFee: 2,
+					SlippageFee: 0.5}})
+			},
+			expected: []string{
+				"trace_id,order_id,timestamp,symbol,exchange,quantity,decision,fill_value_gross,fill_price,exchange_fee," +
+					"slippage_fee,network_fee",
+				"00000000-0000-0000-0000-000000000001,00000000-0000-0000-0000-000000000002,2021-01-01T00:00:00Z,ETH-USD," +
+					"binance,-2.5,CLOSE_LONG,2000,800,2,0.5,0",
+			},
+		},
+		{
+			name: "TestWriteCSV_positions",
+			writeFunc: func(buffer *bytes.Buffer) error {
+				return WritePositionsCSV(buffer, map[string][]model.Position{
+					"ETH-USD": {{Symbol: "ETH-USD", Direction: model.DirectionLong, Quantity: 2.5,
+						EnterTimestamp: testTimestamp.AddDate(0, 0, 1), EnterAvgPriceGross: 700,
+						EnterFillValueGross: 1750, EnterFillFees: map[string]float64{"ExchangeFee": 1.75, "TotalFees": 1.75},
+						ExitTimestamp: testTimestamp.AddDate(0, 0, 3), ExitAvgPriceGross: 800,
+						ExitFillValueGross: 2000, ExitFillFees: map[string]float64{"ExchangeFee": 2, "TotalFees": 2},
+						ResultProfitLoss: 246.25, ExitReason: "SIGNAL"}},
+					"BTC-USD": {{Symbol: "BTC-USD", Direction: model.DirectionShort, Quantity: -0.1,
+						EnterTimestamp: testTimestamp, EnterAvgPriceGross: 30000, EnterFillValueGross: 3000,
+						ExitTimestamp: testTimestamp.AddDate(0, 0, 2), ExitAvgPriceGross: 29000,
+						ExitFillValueGross: 2900, ResultProfitLoss: 100, ExitReason: "TAKE_PROFIT"}},
+				})
+			},
+			expected: []string{
+				"symbol,direction,quantity,enter_timestamp,enter_avg_price_gross,enter_fill_value_gross," +
+					"enter_exchange_fee,enter_slippage_fee,enter_network_fee,enter_total_fees,exit_timestamp," +
+					"exit_avg_price_gross,exit_fill_value_gross,exit_exchange_fee,exit_slippage_fee,exit_network_fee," +
+					"exit_total_fees,result_profit_loss,exit_reason",
+				"BTC-USD,SHORT,-0.1,2021-01-01T00:00:00Z,30000,3000,0,0,0,0,2021-01-03T00:00:00Z,29000,2900,0,0,0,0,100," +
+					"TAKE_PROFIT",
+				"ETH-USD,LONG,2.5,2021-01-02T00:00:00Z,700,1750,1.75,0,0,1.75,2021-01-04T00:00:00Z,800,2000,2,0,0,2," +
+					"246.25,SIGNAL",
+			},
+		},
+		{
+			name: "TestWriteCSV_noSnapshots",
+			writeFunc: func(buffer *bytes.Buffer) error {
+				return WriteSnapshotsCSV(buffer, nil)
+			},
+			expected: []string{"timestamp,cash,market_value,total_value,unreal_profit_loss,real_profit_loss"},
+		},
+		{
+			name: "TestWriteCSV_noOrders",
+			writeFunc: func(buffer *bytes.Buffer) error {
+				return WriteOrdersCSV(buffer, nil)
+			},
+			expected: []string{
+				"trace_id,order_id,timestamp,symbol,order_type,quantity,decision,price,stop_price,time_in_force,status,exit_reason",
+			},
+		},
+		{
+			name: "TestWriteCSV_noFills",
+			writeFunc: func(buffer *bytes.Buffer) error {
+				return WriteFillsCSV(buffer, nil)
+			},
+			expected: []string{
+				"trace_id,order_id,timestamp,symbol,exchange,quantity,decision,fill_value_gross,fill_price,exchange_fee," +
+					"slippage_fee,network_fee",
+			},
+		},
+		{
+			name: "TestWriteCSV_noPositions",
+			writeFunc: func(buffer *bytes.Buffer) error {
+				return WritePositionsCSV(buffer, map[string][]model.Position{})
+			},
+			expected: []string{
+				"symbol,direction,quantity,enter_timestamp,enter_avg_price_gross,enter_fill_value_gross," +
+					"enter_exchange_fee,enter_slippage_fee,enter_network_fee,enter_total_fees,exit_timestamp," +
+					"exit_avg_price_gross,exit_fill_value_gross,exit_exchange_fee,exit_slippage_fee,exit_network_fee," +
+					"exit_total_fees,result_profit_loss,exit_reason",
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := testCase.writeFunc(&buffer); err != nil {
+				t.Fatal(err)
+			}
+			actual := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+			if diff := cmp.Diff(testCase.expected, actual); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteJSONLines(t *testing.T) {
+	type trade struct {
+		Symbol           string
+		ResultProfitLoss float64
+	}
+
+	testCases := []struct {
+		name          string
+		items         interface{}
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:     "TestWriteJSONLines_trades",
+			items:    []trade{{Symbol: "ETH-USD", ResultProfitLoss: 246.25}, {Symbol: "BTC-USD", ResultProfitLoss: -100}},
+			expected: "{\"Symbol\":\"ETH-USD\",\"ResultProfitLoss\":246.25}\n{\"Symbol\":\"BTC-USD\",\"ResultProfitLoss\":-100}\n",
+		},
+		{
+			name:     "TestWriteJSONLines_noTrades",
+			items:    []trade{},
+			expected: "",
+		},
+		{
+			name:     "TestWriteJSONLines_nilTrades",
+			items:    []trade(nil),
+			expected: "",
+		},
+		{
+			name:          "TestWriteJSONLines_notSlice",
+			items:         trade{Symbol: "ETH-USD"},
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			err := WriteJSONLines(&buffer, testCase.items)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if diff := cmp.Diff(testCase.expected, buffer.String()); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
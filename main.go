@@ -1,35 +1,363 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"github.com/pkg/errors"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/export"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/service"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/strategy"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/trader"
 	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	commandBacktest = "backtest"
+	commandDry      = "dry"
+	commandLive     = "live"
+	commandReplay   = "replay"
+	commandSynth    = "synth"
+	commandWalk     = "walkforward"
+	commandSweep    = "sweep"
 )
 
 func main() {
-	if err := run(); err != nil {
+	if err := run(os.Args[1:]); err != nil {
 		panic(err)
 	}
 }
 
-func run() error {
+func run(args []string) error {
 	log, err := zap.NewDevelopment()
 	if err != nil {
 		return errors.Wrap(err, "failed to init logger")
 	}
 	defer log.Sync()
 
+	// Default to a backtest if no command is provided
+	command := commandBacktest
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case commandBacktest:
+		return runBacktest(args, log)
+	case commandDry, commandLive:
+		return runStreaming(command, args, log)
+	case commandReplay:
+		return runReplay(args, log)
+	case commandSynth:
+		return runSynth(args, log)
+	case commandWalk:
+		return runWalkForward(args, log)
+	case commandSweep:
+		return runSweep(args, log)
+	default:
+		return errors.New(fmt.Sprintf("unknown command %s", command))
+	}
+}
+
+// runBacktest runs a backtest for every configured trader & optionally exports the results
+func runBacktest(args []string, log *zap.Logger) error {
+	flags := flag.NewFlagSet(commandBacktest, flag.ContinueOnError)
+	exportDirectory := flags.String("export", "", "directory to write the order book, fill journal, closed positions & snapshots to")
+	reportDirectory := flags.String("report", "", "directory to write the HTML backtest reports to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.GetConfig(log)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("failed to init environment config: %s", err))
+	}
+
+	traderService, err := service.NewTradingEngine(&cfg.Engine, trader.ModeBacktest, log)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("failed to init trading engine: %s", err))
+	}
+
+	ctx, cancel := interruptContext(log)
+	defer cancel()
+
+	if err := traderService.RunBacktest(ctx); err != nil {
+		return err
+	}
+
+	if *exportDirectory != "" {
+		if err := traderService.Export(*exportDirectory); err != nil {
+			return err
+		}
+	}
+	if *reportDirectory != "" {
+		if err := traderService.Report(*reportDirectory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runStreaming trades every configured trader against the bars polled from DATA_FEED_URL until interrupted or the
+// feeds finish - on paper for the dry command, or with real orders on the exchange for the live command
+func runStreaming(command string, args []string, log *zap.Logger) error {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	exportDirectory := flags.String("export", "", "directory to write the order book, fill journal, closed positions & snapshots to")
+	confirm := flags.Bool("confirm", false, "confirm that live trading places real orders on the exchange")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	mode := trader.ModeDry
+	if command == commandLive {
+		if !*confirm {
+			return errors.New("live trading places real orders on the exchange, rerun with -confirm to proceed")
+		}
+		mode = trader.ModeLive
+	}
+
 	cfg, err := config.GetConfig(log)
 	if err != nil {
 		log.Fatal(fmt.Sprintf("failed to init environment config: %s", err))
 	}
 
-	traderService, err := service.NewTradingEngine(&cfg.Engine, log)
+	traderService, err := service.NewTradingEngine(&cfg.Engine, mode, log)
 	if err != nil {
 		log.Fatal(fmt.Sprintf("failed to init trading engine: %s", err))
 	}
 
-	return traderService.RunBacktest()
+	ctx, cancel := interruptContext(log)
+	defer cancel()
+
+	run := traderService.RunTraderDry
+	if mode == trader.ModeLive {
+		run = traderService.RunTraderLive
+	}
+	// An interrupt is the normal way to end a dry or live run, so the results are still exported
+	if err := run(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	if *exportDirectory != "" {
+		if err := traderService.Export(*exportDirectory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runReplay serves the historic data files as a live bar feed at an accelerated speed, a local stand-in for an
+// exchange feed to dry run against
+func runReplay(args []string, log *zap.Logger) error {
+	flags := flag.NewFlagSet(commandReplay, flag.ContinueOnError)
+	address := flags.String("addr", ":8081", "address to serve the bar feed on")
+	speed := flags.Float64("speed", 86400, "multiple of real time to replay the bars at")
+	schemaSpecification := flags.String("schema", "", "CSV schema of the historic data files in the format \"timestamp:open_time,close_price:RAW\"")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	schema, err := data.NewCSVSchema(*schemaSpecification)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse CSV schema")
+	}
+
+	replayServer, err := data.NewReplayServer(log, *speed, schema)
+	if err != nil {
+		return errors.Wrap(err, "failed to init replay server")
+	}
+	server := &http.Server{Addr: *address, Handler: replayServer}
+
+	ctx, cancel := interruptContext(log)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer shutdownCancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info(fmt.Sprintf("replaying historic data at %vx speed on %s", *speed, *address))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "replay server failed")
+	}
+	return nil
+}
+
+// runSynth writes a historic data file of bars synthesised from a price process, so strategies can be backtested
+// against markets with known properties
+func runSynth(args []string, log *zap.Logger) error {
+	flags := flag.NewFlagSet(commandSynth, flag.ContinueOnError)
+	symbol := flags.String("symbol", "SYN-USD", "symbol of the synthesised market")
+	timeframe := flags.String("timeframe", "1D", "timeframe of the synthesised bars")
+	process := flags.String("model", "gbm:0.0:0.8", "price process in the format \"process:params\" (gbm, heston, jump or regime)")
+	seed := flags.Int64("seed", 1, "seed of the random number generator")
+	bars := flags.Int("bars", 1000, "number of bars to synthesise")
+	start := flags.String("start", "2020-01-01", "ISO date or RFC3339 timestamp of the first bar")
+	startPrice := flags.Float64("price", 100, "open of the first bar")
+	directory := flags.String("out", "data", "directory to write the \"symbol_timeframe.csv\" file to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	startTime, err := time.Parse(time.RFC3339, *start)
+	if err != nil {
+		if startTime, err = time.Parse("2006-01-02", *start); err != nil {
+			return errors.New(fmt.Sprintf("failed to parse start %s", *start))
+		}
+	}
+	symbolData, err := data.SynthesiseSymbolData(*process, *seed, *symbol, *timeframe, startTime, *startPrice, *bars)
+	if err != nil {
+		return errors.Wrap(err, "failed to synthesise data")
+	}
+
+	if err := os.MkdirAll(*directory, 0755); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to create directory %s", *directory))
+	}
+	filePath := filepath.Join(*directory, fmt.Sprintf("%s_%s.csv", *symbol, *timeframe))
+	file, err := os.Create(filePath)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to create %s", filePath))
+	}
+	defer file.Close()
+	if err := data.WriteCSVSymbolData(file, symbolData, *timeframe); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to write %s", filePath))
+	}
+
+	log.Info(fmt.Sprintf("wrote %v bars of %s synthesised from %s to %s", *bars, *symbol, *process, filePath))
+	return nil
+}
+
+// runWalkForward optimises the strategy parameters on rolling or anchored in-sample windows, runs the chosen parameters
+// on the out-of-sample windows following them & optionally writes the per-window parameters & stitched equity curve
+func runWalkForward(args []string, log *zap.Logger) error {
+	flags := flag.NewFlagSet(commandWalk, flag.ContinueOnError)
+	grid := flags.String("params", "", "parameter grid in the format \"name:min..max:step,name:value\", eg/ \"period:2..14,entry:20..45:5\"")
+	mode := flags.String("mode", service.WalkForwardRolling, "in-sample windows ROLLING forward or ANCHORED at the start of the data")
+	inSample := flags.String("in-sample", "365D", "length of the (first) in-sample window as a timeframe, eg/ 365D")
+	outOfSample := flags.String("out-of-sample", "90D", "length of the out-of-sample windows as a timeframe, eg/ 90D")
+	objective := flags.String("objective", service.ObjectiveSharpe, "statistic to maximise in-sample (sharpe, return or return_drawdown)")
+	outFile := flags.String("out", "", "JSON file to write the per-window parameters, statistics & stitched equity curve to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.GetConfig(log)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("failed to init environment config: %s", err))
+	}
+
+	parameterGrid, err := strategy.ParseParameterGrid(cfg.Engine.Strategy, *grid)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse parameter grid")
+	}
+	inSampleDuration, err := data.ParseTimeframe(*inSample)
+	if err != nil {
+		return errors.Wrap(err, "invalid in-sample window")
+	}
+	outOfSampleDuration, err := data.ParseTimeframe(*outOfSample)
+	if err != nil {
+		return errors.Wrap(err, "invalid out-of-sample window")
+	}
+
+	ctx, cancel := interruptContext(log)
+	defer cancel()
+
+	result, err := service.RunWalkForward(ctx, &cfg.Engine, service.WalkForwardConfig{
+		Mode:        strings.ToUpper(*mode),
+		InSample:    inSampleDuration,
+		OutOfSample: outOfSampleDuration,
+		Objective:   *objective,
+		Grid:        parameterGrid,
+	}, log)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("walk-forward of %v parameter combinations over %v windows: out-of-sample return %.4f, Sharpe %.4f, max drawdown %.4f, efficiency %.4f",
+		len(parameterGrid), len(result.Windows), result.OutOfSample.TotalReturn, result.OutOfSample.SharpeRatio,
+		result.OutOfSample.MaxDrawdown, result.Efficiency))
+
+	if *outFile != "" {
+		if err := export.WriteFile(*outFile, func(w io.Writer) error { return export.WriteJSON(w, result) }); err != nil {
+			return errors.Wrap(err, "failed to write walk-forward results")
+		}
+		log.Info(fmt.Sprintf("walk-forward results written to: %s", *outFile))
+	}
+	return nil
+}
+
+// runSweep backtests every combination of a strategy parameter grid in parallel & writes the combinations ranked by the
+// objective to CSV
+func runSweep(args []string, log *zap.Logger) error {
+	flags := flag.NewFlagSet(commandSweep, flag.ContinueOnError)
+	grid := flags.String("params", "", "parameter grid in the format \"name:min..max:step,name:value\", eg/ \"period:2..14,entry:20..45:5\"")
+	objective := flags.String("objective", service.ObjectiveSharpe, "statistic to rank the combinations by (sharpe, return or return_drawdown)")
+	outFile := flags.String("out", "sweep.csv", "CSV file to write the ranked combinations & their statistics to")
+	top := flags.Int("top", 10, "number of the best combinations to log")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.GetConfig(log)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("failed to init environment config: %s", err))
+	}
+
+	parameters, err := strategy.StrategyParameters(cfg.Engine.Strategy)
+	if err != nil {
+		return err
+	}
+	parameterGrid, err := strategy.ParseParameterGrid(cfg.Engine.Strategy, *grid)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse parameter grid")
+	}
+
+	ctx, cancel := interruptContext(log)
+	defer cancel()
+
+	log.Info(fmt.Sprintf("sweeping %v parameter combinations of strategy %s", len(parameterGrid), cfg.Engine.Strategy))
+	results, err := service.RunSweep(ctx, &cfg.Engine, parameterGrid, *objective, log)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Rank > *top {
+			break
+		}
+		stats := result.Results.Portfolio
+		log.Info(fmt.Sprintf("#%v %s: %s %.4f, return %.4f, max drawdown %.4f, trades %v", result.Rank, result.Parameters,
+			*objective, result.Objective, stats.TotalReturn, stats.MaxDrawdown, stats.Trades.NumTrades))
+	}
+
+	if err := export.WriteFile(*outFile, func(w io.Writer) error { return service.WriteSweepCSV(w, results, parameters) }); err != nil {
+		return errors.Wrap(err, "failed to write sweep results")
+	}
+	log.Info(fmt.Sprintf("sweep results written to: %s", *outFile))
+	return nil
+}
+
+// interruptContext returns a context that is cancelled on interrupt, stopping the running traders
+func interruptContext(log *zap.Logger) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		defer signal.Stop(interrupt)
+		select {
+		case <-interrupt:
+			log.Info("interrupt received, cancelling run")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
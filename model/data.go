@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // Bar represents a symbol's market data state at a fixed interval of time
 type Bar struct {
@@ -9,7 +12,7 @@ type Bar struct {
 	High float64
 	Low float64
 	Close float64
-	Volume uint64
+	Volume float64
 }
 
 // SymbolData represents a symbol's struct of market data arrays (OHLCV) and associated indicators values
@@ -19,7 +22,7 @@ type SymbolData struct {
 	Highs 		[]float64
 	Lows 		[]float64
 	Closes 		[]float64
-	Volumes 	[]uint64
+	Volumes 	[]float64
 	Indicators 	map[string][]interface{}
 }
 
@@ -31,4 +34,52 @@ func (td *SymbolData) AddBar(bar Bar) {
 	td.Lows = append(td.Lows, bar.Low)
 	td.Closes = append(td.Closes, bar.Close)
 	td.Volumes = append(td.Volumes, bar.Volume)
+}
+
+// GetBar returns the Bar at the provided index of the SymbolData arrays
+func (td *SymbolData) GetBar(index int64) Bar {
+	return Bar{
+		Timestamp: td.Timestamps[index],
+		Open:      td.Opens[index],
+		High:      td.Highs[index],
+		Low:       td.Lows[index],
+		Close:     td.Closes[index],
+		Volume:    td.Volumes[index],
+	}
+}
+
+// TimeSeries represents a single value (eg/ gas price) sampled at ascending timestamps
+type TimeSeries struct {
+	Timestamps 	[]time.Time
+	Values 		[]float64
+}
+
+// ValueAt returns the latest value sampled at or before the provided timestamp, and false if there is none
+func (ts *TimeSeries) ValueAt(timestamp time.Time) (float64, bool) {
+	index := sort.Search(len(ts.Timestamps), func(i int) bool {
+		return ts.Timestamps[i].After(timestamp)
+	})
+	if index == 0 {
+		return 0.0, false
+	}
+	return ts.Values[index-1], true
+}
+
+// PoolReserves represents the historical reserves of a constant-product AMM pool for a base/quote pair
+type PoolReserves struct {
+	Timestamps 		[]time.Time
+	BaseReserves 	[]float64
+	QuoteReserves 	[]float64
+}
+
+// ReservesAt returns the latest (base, quote) reserves sampled at or before the provided timestamp, and false if there
+// are none
+func (pr *PoolReserves) ReservesAt(timestamp time.Time) (float64, float64, bool) {
+	index := sort.Search(len(pr.Timestamps), func(i int) bool {
+		return pr.Timestamps[i].After(timestamp)
+	})
+	if index == 0 {
+		return 0.0, 0.0, false
+	}
+	return pr.BaseReserves[index-1], pr.QuoteReserves[index-1], true
 }
\ No newline at end of file
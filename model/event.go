@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"math"
 	"time"
 )
 
@@ -15,6 +16,35 @@ const (
 	DecisionNothing = "NOTHING"
 )
 
+const (
+	OrderTypeMarket = "MARKET"
+	OrderTypeLimit = "LIMIT"
+	OrderTypeStop = "STOP"
+	OrderTypeStopLimit = "STOP_LIMIT"
+)
+
+const (
+	TimeInForceGTC = "GTC" 	// Good 'til cancelled
+	TimeInForceIOC = "IOC" 	// Immediate or cancel - unfilled Quantity is cancelled after the first bar
+	TimeInForceFOK = "FOK" 	// Fill or kill - cancelled unless the entire Quantity fills on the first bar
+	TimeInForceGTD = "GTD" 	// Good 'til date - expires after ExpireTimestamp
+)
+
+const (
+	OrderStatusNew = "NEW"
+	OrderStatusPartiallyFilled = "PARTIALLY_FILLED"
+	OrderStatusFilled = "FILLED"
+	OrderStatusCancelled = "CANCELLED"
+	OrderStatusExpired = "EXPIRED"
+)
+
+const (
+	ExitReasonSignal = "SIGNAL"
+	ExitReasonStopLoss = "STOP_LOSS"
+	ExitReasonTakeProfit = "TAKE_PROFIT"
+	ExitReasonTrailingStop = "TRAILING_STOP"
+)
+
 // MarketEvent (data) is the system heartbeat & represents the arrival of new data for the strategy to interpret
 type MarketEvent struct {
 	TraceId 	uuid.UUID
@@ -33,12 +63,19 @@ type SignalEvent struct {
 
 // OrderEvent (portfolio) are actions for the execution handler to execute
 type OrderEvent struct {
-	TraceId 	uuid.UUID
-	Timestamp 	time.Time
-	Symbol    	string
-	OrderType 	string  	// MARKET, LIMIT etc
-	Quantity   	float64		// +ve or -ve Quantity depending on Decision
-	Decision  	string		// LONG, CLOSE_LONG, SHORT or CLOSE_SHORT
+	TraceId 		uuid.UUID
+	OrderId 		uuid.UUID
+	Timestamp 		time.Time
+	Symbol    		string
+	OrderType 		string  	// MARKET, LIMIT, STOP or STOP_LIMIT
+	Quantity   		float64		// +ve or -ve Quantity depending on Decision
+	Decision  		string		// LONG, CLOSE_LONG, SHORT or CLOSE_SHORT
+	Price 			float64 	// Limit price of LIMIT & STOP_LIMIT orders, or the triggered level of protective exit MARKET orders
+	StopPrice 		float64 	// Trigger price of STOP & STOP_LIMIT orders
+	TimeInForce 	string 		// GTC, IOC, FOK or GTD
+	ExpireTimestamp time.Time 	// Expiry of GTD orders
+	Status 			string 		// NEW, PARTIALLY_FILLED, FILLED, CANCELLED or EXPIRED
+	ExitReason 		string 		// Why CLOSE_LONG & CLOSE_SHORT orders were generated eg/ SIGNAL or STOP_LOSS
 }
 
 func (o *OrderEvent) IsExit() bool {
@@ -53,18 +90,51 @@ func (o *OrderEvent) IsShort() bool {
 	return o.Decision == DecisionShort
 }
 
+// IsBuy determines if the OrderEvent increases the Quantity held (LONG or CLOSE_SHORT)
+func (o *OrderEvent) IsBuy() bool {
+	return o.Quantity > 0
+}
+
+// IsOpen determines if the OrderEvent can still be filled
+func (o *OrderEvent) IsOpen() bool {
+	return o.Status == OrderStatusNew || o.Status == OrderStatusPartiallyFilled
+}
+
+// CancelEvent (portfolio) are requests for the execution handler to cancel the unfilled Quantity of an OrderEvent
+type CancelEvent struct {
+	TraceId 	uuid.UUID
+	OrderId 	uuid.UUID
+	Timestamp 	time.Time
+	Symbol 		string
+	Reason 		string 		// Why the OrderEvent is no longer wanted
+}
+
+// OrderUpdateEvent (execution) are journals of OrderEvent status transitions sent back to the portfolio
+type OrderUpdateEvent struct {
+	TraceId 		uuid.UUID
+	OrderId 		uuid.UUID
+	Timestamp 		time.Time
+	Symbol 			string
+	Status 			string 		// NEW, PARTIALLY_FILLED, FILLED, CANCELLED or EXPIRED
+	FilledQuantity 	float64 	// +ve or -ve Quantity filled to date
+	Reason 			string 		// Explanation of CANCELLED & EXPIRED transitions
+}
+
 // FillEvent (execution) are journals of work done sent back to the portfolio to interpret and update holdings
 type FillEvent struct {
 	TraceId 		uuid.UUID
+	OrderId 		uuid.UUID
 	Timestamp  		time.Time
 	Symbol     		string
 	Exchange   		string
 	Quantity   		float64		// +ve or -ve Quantity depending on Decision
 	Decision  		string 		// LONG, CLOSE_LONG, SHORT or CLOSE_SHORT
 	FillValueGross  float64		// abs(Quantity) * ClosePrice, excluding TotalFees
+	FillPrice 		float64		// Effective price per unit, including the adverse price movement of SlippageFee
 	ExchangeFee 	float64		// All fees that Exchange imposes on the FillEvent
 	SlippageFee		float64		// Financial consequences of FillEvent Slippage modelled as a fee
 	NetworkFee		float64		// All fees incurred from transacting over the network (DEX) eg/ GAS
+	ExitReason 		string 		// ExitReason of the exit OrderEvent that was filled
 }
 
 // DetermineFillDirection determines the Direction of a FillEvent based on it's Quantity and Decision
@@ -80,22 +150,7 @@ func (f *FillEvent) DetermineFillDirection() (string, error) {
 	return direction, nil
 }
 
-// CalculateExchangeFee calculates the exchange fees incurred by the FillEvent
-func (f *FillEvent) CalculateExchangeFee() float64 {
-	return 0.0
-}
-
-// CalculateSlippageFee calculates the slippage fees (losses) incurred by the FillEvent
-func (f *FillEvent) CalculateSlippageFee() float64 {
-	return 0.0
-}
-
-// CalculateNetworkFee calculates the network fees (DEX) incurred by the FillEvent
-func (f *FillEvent) CalculateNetworkFee() float64 {
-	return 0.0
-}
-
-// CalculateFillValueGross calculates the total value transacted by the FillEvent excluding TotalFees
-func (f *FillEvent) CalculateFillValueGross() float64 {
-	return 0.0
+// CalculateFillValueGross calculates the total value transacted by the FillEvent at the fill price excluding TotalFees
+func (f *FillEvent) CalculateFillValueGross(price float64) float64 {
+	return math.Abs(f.Quantity) * price
 }
\ No newline at end of file
@@ -13,26 +13,34 @@ const (
 	DirectionShort = "SHORT"
 )
 
+// closedQuantityTolerance is the relative floating point error allowed when exit fills sum to the entered Quantity
+const closedQuantityTolerance = 1e-9
+
 type Position struct {
 	LastUpdateTraceId		uuid.UUID
 	LastUpdateTimestamp 	time.Time
 	Symbol 					string
 	Direction				string				// LONG or SHORT
 	Quantity 				float64				// +ve or -ve Quantity of Symbol contracts opened
+	ExitQuantity			float64				// +ve or -ve Quantity of Symbol contracts closed, same sign as Quantity
+
+	EnterTimestamp			time.Time			// Timestamp of the enter FillEvent
+	ExitTimestamp			time.Time			// Timestamp of the exit FillEvent
 
 	EnterFillFees			map[string]float64 	// map[feeType]feeAmount
 	EnterAvgPriceGross		float64				// Enter AvgPrice excluding EnterFillFees["totalFees"]
-	EnterFillValueGross		float64				// abs(Quantity) * EnterAvgPriceGross
+	EnterFillValueGross		float64				// abs(Quantity) * EnterAvgPriceGross, where the price is volume-weighted
 
 	ExitFillFees 			map[string]float64	// map[feeType]feeAmount
 	ExitAvgPriceGross		float64				// Exit AvgPrice excluding ExitFillFees["totalFees"]
-	ExitFillValueGross		float64				// abs(Quantity) * ExitAvgPriceGross
+	ExitFillValueGross		float64				// abs(ExitQuantity) * ExitAvgPriceGross, where the price is volume-weighted
 
 	CurrentSymbolPrice 		float64				// Symbol current close price
-	CurrentMarketValue 		float64				// abs(Quantity) * CurrentSymbolPrice
+	CurrentMarketValue 		float64				// abs(OpenQuantity()) * CurrentSymbolPrice
 
 	UnrealProfitLoss		float64 			// unrealised P&L whilst Position open
-	ResultProfitLoss		float64 			// realised P&L after Position closed
+	ResultProfitLoss		float64 			// realised P&L of the ExitQuantity closed to date
+	ExitReason				string				// Why the Position was closed eg/ SIGNAL, STOP_LOSS, TAKE_PROFIT or TRAILING_STOP
 }
 
 // Enter enriches a new Position using information from an enter FillEvent
@@ -40,6 +48,7 @@ func (p *Position) Enter(fill FillEvent) error {
 	p.LastUpdateTraceId = fill.TraceId
 	p.LastUpdateTimestamp = fill.Timestamp
 	p.Symbol = fill.Symbol
+	p.EnterTimestamp = fill.Timestamp
 
 	// Direction
 	direction, err := fill.DetermineFillDirection()
@@ -70,6 +79,7 @@ func (p *Position) Enter(fill FillEvent) error {
 	p.ExitFillFees["TotalFees"] = 0.0
 
 	// Exit Price & Value
+	p.ExitQuantity = 0.0
 	p.ExitAvgPriceGross = 0.0
 	//p.ExitAvgPriceNet = 0.0
 	p.ExitFillValueGross = 0.0
@@ -85,13 +95,43 @@ func (p *Position) Enter(fill FillEvent) error {
 	return nil
 }
 
+// Increase adds the Quantity of a further enter FillEvent to an open Position, volume-weighting the EnterAvgPriceGross
+func (p *Position) Increase(fill FillEvent) error {
+	direction, err := fill.DetermineFillDirection()
+	if err != nil || direction != p.Direction {
+		return errors.New(fmt.Sprintf("failed Position.Increase() with FillEvent in the wrong Direction: %+v", fill))
+	}
+	p.LastUpdateTraceId = fill.TraceId
+	p.LastUpdateTimestamp = fill.Timestamp
+
+	p.Quantity += fill.Quantity
+	addFillFees(p.EnterFillFees, fill)
+
+	// Enter Price & Value
+	p.EnterFillValueGross += fill.FillValueGross
+	p.EnterAvgPriceGross = p.EnterFillValueGross / math.Abs(p.Quantity)
+	p.CurrentMarketValue = p.CurrentSymbolPrice * math.Abs(p.OpenQuantity())
+
+	return nil
+}
+
+// OpenQuantity returns the +ve or -ve Quantity of Symbol contracts still open
+func (p *Position) OpenQuantity() float64 {
+	return p.Quantity - p.ExitQuantity
+}
+
+// IsClosed determines if exit FillEvents have closed the entire Quantity of the Position
+func (p *Position) IsClosed() bool {
+	return p.Quantity != 0 && math.Abs(p.OpenQuantity()) <= closedQuantityTolerance*math.Abs(p.Quantity)
+}
+
 // Update updates the Position instance on every MarketEvent
 func (p *Position) Update(market MarketEvent) error {
 	p.LastUpdateTraceId = market.TraceId
 	p.LastUpdateTimestamp = market.Timestamp
 
 	p.CurrentSymbolPrice = market.Close
-	p.CurrentMarketValue = market.Close * math.Abs(p.Quantity)
+	p.CurrentMarketValue = market.Close * math.Abs(p.OpenQuantity())
 
 	// Unreal Profit & Loss
 	unrealProfitLoss, err := calculateUnrealProfitLoss(*p)
@@ -103,20 +143,24 @@ func (p *Position) Update(market MarketEvent) error {
 	return nil
 }
 
-// Exit closes an existing Position with information from an exit FillEvent
+// Exit closes some or all of an existing Position with information from an exit FillEvent
 func (p *Position) Exit(fill FillEvent) error {
+	if math.Abs(fill.Quantity) > math.Abs(p.OpenQuantity())*(1+closedQuantityTolerance) {
+		return errors.New(fmt.Sprintf("failed Position.Exit() with FillEvent Quantity exceeding the open Quantity: %+v", fill))
+	}
 	p.LastUpdateTraceId = fill.TraceId
 	p.LastUpdateTimestamp = fill.Timestamp
+	p.ExitTimestamp = fill.Timestamp
+	p.ExitReason = fill.ExitReason
 
-	// Exit Fees
-	p.ExitFillFees["ExchangeFee"] = fill.ExchangeFee
-	p.ExitFillFees["SlippageFee"] = fill.SlippageFee
-	p.ExitFillFees["NetworkFee"] = fill.NetworkFee
-	p.ExitFillFees["TotalFees"] = fill.ExchangeFee + fill.SlippageFee + fill.NetworkFee
+	// Exit fills reduce the Position, so have the opposite sign to Quantity
+	p.ExitQuantity -= fill.Quantity
+	addFillFees(p.ExitFillFees, fill)
 
 	// Exit Price & Value
-	p.ExitAvgPriceGross = fill.FillValueGross / math.Abs(fill.Quantity)
-	p.ExitFillValueGross = math.Abs(fill.Quantity) * p.ExitAvgPriceGross
+	p.ExitFillValueGross += fill.FillValueGross
+	p.ExitAvgPriceGross = p.ExitFillValueGross / math.Abs(p.ExitQuantity)
+	p.CurrentMarketValue = p.CurrentSymbolPrice * math.Abs(p.OpenQuantity())
 
 	// Result Profit & Loss
 	resultProfitLoss, err := calculateResultProfitLoss(*p)
@@ -128,16 +172,27 @@ func (p *Position) Exit(fill FillEvent) error {
 	return nil
 }
 
+// addFillFees accumulates the fees of a FillEvent into a map[feeType]feeAmount
+func addFillFees(fees map[string]float64, fill FillEvent) {
+	fees["ExchangeFee"] += fill.ExchangeFee
+	fees["SlippageFee"] += fill.SlippageFee
+	fees["NetworkFee"] += fill.NetworkFee
+	fees["TotalFees"] += fill.ExchangeFee + fill.SlippageFee + fill.NetworkFee
+}
+
 // Todo: https://help.bybit.com/hc/en-us/articles/900000630066-P-L-calculations-USDT-Contract-
-// calculateUnrealProfitLoss calculates the Unreal Profit&Loss given a copy of the entered Position
+// calculateUnrealProfitLoss calculates the Unreal Profit&Loss of the open Quantity given a copy of the entered Position
 func calculateUnrealProfitLoss(position Position) (float64, error) {
 	var profitLoss float64
 
-	totalFees := position.EnterFillFees["TotalFees"] * 2
+	// Only the open fraction of the Position's enter value & fees remains unrealised
+	openFraction := position.OpenQuantity() / position.Quantity
+	enterValueOpen := position.EnterFillValueGross * openFraction
+	totalFees := position.EnterFillFees["TotalFees"] * openFraction * 2
 	if position.Direction == DirectionLong && position.Quantity > 0 {
-		profitLoss = (position.CurrentMarketValue - position.EnterFillValueGross) - totalFees
+		profitLoss = (position.CurrentMarketValue - enterValueOpen) - totalFees
 	} else if position.Direction == DirectionShort && position.Quantity < 0 {
-		profitLoss = (position.EnterFillValueGross - position.CurrentMarketValue) - totalFees
+		profitLoss = (enterValueOpen - position.CurrentMarketValue) - totalFees
 	} else {
 		return profitLoss, errors.New("failed calculateUnrealProfitLoss due to ambiguous Direction & Quantity")
 	}
@@ -145,15 +200,18 @@ func calculateUnrealProfitLoss(position Position) (float64, error) {
 	return profitLoss, nil
 }
 
-// calculateResultProfitLoss calculates the Result Profit&Loss given a copy of the exited Position
+// calculateResultProfitLoss calculates the Result Profit&Loss of the ExitQuantity given a copy of the exited Position
 func calculateResultProfitLoss(position Position) (float64, error) {
 	var profitLoss float64
 
-	totalFees := position.EnterFillFees["TotalFees"] + position.ExitFillFees["TotalFees"]
+	// Only the exited fraction of the Position's enter value & fees is realised
+	exitFraction := position.ExitQuantity / position.Quantity
+	enterValueExited := position.EnterFillValueGross * exitFraction
+	totalFees := position.EnterFillFees["TotalFees"]*exitFraction + position.ExitFillFees["TotalFees"]
 	if position.Direction == DirectionLong && position.Quantity > 0 {
-		profitLoss = (position.ExitFillValueGross - position.EnterFillValueGross) - totalFees
+		profitLoss = (position.ExitFillValueGross - enterValueExited) - totalFees
 	} else if position.Direction == DirectionShort && position.Quantity < 0 {
-		profitLoss = (position.EnterFillValueGross - position.ExitFillValueGross) - totalFees
+		profitLoss = (enterValueExited - position.ExitFillValueGross) - totalFees
 	} else {
 		return profitLoss, errors.New("failed calculateResultProfitLoss due to ambiguous Direction & Quantity")
 	}
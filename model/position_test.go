@@ -38,6 +38,7 @@ func TestPosition_Enter(t *testing.T) {
 				Symbol:              "ETH-USD",
 				Direction:           DecisionLong,
 				Quantity:            10,
+				EnterTimestamp:      testTimestamp,
 				EnterFillFees:       map[string]float64{
 					"ExchangeFee": 10,
 					"SlippageFee": 50,
@@ -73,4 +74,70 @@ func TestPosition_Enter(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestPosition_Exit_partialFills(t *testing.T) {
+	testCases := []struct {
+		name                     string
+		enterFills               []FillEvent
+		exitFills                []FillEvent
+		expectedEnterAvgPrice    float64
+		expectedResultProfitLoss float64
+		expectedClosed           bool
+	}{
+		{
+			name: "TestPosition_Exit_partialFills_longVolumeWeightedEnter",
+			enterFills: []FillEvent{
+				{Quantity: 10, Decision: DecisionLong, FillValueGross: 1000, ExchangeFee: 10},
+				{Quantity: 30, Decision: DecisionLong, FillValueGross: 3600, ExchangeFee: 30},
+			},
+			exitFills: []FillEvent{
+				{Quantity: -20, Decision: DecisionCloseLong, FillValueGross: 2600, ExchangeFee: 20},
+			},
+			expectedEnterAvgPrice:    115,
+			expectedResultProfitLoss: (2600 - 2300) - 20 - 20,
+			expectedClosed:           false,
+		},
+		{
+			name: "TestPosition_Exit_partialFills_shortClosedInTwoFills",
+			enterFills: []FillEvent{
+				{Quantity: -10, Decision: DecisionShort, FillValueGross: 1000},
+			},
+			exitFills: []FillEvent{
+				{Quantity: 4, Decision: DecisionCloseShort, FillValueGross: 360},
+				{Quantity: 6, Decision: DecisionCloseShort, FillValueGross: 480},
+			},
+			expectedEnterAvgPrice:    100,
+			expectedResultProfitLoss: 1000 - 840,
+			expectedClosed:           true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			position := Position{}
+			if err := position.Enter(testCase.enterFills[0]); err != nil {
+				t.Fatal(err)
+			}
+			for _, fill := range testCase.enterFills[1:] {
+				if err := position.Increase(fill); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, fill := range testCase.exitFills {
+				if err := position.Exit(fill); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if position.EnterAvgPriceGross != testCase.expectedEnterAvgPrice {
+				t.Fatalf("expected EnterAvgPriceGross %v, got %v", testCase.expectedEnterAvgPrice, position.EnterAvgPriceGross)
+			}
+			if position.ResultProfitLoss != testCase.expectedResultProfitLoss {
+				t.Fatalf("expected ResultProfitLoss %v, got %v", testCase.expectedResultProfitLoss, position.ResultProfitLoss)
+			}
+			if position.IsClosed() != testCase.expectedClosed {
+				t.Fatalf("expected IsClosed %v, got %v", testCase.expectedClosed, position.IsClosed())
+			}
+		})
+	}
+}
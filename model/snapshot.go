@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Snapshot represents the state of a portfolio at the close of a bar
+type Snapshot struct {
+	Timestamp        time.Time
+	Cash             float64
+	MarketValue      float64            // Value of all open Positions
+	TotalValue       float64            // Cash + MarketValue
+	Exposures        map[string]float64 // map[Symbol]Exposure, +ve for LONG & -ve for SHORT Positions
+	UnrealProfitLoss float64            // unrealised P&L of all open Positions
+	RealProfitLoss   float64            // realised P&L of all Positions closed to date
+	SymbolValues     map[string]float64 // map[Symbol]Value of the Symbol's starting cash plus its P&L to date
+}
@@ -0,0 +1,255 @@
+package portfolio
+
+import (
+	"fmt"
+	"github.com/markcheno/go-talib"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExitRuleMethodPercentage = "pct"
+	ExitRuleMethodATR        = "atr"
+)
+
+const (
+	ExitPriorityStopFirst   = "STOP_FIRST"   // Assume stops are touched before targets, the pessimistic default
+	ExitPriorityTargetFirst = "TARGET_FIRST" // Assume targets are touched before stops
+	ExitPriorityNearestOpen = "NEAREST_OPEN" // Assume the level nearest the bar's open is touched first
+)
+
+// ExitManager attaches protective exits to entered Positions & determines if a bar triggers one of them
+type ExitManager interface {
+	Attach(model.Position, *model.SymbolData, int64)
+	Detach(symbol string)
+	EvaluateExit(model.Position, model.Bar) (string, float64)
+}
+
+// ExitRule is the distance a protective exit is placed away from a price, either a Fraction of the price or a
+// multiple of the Average True Range
+type ExitRule struct {
+	Method      string
+	Fraction    float64
+	ATRPeriod   int
+	ATRMultiple float64
+}
+
+// distance returns the price distance of the exit, zero if there is not yet enough data to calculate the ATR
+func (r *ExitRule) distance(price float64, atr float64) float64 {
+	if r.Method == ExitRuleMethodATR {
+		return atr * r.ATRMultiple
+	}
+	return price * r.Fraction
+}
+
+// calculateATR returns the rule's Average True Range at the index, zero if there are too few bars to calculate it
+func (r *ExitRule) calculateATR(data *model.SymbolData, index int64) float64 {
+	if r.Method != ExitRuleMethodATR || index < int64(r.ATRPeriod) {
+		return 0.0
+	}
+	return talib.Atr(data.Highs[:index+1], data.Lows[:index+1], data.Closes[:index+1], r.ATRPeriod)[index]
+}
+
+// exitLevels are the prices at which a Position's protective exits trigger, zero when not set
+type exitLevels struct {
+	stopLoss     float64
+	takeProfit   float64
+	trailingStop float64
+	trailingATR  float64 // ATR at entry the trailing stop distance is fixed to
+}
+
+// exitTrigger is a protective exit touched by a bar
+type exitTrigger struct {
+	reason string
+	level  float64
+}
+
+// Exits manages fixed stop-loss & take-profit levels and a trailing stop for each Symbol's open Position
+type Exits struct {
+	StopLoss     *ExitRule
+	TakeProfit   *ExitRule
+	TrailingStop *ExitRule
+	Priority     string
+	levels       map[string]*exitLevels
+}
+
+// Attach places the protective exits around the Position's EnterAvgPriceGross - further enter fills move the fixed
+// levels to the new average price, whilst the trailing stop keeps ratcheting from where it is
+func (e *Exits) Attach(position model.Position, data *model.SymbolData, index int64) {
+	direction := 1.0
+	if position.Direction == model.DirectionShort {
+		direction = -1.0
+	}
+	price := position.EnterAvgPriceGross
+
+	levels, isAttached := e.levels[position.Symbol]
+	if !isAttached {
+		levels = &exitLevels{}
+		e.levels[position.Symbol] = levels
+	}
+
+	if e.StopLoss != nil {
+		if distance := e.StopLoss.distance(price, e.StopLoss.calculateATR(data, index)); distance > 0 {
+			levels.stopLoss = price - direction*distance
+		}
+	}
+	if e.TakeProfit != nil {
+		if distance := e.TakeProfit.distance(price, e.TakeProfit.calculateATR(data, index)); distance > 0 {
+			levels.takeProfit = price + direction*distance
+		}
+	}
+	if e.TrailingStop != nil && !isAttached {
+		levels.trailingATR = e.TrailingStop.calculateATR(data, index)
+		if distance := e.TrailingStop.distance(price, levels.trailingATR); distance > 0 {
+			levels.trailingStop = price - direction*distance
+		}
+	}
+}
+
+// Detach removes the protective exits of a closed Position
+func (e *Exits) Detach(symbol string) {
+	delete(e.levels, symbol)
+}
+
+// EvaluateExit checks the bar's High & Low against the Position's protective exits, returning the ExitReason of the
+// exit that triggered & the price it fills at, or an empty string if none did. If no exit triggered the trailing stop
+// ratchets behind the bar's most favourable price, ready for the next bar.
+func (e *Exits) EvaluateExit(position model.Position, bar model.Bar) (string, float64) {
+	levels, isAttached := e.levels[position.Symbol]
+	if !isAttached {
+		return "", 0.0
+	}
+	isLong := position.Direction == model.DirectionLong
+
+	var triggers []exitTrigger
+	if touchedStop(isLong, levels.stopLoss, bar) {
+		triggers = append(triggers, exitTrigger{reason: model.ExitReasonStopLoss, level: levels.stopLoss})
+	}
+	if touchedStop(isLong, levels.trailingStop, bar) {
+		triggers = append(triggers, exitTrigger{reason: model.ExitReasonTrailingStop, level: levels.trailingStop})
+	}
+	// Targets are touched from the opposite side to stops
+	if touchedStop(!isLong, levels.takeProfit, bar) {
+		triggers = append(triggers, exitTrigger{reason: model.ExitReasonTakeProfit, level: levels.takeProfit})
+	}
+
+	if len(triggers) == 0 {
+		e.ratchetTrailingStop(levels, isLong, bar)
+		return "", 0.0
+	}
+	trigger := e.prioritise(triggers, bar)
+	return trigger.reason, trigger.fillPrice(isLong, bar)
+}
+
+// ratchetTrailingStop moves the trailing stop towards the bar's most favourable price, but never away from it
+func (e *Exits) ratchetTrailingStop(levels *exitLevels, isLong bool, bar model.Bar) {
+	if e.TrailingStop == nil || levels.trailingStop == 0 {
+		return
+	}
+	if isLong {
+		levels.trailingStop = math.Max(levels.trailingStop, bar.High-e.TrailingStop.distance(bar.High, levels.trailingATR))
+	} else {
+		levels.trailingStop = math.Min(levels.trailingStop, bar.Low+e.TrailingStop.distance(bar.Low, levels.trailingATR))
+	}
+}
+
+// prioritise decides which of several exits touched by the same bar triggered first, as the order prices were
+// reached within the bar is unknown
+func (e *Exits) prioritise(triggers []exitTrigger, bar model.Bar) exitTrigger {
+	sort.SliceStable(triggers, func(i, j int) bool {
+		return math.Abs(triggers[i].level-bar.Open) < math.Abs(triggers[j].level-bar.Open)
+	})
+
+	for _, trigger := range triggers {
+		isTarget := trigger.reason == model.ExitReasonTakeProfit
+		if (e.Priority == ExitPriorityStopFirst && !isTarget) || (e.Priority == ExitPriorityTargetFirst && isTarget) {
+			return trigger
+		}
+	}
+	return triggers[0]
+}
+
+// fillPrice returns the price the triggered exit fills at - its level, or the bar's open if the bar gapped through
+// the level. LONG stops & SHORT targets are reached as the price falls, LONG targets & SHORT stops as it rises.
+func (t exitTrigger) fillPrice(isLong bool, bar model.Bar) float64 {
+	isTarget := t.reason == model.ExitReasonTakeProfit
+	if isLong != isTarget {
+		return math.Min(bar.Open, t.level)
+	}
+	return math.Max(bar.Open, t.level)
+}
+
+// touchedStop determines if a bar traded through a stop level - below it for LONG Positions & above it for SHORT
+func touchedStop(isLong bool, level float64, bar model.Bar) bool {
+	if level == 0 {
+		return false
+	}
+	if isLong {
+		return bar.Low <= level
+	}
+	return bar.High >= level
+}
+
+// parseExitRule constructs an ExitRule from a specification in the format "pct:fraction" or "atr:period:multiple",
+// eg/ "pct:0.05" or "atr:14:2". An empty specification returns a nil ExitRule.
+func parseExitRule(specification string) (*ExitRule, error) {
+	specification = strings.TrimSpace(specification)
+	if specification == "" {
+		return nil, nil
+	}
+
+	params := strings.Split(specification, ":")
+	switch {
+	case params[0] == ExitRuleMethodPercentage && len(params) == 2:
+		fraction, err := strconv.ParseFloat(strings.TrimSpace(params[1]), 64)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse exit rule fraction %s", params[1]))
+		}
+		if fraction <= 0 {
+			return nil, errors.New(fmt.Sprintf("exit rule fraction %v must be positive", fraction))
+		}
+		return &ExitRule{Method: ExitRuleMethodPercentage, Fraction: fraction}, nil
+
+	case params[0] == ExitRuleMethodATR && len(params) == 3:
+		period, err := strconv.Atoi(strings.TrimSpace(params[1]))
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse exit rule ATR period %s", params[1]))
+		}
+		multiple, err := strconv.ParseFloat(strings.TrimSpace(params[2]), 64)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse exit rule ATR multiple %s", params[2]))
+		}
+		if period <= 0 || multiple <= 0 {
+			return nil, errors.New(fmt.Sprintf("exit rule ATR period %v & multiple %v must be positive", period, multiple))
+		}
+		return &ExitRule{Method: ExitRuleMethodATR, ATRPeriod: period, ATRMultiple: multiple}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("unsupported exit rule %s", specification))
+}
+
+// NewExits constructs an ExitManager from STOP_LOSS, TAKE_PROFIT & TRAILING_STOP specifications & an EXIT_PRIORITY
+func NewExits(stopLoss string, takeProfit string, trailingStop string, priority string) (*Exits, error) {
+	switch priority {
+	case ExitPriorityStopFirst, ExitPriorityTargetFirst, ExitPriorityNearestOpen:
+	default:
+		return &Exits{}, errors.New(fmt.Sprintf("unsupported exit priority %s", priority))
+	}
+
+	exits := &Exits{Priority: priority, levels: make(map[string]*exitLevels)}
+	var err error
+	if exits.StopLoss, err = parseExitRule(stopLoss); err != nil {
+		return &Exits{}, errors.Wrap(err, "failed to parse stop loss")
+	}
+	if exits.TakeProfit, err = parseExitRule(takeProfit); err != nil {
+		return &Exits{}, errors.Wrap(err, "failed to parse take profit")
+	}
+	if exits.TrailingStop, err = parseExitRule(trailingStop); err != nil {
+		return &Exits{}, errors.Wrap(err, "failed to parse trailing stop")
+	}
+	return exits, nil
+}
@@ -0,0 +1,237 @@
+package portfolio
+
+import (
+	"github.com/eapache/queue"
+	"github.com/google/uuid"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestExits_EvaluateExit(t *testing.T) {
+	long := model.Position{Symbol: "ETH-USD", Direction: model.DirectionLong, EnterAvgPriceGross: 100}
+	short := model.Position{Symbol: "ETH-USD", Direction: model.DirectionShort, EnterAvgPriceGross: 100}
+
+	testCases := []struct {
+		name           string
+		stopLoss       string
+		takeProfit     string
+		trailingStop   string
+		priority       string
+		position       model.Position
+		bars           []model.Bar
+		expectedReason string
+		expectedPrice  float64
+	}{
+		{
+			name:           "TestExits_EvaluateExit_longNotTouched",
+			stopLoss:       "pct:0.05",
+			takeProfit:     "pct:0.1",
+			priority:       ExitPriorityStopFirst,
+			position:       long,
+			bars:           []model.Bar{{Open: 100, High: 109, Low: 96}},
+			expectedReason: "",
+		},
+		{
+			name:           "TestExits_EvaluateExit_shortStopLoss",
+			stopLoss:       "pct:0.05",
+			priority:       ExitPriorityStopFirst,
+			position:       short,
+			bars:           []model.Bar{{Open: 100, High: 106, Low: 99}},
+			expectedReason: model.ExitReasonStopLoss,
+			expectedPrice:  105,
+		},
+		{
+			name:           "TestExits_EvaluateExit_bothTouchedStopFirst",
+			stopLoss:       "pct:0.05",
+			takeProfit:     "pct:0.1",
+			priority:       ExitPriorityStopFirst,
+			position:       long,
+			bars:           []model.Bar{{Open: 108, High: 111, Low: 94}},
+			expectedReason: model.ExitReasonStopLoss,
+			expectedPrice:  95,
+		},
+		{
+			name:           "TestExits_EvaluateExit_bothTouchedTargetFirst",
+			stopLoss:       "pct:0.05",
+			takeProfit:     "pct:0.1",
+			priority:       ExitPriorityTargetFirst,
+			position:       long,
+			bars:           []model.Bar{{Open: 97, High: 111, Low: 94}},
+			expectedReason: model.ExitReasonTakeProfit,
+			expectedPrice:  110,
+		},
+		{
+			name:           "TestExits_EvaluateExit_bothTouchedNearestOpen",
+			stopLoss:       "pct:0.05",
+			takeProfit:     "pct:0.1",
+			priority:       ExitPriorityNearestOpen,
+			position:       long,
+			bars:           []model.Bar{{Open: 108, High: 111, Low: 94}},
+			expectedReason: model.ExitReasonTakeProfit,
+			expectedPrice:  110,
+		},
+		{
+			name:         "TestExits_EvaluateExit_trailingStopRatchets",
+			stopLoss:     "pct:0.05",
+			trailingStop: "pct:0.05",
+			priority:     ExitPriorityStopFirst,
+			position:     long,
+			bars: []model.Bar{
+				{Open: 100, High: 120, Low: 99},
+				{Open: 118, High: 119, Low: 113},
+			},
+			expectedReason: model.ExitReasonTrailingStop,
+			expectedPrice:  114,
+		},
+		{
+			name:           "TestExits_EvaluateExit_longStopGappedThrough",
+			stopLoss:       "pct:0.05",
+			priority:       ExitPriorityStopFirst,
+			position:       long,
+			bars:           []model.Bar{{Open: 90, High: 92, Low: 88}},
+			expectedReason: model.ExitReasonStopLoss,
+			expectedPrice:  90,
+		},
+		{
+			name:           "TestExits_EvaluateExit_shortTargetGappedThrough",
+			takeProfit:     "pct:0.1",
+			priority:       ExitPriorityStopFirst,
+			position:       short,
+			bars:           []model.Bar{{Open: 85, High: 87, Low: 84}},
+			expectedReason: model.ExitReasonTakeProfit,
+			expectedPrice:  85,
+		},
+		{
+			name:           "TestExits_EvaluateExit_longTargetGappedThrough",
+			takeProfit:     "pct:0.1",
+			priority:       ExitPriorityStopFirst,
+			position:       long,
+			bars:           []model.Bar{{Open: 115, High: 116, Low: 112}},
+			expectedReason: model.ExitReasonTakeProfit,
+			expectedPrice:  115,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			exits, err := NewExits(testCase.stopLoss, testCase.takeProfit, testCase.trailingStop, testCase.priority)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exits.Attach(testCase.position, &model.SymbolData{}, 0)
+
+			var reason string
+			var price float64
+			for _, bar := range testCase.bars {
+				if reason, price = exits.EvaluateExit(testCase.position, bar); reason != "" {
+					break
+				}
+			}
+
+			if reason != testCase.expectedReason {
+				t.Fatalf("expected exit reason %q, got %q", testCase.expectedReason, reason)
+			}
+			if math.Abs(price-testCase.expectedPrice) > 1e-9 {
+				t.Fatalf("expected exit price %v, got %v", testCase.expectedPrice, price)
+			}
+		})
+	}
+}
+
+func TestPortfolio_UpdateFromMarket_workingOrderExit(t *testing.T) {
+	enterTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	exitTimestamp := enterTimestamp.Add(24 * time.Hour)
+
+	testCases := []struct {
+		name           string
+		openOrder      model.OrderEvent
+		expectedCancel bool
+		expectedExit   bool
+	}{
+		{
+			name: "TestPortfolio_UpdateFromMarket_workingOrderExit_restingLimitSignalExit",
+			openOrder: model.OrderEvent{OrderType: model.OrderTypeLimit, Quantity: -10, Decision: model.DecisionCloseLong,
+				Price: 110, TimeInForce: model.TimeInForceGTC, ExitReason: model.ExitReasonSignal},
+			expectedCancel: true,
+			expectedExit:   true,
+		},
+		{
+			name: "TestPortfolio_UpdateFromMarket_workingOrderExit_entryRemainder",
+			openOrder: model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: 20, Decision: model.DecisionLong,
+				TimeInForce: model.TimeInForceGTC},
+			expectedCancel: true,
+			expectedExit:   true,
+		},
+		{
+			name: "TestPortfolio_UpdateFromMarket_workingOrderExit_protectiveExitRemainder",
+			openOrder: model.OrderEvent{OrderType: model.OrderTypeMarket, Quantity: -10, Decision: model.DecisionCloseLong,
+				Price: 95, TimeInForce: model.TimeInForceGTC, ExitReason: model.ExitReasonStopLoss},
+			expectedCancel: false,
+			expectedExit:   false,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := &fakeHandler{}
+			handler.symbolData.AddBar(model.Bar{Timestamp: enterTimestamp, Open: 100, High: 100, Low: 100, Close: 100,
+				Volume: 1000})
+			cfg := config.Trader{Log: zap.NewNop(), Symbol: "ETH-USD", StartingCash: 10000, DefaultOrderValue: 1000,
+				OrderType: model.OrderTypeMarket, StopLoss: "pct:0.05", ExitPriority: ExitPriorityStopFirst}
+			eventQ := queue.New()
+			p, err := NewPortfolio([]config.Trader{cfg}, eventQ, map[string]data.Handler{"ETH-USD": handler})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Enter 10 units at 100 with a stop at 95, whilst an order on the Symbol is still working
+			err = p.UpdateFromFill(model.FillEvent{Timestamp: enterTimestamp, Symbol: "ETH-USD", Decision: model.DecisionLong,
+				Quantity: 10, FillValueGross: 1000, FillPrice: 100})
+			if err != nil {
+				t.Fatal(err)
+			}
+			openOrder := testCase.openOrder
+			openOrder.OrderId = uuid.New()
+			openOrder.Timestamp = enterTimestamp
+			openOrder.Symbol = "ETH-USD"
+			openOrder.Status = model.OrderStatusNew
+			p.submitOrder(openOrder)
+			eventQ.Remove()
+
+			// The next bar breaks the stop
+			handler.symbolData = model.SymbolData{}
+			handler.symbolData.AddBar(model.Bar{Timestamp: exitTimestamp, Open: 96, High: 97, Low: 90, Close: 92, Volume: 1000})
+			if err := p.UpdateFromMarket(model.MarketEvent{Timestamp: exitTimestamp, Symbol: "ETH-USD", Close: 92}); err != nil {
+				t.Fatal(err)
+			}
+
+			var cancels []model.CancelEvent
+			var exits []model.OrderEvent
+			for eventQ.Length() > 0 {
+				switch event := eventQ.Remove().(type) {
+				case model.CancelEvent:
+					if len(exits) > 0 {
+						t.Fatal("expected the working order to be cancelled before the exit is sent")
+					}
+					cancels = append(cancels, event)
+				case model.OrderEvent:
+					exits = append(exits, event)
+				}
+			}
+
+			if testCase.expectedCancel != (len(cancels) == 1) || (len(cancels) == 1 && cancels[0].OrderId != openOrder.OrderId) {
+				t.Fatalf("expected cancel of the working order %v, got %+v", testCase.expectedCancel, cancels)
+			}
+			if testCase.expectedExit != (len(exits) == 1) {
+				t.Fatalf("expected stop loss exit %v, got %+v", testCase.expectedExit, exits)
+			}
+			if testCase.expectedExit && (exits[0].Quantity != -10 || exits[0].Price != 95 ||
+				exits[0].ExitReason != model.ExitReasonStopLoss) {
+				t.Fatalf("expected STOP_LOSS exit of -10 at 95, got %+v", exits[0])
+			}
+		})
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/eapache/queue"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/statistics"
 	"go.uber.org/zap"
 	"math"
 	"time"
@@ -17,50 +19,148 @@ type Portfolio interface {
 	UpdateFromMarket(event model.MarketEvent) error
 	GenerateOrders(model.SignalEvent) error
 	UpdateFromFill(model.FillEvent) error
-
-	// Todo: For dev only!
-	GetPortfolio() (float64, float64, float64, map[string][]model.Position)
+	UpdateFromOrder(model.OrderUpdateEvent) error
+	GetOrders() []model.OrderEvent
+	GetFills() []model.FillEvent
+	GetHistoricPositions() map[string][]model.Position
+	GetSnapshots() []model.Snapshot
+	GetEquityCurve() []statistics.EquityPoint
+	GetSymbolEquityCurves() map[string][]statistics.EquityPoint
 }
 
 type portfolio struct {
 	log              *zap.Logger
 	eventQ           *queue.Queue
-	data              data.Handler
+	data              map[string]data.Handler // map[Symbol]Handler of every Symbol sharing the portfolio
 	sizeManager       SizeManager
 	riskManager       RiskManager
-	symbol            string
+	exitManager       ExitManager
 	initialCash       float64
 	currentCash       float64
 	currentValue      float64
 	orders            []model.OrderEvent
+	openOrders        map[string]model.OrderEvent // map[Symbol]OrderEvent of the Symbol's unfilled order
 	fills             []model.FillEvent
 	positions         map[string]model.Position
 	historicPositions map[string][]model.Position
+	realProfitLoss    float64
+	symbolCash        map[string]float64 // map[Symbol]StartingCash allocated to the Symbol
+	symbolProfitLoss  map[string]float64 // map[Symbol]realised P&L of the Symbol
+	snapshots         []model.Snapshot
 }
 
-// UpdateFromMarket updates the current portfolio positions using the new market event data
+// UpdateFromMarket revalues every open position in the portfolio at the latest close of its Symbol, and checks the
+// new market event's bar against the protective exits of its Symbol's position
 func (p *portfolio) UpdateFromMarket(market model.MarketEvent) error {
 	// Update current positions
-	if position, isInvested := p.isInvested(p.symbol); isInvested {
-		err := position.Update(market)
+	for symbol := range p.positions {
+		position, isInvested := p.isInvested(symbol)
+		if !isInvested {
+			continue
+		}
+		currentData, latestBarIndex := p.data[symbol].GetLatestData()
+		latestBar := currentData.GetBar(latestBarIndex)
+		err := position.Update(model.MarketEvent{
+			TraceId:   market.TraceId,
+			Timestamp: market.Timestamp,
+			Symbol:    symbol,
+			Close:     latestBar.Close,
+		})
 		if err != nil {
 			return errors.Wrap(err, "failed portfolio.UpdateFromMarket()")
 		}
-		p.positions[p.symbol] = position
+		p.positions[symbol] = position
+
+		// Check the bar's range against the protective exits
+		if symbol != market.Symbol {
+			continue
+		}
+		reason, price := p.exitManager.EvaluateExit(position, latestBar)
+		if reason == "" {
+			continue
+		}
+		if openOrder, hasOpenOrder := p.openOrders[symbol]; hasOpenOrder {
+			// The unfilled remainder of an earlier protective exit keeps working to close the Position
+			if openOrder.IsExit() && openOrder.ExitReason != model.ExitReasonSignal {
+				continue
+			}
+			// Working entries & resting signal exits are cancelled so they cannot change the Position once it is closed
+			p.cancelOrder(market, openOrder, fmt.Sprintf("replaced by %s exit", reason))
+		}
+		p.generateExitOrder(market, position, reason, price)
 	}
 
 	// Update currentValue
-	p.currentValue = p.currentCash + p.positions[p.symbol].CurrentMarketValue
+	p.updateValue()
+
+	// Record the state of the portfolio at the close of this bar - every Symbol sharing the portfolio updates the
+	// same Snapshot of a timestamp
+	snapshot := p.takeSnapshot(market.Timestamp)
+	if latest := len(p.snapshots) - 1; latest >= 0 && p.snapshots[latest].Timestamp.Equal(market.Timestamp) {
+		p.snapshots[latest] = snapshot
+	} else {
+		p.snapshots = append(p.snapshots, snapshot)
+	}
 
 	return nil
 }
 
+// updateValue sets the currentValue of the portfolio to its cash plus the value of every open position
+func (p *portfolio) updateValue() {
+	p.currentValue = p.currentCash
+	for symbol, position := range p.positions {
+		if _, isInvested := p.isInvested(symbol); isInvested {
+			p.currentValue += calculatePositionValue(position)
+		}
+	}
+}
+
+// takeSnapshot captures the current cash, value, exposures & P&L of the portfolio
+func (p *portfolio) takeSnapshot(timestamp time.Time) model.Snapshot {
+	snapshot := model.Snapshot{
+		Timestamp:      timestamp,
+		Cash:           p.currentCash,
+		Exposures:      make(map[string]float64),
+		RealProfitLoss: p.realProfitLoss,
+		SymbolValues:   make(map[string]float64),
+	}
+	for symbol, cash := range p.symbolCash {
+		snapshot.SymbolValues[symbol] = cash + p.symbolProfitLoss[symbol]
+	}
+	for symbol, position := range p.positions {
+		if _, isInvested := p.isInvested(symbol); !isInvested {
+			continue
+		}
+		positionValue := calculatePositionValue(position)
+		snapshot.MarketValue += positionValue
+		snapshot.Exposures[symbol] = math.Copysign(position.CurrentMarketValue, position.Quantity)
+		snapshot.UnrealProfitLoss += position.UnrealProfitLoss
+
+		// The open fraction of the enter value & fees was paid from cash, so only the difference is the Symbol's P&L
+		openFraction := position.OpenQuantity() / position.Quantity
+		snapshot.SymbolValues[symbol] += positionValue -
+			(position.EnterFillValueGross+position.EnterFillFees["TotalFees"])*openFraction
+	}
+	snapshot.TotalValue = snapshot.Cash + snapshot.MarketValue
+	return snapshot
+}
+
+// calculatePositionValue returns the value an open Position contributes to the portfolio - the EnterFillValueGross
+// of a SHORT Position is deducted from cash on entry, so its value moves inversely to the CurrentMarketValue
+func calculatePositionValue(position model.Position) float64 {
+	if position.Direction == model.DirectionShort {
+		openFraction := position.OpenQuantity() / position.Quantity
+		return 2*position.EnterFillValueGross*openFraction - position.CurrentMarketValue
+	}
+	return position.CurrentMarketValue
+}
+
 // isInvested determines if a portfolio has an open Position for a Symbol & returns that position
 func (p *portfolio) isInvested(symbol string) (model.Position, bool) {
 	// Todo: Test this func asap rocky
 	position, isInPositions := p.positions[symbol]
-	// If present in current positions & exit fill value is zero
-	if isInPositions && position.ExitFillValueGross == 0 {
+	// If present in current positions & exit fills have not closed the entire Quantity
+	if isInPositions && !position.IsClosed() {
 		return position, true
 	}
 	return position, false
@@ -70,6 +170,11 @@ func (p *portfolio) isInvested(symbol string) (model.Position, bool) {
 func (p *portfolio) GenerateOrders(signal model.SignalEvent) error {
 	// Todo: Enhance this to allow for closing a trade and opening a reverse trade on the same market event
 
+	// Wait for any unfilled order on the Symbol to complete before acting on new signals
+	if _, hasOpenOrder := p.openOrders[signal.Symbol]; hasOpenOrder {
+		return nil
+	}
+
 	// Check if the SignalEvent is for a Symbol already invested in
 	position, isInvested := p.isInvested(signal.Symbol)
 
@@ -87,14 +192,19 @@ func (p *portfolio) GenerateOrders(signal model.SignalEvent) error {
 	// Construct base OrderEvent
 	order := model.OrderEvent{
 		TraceId:   signal.TraceId,
-		Timestamp: time.Now().Truncate(time.Nanosecond),
+		OrderId:   uuid.New(),
+		Timestamp: signal.Timestamp,
 		Symbol:    signal.Symbol,
 		Decision:  decision,
+		Status:    model.OrderStatusNew,
+	}
+	if order.IsExit() {
+		order.ExitReason = model.ExitReasonSignal
 	}
 
 	// Size order
 	// Get current available data and the index of the latest bar
-	currentData, latestBarIndex := p.data.GetLatestData()
+	currentData, latestBarIndex := p.data[signal.Symbol].GetLatestData()
 
 	err := p.sizeManager.SizeOrder(&order, strength, position, currentData.Closes[latestBarIndex])
 	if err != nil {
@@ -102,18 +212,84 @@ func (p *portfolio) GenerateOrders(signal model.SignalEvent) error {
 	}
 
 	// Manage risk - refine or cancel order
-	err = p.riskManager.EvaluateOrder(&order)
+	isApproved, err := p.riskManager.EvaluateOrder(&order, currentData.Closes[latestBarIndex], p.takeRiskSnapshot(signal.Timestamp))
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("failed to risk evaluate order: %+v", order))
 	}
+	if !isApproved {
+		// Record the cancelled order in the orders book without sending it for execution
+		order.Status = model.OrderStatusCancelled
+		p.orders = append(p.orders, order)
+		p.log.Info(fmt.Sprintf("order cancelled by risk limits: %+v", order))
+		return nil
+	}
+
+	p.submitOrder(order)
+
+	return nil
+}
+
+// generateExitOrder generates a MARKET OrderEvent closing the open Quantity of a Position when a protective exit
+// triggers, priced at the level the exit was triggered at - the order bypasses the RiskManager so it is never left
+// resting away from the market
+func (p *portfolio) generateExitOrder(market model.MarketEvent, position model.Position, reason string, price float64) {
+	decision := model.DecisionCloseLong
+	if position.Direction == model.DirectionShort {
+		decision = model.DecisionCloseShort
+	}
+
+	p.submitOrder(model.OrderEvent{
+		TraceId:     market.TraceId,
+		OrderId:     uuid.New(),
+		Timestamp:   market.Timestamp,
+		Symbol:      position.Symbol,
+		OrderType:   model.OrderTypeMarket,
+		Quantity:    -position.OpenQuantity(),
+		Decision:    decision,
+		Price:       price,
+		TimeInForce: model.TimeInForceGTC,
+		Status:      model.OrderStatusNew,
+		ExitReason:  reason,
+	})
+}
 
+// cancelOrder appends a CancelEvent for the unfilled Quantity of a working OrderEvent to the event queue
+func (p *portfolio) cancelOrder(market model.MarketEvent, order model.OrderEvent, reason string) {
+	p.eventQ.Add(model.CancelEvent{
+		TraceId:   market.TraceId,
+		OrderId:   order.OrderId,
+		Timestamp: market.Timestamp,
+		Symbol:    order.Symbol,
+		Reason:    reason,
+	})
+}
+
+// submitOrder appends the OrderEvent to the orders book & the event queue, blocking new orders on the Symbol until
+// it completes
+func (p *portfolio) submitOrder(order model.OrderEvent) {
 	// Append order to the orders book
 	p.orders = append(p.orders, order)
+	p.openOrders[order.Symbol] = order
 
 	// Append order to the event queue
 	p.eventQ.Add(order)
+}
 
-	return nil
+// takeRiskSnapshot captures the current Snapshot of the portfolio with the value of open entry orders reserved from
+// cash & added to their Symbol's exposure, as if they had already filled. The full order Quantity is reserved, which
+// overstates the exposure of partially filled orders.
+func (p *portfolio) takeRiskSnapshot(timestamp time.Time) model.Snapshot {
+	snapshot := p.takeSnapshot(timestamp)
+	for symbol, order := range p.openOrders {
+		if order.IsExit() {
+			continue
+		}
+		currentData, latestBarIndex := p.data[symbol].GetLatestData()
+		orderValue := math.Abs(order.Quantity) * currentData.Closes[latestBarIndex]
+		snapshot.Cash -= orderValue
+		snapshot.Exposures[symbol] += math.Copysign(orderValue, order.Quantity)
+	}
+	return snapshot
 }
 
 // parseSignalDecisions assesses what, if any, decisions should be made based on incoming signalPairs
@@ -151,25 +327,47 @@ func (p *portfolio) parseSignalDecisions(position model.Position, isInvested boo
 
 // UpdateFromFill updates the portfolio's current positions & historicPositions from a FillEvent
 func (p *portfolio) UpdateFromFill(fill model.FillEvent) error {
+	position, isInvested := p.isInvested(fill.Symbol)
+	isExit := fill.Decision == model.DecisionCloseLong || fill.Decision == model.DecisionCloseShort
 
-	// Get current available data to determine the FillValueGross - would be determined in execution for live trading
-	currentData, latestBarIndex := p.data.GetLatestData()
-	fill.FillValueGross = math.Abs(fill.Quantity) * currentData.Closes[latestBarIndex]
-
-	// Must be an exit
-	if position, isInvested := p.isInvested(fill.Symbol); isInvested {
-		// Exit position instance
+	if isInvested && isExit {
+		// Exit some or all of the position instance
+		resultProfitLossBefore := position.ResultProfitLoss
 		err := position.Exit(fill)
 		if err != nil {
 			return errors.Wrap(err, "failed exit portfolio.UpdateFromFill()")
 		}
-		// Append exited position to historicPositions and remove from current positions
-		p.historicPositions[fill.Symbol] = append(p.historicPositions[fill.Symbol], position)
-		delete(p.positions, fill.Symbol)
 
-		// Update portfolio cash & value on exit
-		p.currentCash = p.currentCash + position.EnterFillValueGross + position.ResultProfitLoss // Todo: Double check this
-		p.currentValue = p.currentCash
+		// Update portfolio cash & realised P&L with the exited fraction of the position - the entry fees were paid from
+		// cash on entry, so are added back to the net P&L which deducts them
+		exitedFraction := math.Abs(fill.Quantity) / math.Abs(position.Quantity)
+		exitedEnterValue := position.EnterFillValueGross * exitedFraction
+		exitedEnterFees := position.EnterFillFees["TotalFees"] * exitedFraction
+		resultProfitLoss := position.ResultProfitLoss - resultProfitLossBefore
+		p.realProfitLoss += resultProfitLoss
+		p.symbolProfitLoss[fill.Symbol] += resultProfitLoss
+		p.currentCash = p.currentCash + exitedEnterValue + resultProfitLoss + exitedEnterFees
+
+		if position.IsClosed() {
+			// Append exited position to historicPositions and remove from current positions
+			p.historicPositions[fill.Symbol] = append(p.historicPositions[fill.Symbol], position)
+			delete(p.positions, fill.Symbol)
+			p.exitManager.Detach(fill.Symbol)
+		} else {
+			p.positions[fill.Symbol] = position
+		}
+
+	} else if isInvested {
+		// Further entry fill of a partially filled order
+		err := position.Increase(fill)
+		if err != nil {
+			return errors.Wrap(err, "failed increase portfolio.UpdateFromFill()")
+		}
+		p.positions[fill.Symbol] = position
+		p.attachExits(position)
+
+		// Update cash on entry
+		p.currentCash = p.currentCash - fill.FillValueGross - (fill.ExchangeFee + fill.SlippageFee + fill.NetworkFee)
 
 	} else {
 		// Must be an entry
@@ -179,10 +377,16 @@ func (p *portfolio) UpdateFromFill(fill model.FillEvent) error {
 			return errors.Wrap(err, "failed entry portfolio.UpdateFromFill()")
 		}
 		p.positions[fill.Symbol] = position
+		p.attachExits(position)
 
-		// Update cash & value on entry
-		p.currentCash = p.currentCash - position.EnterFillValueGross - position.EnterFillFees["TotalFees"] // Todo: Double check this
-		p.currentValue = p.currentCash + position.EnterFillValueGross
+		// Update cash on entry
+		p.currentCash = p.currentCash - position.EnterFillValueGross - position.EnterFillFees["TotalFees"]
+	}
+	p.updateValue()
+
+	// Fills on a bar whose Snapshot was already recorded, eg/ at its close or at a triggered exit level, update it
+	if latest := len(p.snapshots) - 1; latest >= 0 && p.snapshots[latest].Timestamp.Equal(fill.Timestamp) {
+		p.snapshots[latest] = p.takeSnapshot(fill.Timestamp)
 	}
 
 	// Update completed FillEvents
@@ -198,24 +402,131 @@ func (p *portfolio) UpdateFromFill(fill model.FillEvent) error {
 	return nil
 }
 
-func (p *portfolio) GetPortfolio() (float64, float64, float64, map[string][]model.Position) {
-	return p.initialCash, p.currentCash, p.currentValue, p.historicPositions
+// attachExits places the protective exits of an entered Position using the data available at the latest bar
+func (p *portfolio) attachExits(position model.Position) {
+	currentData, latestBarIndex := p.data[position.Symbol].GetLatestData()
+	p.exitManager.Attach(position, currentData, latestBarIndex)
+}
+
+// UpdateFromOrder updates the status of an order in the orders book from an OrderUpdateEvent
+func (p *portfolio) UpdateFromOrder(update model.OrderUpdateEvent) error {
+	for index := len(p.orders) - 1; index >= 0; index-- {
+		if p.orders[index].OrderId != update.OrderId {
+			continue
+		}
+		p.orders[index].Status = update.Status
+
+		// Release the Symbol for new orders once the order can no longer be filled
+		if !p.orders[index].IsOpen() && p.openOrders[update.Symbol].OrderId == update.OrderId {
+			delete(p.openOrders, update.Symbol)
+		}
+		return nil
+	}
+	return errors.New(fmt.Sprintf("failed portfolio.UpdateFromOrder() for unknown order: %+v", update))
+}
+
+// GetOrders returns the portfolio's order book
+func (p *portfolio) GetOrders() []model.OrderEvent {
+	return p.orders
+}
+
+// GetFills returns the portfolio's journal of completed FillEvents
+func (p *portfolio) GetFills() []model.FillEvent {
+	return p.fills
 }
 
-func NewPortfolio(cfg config.Trader, eventQ *queue.Queue, data data.Handler) *portfolio {
+// GetHistoricPositions returns the portfolio's closed Positions for every Symbol
+func (p *portfolio) GetHistoricPositions() map[string][]model.Position {
+	return p.historicPositions
+}
+
+// GetSnapshots returns the state of the portfolio recorded at the close of every bar
+func (p *portfolio) GetSnapshots() []model.Snapshot {
+	return p.snapshots
+}
+
+// GetEquityCurve returns the portfolio value & exposure recorded at the close of every bar
+func (p *portfolio) GetEquityCurve() []statistics.EquityPoint {
+	equityCurve := make([]statistics.EquityPoint, 0, len(p.snapshots))
+	for _, snapshot := range p.snapshots {
+		var exposure float64
+		for _, symbolExposure := range snapshot.Exposures {
+			exposure += math.Abs(symbolExposure)
+		}
+		equityCurve = append(equityCurve, statistics.EquityPoint{
+			Timestamp: snapshot.Timestamp,
+			Value:     snapshot.TotalValue,
+			Exposure:  exposure,
+		})
+	}
+	return equityCurve
+}
+
+// GetSymbolEquityCurves returns the value & exposure of every Symbol's share of the portfolio recorded at the close of
+// every bar, where a Symbol's value is its StartingCash plus its realised & mark-to-market P&L
+func (p *portfolio) GetSymbolEquityCurves() map[string][]statistics.EquityPoint {
+	equityCurves := make(map[string][]statistics.EquityPoint)
+	for _, snapshot := range p.snapshots {
+		for symbol, value := range snapshot.SymbolValues {
+			equityCurves[symbol] = append(equityCurves[symbol], statistics.EquityPoint{
+				Timestamp: snapshot.Timestamp,
+				Value:     value,
+				Exposure:  math.Abs(snapshot.Exposures[symbol]),
+			})
+		}
+	}
+	return equityCurves
+}
+
+// NewPortfolio constructs a portfolio shared by the Symbol of every config, pooling their StartingCash - each Symbol
+// keeps its DefaultOrderValue, but the order & risk settings of the first config apply to the whole portfolio
+func NewPortfolio(cfgs []config.Trader, eventQ *queue.Queue, handlers map[string]data.Handler) (*portfolio, error) {
+	if len(cfgs) == 0 {
+		return &portfolio{}, errors.New("portfolio requires at least one symbol")
+	}
+	cfg := cfgs[0]
+	var startingCash float64
+	symbolOrderValues := make(map[string]float64)
+	symbolCash := make(map[string]float64)
+	for _, symbolCfg := range cfgs {
+		symbolOrderValues[symbolCfg.Symbol] = symbolCfg.DefaultOrderValue
+		symbolCash[symbolCfg.Symbol] = symbolCfg.StartingCash
+		if _, hasHandler := handlers[symbolCfg.Symbol]; !hasHandler {
+			return &portfolio{}, errors.New(fmt.Sprintf("no data handler for symbol %s", symbolCfg.Symbol))
+		}
+		startingCash += symbolCfg.StartingCash
+	}
+
+	exits, err := NewExits(cfg.StopLoss, cfg.TakeProfit, cfg.TrailingStop, cfg.ExitPriority)
+	if err != nil {
+		return &portfolio{}, errors.Wrap(err, "failed to init exit manager")
+	}
+
 	return &portfolio{
 		log:               cfg.Log,
 		eventQ:            eventQ,
-		data:              data,
-		sizeManager:       &Size{DefaultOrderValue: cfg.DefaultOrderValue},
-		riskManager:       &Risk{DefaultOrderType: OrderTypeMarket},
-		symbol:            cfg.Symbol,
-		initialCash:       cfg.StartingCash,
-		currentCash:       cfg.StartingCash,
-		currentValue:      cfg.StartingCash,
+		data:              handlers,
+		sizeManager:       &Size{DefaultOrderValue: cfg.DefaultOrderValue, SymbolOrderValues: symbolOrderValues},
+		riskManager:       &Risk{
+			DefaultOrderType:   cfg.OrderType,
+			PriceOffset:        cfg.OrderPriceOffset,
+			DefaultTimeInForce: cfg.TimeInForce,
+			TimeToLive:         cfg.OrderTimeToLive,
+			MaxGrossExposure:   cfg.MaxGrossExposure,
+			MaxSymbolExposure:  cfg.MaxSymbolExposure,
+			MarginRequirement:  cfg.MarginRequirement,
+		},
+		exitManager:       exits,
+		initialCash:       startingCash,
+		currentCash:       startingCash,
+		currentValue:      startingCash,
 		orders:            []model.OrderEvent{},
+		openOrders:        make(map[string]model.OrderEvent),
 		fills:             []model.FillEvent{},
 		positions:         make(map[string]model.Position),
 		historicPositions: make(map[string][]model.Position),
-	}
+		symbolCash:        symbolCash,
+		symbolProfitLoss:  make(map[string]float64),
+		snapshots:         []model.Snapshot{},
+	}, nil
 }
\ No newline at end of file
@@ -0,0 +1,119 @@
+package portfolio
+
+import (
+	"github.com/eapache/queue"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"go.uber.org/zap"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeHandler serves a single fixed bar
+type fakeHandler struct {
+	symbolData model.SymbolData
+}
+
+func (f *fakeHandler) ShouldContinue() bool                      { return false }
+func (f *fakeHandler) UpdateData()                               {}
+func (f *fakeHandler) GetLatestData() (*model.SymbolData, int64) { return &f.symbolData, 0 }
+func (f *fakeHandler) NextTimestamp() time.Time                  { return time.Time{} }
+
+func TestPortfolio_UpdateFromFill_cash(t *testing.T) {
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	fill := func(decision string, quantity float64, price float64, fee float64) model.FillEvent {
+		return model.FillEvent{Timestamp: timestamp, Symbol: "ETH-USD", Exchange: "binance", Decision: decision,
+			Quantity: quantity, FillValueGross: math.Abs(quantity) * price, ExchangeFee: fee}
+	}
+
+	testCases := []struct {
+		name                   string
+		fills                  []model.FillEvent
+		expectedCash           []float64 // Cash after each fill
+		expectedRealProfitLoss float64
+		expectedClosed         bool
+	}{
+		{
+			name:                   "TestPortfolio_UpdateFromFill_cash_longRoundTrip",
+			fills:                  []model.FillEvent{fill(model.DecisionLong, 10, 100, 10), fill(model.DecisionCloseLong, -10, 100, 10)},
+			expectedCash:           []float64{8990, 9980},
+			expectedRealProfitLoss: -20,
+			expectedClosed:         true,
+		},
+		{
+			name:                   "TestPortfolio_UpdateFromFill_cash_longProfit",
+			fills:                  []model.FillEvent{fill(model.DecisionLong, 10, 100, 10), fill(model.DecisionCloseLong, -10, 110, 11)},
+			expectedCash:           []float64{8990, 10079},
+			expectedRealProfitLoss: 79,
+			expectedClosed:         true,
+		},
+		{
+			name:                   "TestPortfolio_UpdateFromFill_cash_shortRoundTrip",
+			fills:                  []model.FillEvent{fill(model.DecisionShort, -10, 100, 10), fill(model.DecisionCloseShort, 10, 90, 9)},
+			expectedCash:           []float64{8990, 10081},
+			expectedRealProfitLoss: 81,
+			expectedClosed:         true,
+		},
+		{
+			name: "TestPortfolio_UpdateFromFill_cash_partialExits",
+			fills: []model.FillEvent{fill(model.DecisionLong, 10, 100, 10), fill(model.DecisionCloseLong, -4, 110, 4.4),
+				fill(model.DecisionCloseLong, -6, 90, 5.4)},
+			expectedCash:           []float64{8990, 9425.6, 9960.2},
+			expectedRealProfitLoss: -39.8,
+			expectedClosed:         true,
+		},
+		{
+			name:  "TestPortfolio_UpdateFromFill_cash_partialExitOpen",
+			fills: []model.FillEvent{fill(model.DecisionShort, -10, 100, 10), fill(model.DecisionCloseShort, 5, 80, 4)},
+			// Half the entry value & fees are released with the P&L of (500 - 400) - 5 - 4
+			expectedCash:           []float64{8990, 9586},
+			expectedRealProfitLoss: 91,
+			expectedClosed:         false,
+		},
+		{
+			name: "TestPortfolio_UpdateFromFill_cash_partialEntries",
+			fills: []model.FillEvent{fill(model.DecisionLong, 5, 100, 5), fill(model.DecisionLong, 5, 100, 5),
+				fill(model.DecisionCloseLong, -10, 100, 10)},
+			expectedCash:           []float64{9495, 8990, 9980},
+			expectedRealProfitLoss: -20,
+			expectedClosed:         true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			symbolData := model.SymbolData{}
+			symbolData.AddBar(model.Bar{Timestamp: timestamp, Open: 100, High: 100, Low: 100, Close: 100, Volume: 1000})
+			handlers := map[string]data.Handler{"ETH-USD": &fakeHandler{symbolData: symbolData}}
+			cfg := config.Trader{Log: zap.NewNop(), Symbol: "ETH-USD", StartingCash: 10000, DefaultOrderValue: 1000,
+				OrderType: model.OrderTypeMarket, ExitPriority: ExitPriorityStopFirst}
+			p, err := NewPortfolio([]config.Trader{cfg}, queue.New(), handlers)
+			if err != nil {
+				t.Fatalf("failed to init portfolio: %s", err)
+			}
+
+			for index, fill := range testCase.fills {
+				if err := p.UpdateFromFill(fill); err != nil {
+					t.Fatalf("failed to update from fill %v: %s", index, err)
+				}
+				if math.Abs(p.currentCash-testCase.expectedCash[index]) > 1e-9 {
+					t.Errorf("expected cash %v after fill %v, got %v", testCase.expectedCash[index], index, p.currentCash)
+				}
+				// The only Symbol's share of the portfolio is the whole portfolio
+				snapshot := p.takeSnapshot(timestamp)
+				if math.Abs(snapshot.SymbolValues["ETH-USD"]-snapshot.TotalValue) > 1e-9 {
+					t.Errorf("expected symbol value %v after fill %v, got %v", snapshot.TotalValue, index,
+						snapshot.SymbolValues["ETH-USD"])
+				}
+			}
+			if math.Abs(p.realProfitLoss-testCase.expectedRealProfitLoss) > 1e-9 {
+				t.Errorf("expected realised P&L %v, got %v", testCase.expectedRealProfitLoss, p.realProfitLoss)
+			}
+			if _, isInvested := p.isInvested("ETH-USD"); isInvested == testCase.expectedClosed {
+				t.Errorf("expected position closed %v", testCase.expectedClosed)
+			}
+		})
+	}
+}
@@ -1,21 +1,92 @@
 package portfolio
 
-import "gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
-
-const (
-	OrderTypeMarket = "MARKET"
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"math"
+	"time"
 )
 
 type RiskManager interface {
-	EvaluateOrder(*model.OrderEvent) error
+	EvaluateOrder(*model.OrderEvent, float64, model.Snapshot) (bool, error)
 }
 
 type Risk struct {
-	DefaultOrderType string
+	DefaultOrderType   string
+	PriceOffset        float64 // Fraction of the current price LIMIT & STOP prices are placed away from it
+	DefaultTimeInForce string
+	TimeToLive         time.Duration // Lifetime of GTD orders
+	MaxGrossExposure   float64       // Max sum of abs(Exposures) as a fraction of TotalValue, zero disables the limit
+	MaxSymbolExposure  float64       // Max abs(Exposure) of a single Symbol as a fraction of TotalValue, zero disables the limit
+	MarginRequirement  float64       // Fraction of an entry's value that must be available in cash, zero disables the limit
+}
+
+// EvaluateOrder manages the risk of an order by refining it, or cancelling it by returning false, given a Snapshot of
+// the portfolio
+func (r *Risk) EvaluateOrder(order *model.OrderEvent, price float64, snapshot model.Snapshot) (bool, error) {
+	// Exits reduce exposure, so are never limited
+	if !order.IsExit() && !r.limitQuantity(order, price, snapshot) {
+		return false, nil
+	}
+
+	// Exits must close the position, so are MARKET orders resting until filled whatever the entry order defaults
+	if order.IsExit() {
+		order.OrderType = model.OrderTypeMarket
+		order.TimeInForce = model.TimeInForceGTC
+		return true, nil
+	}
+
+	order.OrderType = r.DefaultOrderType
+	order.TimeInForce = r.DefaultTimeInForce
+	if order.TimeInForce == model.TimeInForceGTD {
+		order.ExpireTimestamp = order.Timestamp.Add(r.TimeToLive)
+	}
+
+	// Buy limits rest below the current price & buy stops trigger above it, vice versa for sells
+	direction := 1.0
+	if !order.IsBuy() {
+		direction = -1.0
+	}
+
+	switch order.OrderType {
+	case model.OrderTypeMarket:
+	case model.OrderTypeLimit:
+		order.Price = price * (1 - direction*r.PriceOffset)
+	case model.OrderTypeStop:
+		order.StopPrice = price * (1 + direction*r.PriceOffset)
+	case model.OrderTypeStopLimit:
+		order.StopPrice = price * (1 + direction*r.PriceOffset)
+		order.Price = order.StopPrice * (1 + direction*r.PriceOffset)
+	default:
+		return false, errors.New(fmt.Sprintf("unsupported order type %s", order.OrderType))
+	}
+
+	return true, nil
 }
 
-// EvaluateOrder manages the risk of an order by refining it, or cancelling it
-func (r *Risk) EvaluateOrder(order *model.OrderEvent) error {
-	order.OrderType = OrderTypeMarket
-	return nil
-}
\ No newline at end of file
+// limitQuantity reduces the Quantity of an entry order so its value fits within the margin & exposure limits,
+// returning false if no Quantity remains
+func (r *Risk) limitQuantity(order *model.OrderEvent, price float64, snapshot model.Snapshot) bool {
+	allowedValue := math.Inf(1)
+	if r.MarginRequirement > 0 {
+		allowedValue = math.Min(allowedValue, snapshot.Cash/r.MarginRequirement)
+	}
+	if r.MaxGrossExposure > 0 {
+		var grossExposure float64
+		for _, exposure := range snapshot.Exposures {
+			grossExposure += math.Abs(exposure)
+		}
+		allowedValue = math.Min(allowedValue, r.MaxGrossExposure*snapshot.TotalValue-grossExposure)
+	}
+	if r.MaxSymbolExposure > 0 {
+		allowedValue = math.Min(allowedValue, r.MaxSymbolExposure*snapshot.TotalValue-math.Abs(snapshot.Exposures[order.Symbol]))
+	}
+
+	if math.Abs(order.Quantity)*price <= allowedValue {
+		return true
+	}
+	quantity := math.Floor(math.Max(allowedValue, 0) / price)
+	order.Quantity = math.Copysign(quantity, order.Quantity)
+	return quantity > 0
+}
@@ -0,0 +1,83 @@
+package portfolio
+
+import (
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"testing"
+)
+
+func TestRisk_EvaluateOrder(t *testing.T) {
+	snapshot := model.Snapshot{
+		Cash:       5000,
+		TotalValue: 10000,
+		Exposures:  map[string]float64{"ETH-USD": 3000, "BTC-USD": -2000},
+	}
+
+	testCases := []struct {
+		name             string
+		risk             Risk
+		order            model.OrderEvent
+		expectedApproved bool
+		expectedQuantity float64
+	}{
+		{
+			name:             "TestRisk_EvaluateOrder_withinLimits",
+			risk:             Risk{DefaultOrderType: model.OrderTypeMarket, MarginRequirement: 1, MaxGrossExposure: 1},
+			order:            model.OrderEvent{Symbol: "SOL-USD", Decision: model.DecisionLong, Quantity: 40},
+			expectedApproved: true,
+			expectedQuantity: 40,
+		},
+		{
+			name:             "TestRisk_EvaluateOrder_reducedByMargin",
+			risk:             Risk{DefaultOrderType: model.OrderTypeMarket, MarginRequirement: 2},
+			order:            model.OrderEvent{Symbol: "SOL-USD", Decision: model.DecisionShort, Quantity: -40},
+			expectedApproved: true,
+			expectedQuantity: -25,
+		},
+		{
+			name:             "TestRisk_EvaluateOrder_reducedBySymbolExposure",
+			risk:             Risk{DefaultOrderType: model.OrderTypeMarket, MaxSymbolExposure: 0.35},
+			order:            model.OrderEvent{Symbol: "ETH-USD", Decision: model.DecisionLong, Quantity: 10},
+			expectedApproved: true,
+			expectedQuantity: 5,
+		},
+		{
+			name:             "TestRisk_EvaluateOrder_cancelledByGrossExposure",
+			risk:             Risk{DefaultOrderType: model.OrderTypeMarket, MaxGrossExposure: 0.5},
+			order:            model.OrderEvent{Symbol: "SOL-USD", Decision: model.DecisionLong, Quantity: 10},
+			expectedApproved: false,
+			expectedQuantity: 0,
+		},
+		{
+			name:             "TestRisk_EvaluateOrder_exitNeverLimited",
+			risk:             Risk{DefaultOrderType: model.OrderTypeMarket, MaxGrossExposure: 0.5},
+			order:            model.OrderEvent{Symbol: "ETH-USD", Decision: model.DecisionCloseLong, Quantity: -30},
+			expectedApproved: true,
+			expectedQuantity: -30,
+		},
+		{
+			name: "TestRisk_EvaluateOrder_exitAlwaysMarket",
+			risk: Risk{DefaultOrderType: model.OrderTypeLimit, DefaultTimeInForce: model.TimeInForceIOC,
+				PriceOffset: 0.01},
+			order:            model.OrderEvent{Symbol: "ETH-USD", Decision: model.DecisionCloseLong, Quantity: -30},
+			expectedApproved: true,
+			expectedQuantity: -30,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			order := testCase.order
+			approved, err := testCase.risk.EvaluateOrder(&order, 100, snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if approved != testCase.expectedApproved || order.Quantity != testCase.expectedQuantity {
+				t.Fatalf("expected (%v, %v), got (%v, %v)", testCase.expectedApproved, testCase.expectedQuantity,
+					approved, order.Quantity)
+			}
+			if approved && order.IsExit() && (order.OrderType != model.OrderTypeMarket || order.TimeInForce != model.TimeInForceGTC) {
+				t.Fatalf("expected exit to be a GTC MARKET order, got %s %s", order.TimeInForce, order.OrderType)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ type SizeManager interface {
 
 type Size struct {
 	DefaultOrderValue 	float64
+	SymbolOrderValues 	map[string]float64 	// map[Symbol]OrderValue replacing the DefaultOrderValue of a Symbol
 }
 
 func (s *Size) SizeOrder(order *model.OrderEvent, decisionStrength float32, position model.Position, price float64) error {
@@ -18,12 +19,16 @@ func (s *Size) SizeOrder(order *model.OrderEvent, decisionStrength float32, posi
 
 	// If order is an exit
 	if order.IsExit() {
-		enterQuantity := position.Quantity 	// +ve or -ve Quantity depending on Direction
+		enterQuantity := position.OpenQuantity() 	// +ve or -ve Quantity depending on Direction
 		order.Quantity = (0.0 - enterQuantity) * strength
 	}
 
 	// If order is an entry
-	defaultOrderSize := math.Floor(s.DefaultOrderValue / price)
+	orderValue := s.DefaultOrderValue
+	if symbolOrderValue, isSet := s.SymbolOrderValues[order.Symbol]; isSet {
+		orderValue = symbolOrderValue
+	}
+	defaultOrderSize := math.Floor(orderValue / price)
 	if order.IsLong() {
 		order.Quantity = defaultOrderSize * strength
 	}
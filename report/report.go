@@ -0,0 +1,266 @@
+package report
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/statistics"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// Input is everything required to generate a backtest report for a single trader
+type Input struct {
+	Name              string
+	GeneratedAt       time.Time
+	Summary           statistics.Summary
+	EquityCurve       []statistics.EquityPoint
+	Prices            map[string]*model.SymbolData // map[Symbol]SymbolData
+	HistoricPositions map[string][]model.Position
+}
+
+// statisticRow is a labelled, formatted value displayed in a report statistics table
+type statisticRow struct {
+	Label string
+	Value string
+}
+
+// symbolChart is the price chart of a single Symbol
+type symbolChart struct {
+	Symbol string
+	Chart  template.HTML
+}
+
+// symbolTable is the statistics table of a single Symbol
+type symbolTable struct {
+	Symbol string
+	Rows   []statisticRow
+}
+
+// page is the data rendered by the reportTemplate
+type page struct {
+	Name           string
+	GeneratedAt    string
+	EquityChart    template.HTML
+	DrawdownChart  template.HTML
+	PriceCharts    []symbolChart
+	MonthlyHeatmap template.HTML
+	PortfolioTable []statisticRow
+	SymbolTables   []symbolTable
+}
+
+// Generate writes a self-contained HTML backtest report with inline SVG charts to the writer
+func Generate(w io.Writer, input Input) error {
+	reportPage := page{
+		Name:           input.Name,
+		GeneratedAt:    input.GeneratedAt.Format(time.RFC3339),
+		EquityChart:    buildEquityChart(input.EquityCurve).Render(),
+		DrawdownChart:  buildDrawdownChart(input.EquityCurve).Render(),
+		MonthlyHeatmap: monthlyReturnsHeatmap{Returns: calculateMonthlyReturns(input.EquityCurve)}.Render(),
+		PortfolioTable: buildStatisticsTable(input.Summary.Portfolio),
+	}
+
+	var symbols []string
+	for symbol := range input.Summary.Symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	var priceSymbols []string
+	for symbol := range input.Prices {
+		priceSymbols = append(priceSymbols, symbol)
+	}
+	sort.Strings(priceSymbols)
+	for _, symbol := range priceSymbols {
+		reportPage.PriceCharts = append(reportPage.PriceCharts, symbolChart{
+			Symbol: symbol,
+			Chart:  buildPriceChart(input.Prices[symbol], input.HistoricPositions[symbol]).Render(),
+		})
+	}
+
+	for _, symbol := range symbols {
+		reportPage.SymbolTables = append(reportPage.SymbolTables, symbolTable{
+			Symbol: symbol,
+			Rows:   buildStatisticsTable(input.Summary.Symbols[symbol]),
+		})
+	}
+
+	if err := reportTemplate.Execute(w, reportPage); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to render report for %s", input.Name))
+	}
+	return nil
+}
+
+// buildEquityChart plots the portfolio value at the close of every bar
+func buildEquityChart(equityCurve []statistics.EquityPoint) timeSeriesChart {
+	chart := timeSeriesChart{Colour: colourLine, Format: "%.0f"}
+	for _, equityPoint := range equityCurve {
+		chart.Points = append(chart.Points, point{Timestamp: equityPoint.Timestamp, Value: equityPoint.Value})
+	}
+	return chart
+}
+
+// buildDrawdownChart plots the percentage decline of the portfolio value from its running peak
+func buildDrawdownChart(equityCurve []statistics.EquityPoint) timeSeriesChart {
+	chart := timeSeriesChart{Colour: colourDrawdown, Fill: true, Format: "%.1f%%"}
+	var peak float64
+	for _, equityPoint := range equityCurve {
+		if equityPoint.Value > peak {
+			peak = equityPoint.Value
+		}
+		var drawdown float64
+		if peak > 0 {
+			drawdown = (equityPoint.Value - peak) / peak * 100
+		}
+		chart.Points = append(chart.Points, point{Timestamp: equityPoint.Timestamp, Value: drawdown})
+	}
+	return chart
+}
+
+// buildPriceChart plots the close price with a marker at the enter & exit of every historic Position of the Symbol
+func buildPriceChart(prices *model.SymbolData, positions []model.Position) timeSeriesChart {
+	chart := timeSeriesChart{Colour: colourText, Format: "%.2f"}
+	if prices == nil {
+		return chart
+	}
+	for index, timestamp := range prices.Timestamps {
+		chart.Points = append(chart.Points, point{Timestamp: timestamp, Value: prices.Closes[index]})
+	}
+
+	for _, position := range positions {
+		enter := marker{
+			point:  point{Timestamp: position.EnterTimestamp, Value: position.EnterAvgPriceGross},
+			Colour: colourLong,
+			Shape:  "up",
+			Title:  fmt.Sprintf("Enter %s %v @ %.2f", position.Direction, position.Quantity, position.EnterAvgPriceGross),
+		}
+		if position.Direction == model.DirectionShort {
+			enter.Colour, enter.Shape = colourShort, "down"
+		}
+		exit := marker{
+			point:  point{Timestamp: position.ExitTimestamp, Value: position.ExitAvgPriceGross},
+			Colour: colourExit,
+			Shape:  "circle",
+			Title: fmt.Sprintf("Exit %s @ %.2f (%s), P&L %.2f",
+				position.Direction, position.ExitAvgPriceGross, position.ExitReason, position.ResultProfitLoss),
+		}
+		chart.Markers = append(chart.Markers, enter, exit)
+	}
+	return chart
+}
+
+// calculateMonthlyReturns returns the return of each calendar month using the last equity value of each month
+func calculateMonthlyReturns(equityCurve []statistics.EquityPoint) map[int]map[time.Month]float64 {
+	monthlyReturns := make(map[int]map[time.Month]float64)
+	if len(equityCurve) == 0 {
+		return monthlyReturns
+	}
+
+	previousValue := equityCurve[0].Value
+	for index, equityPoint := range equityCurve {
+		isMonthEnd := index == len(equityCurve)-1 || equityCurve[index+1].Timestamp.Month() != equityPoint.Timestamp.Month()
+		if !isMonthEnd {
+			continue
+		}
+		year, month := equityPoint.Timestamp.Year(), equityPoint.Timestamp.Month()
+		if _, ok := monthlyReturns[year]; !ok {
+			monthlyReturns[year] = make(map[time.Month]float64)
+		}
+		if previousValue != 0 {
+			monthlyReturns[year][month] = equityPoint.Value/previousValue - 1
+		}
+		previousValue = equityPoint.Value
+	}
+	return monthlyReturns
+}
+
+// buildStatisticsTable formats the Statistics of the portfolio or a Symbol's share of it for display
+func buildStatisticsTable(stats statistics.Statistics) []statisticRow {
+	rows := []statisticRow{
+		{"Start", stats.StartTimestamp.Format("2006-01-02 15:04")},
+		{"End", stats.EndTimestamp.Format("2006-01-02 15:04")},
+		{"Starting Value", fmt.Sprintf("%.2f", stats.StartingValue)},
+		{"Ending Value", fmt.Sprintf("%.2f", stats.EndingValue)},
+		{"Total Return", formatPercent(stats.TotalReturn)},
+		{"Annualised Return", formatPercent(stats.AnnualisedReturn)},
+		{"Annualised Volatility", formatPercent(stats.AnnualisedVolatility)},
+		{"Sharpe Ratio", fmt.Sprintf("%.2f", stats.SharpeRatio)},
+		{"Sortino Ratio", fmt.Sprintf("%.2f", stats.SortinoRatio)},
+		{"Calmar Ratio", fmt.Sprintf("%.2f", stats.CalmarRatio)},
+		{"Max Drawdown", formatPercent(stats.MaxDrawdown)},
+		{"Max Drawdown Duration", formatDuration(stats.MaxDrawdownDuration)},
+		{"Exposure", formatPercent(stats.Exposure)},
+	}
+	return append(rows, buildTradeRows(stats.Trades)...)
+}
+
+// buildTradeRows formats the TradeStatistics for display
+func buildTradeRows(stats statistics.TradeStatistics) []statisticRow {
+	return []statisticRow{
+		{"Trades", fmt.Sprintf("%d", stats.NumTrades)},
+		{"Win Rate", formatPercent(stats.WinRate)},
+		{"Profit Factor", fmt.Sprintf("%.2f", stats.ProfitFactor)},
+		{"Expectancy", fmt.Sprintf("%.2f", stats.Expectancy)},
+		{"Total P&L", fmt.Sprintf("%.2f", stats.TotalProfitLoss)},
+		{"Avg Hold Time", formatDuration(stats.AvgHoldTime)},
+		{"Time In Market", formatPercent(stats.Exposure)},
+	}
+}
+
+// formatPercent formats a fraction as a percentage
+func formatPercent(value float64) string {
+	return fmt.Sprintf("%.2f%%", value*100)
+}
+
+// formatDuration formats a duration in days & hours
+func formatDuration(duration time.Duration) string {
+	days := int(duration.Hours()) / 24
+	hours := int(duration.Hours()) % 24
+	return fmt.Sprintf("%dd %dh", days, hours)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Backtest Report: {{.Name}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1a202c; margin: 2em auto; max-width: 1000px; }
+h1 { font-size: 1.6em; margin-bottom: 0; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #e2e8f0; }
+p.meta { color: #4a5568; margin-top: 0.2em; }
+table { border-collapse: collapse; min-width: 360px; }
+td { padding: 4px 12px; border-bottom: 1px solid #edf2f7; }
+td.value { text-align: right; font-variant-numeric: tabular-nums; }
+</style>
+</head>
+<body>
+<h1>Backtest Report: {{.Name}}</h1>
+<p class="meta">Generated {{.GeneratedAt}}</p>
+
+<h2>Statistics</h2>
+<table>
+{{range .PortfolioTable}}<tr><td>{{.Label}}</td><td class="value">{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>Equity Curve</h2>
+{{.EquityChart}}
+
+<h2>Drawdown</h2>
+{{.DrawdownChart}}
+
+{{range .PriceCharts}}<h2>Price &amp; Trades: {{.Symbol}}</h2>
+{{.Chart}}
+{{end}}
+<h2>Monthly Returns</h2>
+{{.MonthlyHeatmap}}
+
+{{range .SymbolTables}}<h2>Statistics: {{.Symbol}}</h2>
+<table>
+{{range .Rows}}<tr><td>{{.Label}}</td><td class="value">{{.Value}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,189 @@
+package report
+
+import (
+	"bytes"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/statistics"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalculateMonthlyReturns(t *testing.T) {
+	testCases := []struct {
+		name        string
+		equityCurve []statistics.EquityPoint
+		expected    map[int]map[time.Month]float64
+	}{
+		{
+			name:        "TestCalculateMonthlyReturns_empty",
+			equityCurve: []statistics.EquityPoint{},
+			expected:    map[int]map[time.Month]float64{},
+		},
+		{
+			name: "TestCalculateMonthlyReturns_singleMonth",
+			equityCurve: []statistics.EquityPoint{
+				{Timestamp: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Value: 100},
+				{Timestamp: time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC), Value: 90},
+				{Timestamp: time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC), Value: 110},
+			},
+			expected: map[int]map[time.Month]float64{2021: {time.January: 0.1}},
+		},
+		{
+			name: "TestCalculateMonthlyReturns_acrossYearEnd",
+			equityCurve: []statistics.EquityPoint{
+				{Timestamp: time.Date(2020, 11, 20, 0, 0, 0, 0, time.UTC), Value: 100},
+				{Timestamp: time.Date(2020, 11, 30, 0, 0, 0, 0, time.UTC), Value: 120},
+				{Timestamp: time.Date(2020, 12, 15, 0, 0, 0, 0, time.UTC), Value: 150},
+				{Timestamp: time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC), Value: 90},
+				{Timestamp: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Value: 99},
+			},
+			// Each month's return is measured from the last value of the previous month
+			expected: map[int]map[time.Month]float64{
+				2020: {time.November: 0.2, time.December: -0.25},
+				2021: {time.January: 0.1},
+			},
+		},
+		{
+			name: "TestCalculateMonthlyReturns_skippedMonth",
+			equityCurve: []statistics.EquityPoint{
+				{Timestamp: time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC), Value: 100},
+				{Timestamp: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), Value: 105},
+			},
+			expected: map[int]map[time.Month]float64{2021: {time.January: 0, time.March: 0.05}},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := calculateMonthlyReturns(testCase.equityCurve)
+
+			if diff := cmp.Diff(testCase.expected, actual, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBuildDrawdownChart(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	testCases := []struct {
+		name        string
+		equityCurve []statistics.EquityPoint
+		expected    []float64 // Drawdown percentage of each point
+	}{
+		{
+			name:        "TestBuildDrawdownChart_empty",
+			equityCurve: []statistics.EquityPoint{},
+		},
+		{
+			name: "TestBuildDrawdownChart_drawdownAndRecovery",
+			equityCurve: []statistics.EquityPoint{
+				{Timestamp: testTimestamp, Value: 100},
+				{Timestamp: testTimestamp.Add(day), Value: 200},
+				{Timestamp: testTimestamp.Add(2 * day), Value: 150},
+				{Timestamp: testTimestamp.Add(3 * day), Value: 100},
+				{Timestamp: testTimestamp.Add(4 * day), Value: 250},
+				{Timestamp: testTimestamp.Add(5 * day), Value: 225},
+			},
+			expected: []float64{0, 0, -25, -50, 0, -10},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			chart := buildDrawdownChart(testCase.equityCurve)
+
+			var actual []float64
+			for index, point := range chart.Points {
+				if !point.Timestamp.Equal(testCase.equityCurve[index].Timestamp) {
+					t.Fatalf("expected timestamp %s at index %v, got %s", testCase.equityCurve[index].Timestamp, index,
+						point.Timestamp)
+				}
+				actual = append(actual, point.Value)
+			}
+			if diff := cmp.Diff(testCase.expected, actual, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+			if !chart.Fill {
+				t.Fatal("expected the drawdown chart to be filled")
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 30, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	prices := &model.SymbolData{}
+	for index, close := range []float64{100, 110, 105} {
+		timestamp := testTimestamp.Add(time.Duration(index) * day)
+		prices.AddBar(model.Bar{Timestamp: timestamp, Open: close, High: close, Low: close, Close: close, Volume: 1000})
+	}
+	equityCurve := []statistics.EquityPoint{
+		{Timestamp: testTimestamp, Value: 10000},
+		{Timestamp: testTimestamp.Add(day), Value: 10100, Exposure: 1100},
+		{Timestamp: testTimestamp.Add(2 * day), Value: 10050},
+	}
+	historicPositions := map[string][]model.Position{
+		"ETH-USD": {{Symbol: "ETH-USD", Direction: model.DirectionLong, Quantity: 10, EnterTimestamp: testTimestamp,
+			EnterAvgPriceGross: 100, ExitTimestamp: testTimestamp.Add(2 * day), ExitAvgPriceGross: 105,
+			ResultProfitLoss: 50, ExitReason: "<SIGNAL>"}},
+	}
+	symbolEquityCurves := map[string][]statistics.EquityPoint{"ETH-USD": equityCurve}
+	input := Input{
+		Name:              "ETH-USD_1D_<binance>",
+		GeneratedAt:       testTimestamp,
+		Summary:           statistics.Calculate(historicPositions, equityCurve, symbolEquityCurves),
+		EquityCurve:       equityCurve,
+		Prices:            map[string]*model.SymbolData{"ETH-USD": prices},
+		HistoricPositions: historicPositions,
+	}
+
+	var buffer bytes.Buffer
+	if err := Generate(&buffer, input); err != nil {
+		t.Fatal(err)
+	}
+	html := buffer.String()
+
+	for _, expected := range []string{
+		"<title>Backtest Report: ETH-USD_1D_&lt;binance&gt;</title>",
+		"<h2>Equity Curve</h2>",
+		"<h2>Drawdown</h2>",
+		"<h2>Price &amp; Trades: ETH-USD</h2>",
+		"<h2>Monthly Returns</h2>",
+		"<h2>Statistics: ETH-USD</h2>",
+		`<svg xmlns="http://www.w3.org/2000/svg"`,
+		`fill-opacity="0.2"`, // Filled drawdown area
+		`<path d="M`,         // Chart lines & enter markers
+		"<circle ",           // Exit marker
+		"(&lt;SIGNAL&gt;)",   // Escaped marker title
+		"<rect ",             // Heatmap cells
+		">Jan</text>",        // Heatmap month header
+		"<td>Total Return</td><td class=\"value\">0.50%</td>",
+		"<td>Trades</td><td class=\"value\">1</td>",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected report to contain %q", expected)
+		}
+	}
+	if strings.Contains(html, "<binance>") || strings.Contains(html, "<SIGNAL>") {
+		t.Error("expected user supplied text to be escaped")
+	}
+	if count := strings.Count(html, "<svg "); count != 4 {
+		t.Errorf("expected 4 SVG charts, got %v", count)
+	}
+}
+
+func TestGenerate_noData(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := Generate(&buffer, Input{Name: "ETH-USD_1D_binance"}); err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(buffer.String(), "<p>No data</p>"); count != 3 {
+		t.Errorf("expected the equity, drawdown & heatmap charts to have no data, got %v", count)
+	}
+}
@@ -0,0 +1,206 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	chartWidth   = 960.0
+	chartHeight  = 280.0
+	chartPadding = 60.0
+
+	colourLine     = "#2b6cb0"
+	colourDrawdown = "#c53030"
+	colourLong     = "#2f855a"
+	colourShort    = "#c53030"
+	colourExit     = "#1a202c"
+	colourGrid     = "#e2e8f0"
+	colourText     = "#4a5568"
+)
+
+// point is a value at a timestamp plotted on a timeSeriesChart
+type point struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// marker is an annotated point plotted on top of a timeSeriesChart line
+type marker struct {
+	point
+	Colour string
+	Shape  string // "up", "down" or "circle"
+	Title  string
+}
+
+// timeSeriesChart renders a line of points against a time x-axis as an inline SVG
+type timeSeriesChart struct {
+	Points  []point
+	Markers []marker
+	Colour  string
+	Fill    bool   // Shade the area between the line & the zero line
+	Format  string // fmt verb used for y-axis labels
+}
+
+// Render returns the chart as an SVG element
+func (c timeSeriesChart) Render() template.HTML {
+	if len(c.Points) == 0 {
+		return template.HTML("<p>No data</p>")
+	}
+
+	start, end := c.Points[0].Timestamp, c.Points[len(c.Points)-1].Timestamp
+	minValue, maxValue := c.valueRange()
+
+	scaleX := func(timestamp time.Time) float64 {
+		if !end.After(start) {
+			return chartPadding
+		}
+		fraction := float64(timestamp.Sub(start)) / float64(end.Sub(start))
+		return chartPadding + fraction*(chartWidth-2*chartPadding)
+	}
+	scaleY := func(value float64) float64 {
+		fraction := (value - minValue) / (maxValue - minValue)
+		return chartHeight - chartPadding/2 - fraction*(chartHeight-chartPadding)
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %.0f %.0f" width="100%%">`, chartWidth, chartHeight)
+
+	// Horizontal grid lines & y-axis labels
+	for i := 0; i <= 4; i++ {
+		value := minValue + float64(i)*(maxValue-minValue)/4
+		y := scaleY(value)
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`,
+			chartPadding, y, chartWidth-chartPadding, y, colourGrid)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" font-size="11" text-anchor="end" fill="%s">%s</text>`,
+			chartPadding-6, y+4, colourText, fmt.Sprintf(c.Format, value))
+	}
+
+	// x-axis labels
+	for i := 0; i <= 4; i++ {
+		timestamp := start.Add(time.Duration(float64(end.Sub(start)) * float64(i) / 4))
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" font-size="11" text-anchor="middle" fill="%s">%s</text>`,
+			scaleX(timestamp), chartHeight-4, colourText, timestamp.Format("2006-01-02"))
+	}
+
+	// Line
+	var path strings.Builder
+	for i, p := range c.Points {
+		command := "L"
+		if i == 0 {
+			command = "M"
+		}
+		fmt.Fprintf(&path, "%s%.1f,%.1f ", command, scaleX(p.Timestamp), scaleY(p.Value))
+	}
+	if c.Fill {
+		zeroY := scaleY(math.Max(minValue, math.Min(0, maxValue)))
+		fmt.Fprintf(&svg, `<path d="%sL%.1f,%.1f L%.1f,%.1f Z" fill="%s" fill-opacity="0.2" stroke="none"/>`,
+			path.String(), scaleX(end), zeroY, scaleX(start), zeroY, c.Colour)
+	}
+	fmt.Fprintf(&svg, `<path d="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, path.String(), c.Colour)
+
+	// Markers
+	for _, m := range c.Markers {
+		x, y := scaleX(m.Timestamp), scaleY(m.Value)
+		switch m.Shape {
+		case "up":
+			fmt.Fprintf(&svg, `<path d="M%.1f,%.1f l5,9 l-10,0 Z" fill="%s"><title>%s</title></path>`,
+				x, y, m.Colour, template.HTMLEscapeString(m.Title))
+		case "down":
+			fmt.Fprintf(&svg, `<path d="M%.1f,%.1f l5,-9 l-10,0 Z" fill="%s"><title>%s</title></path>`,
+				x, y, m.Colour, template.HTMLEscapeString(m.Title))
+		default:
+			fmt.Fprintf(&svg, `<circle cx="%.1f" cy="%.1f" r="3.5" fill="none" stroke="%s"><title>%s</title></circle>`,
+				x, y, m.Colour, template.HTMLEscapeString(m.Title))
+		}
+	}
+
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
+
+// valueRange returns the min & max values of the chart's points & markers, padded so a flat line is still visible
+func (c timeSeriesChart) valueRange() (float64, float64) {
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, p := range c.Points {
+		minValue, maxValue = math.Min(minValue, p.Value), math.Max(maxValue, p.Value)
+	}
+	for _, m := range c.Markers {
+		minValue, maxValue = math.Min(minValue, m.Value), math.Max(maxValue, m.Value)
+	}
+	if c.Fill {
+		minValue, maxValue = math.Min(minValue, 0), math.Max(maxValue, 0)
+	}
+	if maxValue == minValue {
+		minValue, maxValue = minValue-1, maxValue+1
+	}
+	return minValue, maxValue
+}
+
+// monthlyReturnsHeatmap renders a grid of monthly returns (rows are years, columns are months) as an inline SVG
+type monthlyReturnsHeatmap struct {
+	Returns map[int]map[time.Month]float64 // map[Year]map[Month]Return
+}
+
+// Render returns the heatmap as an SVG element
+func (h monthlyReturnsHeatmap) Render() template.HTML {
+	if len(h.Returns) == 0 {
+		return template.HTML("<p>No data</p>")
+	}
+
+	var years []int
+	maxAbsReturn := 0.0
+	for year, months := range h.Returns {
+		years = append(years, year)
+		for _, monthReturn := range months {
+			maxAbsReturn = math.Max(maxAbsReturn, math.Abs(monthReturn))
+		}
+	}
+	sort.Ints(years)
+
+	const cellWidth, cellHeight, labelWidth, headerHeight = 64.0, 28.0, 50.0, 20.0
+	width := labelWidth + 12*cellWidth
+	height := headerHeight + float64(len(years))*cellHeight
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %.0f %.0f" width="%.0f">`, width, height, width)
+	for month := time.January; month <= time.December; month++ {
+		fmt.Fprintf(&svg, `<text x="%.1f" y="14" font-size="11" text-anchor="middle" fill="%s">%s</text>`,
+			labelWidth+(float64(month)-0.5)*cellWidth, colourText, month.String()[:3])
+	}
+	for row, year := range years {
+		y := headerHeight + float64(row)*cellHeight
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" font-size="11" fill="%s">%d</text>`,
+			4.0, y+cellHeight/2+4, colourText, year)
+		for month := time.January; month <= time.December; month++ {
+			monthReturn, ok := h.Returns[year][month]
+			if !ok {
+				continue
+			}
+			x := labelWidth + float64(month-1)*cellWidth
+			fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" stroke="#ffffff"/>`,
+				x, y, cellWidth, cellHeight, heatmapColour(monthReturn, maxAbsReturn))
+			fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" font-size="11" text-anchor="middle" fill="#1a202c">%.1f%%</text>`,
+				x+cellWidth/2, y+cellHeight/2+4, monthReturn*100)
+		}
+	}
+	svg.WriteString("</svg>")
+	return template.HTML(svg.String())
+}
+
+// heatmapColour returns a green (+ve) or red (-ve) fill colour with an intensity relative to the largest return
+func heatmapColour(value float64, maxAbsValue float64) string {
+	intensity := 0.0
+	if maxAbsValue > 0 {
+		intensity = math.Abs(value) / maxAbsValue
+	}
+	fade := int(255 - intensity*155)
+	if value >= 0 {
+		return fmt.Sprintf("rgb(%d,%d,%d)", fade, 255-int(intensity*60), fade)
+	}
+	return fmt.Sprintf("rgb(%d,%d,%d)", 255-int(intensity*60), fade, fade)
+}
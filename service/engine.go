@@ -1,87 +1,350 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/trader"
 	"go.uber.org/zap"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PortfolioModeShared   = "SHARED"   // One trader & portfolio pooling the cash of every market
+	PortfolioModeIsolated = "ISOLATED" // A trader & portfolio per market
 )
 
 type TradingEngine interface {
-	RunBacktest() error
-	RunTraderLive() error
-	RunTraderDry() error
+	RunBacktest(ctx context.Context) error
+	RunTraderLive(ctx context.Context) error
+	RunTraderDry(ctx context.Context) error
+	Export(directory string) error
+	Report(directory string) error
 }
 
 type tradingEngine struct {
-	log     *zap.Logger
-	traders []trader.Trader
+	log        *zap.Logger
+	mode       string
+	traders    []trader.Trader
+	maxWorkers int
+}
+
+// RunBacktest runs every trader in parallel on a pool of maxWorkers goroutines - each trader owns its event queue,
+// so traders are independent. A failed trader does not stop the others, and every failure is collected into the
+// returned error. Cancelling the context stops the running traders & any trader not yet started.
+func (t *tradingEngine) RunBacktest(ctx context.Context) error {
+	if t.mode != trader.ModeBacktest {
+		return errors.New(fmt.Sprintf("cannot RunBacktest() with traders built for %s mode", t.mode))
+	}
+	return t.runTraders(ctx, t.maxWorkers)
 }
 
-func (t *tradingEngine) RunBacktest() error {
+// runTraders runs every trader on a pool of workers, collecting the error of every failed trader - a cancelled run
+// returns the context's error, with the failures of any traders that failed before the cancellation
+func (t *tradingEngine) runTraders(ctx context.Context, workers int) error {
+	traderQ := make(chan trader.Trader)
+	var failures []string
+	var failuresMutex sync.Mutex
+	var waitGroup sync.WaitGroup
+
+	for worker := 0; worker < workers; worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for traderPair := range traderQ {
+				if err := t.runTrader(ctx, traderPair); err != nil {
+					// Traders stopped by the cancellation have not failed
+					if ctx.Err() != nil && errors.Cause(err) == ctx.Err() {
+						continue
+					}
+					failuresMutex.Lock()
+					failures = append(failures, fmt.Sprintf("%s: %s", traderPair.Name(), err))
+					failuresMutex.Unlock()
+				}
+			}
+		}()
+	}
+
 	for _, traderPair := range t.traders {
-		if err := traderPair.Run(); err != nil {
-			return errors.Wrap(err, "failed to RunBacktest()")
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case traderQ <- traderPair:
+		case <-ctx.Done():
 		}
 	}
+	close(traderQ)
+	waitGroup.Wait()
+
+	if ctx.Err() != nil {
+		if len(failures) > 0 {
+			return errors.Wrap(ctx.Err(), fmt.Sprintf("run cancelled after %v of %v traders failed: %s", len(failures),
+				len(t.traders), strings.Join(failures, "; ")))
+		}
+		return errors.Wrap(ctx.Err(), "run cancelled")
+	}
+	if len(failures) > 0 {
+		return errors.New(fmt.Sprintf("%v of %v traders failed: %s", len(failures), len(t.traders),
+			strings.Join(failures, "; ")))
+	}
 	return nil
 }
 
-func (t *tradingEngine) RunTraderLive() error {
-	// Run live trading with meta-strategy for specified trading pairs
+// runTrader runs a single trader & logs its results
+func (t *tradingEngine) runTrader(ctx context.Context, traderPair trader.Trader) error {
+	if err := traderPair.Run(ctx); err != nil {
+		return err
+	}
+	summary, err := json.Marshal(traderPair.Results())
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal results")
+	}
+	t.log.Info(fmt.Sprintf("RESULTS %s: %s", traderPair.Name(), string(summary)))
 	return nil
 }
 
-func (t *tradingEngine) RunTraderDry() error {
-	// Run live trading with meta-strategy for specified trading pairs
+// RunTraderLive trades every trader on its exchange, placing real orders, until the feeds finish or the context is
+// cancelled - like dry runs, every trader runs at once regardless of maxWorkers
+func (t *tradingEngine) RunTraderLive(ctx context.Context) error {
+	if t.mode != trader.ModeLive {
+		return errors.New(fmt.Sprintf("cannot RunTraderLive() with traders built for %s mode", t.mode))
+	}
+	return t.runTraders(ctx, len(t.traders))
+}
+
+// RunTraderDry paper trades every trader against its live feed until the feeds finish or the context is cancelled -
+// traders wait on their feeds rather than the CPU, so every trader runs at once regardless of maxWorkers
+func (t *tradingEngine) RunTraderDry(ctx context.Context) error {
+	if t.mode != trader.ModeDry {
+		return errors.New(fmt.Sprintf("cannot RunTraderDry() with traders built for %s mode", t.mode))
+	}
+	return t.runTraders(ctx, len(t.traders))
+}
+
+// Export writes the order book, fill journal, closed position ledger & portfolio Snapshots of every trader to the
+// provided directory
+func (t *tradingEngine) Export(directory string) error {
+	for _, traderPair := range t.traders {
+		if err := traderPair.Export(directory); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to export trader %s", traderPair.Name()))
+		}
+	}
+	t.log.Info(fmt.Sprintf("backtest results exported to: %s", directory))
 	return nil
 }
 
-func NewTradingEngine(cfg *config.Engine, log *zap.Logger) (*tradingEngine, error) {
-	traders, err := buildTraders(cfg, log)
+// Report writes a self-contained HTML backtest report for every trader to the provided directory
+func (t *tradingEngine) Report(directory string) error {
+	for _, traderPair := range t.traders {
+		if err := traderPair.Report(directory); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to report trader %s", traderPair.Name()))
+		}
+	}
+	t.log.Info(fmt.Sprintf("backtest reports written to: %s", directory))
+	return nil
+}
+
+// NewTradingEngine constructs a TradingEngine whose traders run in the provided trading mode
+func NewTradingEngine(cfg *config.Engine, mode string, log *zap.Logger) (*tradingEngine, error) {
+	traders, err := buildTraders(cfg, mode, log)
 	if err != nil {
 		return &tradingEngine{}, err
 	}
 
+	// Default to a worker per CPU
+	maxWorkers := cfg.MaxWorkers
+	if maxWorkers <= 0 {
+		maxWorkers = runtime.NumCPU()
+	}
+
 	engine := &tradingEngine{
-		log:     log,
-		traders: traders,
+		log:        log,
+		mode:       mode,
+		traders:    traders,
+		maxWorkers: maxWorkers,
 	}
 
 	return engine, nil
 }
 
-func buildTraders(cfg *config.Engine, log *zap.Logger) ([]trader.Trader, error) {
+// buildTraders groups the market of every trader config into traders according to the engine's PortfolioMode
+func buildTraders(cfg *config.Engine, mode string, log *zap.Logger) ([]trader.Trader, error) {
+	traderConfigs, err := buildTraderConfigs(cfg, mode, log)
+	if err != nil {
+		return nil, err
+	}
+
+	var traderGroups [][]config.Trader
+	switch cfg.PortfolioMode {
+	case PortfolioModeShared:
+		traderGroups = append(traderGroups, traderConfigs)
+	case PortfolioModeIsolated:
+		for _, traderConfig := range traderConfigs {
+			traderGroups = append(traderGroups, []config.Trader{traderConfig})
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported portfolio mode %s", cfg.PortfolioMode))
+	}
+
 	var traders []trader.Trader
-	for index, cfg := range buildTraderConfigs(cfg, log) {
-		traderPair, err := trader.NewTrader(cfg)
+	for index, cfgs := range traderGroups {
+		traderPair, err := trader.NewTrader(cfgs)
 		if err != nil {
-			return traders, errors.Wrap(err, fmt.Sprintf("failed to init trader %v with config: %+v\n", index, cfg))
+			// Configs are not logged as they hold the exchange API secret
+			var symbols []string
+			for _, cfg := range cfgs {
+				symbols = append(symbols, cfg.Symbol)
+			}
+			return traders, errors.Wrap(err, fmt.Sprintf("failed to init trader %v of symbols %s", index, strings.Join(symbols, ",")))
 		}
 		traders = append(traders, traderPair)
 	}
 	return traders, nil
 }
 
-func buildTraderConfigs(cfg *config.Engine, log *zap.Logger) []config.Trader {
-	// Todo: Remove these stubs with the real array from the config.Engine struct
-	tickers := []string{cfg.Symbols}
-	timeframes := []string{cfg.Timeframes}
-	exchanges := []string{cfg.Exchanges}
-	startingCash := cfg.StartingCash / float64(len(tickers))
-	defaultOrderValue := startingCash / 10
+// buildTraderConfigs builds the config of every market in the trader matrix - STARTING_CASH left over after the cash
+// overrides is split evenly between the remaining markets, and orders default to a tenth of a market's cash
+func buildTraderConfigs(cfg *config.Engine, mode string, log *zap.Logger) ([]config.Trader, error) {
+	markets, err := buildMarkets(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build trader matrix")
+	}
+	overrides, err := parseTraderOverrides(cfg.TraderOverrides)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse trader overrides")
+	}
+	if cfg.PortfolioMode == PortfolioModeShared {
+		if err := validateSharedMarkets(markets, overrides); err != nil {
+			return nil, err
+		}
+	}
+
+	// Allocate the cash left over after the overrides
+	marketNames := make(map[string]bool)
+	remainingCash := cfg.StartingCash
+	remainingMarkets := 0
+	for _, market := range markets {
+		marketNames[market.name()] = true
+		if override := overrides[market.name()]; override.startingCash > 0 {
+			remainingCash -= override.startingCash
+		} else {
+			remainingMarkets++
+		}
+	}
+	for name := range overrides {
+		if !marketNames[name] {
+			return nil, errors.New(fmt.Sprintf("trader override for %s does not match a market in the trader matrix", name))
+		}
+	}
+	if remainingMarkets > 0 && remainingCash <= 0 {
+		return nil, errors.New(fmt.Sprintf("cash overrides leave no STARTING_CASH for the remaining %v markets", remainingMarkets))
+	}
+
+	// Window the backtest
+	backtestStart, err := parseBacktestDate(cfg.BacktestStart)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid BACKTEST_START")
+	}
+	backtestEnd, err := parseBacktestDate(cfg.BacktestEnd)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid BACKTEST_END")
+	}
+	if !backtestStart.IsZero() && !backtestEnd.IsZero() && !backtestEnd.After(backtestStart) {
+		return nil, errors.New(fmt.Sprintf("BACKTEST_END %s is not after BACKTEST_START %s", cfg.BacktestEnd, cfg.BacktestStart))
+	}
+	if cfg.WarmupBars < 0 {
+		return nil, errors.New(fmt.Sprintf("WARMUP_BARS %v is negative", cfg.WarmupBars))
+	}
 
 	var traderConfigs []config.Trader
-	for index, symbol := range tickers {
+	for _, market := range markets {
+		override := overrides[market.name()]
+		startingCash := override.startingCash
+		if startingCash == 0 {
+			startingCash = remainingCash / float64(remainingMarkets)
+		}
+		defaultOrderValue := override.defaultOrderValue
+		if defaultOrderValue == 0 {
+			defaultOrderValue = startingCash / 10
+		}
+		strategy := override.strategy
+		if strategy == "" {
+			strategy = cfg.Strategy
+		}
+		slippageModel := override.slippageModel
+		if slippageModel == "" {
+			slippageModel = cfg.SlippageModel
+		}
+
 		traderConfigs = append(traderConfigs, config.Trader{
 			Log: 				log,
-			Symbol:    			symbol,
-			Timeframe:      	timeframes[index],
-			Exchange:       	exchanges[index],
+			Mode: 				mode,
+			Symbol:    			market.symbol,
+			Timeframe:      	market.timeframe,
+			Exchange:       	market.exchange,
 			StartingCash: 		startingCash,
+			Strategy: 			strategy,
+			StrategyParams: 	cfg.StrategyParams,
 			DefaultOrderValue: 	defaultOrderValue,
+			FillTiming: 		cfg.FillTiming,
+			ExchangeFees: 		cfg.ExchangeFees,
+			SlippageModel: 		slippageModel,
+			NetworkFees: 		cfg.NetworkFees,
+			AMMPools: 			cfg.AMMPools,
+			OrderType: 			cfg.OrderType,
+			OrderPriceOffset: 	cfg.OrderPriceOffset,
+			TimeInForce: 		cfg.TimeInForce,
+			OrderTimeToLive: 	cfg.OrderTimeToLive,
+			MaxVolumeFraction: 	cfg.MaxVolumeFraction,
+			StopLoss: 			cfg.StopLoss,
+			TakeProfit: 		cfg.TakeProfit,
+			TrailingStop: 		cfg.TrailingStop,
+			ExitPriority: 		cfg.ExitPriority,
+			MaxGrossExposure: 	cfg.MaxGrossExposure,
+			MaxSymbolExposure: 	cfg.MaxSymbolExposure,
+			MarginRequirement: 	cfg.MarginRequirement,
+			DataFeed: 			cfg.DataFeed,
+			DataFeedURL: 		cfg.DataFeedURL,
+			DataStreamURL: 		cfg.DataStreamURL,
+			Heartbeat: 			cfg.Heartbeat,
+			ExchangeAPIURL: 	cfg.ExchangeAPIURL,
+			ExchangeAPIKey: 	cfg.ExchangeAPIKey,
+			ExchangeAPISecret: 	cfg.ExchangeAPISecret,
+			BaseTimeframe: 		cfg.BaseTimeframe,
+			CSVSchemas: 		cfg.CSVSchemas,
+			DataQuality: 		cfg.DataQuality,
+			DataQualityOutlier: cfg.DataQualityOutlier,
+			DataSource: 		cfg.DataSource,
+			SynthModel: 		cfg.SynthModel,
+			SynthSeed: 			cfg.SynthSeed,
+			SynthBars: 			cfg.SynthBars,
+			SynthStart: 		cfg.SynthStart,
+			SynthStartPrice: 	cfg.SynthStartPrice,
+			BacktestStart: 		backtestStart,
+			BacktestEnd: 		backtestEnd,
+			WarmupBars: 		cfg.WarmupBars,
 		})
 	}
-	return traderConfigs
-}
\ No newline at end of file
+	return traderConfigs, nil
+}
+
+// parseBacktestDate parses an ISO date or RFC3339 timestamp bounding the backtest, an empty value is unbounded
+func parseBacktestDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("%s is neither an ISO date nor an RFC3339 timestamp", value))
+	}
+	return timestamp.UTC(), nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pkgerrors "github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/statistics"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/trader"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTrader records how many fakeTraders run concurrently & fails with err once its run completes
+type fakeTrader struct {
+	name    string
+	err     error
+	wait    time.Duration // Duration of the run, 10ms when zero
+	started chan string   // Receives the name of the fakeTrader when its run starts, if set
+	running *int32
+	peak    *int32
+	mutex   *sync.Mutex
+}
+
+func (f *fakeTrader) Run(ctx context.Context) error {
+	running := atomic.AddInt32(f.running, 1)
+	defer atomic.AddInt32(f.running, -1)
+	f.mutex.Lock()
+	if running > *f.peak {
+		*f.peak = running
+	}
+	f.mutex.Unlock()
+	if f.started != nil {
+		f.started <- f.name
+	}
+
+	wait := f.wait
+	if wait == 0 {
+		wait = 10 * time.Millisecond
+	}
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return f.err
+}
+
+func (f *fakeTrader) Name() string                          { return f.name }
+func (f *fakeTrader) Results() statistics.Summary           { return statistics.Summary{} }
+func (f *fakeTrader) EquityCurve() []statistics.EquityPoint { return nil }
+func (f *fakeTrader) Export(directory string) error         { return nil }
+func (f *fakeTrader) Report(directory string) error         { return nil }
+
+func TestTradingEngine_RunBacktest(t *testing.T) {
+	testCases := []struct {
+		name           string
+		errs           []error
+		maxWorkers     int
+		cancelled      bool
+		expectedErrors []string
+	}{
+		{
+			name:       "TestTradingEngine_RunBacktest_success",
+			errs:       []error{nil, nil, nil, nil},
+			maxWorkers: 2,
+		},
+		{
+			name:           "TestTradingEngine_RunBacktest_collectsErrors",
+			errs:           []error{errors.New("bad data"), nil, errors.New("bad order"), nil},
+			maxWorkers:     4,
+			expectedErrors: []string{"2 of 4 traders failed", "trader0: bad data", "trader2: bad order"},
+		},
+		{
+			name:           "TestTradingEngine_RunBacktest_cancelled",
+			errs:           []error{nil, nil},
+			maxWorkers:     1,
+			cancelled:      true,
+			expectedErrors: []string{"cancelled"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var running, peak int32
+			var mutex sync.Mutex
+			var traders []trader.Trader
+			for index, err := range testCase.errs {
+				traders = append(traders, &fakeTrader{name: fmt.Sprintf("trader%v", index), err: err,
+					running: &running, peak: &peak, mutex: &mutex})
+			}
+			engine := &tradingEngine{log: zap.NewNop(), mode: trader.ModeBacktest, traders: traders,
+				maxWorkers: testCase.maxWorkers}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if testCase.cancelled {
+				cancel()
+			}
+
+			err := engine.RunBacktest(ctx)
+			if len(testCase.expectedErrors) == 0 && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			for _, expected := range testCase.expectedErrors {
+				if err == nil || !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error containing %q, got: %v", expected, err)
+				}
+			}
+			if peak > int32(testCase.maxWorkers) {
+				t.Errorf("expected at most %v traders to run concurrently, got: %v", testCase.maxWorkers, peak)
+			}
+		})
+	}
+}
+
+func TestTradingEngine_RunBacktest_cancelledMidRun(t *testing.T) {
+	testCases := []struct {
+		name             string
+		errs             []error
+		waits            []time.Duration
+		expectedErrors   []string
+		unexpectedErrors []string
+	}{
+		{
+			name:             "TestTradingEngine_RunBacktest_cancelledMidRun_noFailures",
+			errs:             []error{nil, nil, nil},
+			waits:            []time.Duration{time.Minute, time.Minute, time.Minute},
+			expectedErrors:   []string{"run cancelled"},
+			unexpectedErrors: []string{"failed", "trader0", "trader1", "trader2"},
+		},
+		{
+			name:             "TestTradingEngine_RunBacktest_cancelledMidRun_withFailure",
+			errs:             []error{errors.New("bad data"), nil, nil},
+			waits:            []time.Duration{time.Millisecond, time.Minute, time.Minute},
+			expectedErrors:   []string{"run cancelled after 1 of 3 traders failed", "trader0: bad data"},
+			unexpectedErrors: []string{"trader1", "trader2"},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var running, peak int32
+			var mutex sync.Mutex
+			started := make(chan string, len(testCase.errs))
+			var traders []trader.Trader
+			for index, err := range testCase.errs {
+				traders = append(traders, &fakeTrader{name: fmt.Sprintf("trader%v", index), err: err,
+					wait: testCase.waits[index], started: started, running: &running, peak: &peak, mutex: &mutex})
+			}
+			engine := &tradingEngine{log: zap.NewNop(), mode: trader.ModeBacktest, traders: traders,
+				maxWorkers: len(traders)}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				// Cancel once every trader is running & the quick ones have had time to finish
+				for range testCase.errs {
+					<-started
+				}
+				time.Sleep(20 * time.Millisecond)
+				cancel()
+			}()
+
+			err := engine.RunBacktest(ctx)
+			if err == nil {
+				t.Fatal("expected an error from the cancelled run")
+			}
+			if pkgerrors.Cause(err) != context.Canceled {
+				t.Errorf("expected the cause %v, got %v", context.Canceled, pkgerrors.Cause(err))
+			}
+			for _, expected := range testCase.expectedErrors {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error containing %q, got: %v", expected, err)
+				}
+			}
+			for _, unexpected := range testCase.unexpectedErrors {
+				if strings.Contains(err.Error(), unexpected) {
+					t.Errorf("expected error without %q, got: %v", unexpected, err)
+				}
+			}
+		})
+	}
+}
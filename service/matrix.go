@@ -0,0 +1,185 @@
+package service
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/execution"
+	"strconv"
+	"strings"
+)
+
+const (
+	TraderMatrixZip       = "ZIP"       // Combine the nth ticker, timeframe & exchange, broadcasting single entries
+	TraderMatrixCartesian = "CARTESIAN" // Combine every ticker with every timeframe & every exchange
+)
+
+const (
+	overrideCash       = "cash"
+	overrideOrderValue = "order_value"
+	overrideStrategy   = "strategy"
+	overrideSlippage   = "slippage"
+)
+
+// market is a single symbol, timeframe & exchange combination traded by the engine
+type market struct {
+	symbol    string
+	timeframe string
+	exchange  string
+}
+
+// name returns the identifier of the market in the format "symbol_timeframe_exchange"
+func (m market) name() string {
+	return fmt.Sprintf("%s_%s_%s", m.symbol, m.timeframe, m.exchange)
+}
+
+// traderOverride replaces the engine's default cash, order value, strategy or slippage model for a single market, zero
+// values are not overridden
+type traderOverride struct {
+	startingCash      float64
+	defaultOrderValue float64
+	strategy          string
+	slippageModel     string
+}
+
+// buildMarkets combines the engine's tickers, timeframes & exchanges into markets according to its TraderMatrix
+func buildMarkets(cfg *config.Engine) ([]market, error) {
+	symbols := cleanList(cfg.Symbols)
+	timeframes := cleanList(cfg.Timeframes)
+	exchanges := cleanList(cfg.Exchanges)
+	if len(symbols) == 0 || len(timeframes) == 0 || len(exchanges) == 0 {
+		return nil, errors.New("TICKERS, TIMEFRAMES & EXCHANGES must each contain at least one entry")
+	}
+
+	var markets []market
+	switch cfg.TraderMatrix {
+	case TraderMatrixZip:
+		length := len(symbols)
+		for _, list := range [][]string{timeframes, exchanges} {
+			if len(list) > length {
+				length = len(list)
+			}
+		}
+		lists := []struct {
+			name   string
+			values []string
+		}{{"TICKERS", symbols}, {"TIMEFRAMES", timeframes}, {"EXCHANGES", exchanges}}
+		for _, list := range lists {
+			if len(list.values) != 1 && len(list.values) != length {
+				return nil, errors.New(fmt.Sprintf("%s has %v entries but ZIP requires %v entries, or a single entry to "+
+					"use for every market", list.name, len(list.values), length))
+			}
+		}
+		for index := 0; index < length; index++ {
+			markets = append(markets, market{
+				symbol:    symbols[index%len(symbols)],
+				timeframe: timeframes[index%len(timeframes)],
+				exchange:  exchanges[index%len(exchanges)],
+			})
+		}
+
+	case TraderMatrixCartesian:
+		for _, symbol := range symbols {
+			for _, timeframe := range timeframes {
+				for _, exchange := range exchanges {
+					markets = append(markets, market{symbol: symbol, timeframe: timeframe, exchange: exchange})
+				}
+			}
+		}
+
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported trader matrix %s", cfg.TraderMatrix))
+	}
+
+	seen := make(map[string]bool)
+	for _, market := range markets {
+		if seen[market.name()] {
+			return nil, errors.New(fmt.Sprintf("market %s appears more than once in the trader matrix", market.name()))
+		}
+		seen[market.name()] = true
+	}
+	return markets, nil
+}
+
+// validateSharedMarkets checks the markets & overrides can share one portfolio - positions are held per symbol, so a
+// symbol cannot be traded on two timeframes or exchanges, and STARTING_CASH is pooled, so cash overrides have no effect
+func validateSharedMarkets(markets []market, overrides map[string]traderOverride) error {
+	symbolMarkets := make(map[string]string)
+	for _, market := range markets {
+		if other, isDuplicate := symbolMarkets[market.symbol]; isDuplicate {
+			return errors.New(fmt.Sprintf("markets %s & %s trade the same symbol, so cannot share a portfolio - use "+
+				"PORTFOLIO_MODE %s", other, market.name(), PortfolioModeIsolated))
+		}
+		symbolMarkets[market.symbol] = market.name()
+		if overrides[market.name()].startingCash > 0 {
+			return errors.New(fmt.Sprintf("cash override of %s has no effect as a shared portfolio pools STARTING_CASH - "+
+				"remove it or use PORTFOLIO_MODE %s", market.name(), PortfolioModeIsolated))
+		}
+	}
+	return nil
+}
+
+// parseTraderOverrides parses a TRADER_OVERRIDES specification in the format
+// "symbol_timeframe_exchange=cash:5000,order_value:500,strategy:rsi,slippage:fixed_bps:5;symbol_timeframe_exchange=..."
+func parseTraderOverrides(specification string) (map[string]traderOverride, error) {
+	overrides := make(map[string]traderOverride)
+	for _, marketSpecification := range strings.Split(specification, ";") {
+		marketSpecification = strings.TrimSpace(marketSpecification)
+		if marketSpecification == "" {
+			continue
+		}
+
+		nameAndOverrides := strings.SplitN(marketSpecification, "=", 2)
+		if len(nameAndOverrides) != 2 {
+			return nil, errors.New(fmt.Sprintf("failed to parse trader override %s", marketSpecification))
+		}
+		name := strings.TrimSpace(nameAndOverrides[0])
+
+		var override traderOverride
+		for _, field := range strings.Split(nameAndOverrides[1], ",") {
+			keyAndValue := strings.SplitN(strings.TrimSpace(field), ":", 2)
+			if len(keyAndValue) != 2 {
+				return nil, errors.New(fmt.Sprintf("failed to parse trader override field %s of %s", field, name))
+			}
+			key, value := strings.TrimSpace(keyAndValue[0]), strings.TrimSpace(keyAndValue[1])
+
+			switch key {
+			case overrideStrategy:
+				override.strategy = value
+			case overrideSlippage:
+				if _, err := execution.NewSlippageModel(value); err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("invalid trader override %s of %s", key, name))
+				}
+				override.slippageModel = value
+			case overrideCash, overrideOrderValue:
+				amount, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("failed to parse trader override %s of %s", key, name))
+				}
+				if amount <= 0 {
+					return nil, errors.New(fmt.Sprintf("trader override %s of %s must be positive", key, name))
+				}
+				if key == overrideCash {
+					override.startingCash = amount
+				} else {
+					override.defaultOrderValue = amount
+				}
+			default:
+				return nil, errors.New(fmt.Sprintf("unsupported trader override %s of %s", key, name))
+			}
+		}
+		overrides[name] = override
+	}
+	return overrides, nil
+}
+
+// cleanList trims every entry of a comma-separated config list & drops empty entries
+func cleanList(values []string) []string {
+	var cleaned []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			cleaned = append(cleaned, value)
+		}
+	}
+	return cleaned
+}
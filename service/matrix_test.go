@@ -0,0 +1,159 @@
+package service
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"testing"
+)
+
+func TestBuildMarkets(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cfg           config.Engine
+		expected      []string
+		expectedError bool
+	}{
+		{
+			name: "TestBuildMarkets_zip",
+			cfg: config.Engine{Symbols: []string{"ETH-USD", " BTC-USD"}, Timeframes: []string{"1D", "4H"},
+				Exchanges: []string{"binance"}, TraderMatrix: TraderMatrixZip},
+			expected: []string{"ETH-USD_1D_binance", "BTC-USD_4H_binance"},
+		},
+		{
+			name: "TestBuildMarkets_cartesian",
+			cfg: config.Engine{Symbols: []string{"ETH-USD", "BTC-USD"}, Timeframes: []string{"1D", "4H"},
+				Exchanges: []string{"binance"}, TraderMatrix: TraderMatrixCartesian},
+			expected: []string{"ETH-USD_1D_binance", "ETH-USD_4H_binance", "BTC-USD_1D_binance", "BTC-USD_4H_binance"},
+		},
+		{
+			name: "TestBuildMarkets_zipMismatchedLengths",
+			cfg: config.Engine{Symbols: []string{"ETH-USD", "BTC-USD", "SOL-USD"}, Timeframes: []string{"1D", "4H"},
+				Exchanges: []string{"binance"}, TraderMatrix: TraderMatrixZip},
+			expectedError: true,
+		},
+		{
+			name: "TestBuildMarkets_duplicateMarket",
+			cfg: config.Engine{Symbols: []string{"ETH-USD", "ETH-USD"}, Timeframes: []string{"1D"},
+				Exchanges: []string{"binance"}, TraderMatrix: TraderMatrixZip},
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			markets, err := buildMarkets(&testCase.cfg)
+			if testCase.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got markets: %+v", markets)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, market := range markets {
+				names = append(names, market.name())
+			}
+			if diff := cmp.Diff(testCase.expected, names); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValidateSharedMarkets(t *testing.T) {
+	testCases := []struct {
+		name          string
+		markets       []market
+		overrides     map[string]traderOverride
+		expectedError bool
+	}{
+		{
+			name: "TestValidateSharedMarkets_distinctSymbols",
+			markets: []market{{symbol: "ETH-USD", timeframe: "1D", exchange: "binance"},
+				{symbol: "BTC-USD", timeframe: "1D", exchange: "binance"}},
+			overrides: map[string]traderOverride{"BTC-USD_1D_binance": {defaultOrderValue: 500}},
+		},
+		{
+			name: "TestValidateSharedMarkets_symbolOnTwoExchanges",
+			markets: []market{{symbol: "ETH-USD", timeframe: "1D", exchange: "binance"},
+				{symbol: "ETH-USD", timeframe: "1D", exchange: "coinbase"}},
+			expectedError: true,
+		},
+		{
+			name: "TestValidateSharedMarkets_symbolOnTwoTimeframes",
+			markets: []market{{symbol: "ETH-USD", timeframe: "1D", exchange: "binance"},
+				{symbol: "ETH-USD", timeframe: "4H", exchange: "binance"}},
+			expectedError: true,
+		},
+		{
+			name:          "TestValidateSharedMarkets_cashOverride",
+			markets:       []market{{symbol: "ETH-USD", timeframe: "1D", exchange: "binance"}},
+			overrides:     map[string]traderOverride{"ETH-USD_1D_binance": {startingCash: 5000}},
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := validateSharedMarkets(testCase.markets, testCase.overrides)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestParseTraderOverrides(t *testing.T) {
+	testCases := []struct {
+		name          string
+		specification string
+		expected      map[string]traderOverride
+		expectedError bool
+	}{
+		{
+			name:          "TestParseTraderOverrides_allFields",
+			specification: "ETH-USD_1D_binance=cash:5000,order_value:500,strategy:rsi,slippage:fixed_bps:5",
+			expected: map[string]traderOverride{"ETH-USD_1D_binance": {startingCash: 5000, defaultOrderValue: 500,
+				strategy: "rsi", slippageModel: "fixed_bps:5"}},
+		},
+		{
+			name:          "TestParseTraderOverrides_slippagePerMarket",
+			specification: "ETH-USD_1D_binance=slippage:range:0.1;BTC-USD_1D_binance=slippage:sqrt_impact:1",
+			expected: map[string]traderOverride{"ETH-USD_1D_binance": {slippageModel: "range:0.1"},
+				"BTC-USD_1D_binance": {slippageModel: "sqrt_impact:1"}},
+		},
+		{
+			name:          "TestParseTraderOverrides_negativeSlippage",
+			specification: "ETH-USD_1D_binance=slippage:fixed_bps:-5",
+			expectedError: true,
+		},
+		{
+			name:          "TestParseTraderOverrides_unsupportedSlippage",
+			specification: "ETH-USD_1D_binance=slippage:linear:1",
+			expectedError: true,
+		},
+		{
+			name:          "TestParseTraderOverrides_unsupportedField",
+			specification: "ETH-USD_1D_binance=leverage:2",
+			expectedError: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			overrides, err := parseTraderOverrides(testCase.specification)
+			if testCase.expectedError {
+				if err == nil {
+					t.Fatalf("expected an error, got overrides: %+v", overrides)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(testCase.expected, overrides, cmp.AllowUnexported(traderOverride{})); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
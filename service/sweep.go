@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/statistics"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/strategy"
+	"go.uber.org/zap"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SweepResult is the outcome of backtesting a combination of strategy parameters in a parameter sweep
+type SweepResult struct {
+	Rank       int // 1 is the best value of the objective
+	Parameters strategy.Parameters
+	Objective  float64
+	Results    statistics.Summary
+}
+
+// RunSweep backtests every combination of strategy parameters over the engine's backtest period in parallel on
+// MAX_WORKERS goroutines & ranks them by the objective, best first - combinations with equal values keep the order of
+// the grid. The engine must build a single trader, eg/ a SHARED portfolio.
+func RunSweep(ctx context.Context, cfg *config.Engine, grid []strategy.Parameters, objective string, log *zap.Logger) ([]SweepResult, error) {
+	if len(grid) == 0 {
+		return nil, errors.New("sweep requires at least one parameter combination")
+	}
+	if _, err := Objective(objective, statistics.Statistics{}); err != nil {
+		return nil, err
+	}
+
+	outcomes, err := backtestParameters(ctx, cfg, grid, time.Time{}, time.Time{}, log)
+	if err != nil {
+		return nil, err
+	}
+	return rankSweepResults(outcomes, objective), nil
+}
+
+// rankSweepResults ranks the outcomes of a parameter sweep by the objective, best first, keeping the order of outcomes
+// with equal values
+func rankSweepResults(outcomes []parameterOutcome, objective string) []SweepResult {
+	results := make([]SweepResult, 0, len(outcomes))
+	for _, outcome := range outcomes {
+		value, _ := Objective(objective, outcome.results.Portfolio)
+		results = append(results, SweepResult{Parameters: outcome.parameters, Objective: value, Results: outcome.results})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Objective > results[j].Objective })
+	for index := range results {
+		results[index].Rank = index + 1
+	}
+	return results
+}
+
+// WriteSweepCSV writes the ranked results of a parameter sweep as CSV, one combination per row with a column per
+// strategy parameter followed by the objective & portfolio statistics
+func WriteSweepCSV(w io.Writer, results []SweepResult, parameters []strategy.Parameter) error {
+	header := []string{"rank"}
+	for _, parameter := range parameters {
+		header = append(header, parameter.Name)
+	}
+	header = append(header, "objective", "total_return", "annualised_return", "annualised_volatility", "sharpe_ratio",
+		"sortino_ratio", "calmar_ratio", "max_drawdown", "exposure", "num_trades", "win_rate", "profit_factor")
+
+	records := [][]string{header}
+	for _, result := range results {
+		stats := result.Results.Portfolio
+		record := []string{strconv.Itoa(result.Rank)}
+		for _, parameter := range parameters {
+			record = append(record, formatFloat(result.Parameters[parameter.Name]))
+		}
+		record = append(record,
+			formatFloat(result.Objective),
+			formatFloat(stats.TotalReturn),
+			formatFloat(stats.AnnualisedReturn),
+			formatFloat(stats.AnnualisedVolatility),
+			formatFloat(stats.SharpeRatio),
+			formatFloat(stats.SortinoRatio),
+			formatFloat(stats.CalmarRatio),
+			formatFloat(stats.MaxDrawdown),
+			formatFloat(stats.Exposure),
+			strconv.Itoa(stats.Trades.NumTrades),
+			formatFloat(stats.Trades.WinRate),
+			formatFloat(stats.Trades.ProfitFactor),
+		)
+		records = append(records, record)
+	}
+
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.WriteAll(records); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to write %v sweep results", len(results)))
+	}
+	return nil
+}
+
+// formatFloat formats a float with the fewest digits that represent it exactly
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
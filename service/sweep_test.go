@@ -0,0 +1,102 @@
+package service
+
+import (
+	"bytes"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/statistics"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/strategy"
+	"strings"
+	"testing"
+)
+
+func TestWriteSweepCSV(t *testing.T) {
+	parameters, err := strategy.StrategyParameters(strategy.StrategyRSI)
+	if err != nil {
+		t.Fatalf("failed to get parameters: %s", err)
+	}
+	results := []SweepResult{
+		{
+			Rank:       1,
+			Parameters: strategy.Parameters{"period": 14, "entry": 30, "exit": 70.5},
+			Objective:  1.25,
+			Results: statistics.Summary{Portfolio: statistics.Statistics{TotalReturn: 0.1, SharpeRatio: 1.25,
+				Trades: statistics.TradeStatistics{NumTrades: 3}}},
+		},
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteSweepCSV(&buffer, results, parameters); err != nil {
+		t.Fatalf("failed to write sweep CSV: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a header & 1 row, got %v lines", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "rank,period,entry,exit,objective,total_return") {
+		t.Errorf("expected parameter columns in declaration order, got %s", lines[0])
+	}
+	if expected := "1,14,30,70.5,1.25,0.1,0,0,1.25,0,0,0,0,3,0,0"; lines[1] != expected {
+		t.Errorf("expected row %s, got %s", expected, lines[1])
+	}
+}
+
+func TestRankSweepResults(t *testing.T) {
+	outcome := func(period float64, sharpe float64, totalReturn float64, calmar float64) parameterOutcome {
+		return parameterOutcome{
+			parameters: strategy.Parameters{"period": period},
+			results: statistics.Summary{Portfolio: statistics.Statistics{SharpeRatio: sharpe, TotalReturn: totalReturn,
+				CalmarRatio: calmar}},
+		}
+	}
+	outcomes := []parameterOutcome{
+		outcome(1, 1, 0.3, 2),
+		outcome(2, 2, 0.1, 2),
+		outcome(3, 0.5, 0.3, 3),
+		outcome(4, 2, -0.1, -1),
+	}
+
+	testCases := []struct {
+		name              string
+		objective         string
+		expectedPeriods   []float64
+		expectedObjective []float64
+	}{
+		{
+			name:              "TestRankSweepResults_sharpeTieKeepsGridOrder",
+			objective:         ObjectiveSharpe,
+			expectedPeriods:   []float64{2, 4, 1, 3},
+			expectedObjective: []float64{2, 2, 1, 0.5},
+		},
+		{
+			name:              "TestRankSweepResults_returnTieKeepsGridOrder",
+			objective:         ObjectiveReturn,
+			expectedPeriods:   []float64{1, 3, 2, 4},
+			expectedObjective: []float64{0.3, 0.3, 0.1, -0.1},
+		},
+		{
+			name:              "TestRankSweepResults_returnDrawdownTieKeepsGridOrder",
+			objective:         ObjectiveReturnDrawdown,
+			expectedPeriods:   []float64{3, 1, 2, 4},
+			expectedObjective: []float64{3, 2, 2, -1},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			results := rankSweepResults(outcomes, testCase.objective)
+			if len(results) != len(outcomes) {
+				t.Fatalf("expected %v results, got %v", len(outcomes), len(results))
+			}
+			for index, result := range results {
+				if result.Rank != index+1 {
+					t.Errorf("expected rank %v at index %v, got %v", index+1, index, result.Rank)
+				}
+				if period := result.Parameters["period"]; period != testCase.expectedPeriods[index] {
+					t.Errorf("expected period %v at rank %v, got %v", testCase.expectedPeriods[index], result.Rank, period)
+				}
+				if result.Objective != testCase.expectedObjective[index] {
+					t.Errorf("expected objective %v at rank %v, got %v", testCase.expectedObjective[index], result.Rank,
+						result.Objective)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/eapache/queue"
+	"github.com/pkg/errors"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/statistics"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/strategy"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/trader"
+	"go.uber.org/zap"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	WalkForwardRolling  = "ROLLING"  // In-sample windows of a fixed length roll forward with the out-of-sample windows
+	WalkForwardAnchored = "ANCHORED" // In-sample windows start at the beginning of the data & grow
+
+	ObjectiveSharpe         = "sharpe"          // Annualised Sharpe ratio
+	ObjectiveReturn         = "return"          // Total return
+	ObjectiveReturnDrawdown = "return_drawdown" // Annualised return / max drawdown, the Calmar ratio
+)
+
+// WalkForwardConfig configures a walk-forward optimisation of the engine's strategy parameters
+type WalkForwardConfig struct {
+	Mode        string                // WalkForwardRolling or WalkForwardAnchored
+	InSample    time.Duration         // Length of the (first) in-sample window parameters are optimised on
+	OutOfSample time.Duration         // Length of the out-of-sample windows the optimised parameters are run on
+	Objective   string                // Statistic the optimised parameters maximise in-sample
+	Grid        []strategy.Parameters // Parameter combinations to optimise over
+}
+
+// WalkForwardWindow is an in-sample window, the out-of-sample window following it & the outcome of each
+type WalkForwardWindow struct {
+	InSampleStart     time.Time
+	InSampleEnd       time.Time // Exclusive, the start of the out-of-sample window
+	OutOfSampleStart  time.Time
+	OutOfSampleEnd    time.Time // Exclusive
+	Parameters        strategy.Parameters
+	InSampleObjective float64
+	InSample          statistics.Statistics
+	OutOfSample       statistics.Statistics
+	Efficiency        float64 // Out-of-sample / in-sample annualised return, zero if the in-sample return is not positive
+}
+
+// WalkForwardResult is the outcome of a walk-forward optimisation
+type WalkForwardResult struct {
+	Mode        string
+	Objective   string
+	Windows     []WalkForwardWindow
+	OutOfSample statistics.Statistics    // Statistics of the stitched out-of-sample equity curve
+	EquityCurve []statistics.EquityPoint // Out-of-sample equity curves stitched end to end
+	Efficiency  float64                  // Stitched out-of-sample / mean in-sample annualised return, zero if the in-sample mean is not positive
+}
+
+// parameterOutcome is the outcome of a backtest of a combination of strategy parameters
+type parameterOutcome struct {
+	parameters  strategy.Parameters
+	results     statistics.Summary
+	equityCurve []statistics.EquityPoint
+}
+
+// parameterBacktester backtests every combination of strategy parameters from start to end (exclusive), returning the
+// outcomes in the order of the grid
+type parameterBacktester func(grid []strategy.Parameters, start time.Time, end time.Time) ([]parameterOutcome, error)
+
+// RunWalkForward slices the engine's backtest period into in-sample & out-of-sample windows, optimises the strategy
+// parameters on each in-sample window, runs the chosen parameters on the following out-of-sample window & stitches the
+// out-of-sample equity curves together - the engine must build a single trader, eg/ a SHARED portfolio
+func RunWalkForward(ctx context.Context, cfg *config.Engine, wfCfg WalkForwardConfig, log *zap.Logger) (WalkForwardResult, error) {
+	if len(wfCfg.Grid) == 0 {
+		return WalkForwardResult{}, errors.New("walk-forward requires at least one parameter combination")
+	}
+	if _, err := Objective(wfCfg.Objective, statistics.Statistics{}); err != nil {
+		return WalkForwardResult{}, err
+	}
+
+	start, end, err := backtestSpan(cfg, log)
+	if err != nil {
+		return WalkForwardResult{}, err
+	}
+	windows, err := WalkForwardWindows(wfCfg.Mode, start, end, wfCfg.InSample, wfCfg.OutOfSample)
+	if err != nil {
+		return WalkForwardResult{}, err
+	}
+
+	backtest := func(grid []strategy.Parameters, start time.Time, end time.Time) ([]parameterOutcome, error) {
+		return backtestParameters(ctx, cfg, grid, start, end, log)
+	}
+	return walkForward(wfCfg, windows, backtest, log)
+}
+
+// walkForward optimises the strategy parameters on the in-sample window of every window with the backtester, runs the
+// chosen parameters on the out-of-sample window & stitches the out-of-sample equity curves together
+func walkForward(wfCfg WalkForwardConfig, windows []WalkForwardWindow, backtest parameterBacktester, log *zap.Logger) (WalkForwardResult, error) {
+	result := WalkForwardResult{Mode: wfCfg.Mode, Objective: wfCfg.Objective}
+	var outOfSampleCurves [][]statistics.EquityPoint
+	var inSampleReturns float64
+	for index, window := range windows {
+		// Optimise in-sample
+		outcomes, err := backtest(wfCfg.Grid, window.InSampleStart, window.InSampleEnd)
+		if err != nil {
+			return WalkForwardResult{}, errors.Wrap(err, fmt.Sprintf("failed to optimise in-sample window %v", index))
+		}
+		best := -1
+		for outcomeIndex, outcome := range outcomes {
+			value, _ := Objective(wfCfg.Objective, outcome.results.Portfolio)
+			if best < 0 || value > window.InSampleObjective {
+				best, window.InSampleObjective = outcomeIndex, value
+			}
+		}
+		window.Parameters = outcomes[best].parameters
+		window.InSample = outcomes[best].results.Portfolio
+
+		// Run the chosen parameters out-of-sample
+		outcomes, err = backtest([]strategy.Parameters{window.Parameters}, window.OutOfSampleStart, window.OutOfSampleEnd)
+		if err != nil {
+			return WalkForwardResult{}, errors.Wrap(err, fmt.Sprintf("failed to run out-of-sample window %v", index))
+		}
+		window.OutOfSample = outcomes[0].results.Portfolio
+		if window.InSample.AnnualisedReturn > 0 {
+			window.Efficiency = window.OutOfSample.AnnualisedReturn / window.InSample.AnnualisedReturn
+		}
+		outOfSampleCurves = append(outOfSampleCurves, outcomes[0].equityCurve)
+		inSampleReturns += window.InSample.AnnualisedReturn
+
+		log.Info(fmt.Sprintf("walk-forward window %v/%v: in-sample %s to %s chose %s (%s %.4f), out-of-sample %s to %s returned %.4f",
+			index+1, len(windows), window.InSampleStart.Format(time.RFC3339), window.InSampleEnd.Format(time.RFC3339),
+			window.Parameters, wfCfg.Objective, window.InSampleObjective, window.OutOfSampleStart.Format(time.RFC3339),
+			window.OutOfSampleEnd.Format(time.RFC3339), window.OutOfSample.TotalReturn))
+		result.Windows = append(result.Windows, window)
+	}
+
+	result.EquityCurve = StitchEquityCurves(outOfSampleCurves)
+	result.OutOfSample = statistics.CalculateEquityStatistics(result.EquityCurve)
+	if meanInSampleReturn := inSampleReturns / float64(len(windows)); meanInSampleReturn > 0 {
+		result.Efficiency = result.OutOfSample.AnnualisedReturn / meanInSampleReturn
+	}
+	return result, nil
+}
+
+// WalkForwardWindows slices the period from start to end (exclusive) into consecutive out-of-sample windows of length
+// outOfSample, each preceded by an in-sample window - of length inSample for ROLLING windows, or from the start for
+// ANCHORED windows. The last out-of-sample window is cut short at the end.
+func WalkForwardWindows(mode string, start time.Time, end time.Time, inSample time.Duration, outOfSample time.Duration) ([]WalkForwardWindow, error) {
+	if mode != WalkForwardRolling && mode != WalkForwardAnchored {
+		return nil, errors.New(fmt.Sprintf("unsupported walk-forward mode %s", mode))
+	}
+	if inSample <= 0 || outOfSample <= 0 {
+		return nil, errors.New(fmt.Sprintf("in-sample %s & out-of-sample %s windows must be positive", inSample, outOfSample))
+	}
+
+	var windows []WalkForwardWindow
+	for outOfSampleStart := start.Add(inSample); outOfSampleStart.Before(end); outOfSampleStart = outOfSampleStart.Add(outOfSample) {
+		window := WalkForwardWindow{
+			InSampleStart:    outOfSampleStart.Add(-inSample),
+			InSampleEnd:      outOfSampleStart,
+			OutOfSampleStart: outOfSampleStart,
+			OutOfSampleEnd:   outOfSampleStart.Add(outOfSample),
+		}
+		if mode == WalkForwardAnchored {
+			window.InSampleStart = start
+		}
+		if window.OutOfSampleEnd.After(end) {
+			window.OutOfSampleEnd = end
+		}
+		windows = append(windows, window)
+	}
+	if len(windows) == 0 {
+		return nil, errors.New(fmt.Sprintf("period %s to %s is too short for an in-sample window of %s", start.Format(time.RFC3339),
+			end.Format(time.RFC3339), inSample))
+	}
+	return windows, nil
+}
+
+// StitchEquityCurves joins equity curves end to end, scaling each curve to start at the value the previous one ended
+// at - each curve compounds on the last as if the portfolio were carried over
+func StitchEquityCurves(curves [][]statistics.EquityPoint) []statistics.EquityPoint {
+	var stitched []statistics.EquityPoint
+	for _, curve := range curves {
+		if len(curve) == 0 {
+			continue
+		}
+		scale := 1.0
+		if len(stitched) > 0 && curve[0].Value != 0 {
+			scale = stitched[len(stitched)-1].Value / curve[0].Value
+		}
+		for _, point := range curve {
+			stitched = append(stitched, statistics.EquityPoint{
+				Timestamp: point.Timestamp,
+				Value:     point.Value * scale,
+				Exposure:  point.Exposure * scale,
+			})
+		}
+	}
+	return stitched
+}
+
+// Objective returns the value of the named objective for the statistics of a backtest, higher being better
+func Objective(objective string, stats statistics.Statistics) (float64, error) {
+	switch objective {
+	case ObjectiveSharpe:
+		return stats.SharpeRatio, nil
+	case ObjectiveReturn:
+		return stats.TotalReturn, nil
+	case ObjectiveReturnDrawdown:
+		return stats.CalmarRatio, nil
+	}
+	return 0, errors.New(fmt.Sprintf("unsupported objective %s", objective))
+}
+
+// backtestParameters backtests every combination of strategy parameters from start to end (exclusive), a zero start or
+// end keeping BACKTEST_START or BACKTEST_END, in parallel on MAX_WORKERS goroutines, returning the outcomes in the order
+// of the grid. The backtests log at error level only, so data quality & warm-up warnings are not repeated for every
+// combination.
+func backtestParameters(ctx context.Context, cfg *config.Engine, grid []strategy.Parameters, start time.Time,
+	end time.Time, log *zap.Logger) ([]parameterOutcome, error) {
+	workers := cfg.MaxWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	quietLog := log.WithOptions(zap.IncreaseLevel(zap.ErrorLevel))
+
+	outcomes := make([]parameterOutcome, len(grid))
+	errs := make([]error, len(grid))
+	indexQ := make(chan int)
+	var waitGroup sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for index := range indexQ {
+				outcomes[index], errs[index] = backtestParameter(ctx, *cfg, grid[index], start, end, quietLog)
+			}
+		}()
+	}
+	for index := range grid {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case indexQ <- index:
+		case <-ctx.Done():
+		}
+	}
+	close(indexQ)
+	waitGroup.Wait()
+
+	if ctx.Err() != nil {
+		return nil, errors.Wrap(ctx.Err(), "backtests cancelled")
+	}
+	for index, err := range errs {
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to backtest parameters %s", grid[index]))
+		}
+	}
+	return outcomes, nil
+}
+
+// backtestParameter backtests a combination of strategy parameters from start to end (exclusive), a zero start or end
+// keeping BACKTEST_START or BACKTEST_END
+func backtestParameter(ctx context.Context, cfg config.Engine, params strategy.Parameters, start time.Time,
+	end time.Time, log *zap.Logger) (parameterOutcome, error) {
+	cfg.StrategyParams = params.String()
+	if !start.IsZero() {
+		cfg.BacktestStart = start.Format(time.RFC3339)
+	}
+	if !end.IsZero() {
+		cfg.BacktestEnd = end.Format(time.RFC3339)
+	}
+
+	traders, err := buildTraders(&cfg, trader.ModeBacktest, log)
+	if err != nil {
+		return parameterOutcome{}, err
+	}
+	if len(traders) != 1 {
+		return parameterOutcome{}, errors.New(fmt.Sprintf("optimising parameters requires a single trader, got %v - use PORTFOLIO_MODE %s",
+			len(traders), PortfolioModeShared))
+	}
+	if err := traders[0].Run(ctx); err != nil {
+		return parameterOutcome{}, err
+	}
+	return parameterOutcome{
+		parameters:  params,
+		results:     traders[0].Results(),
+		equityCurve: traders[0].EquityCurve(),
+	}, nil
+}
+
+// backtestSpan returns the period the engine backtests, from the first traded bar to the close of the last bar common to
+// every market, bounded by BACKTEST_START & BACKTEST_END
+func backtestSpan(cfg *config.Engine, log *zap.Logger) (time.Time, time.Time, error) {
+	traderConfigs, err := buildTraderConfigs(cfg, trader.ModeBacktest, log)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	var start, end time.Time
+	for _, traderConfig := range traderConfigs {
+		handler, err := data.NewBacktestHandler(traderConfig, queue.New())
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.Wrap(err, fmt.Sprintf("failed to load data of %s", traderConfig.Symbol))
+		}
+		timeframe, err := data.ParseTimeframe(traderConfig.Timeframe)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+
+		first := handler.NextTimestamp()
+		if warmUpper, isWarmUpper := handler.(data.WarmUpper); isWarmUpper && !warmUpper.TradingStart().IsZero() {
+			first = warmUpper.TradingStart()
+		}
+		var last time.Time
+		for handler.ShouldContinue() {
+			last = handler.NextTimestamp()
+			handler.UpdateData()
+		}
+
+		if start.IsZero() || first.After(start) {
+			start = first
+		}
+		if marketEnd := last.Add(timeframe); end.IsZero() || marketEnd.Before(end) {
+			end = marketEnd
+		}
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, errors.New("the markets share no backtest period")
+	}
+	return start, end, nil
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/statistics"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/strategy"
+	"go.uber.org/zap"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWalkForwardWindows(t *testing.T) {
+	day := func(offset int) time.Time {
+		return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, offset)
+	}
+
+	testCases := []struct {
+		name            string
+		mode            string
+		end             time.Time
+		expectedError   bool
+		expectedWindows [][4]time.Time // [in-sample start, in-sample end, out-of-sample start, out-of-sample end]
+	}{
+		{
+			name: "TestWalkForwardWindows_rolling",
+			mode: WalkForwardRolling,
+			end:  day(25),
+			expectedWindows: [][4]time.Time{
+				{day(0), day(10), day(10), day(15)},
+				{day(5), day(15), day(15), day(20)},
+				{day(10), day(20), day(20), day(25)},
+			},
+		},
+		{
+			name: "TestWalkForwardWindows_anchoredTruncated",
+			mode: WalkForwardAnchored,
+			end:  day(22),
+			expectedWindows: [][4]time.Time{
+				{day(0), day(10), day(10), day(15)},
+				{day(0), day(15), day(15), day(20)},
+				{day(0), day(20), day(20), day(22)},
+			},
+		},
+		{
+			name:          "TestWalkForwardWindows_tooShort",
+			mode:          WalkForwardRolling,
+			end:           day(10),
+			expectedError: true,
+		},
+		{
+			name:          "TestWalkForwardWindows_unsupportedMode",
+			mode:          "EXPANDING",
+			end:           day(25),
+			expectedError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			windows, err := WalkForwardWindows(testCase.mode, day(0), testCase.end, 10*24*time.Hour, 5*24*time.Hour)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if len(windows) != len(testCase.expectedWindows) {
+				t.Fatalf("expected %v windows, got %v", len(testCase.expectedWindows), len(windows))
+			}
+			for index, expected := range testCase.expectedWindows {
+				actual := [4]time.Time{windows[index].InSampleStart, windows[index].InSampleEnd,
+					windows[index].OutOfSampleStart, windows[index].OutOfSampleEnd}
+				if actual != expected {
+					t.Errorf("expected window %v to be %v, got %v", index, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestStitchEquityCurves(t *testing.T) {
+	day := func(offset int) time.Time {
+		return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, offset)
+	}
+	curves := [][]statistics.EquityPoint{
+		{{Timestamp: day(0), Value: 100}, {Timestamp: day(1), Value: 110}},
+		{},
+		{{Timestamp: day(2), Value: 100, Exposure: 50}, {Timestamp: day(3), Value: 90}},
+	}
+
+	stitched := StitchEquityCurves(curves)
+	expectedValues := []float64{100, 110, 110, 99}
+	if len(stitched) != len(expectedValues) {
+		t.Fatalf("expected %v points, got %v", len(expectedValues), len(stitched))
+	}
+	for index, expected := range expectedValues {
+		if diff := stitched[index].Value - expected; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("expected value %v at point %v, got %v", expected, index, stitched[index].Value)
+		}
+	}
+	if diff := stitched[2].Exposure - 55; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("expected exposure to scale to 55, got %v", stitched[2].Exposure)
+	}
+}
+
+// fakeBacktester returns fixed in-sample statistics per combination & window, and a fixed out-of-sample equity curve
+// per window, recording every backtest it is asked to run
+type fakeBacktester struct {
+	inSample    map[time.Time][]statistics.Statistics  // map[InSampleStart]Statistics of each grid combination
+	outOfSample map[time.Time][]statistics.EquityPoint // map[OutOfSampleStart]EquityCurve
+	calls       []string
+}
+
+func (f *fakeBacktester) backtest(grid []strategy.Parameters, start time.Time, end time.Time) ([]parameterOutcome, error) {
+	f.calls = append(f.calls, fmt.Sprintf("%s %s..%s", grid, start.Format("01-02"), end.Format("01-02")))
+	if curve, isOutOfSample := f.outOfSample[start]; isOutOfSample && len(grid) == 1 {
+		return []parameterOutcome{{
+			parameters:  grid[0],
+			results:     statistics.Summary{Portfolio: statistics.CalculateEquityStatistics(curve)},
+			equityCurve: curve,
+		}}, nil
+	}
+	var outcomes []parameterOutcome
+	for index, params := range grid {
+		outcomes = append(outcomes, parameterOutcome{parameters: params,
+			results: statistics.Summary{Portfolio: f.inSample[start][index]}})
+	}
+	return outcomes, nil
+}
+
+func TestWalkForward(t *testing.T) {
+	day := func(offset int) time.Time {
+		return time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, offset)
+	}
+	windows, err := WalkForwardWindows(WalkForwardRolling, day(0), day(20), 10*24*time.Hour, 5*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid := []strategy.Parameters{{"period": 7}, {"period": 14}}
+	outOfSample := map[time.Time][]statistics.EquityPoint{
+		day(10): {{Timestamp: day(10), Value: 100}, {Timestamp: day(14), Value: 110}},
+		day(15): {{Timestamp: day(15), Value: 1000}, {Timestamp: day(19), Value: 990}},
+	}
+	// Stitched out-of-sample curve: 100, 110, 110, 108.9 over 9 days
+	stitchedReturn := math.Pow(1.089, 365.0/9) - 1
+
+	testCases := []struct {
+		name               string
+		inSample           map[time.Time][]statistics.Statistics
+		expectedParameters []strategy.Parameters
+		expectedEfficiency []float64 // Of each window
+		expectedOverall    float64
+	}{
+		{
+			name: "TestWalkForward_efficiency",
+			inSample: map[time.Time][]statistics.Statistics{
+				day(0): {{SharpeRatio: 1, AnnualisedReturn: 3}, {SharpeRatio: 2, AnnualisedReturn: 2}},
+				day(5): {{SharpeRatio: 1.5, AnnualisedReturn: 4}, {SharpeRatio: 0.5, AnnualisedReturn: 8}},
+			},
+			expectedParameters: []strategy.Parameters{grid[1], grid[0]},
+			expectedEfficiency: []float64{
+				(math.Pow(1.1, 365.0/4) - 1) / 2,  // Out-of-sample +10% over 4 days, in-sample 2
+				(math.Pow(0.99, 365.0/4) - 1) / 4, // Out-of-sample -1% over 4 days, in-sample 4
+			},
+			expectedOverall: stitchedReturn / 3, // Mean in-sample annualised return of 2 & 4
+		},
+		{
+			name: "TestWalkForward_losingInSample",
+			inSample: map[time.Time][]statistics.Statistics{
+				day(0): {{SharpeRatio: -1, AnnualisedReturn: -0.5}, {SharpeRatio: -1, AnnualisedReturn: -0.2}},
+				day(5): {{SharpeRatio: -2, AnnualisedReturn: -0.1}, {SharpeRatio: -0.5, AnnualisedReturn: 0.1}},
+			},
+			// The first of tied combinations is kept
+			expectedParameters: []strategy.Parameters{grid[0], grid[1]},
+			expectedEfficiency: []float64{0, (math.Pow(0.99, 365.0/4) - 1) / 0.1},
+			expectedOverall:    0, // Mean in-sample annualised return is not positive
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			backtester := &fakeBacktester{inSample: testCase.inSample, outOfSample: outOfSample}
+			wfCfg := WalkForwardConfig{Mode: WalkForwardRolling, Objective: ObjectiveSharpe, Grid: grid}
+
+			result, err := walkForward(wfCfg, windows, backtester.backtest, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every window optimises the whole grid in-sample, then runs the chosen combination out-of-sample
+			expectedCalls := []string{
+				"[period:7 period:14] 01-01..01-11",
+				fmt.Sprintf("[%s] 01-11..01-16", testCase.expectedParameters[0]),
+				"[period:7 period:14] 01-06..01-16",
+				fmt.Sprintf("[%s] 01-16..01-21", testCase.expectedParameters[1]),
+			}
+			if diff := cmp.Diff(expectedCalls, backtester.calls); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+			if len(result.Windows) != 2 {
+				t.Fatalf("expected 2 windows, got %v", len(result.Windows))
+			}
+			for index, window := range result.Windows {
+				if diff := cmp.Diff(testCase.expectedParameters[index], window.Parameters); diff != "" {
+					t.Errorf("window %v parameters (-want +got):\n%s", index, diff)
+				}
+				if window.InSample != testCase.inSample[window.InSampleStart][indexOf(grid, window.Parameters)] {
+					t.Errorf("expected window %v in-sample statistics of the chosen combination, got %+v", index, window.InSample)
+				}
+				if math.Abs(window.Efficiency-testCase.expectedEfficiency[index]) > 1e-9 {
+					t.Errorf("expected window %v efficiency %v, got %v", index, testCase.expectedEfficiency[index],
+						window.Efficiency)
+				}
+			}
+			if math.Abs(result.OutOfSample.AnnualisedReturn-stitchedReturn) > 1e-9 {
+				t.Errorf("expected stitched out-of-sample return %v, got %v", stitchedReturn,
+					result.OutOfSample.AnnualisedReturn)
+			}
+			if math.Abs(result.Efficiency-testCase.expectedOverall) > 1e-9 {
+				t.Errorf("expected efficiency %v, got %v", testCase.expectedOverall, result.Efficiency)
+			}
+		})
+	}
+}
+
+// indexOf returns the index of the parameters in the grid
+func indexOf(grid []strategy.Parameters, params strategy.Parameters) int {
+	for index, combination := range grid {
+		if cmp.Equal(combination, params) {
+			return index
+		}
+	}
+	return -1
+}
@@ -0,0 +1,277 @@
+package statistics
+
+import (
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// yearDuration is the length of a trading year - crypto markets trade every day of the year
+	yearDuration = 365 * 24 * time.Hour
+)
+
+// EquityPoint represents the total value of a portfolio at the close of a bar
+type EquityPoint struct {
+	Timestamp time.Time
+	Value     float64 // Cash + market value of open positions
+	Exposure  float64 // Absolute market value of open positions
+}
+
+// Summary is the complete set of performance statistics for a backtest run
+type Summary struct {
+	Portfolio Statistics            // Statistics for the whole portfolio
+	Symbols   map[string]Statistics // map[Symbol]Statistics of the Symbol's share of the portfolio
+}
+
+// Statistics are the equity curve & trade statistics of a portfolio
+type Statistics struct {
+	StartTimestamp       time.Time
+	EndTimestamp         time.Time
+	StartingValue        float64
+	EndingValue          float64
+	TotalReturn          float64       // (EndingValue / StartingValue) - 1
+	AnnualisedReturn     float64       // Compound annual growth rate
+	AnnualisedVolatility float64       // Standard deviation of bar returns, annualised
+	SharpeRatio          float64       // Annualised mean bar return / standard deviation of bar returns
+	SortinoRatio         float64       // Annualised mean bar return / downside deviation of bar returns
+	CalmarRatio          float64       // AnnualisedReturn / MaxDrawdown
+	MaxDrawdown          float64       // Largest peak to trough decline as a fraction of the peak
+	MaxDrawdownDuration  time.Duration // Longest time from an equity peak until it is regained, or the end if never regained
+	Exposure             float64       // Fraction of bars with an open position
+	Trades               TradeStatistics
+}
+
+// TradeStatistics are the statistics of a set of closed Positions
+type TradeStatistics struct {
+	NumTrades       int
+	NumWins         int
+	NumLosses       int
+	WinRate         float64       // NumWins / NumTrades
+	GrossProfit     float64       // Sum of winning ResultProfitLoss
+	GrossLoss       float64       // Sum of losing ResultProfitLoss (+ve)
+	ProfitFactor    float64       // GrossProfit / GrossLoss, zero if there are no losing trades
+	TotalProfitLoss float64       // Sum of ResultProfitLoss
+	Expectancy      float64       // Average ResultProfitLoss per trade
+	AvgHoldTime     time.Duration // Average time between Position enter & exit
+	Exposure        float64       // Total hold time as a fraction of the backtest duration
+}
+
+// Calculate computes a Summary from the portfolio's closed Positions, its per-bar equity curve & the per-bar equity
+// curve of each Symbol's share of the portfolio
+func Calculate(historicPositions map[string][]model.Position, equityCurve []EquityPoint,
+	symbolEquityCurves map[string][]EquityPoint) Summary {
+	summary := Summary{
+		Symbols: make(map[string]Statistics),
+	}
+
+	var duration time.Duration
+	if len(equityCurve) > 1 {
+		duration = equityCurve[len(equityCurve)-1].Timestamp.Sub(equityCurve[0].Timestamp)
+	}
+
+	// Per Symbol statistics
+	for symbol, symbolEquityCurve := range symbolEquityCurves {
+		summary.Symbols[symbol] = CalculateEquityStatistics(symbolEquityCurve)
+	}
+	var allPositions []model.Position
+	for symbol, positions := range historicPositions {
+		symbolStats := summary.Symbols[symbol]
+		symbolStats.Trades = CalculateTradeStatistics(positions, duration)
+		summary.Symbols[symbol] = symbolStats
+		allPositions = append(allPositions, positions...)
+	}
+
+	// Portfolio statistics
+	summary.Portfolio = CalculateEquityStatistics(equityCurve)
+	summary.Portfolio.Trades = CalculateTradeStatistics(allPositions, duration)
+
+	return summary
+}
+
+// CalculateEquityStatistics computes the return & risk statistics of an equity curve
+func CalculateEquityStatistics(equityCurve []EquityPoint) Statistics {
+	var stats Statistics
+	if len(equityCurve) == 0 {
+		return stats
+	}
+
+	first, last := equityCurve[0], equityCurve[len(equityCurve)-1]
+	stats.StartTimestamp = first.Timestamp
+	stats.EndTimestamp = last.Timestamp
+	stats.StartingValue = first.Value
+	stats.EndingValue = last.Value
+	if first.Value != 0 {
+		stats.TotalReturn = last.Value/first.Value - 1
+	}
+
+	periodsPerYear := estimatePeriodsPerYear(equityCurve)
+	returns := calculateReturns(equityCurve)
+
+	// Annualised return
+	years := last.Timestamp.Sub(first.Timestamp).Hours() / yearDuration.Hours()
+	if years > 0 && first.Value > 0 && last.Value > 0 {
+		stats.AnnualisedReturn = math.Pow(last.Value/first.Value, 1/years) - 1
+	}
+
+	// Risk adjusted returns
+	meanReturn := mean(returns)
+	volatility := standardDeviation(returns)
+	downsideDeviation := downsideDeviation(returns)
+	stats.AnnualisedVolatility = volatility * math.Sqrt(periodsPerYear)
+	if volatility > 0 {
+		stats.SharpeRatio = meanReturn / volatility * math.Sqrt(periodsPerYear)
+	}
+	if downsideDeviation > 0 {
+		stats.SortinoRatio = meanReturn / downsideDeviation * math.Sqrt(periodsPerYear)
+	}
+
+	// Drawdown
+	stats.MaxDrawdown, stats.MaxDrawdownDuration = calculateMaxDrawdown(equityCurve)
+	if stats.MaxDrawdown > 0 {
+		stats.CalmarRatio = stats.AnnualisedReturn / stats.MaxDrawdown
+	}
+
+	// Exposure
+	var exposedBars int
+	for _, point := range equityCurve {
+		if point.Exposure != 0 {
+			exposedBars++
+		}
+	}
+	stats.Exposure = float64(exposedBars) / float64(len(equityCurve))
+
+	return stats
+}
+
+// CalculateTradeStatistics computes the trade statistics of a set of closed Positions over the backtest duration
+func CalculateTradeStatistics(positions []model.Position, duration time.Duration) TradeStatistics {
+	var stats TradeStatistics
+	if len(positions) == 0 {
+		return stats
+	}
+
+	var totalHoldTime time.Duration
+	for _, position := range positions {
+		stats.NumTrades++
+		stats.TotalProfitLoss += position.ResultProfitLoss
+		if position.ResultProfitLoss > 0 {
+			stats.NumWins++
+			stats.GrossProfit += position.ResultProfitLoss
+		} else if position.ResultProfitLoss < 0 {
+			stats.NumLosses++
+			stats.GrossLoss -= position.ResultProfitLoss
+		}
+		totalHoldTime += position.ExitTimestamp.Sub(position.EnterTimestamp)
+	}
+
+	stats.WinRate = float64(stats.NumWins) / float64(stats.NumTrades)
+	stats.Expectancy = stats.TotalProfitLoss / float64(stats.NumTrades)
+	stats.AvgHoldTime = totalHoldTime / time.Duration(stats.NumTrades)
+	if stats.GrossLoss > 0 {
+		stats.ProfitFactor = stats.GrossProfit / stats.GrossLoss
+	}
+	if duration > 0 {
+		stats.Exposure = math.Min(float64(totalHoldTime)/float64(duration), 1)
+	}
+
+	return stats
+}
+
+// calculateReturns returns the simple return of each bar in the equity curve
+func calculateReturns(equityCurve []EquityPoint) []float64 {
+	var returns []float64
+	for i := 1; i < len(equityCurve); i++ {
+		if equityCurve[i-1].Value == 0 {
+			continue
+		}
+		returns = append(returns, equityCurve[i].Value/equityCurve[i-1].Value-1)
+	}
+	return returns
+}
+
+// calculateMaxDrawdown returns the largest peak to trough decline & the longest drawdown duration. A drawdown lasts
+// from its peak until the first point that regains the peak, or until the last point if the peak is never regained.
+func calculateMaxDrawdown(equityCurve []EquityPoint) (float64, time.Duration) {
+	var maxDrawdown float64
+	var maxDuration time.Duration
+
+	peak := equityCurve[0]
+	isUnderwater := false
+	for _, point := range equityCurve {
+		if point.Value >= peak.Value {
+			if isUnderwater {
+				if duration := point.Timestamp.Sub(peak.Timestamp); duration > maxDuration {
+					maxDuration = duration
+				}
+			}
+			peak, isUnderwater = point, false
+			continue
+		}
+		isUnderwater = true
+		if peak.Value > 0 {
+			maxDrawdown = math.Max(maxDrawdown, (peak.Value-point.Value)/peak.Value)
+		}
+	}
+	if isUnderwater {
+		if duration := equityCurve[len(equityCurve)-1].Timestamp.Sub(peak.Timestamp); duration > maxDuration {
+			maxDuration = duration
+		}
+	}
+	return maxDrawdown, maxDuration
+}
+
+// estimatePeriodsPerYear uses the median interval between equity points to determine the number of bars in a year
+func estimatePeriodsPerYear(equityCurve []EquityPoint) float64 {
+	var intervals []float64
+	for i := 1; i < len(equityCurve); i++ {
+		if interval := equityCurve[i].Timestamp.Sub(equityCurve[i-1].Timestamp); interval > 0 {
+			intervals = append(intervals, float64(interval))
+		}
+	}
+	if len(intervals) == 0 {
+		return 0
+	}
+	sort.Float64s(intervals)
+	return float64(yearDuration) / intervals[len(intervals)/2]
+}
+
+// mean returns the arithmetic mean of the values
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
+
+// standardDeviation returns the sample standard deviation of the values
+func standardDeviation(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	valuesMean := mean(values)
+	var sumSquares float64
+	for _, value := range values {
+		sumSquares += (value - valuesMean) * (value - valuesMean)
+	}
+	return math.Sqrt(sumSquares / float64(len(values)-1))
+}
+
+// downsideDeviation returns the root mean square of the negative values
+func downsideDeviation(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sumSquares float64
+	for _, value := range values {
+		if value < 0 {
+			sumSquares += value * value
+		}
+	}
+	return math.Sqrt(sumSquares / float64(len(values)))
+}
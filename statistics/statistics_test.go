@@ -0,0 +1,299 @@
+package statistics
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCalculateTradeStatistics(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	testCases := []struct {
+		name      string
+		positions []model.Position
+		duration  time.Duration
+		expected  TradeStatistics
+	}{
+		{
+			name:      "TestCalculateTradeStatistics_noPositions",
+			positions: []model.Position{},
+			duration:  10 * day,
+			expected:  TradeStatistics{},
+		},
+		{
+			name: "TestCalculateTradeStatistics_winsAndLosses",
+			positions: []model.Position{
+				{EnterTimestamp: testTimestamp, ExitTimestamp: testTimestamp.Add(day), ResultProfitLoss: 300},
+				{EnterTimestamp: testTimestamp.Add(2 * day), ExitTimestamp: testTimestamp.Add(5 * day), ResultProfitLoss: -100},
+				{EnterTimestamp: testTimestamp.Add(6 * day), ExitTimestamp: testTimestamp.Add(8 * day), ResultProfitLoss: 100},
+			},
+			duration: 10 * day,
+			expected: TradeStatistics{
+				NumTrades:       3,
+				NumWins:         2,
+				NumLosses:       1,
+				WinRate:         2.0 / 3.0,
+				GrossProfit:     400,
+				GrossLoss:       100,
+				ProfitFactor:    4,
+				TotalProfitLoss: 300,
+				Expectancy:      100,
+				AvgHoldTime:     2 * day,
+				Exposure:        0.6,
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := CalculateTradeStatistics(testCase.positions, testCase.duration)
+
+			if diff := cmp.Diff(testCase.expected, actual); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCalculateMaxDrawdown(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	testCases := []struct {
+		name             string
+		equityCurve      []EquityPoint
+		expectedDrawdown float64
+		expectedDuration time.Duration
+	}{
+		{
+			name: "TestCalculateMaxDrawdown_alwaysRising",
+			equityCurve: []EquityPoint{
+				{Timestamp: testTimestamp, Value: 100},
+				{Timestamp: testTimestamp.Add(day), Value: 110},
+				{Timestamp: testTimestamp.Add(2 * day), Value: 120},
+			},
+			expectedDrawdown: 0,
+			expectedDuration: 0,
+		},
+		{
+			name: "TestCalculateMaxDrawdown_recovered",
+			equityCurve: []EquityPoint{
+				{Timestamp: testTimestamp, Value: 100},
+				{Timestamp: testTimestamp.Add(day), Value: 200},
+				{Timestamp: testTimestamp.Add(2 * day), Value: 150},
+				{Timestamp: testTimestamp.Add(3 * day), Value: 100},
+				{Timestamp: testTimestamp.Add(4 * day), Value: 210},
+				{Timestamp: testTimestamp.Add(5 * day), Value: 200},
+			},
+			expectedDrawdown: 0.5,
+			expectedDuration: 3 * day, // Peak of 200 on day 1 regained on day 4
+		},
+		{
+			name: "TestCalculateMaxDrawdown_recoveredAtPeak",
+			equityCurve: []EquityPoint{
+				{Timestamp: testTimestamp, Value: 100},
+				{Timestamp: testTimestamp.Add(day), Value: 90},
+				{Timestamp: testTimestamp.Add(2 * day), Value: 100},
+				{Timestamp: testTimestamp.Add(3 * day), Value: 120},
+			},
+			expectedDrawdown: 0.1,
+			expectedDuration: 2 * day, // Regaining exactly the peak ends the drawdown
+		},
+		{
+			name: "TestCalculateMaxDrawdown_neverRecovered",
+			equityCurve: []EquityPoint{
+				{Timestamp: testTimestamp, Value: 100},
+				{Timestamp: testTimestamp.Add(day), Value: 95},
+				{Timestamp: testTimestamp.Add(2 * day), Value: 100},
+				{Timestamp: testTimestamp.Add(3 * day), Value: 80},
+				{Timestamp: testTimestamp.Add(4 * day), Value: 90},
+				{Timestamp: testTimestamp.Add(7 * day), Value: 99},
+			},
+			expectedDrawdown: 0.2,
+			expectedDuration: 5 * day, // Peak of 100 on day 2 still underwater at the last point on day 7
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			drawdown, duration := calculateMaxDrawdown(testCase.equityCurve)
+
+			if drawdown != testCase.expectedDrawdown {
+				t.Fatalf("expected drawdown %v, got %v", testCase.expectedDrawdown, drawdown)
+			}
+			if duration != testCase.expectedDuration {
+				t.Fatalf("expected duration %v, got %v", testCase.expectedDuration, duration)
+			}
+		})
+	}
+}
+
+func TestCalculateEquityStatistics(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	thirdOfYear := yearDuration / 3
+
+	testCases := []struct {
+		name        string
+		equityCurve []EquityPoint
+		expected    Statistics
+	}{
+		{
+			name:        "TestCalculateEquityStatistics_empty",
+			equityCurve: []EquityPoint{},
+			expected:    Statistics{},
+		},
+		{
+			// Returns of +10%, -10% & +10% over three bars a year: mean 1/30, sample deviation 0.11547 & downside
+			// deviation sqrt(0.01 / 3), each annualised by sqrt(3)
+			name: "TestCalculateEquityStatistics_threeBarsPerYear",
+			equityCurve: []EquityPoint{
+				{Timestamp: testTimestamp, Value: 100},
+				{Timestamp: testTimestamp.Add(thirdOfYear), Value: 110, Exposure: 110},
+				{Timestamp: testTimestamp.Add(2 * thirdOfYear), Value: 99, Exposure: 99},
+				{Timestamp: testTimestamp.Add(3 * thirdOfYear), Value: 108.9},
+			},
+			expected: Statistics{
+				StartTimestamp:       testTimestamp,
+				EndTimestamp:         testTimestamp.Add(yearDuration),
+				StartingValue:        100,
+				EndingValue:          108.9,
+				TotalReturn:          0.089,
+				AnnualisedReturn:     0.089, // Exactly one year
+				AnnualisedVolatility: 0.2,   // 0.11547 * sqrt(3)
+				SharpeRatio:          0.5,   // (1/30) / 0.11547 * sqrt(3)
+				SortinoRatio:         1,     // (1/30) / 0.057735 * sqrt(3)
+				CalmarRatio:          0.89,  // 0.089 / 0.1
+				MaxDrawdown:          0.1,   // 110 -> 99
+				MaxDrawdownDuration:  2 * thirdOfYear,
+				Exposure:             0.5,
+			},
+		},
+		{
+			// Returns of +1%, -0.990099% & +2% over daily bars, annualised by sqrt(365)
+			name: "TestCalculateEquityStatistics_daily",
+			equityCurve: []EquityPoint{
+				{Timestamp: testTimestamp, Value: 100, Exposure: 100},
+				{Timestamp: testTimestamp.Add(day), Value: 101, Exposure: 101},
+				{Timestamp: testTimestamp.Add(2 * day), Value: 100, Exposure: 100},
+				{Timestamp: testTimestamp.Add(3 * day), Value: 102, Exposure: 102},
+			},
+			expected: Statistics{
+				StartTimestamp:       testTimestamp,
+				EndTimestamp:         testTimestamp.Add(3 * day),
+				StartingValue:        100,
+				EndingValue:          102,
+				TotalReturn:          0.02,
+				AnnualisedReturn:     10.126388779444367,  // 1.02^(365 / 3) - 1
+				AnnualisedVolatility: 0.2908015631477425,  // 0.015221 * sqrt(365)
+				SharpeRatio:          8.409100389571893,   // 0.0067 / 0.015221 * sqrt(365)
+				SortinoRatio:         22.391430652521215,  // 0.0067 / sqrt(0.0099^2 / 3) * sqrt(365)
+				CalmarRatio:          1022.765266723881,   // 10.1264 / 0.0099
+				MaxDrawdown:          0.00990099009900991, // 101 -> 100
+				MaxDrawdownDuration:  2 * day,
+				Exposure:             1,
+			},
+		},
+		{
+			name: "TestCalculateEquityStatistics_flat",
+			equityCurve: []EquityPoint{
+				{Timestamp: testTimestamp, Value: 100},
+				{Timestamp: testTimestamp.Add(day), Value: 100},
+				{Timestamp: testTimestamp.Add(2 * day), Value: 100},
+			},
+			expected: Statistics{
+				StartTimestamp: testTimestamp,
+				EndTimestamp:   testTimestamp.Add(2 * day),
+				StartingValue:  100,
+				EndingValue:    100,
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := CalculateEquityStatistics(testCase.equityCurve)
+
+			if diff := cmp.Diff(testCase.expected, actual, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Fatalf("(-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEstimatePeriodsPerYear(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name      string
+		intervals []time.Duration
+		expected  float64
+	}{
+		{name: "TestEstimatePeriodsPerYear_daily", intervals: []time.Duration{24 * time.Hour, 24 * time.Hour}, expected: 365},
+		{name: "TestEstimatePeriodsPerYear_fourHourly", intervals: []time.Duration{4 * time.Hour}, expected: 2190},
+		{name: "TestEstimatePeriodsPerYear_hourly", intervals: []time.Duration{time.Hour, time.Hour}, expected: 8760},
+		{
+			name:      "TestEstimatePeriodsPerYear_weekendGapUsesMedian",
+			intervals: []time.Duration{24 * time.Hour, 24 * time.Hour, 72 * time.Hour},
+			expected:  365,
+		},
+		{name: "TestEstimatePeriodsPerYear_singlePoint", intervals: []time.Duration{}, expected: 0},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			equityCurve := []EquityPoint{{Timestamp: testTimestamp}}
+			for _, interval := range testCase.intervals {
+				last := equityCurve[len(equityCurve)-1].Timestamp
+				equityCurve = append(equityCurve, EquityPoint{Timestamp: last.Add(interval)})
+			}
+
+			if actual := estimatePeriodsPerYear(equityCurve); math.Abs(actual-testCase.expected) > 1e-9 {
+				t.Fatalf("expected %v periods per year, got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCalculate_symbols(t *testing.T) {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	equityCurve := []EquityPoint{
+		{Timestamp: testTimestamp, Value: 200},
+		{Timestamp: testTimestamp.Add(day), Value: 210},
+		{Timestamp: testTimestamp.Add(2 * day), Value: 190},
+	}
+	symbolEquityCurves := map[string][]EquityPoint{
+		"ETH-USD": {
+			{Timestamp: testTimestamp, Value: 100},
+			{Timestamp: testTimestamp.Add(day), Value: 110, Exposure: 110},
+			{Timestamp: testTimestamp.Add(2 * day), Value: 110},
+		},
+		"BTC-USD": {
+			{Timestamp: testTimestamp, Value: 100},
+			{Timestamp: testTimestamp.Add(day), Value: 100},
+			{Timestamp: testTimestamp.Add(2 * day), Value: 80, Exposure: 80},
+		},
+	}
+	historicPositions := map[string][]model.Position{
+		"ETH-USD": {{EnterTimestamp: testTimestamp, ExitTimestamp: testTimestamp.Add(2 * day), ResultProfitLoss: 10}},
+	}
+
+	summary := Calculate(historicPositions, equityCurve, symbolEquityCurves)
+
+	if len(summary.Symbols) != 2 {
+		t.Fatalf("expected statistics for 2 symbols, got %+v", summary.Symbols)
+	}
+	eth, btc := summary.Symbols["ETH-USD"], summary.Symbols["BTC-USD"]
+	if math.Abs(eth.TotalReturn-0.1) > 1e-9 || eth.MaxDrawdown != 0 || eth.Trades.NumTrades != 1 {
+		t.Fatalf("unexpected ETH-USD statistics: %+v", eth)
+	}
+	if math.Abs(btc.TotalReturn+0.2) > 1e-9 || math.Abs(btc.MaxDrawdown-0.2) > 1e-9 || btc.Trades.NumTrades != 0 {
+		t.Fatalf("unexpected BTC-USD statistics: %+v", btc)
+	}
+	if math.Abs(summary.Portfolio.TotalReturn+0.05) > 1e-9 || summary.Portfolio.Trades.NumTrades != 1 {
+		t.Fatalf("unexpected portfolio statistics: %+v", summary.Portfolio)
+	}
+}
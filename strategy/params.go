@@ -0,0 +1,291 @@
+package strategy
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ParameterInt   = "int"   // Whole number parameter, eg/ an indicator period
+	ParameterFloat = "float" // Real number parameter, eg/ an indicator threshold
+
+	// maxGridSize caps the number of parameter combinations of a grid, as each is a full backtest
+	maxGridSize = 100000
+)
+
+// Parameter describes a typed, named parameter a strategy is tuned by
+type Parameter struct {
+	Name        string
+	Type        string
+	Default     float64
+	Min         float64
+	Max         float64
+	Description string
+}
+
+// Parameters are the values of a strategy's parameters by name
+type Parameters map[string]float64
+
+// Int returns the value of an integer parameter
+func (p Parameters) Int(name string) int {
+	return int(math.Round(p[name]))
+}
+
+// Float returns the value of a real parameter
+func (p Parameters) Float(name string) float64 {
+	return p[name]
+}
+
+// String formats the parameters as a specification in the format "name:value,name:value", ordered by name
+func (p Parameters) String() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, fmt.Sprintf("%s:%s", name, strconv.FormatFloat(p[name], 'f', -1, 64)))
+	}
+	return strings.Join(fields, ",")
+}
+
+// parameterSet is the parameters of a strategy & a check of the constraints between them
+type parameterSet struct {
+	parameters []Parameter
+	validate   func(Parameters) error
+}
+
+// strategyParameters is the parameterSet of every strategy
+var strategyParameters = map[string]parameterSet{
+	StrategyRSI: {
+		parameters: []Parameter{
+			{Name: "period", Type: ParameterInt, Default: 2, Min: 2, Max: 100, Description: "RSI lookback in bars"},
+			{Name: "entry", Type: ParameterFloat, Default: 40, Min: 0, Max: 100, Description: "RSI below which to go long & close shorts"},
+			{Name: "exit", Type: ParameterFloat, Default: 60, Min: 0, Max: 100, Description: "RSI above which to go short & close longs"},
+		},
+		validate: func(p Parameters) error {
+			if p.Float("entry") >= p.Float("exit") {
+				return errors.New(fmt.Sprintf("entry threshold %v must be below the exit threshold %v", p.Float("entry"), p.Float("exit")))
+			}
+			return nil
+		},
+	},
+}
+
+// StrategyParameters returns the parameters the named strategy is tuned by
+func StrategyParameters(strategyName string) ([]Parameter, error) {
+	set, err := lookupParameterSet(strategyName)
+	if err != nil {
+		return nil, err
+	}
+	return set.parameters, nil
+}
+
+// ParseParameters parses a STRATEGY_PARAMS specification in the format "name:value,name:value" into the parameters of
+// the named strategy, a parameter left out of the specification takes its default
+func ParseParameters(strategyName string, specification string) (Parameters, error) {
+	set, err := lookupParameterSet(strategyName)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make(Parameters)
+	for _, parameter := range set.parameters {
+		params[parameter.Name] = parameter.Default
+	}
+	for _, field := range splitFields(specification) {
+		nameAndValue := strings.SplitN(field, ":", 2)
+		if len(nameAndValue) != 2 {
+			return nil, errors.New(fmt.Sprintf("failed to parse strategy parameter %s", field))
+		}
+		name := strings.TrimSpace(nameAndValue[0])
+		parameter, isParameter := findParameter(set.parameters, name)
+		if !isParameter {
+			return nil, errors.New(fmt.Sprintf("unsupported parameter %s of strategy %s", name, strategyName))
+		}
+		value, err := parseParameterValue(parameter, nameAndValue[1])
+		if err != nil {
+			return nil, err
+		}
+		params[name] = value
+	}
+
+	if err := set.validate(params); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid parameters of strategy %s", strategyName))
+	}
+	return params, nil
+}
+
+// ParseParameterGrid parses a parameter grid specification in the format "name:min..max:step,name:value" into every
+// combination of the named strategy's parameters - the step defaults to 1, parameters left out of the specification
+// take their defaults, and combinations breaking the strategy's constraints, eg/ an RSI entry above its exit, are
+// skipped
+func ParseParameterGrid(strategyName string, specification string) ([]Parameters, error) {
+	set, err := lookupParameterSet(strategyName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Values of every parameter, defaulting to its default
+	values := make(map[string][]float64)
+	for _, parameter := range set.parameters {
+		values[parameter.Name] = []float64{parameter.Default}
+	}
+	for _, field := range splitFields(specification) {
+		nameAndRange := strings.SplitN(field, ":", 2)
+		if len(nameAndRange) != 2 {
+			return nil, errors.New(fmt.Sprintf("failed to parse parameter range %s", field))
+		}
+		name := strings.TrimSpace(nameAndRange[0])
+		parameter, isParameter := findParameter(set.parameters, name)
+		if !isParameter {
+			return nil, errors.New(fmt.Sprintf("unsupported parameter %s of strategy %s", name, strategyName))
+		}
+		values[name], err = parseParameterRange(parameter, nameAndRange[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	size := 1
+	for _, parameter := range set.parameters {
+		size *= len(values[parameter.Name])
+		if size > maxGridSize {
+			return nil, errors.New(fmt.Sprintf("parameter grid exceeds %v combinations", maxGridSize))
+		}
+	}
+
+	// Cartesian product of the values, in the order the parameters are declared
+	grid := []Parameters{{}}
+	for _, parameter := range set.parameters {
+		var expanded []Parameters
+		for _, params := range grid {
+			for _, value := range values[parameter.Name] {
+				combination := make(Parameters, len(params)+1)
+				for name, existing := range params {
+					combination[name] = existing
+				}
+				combination[parameter.Name] = value
+				expanded = append(expanded, combination)
+			}
+		}
+		grid = expanded
+	}
+
+	var valid []Parameters
+	for _, params := range grid {
+		if set.validate(params) == nil {
+			valid = append(valid, params)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, errors.New(fmt.Sprintf("no combination of parameter grid %s is valid for strategy %s", specification, strategyName))
+	}
+	return valid, nil
+}
+
+// parseParameterRange parses a range in the format "min..max:step" or a single value
+func parseParameterRange(parameter Parameter, specification string) ([]float64, error) {
+	boundsAndStep := strings.SplitN(specification, ":", 2)
+	bounds := strings.SplitN(boundsAndStep[0], "..", 2)
+	if len(bounds) == 1 {
+		if len(boundsAndStep) == 2 {
+			return nil, errors.New(fmt.Sprintf("parameter %s has a step without a range", parameter.Name))
+		}
+		value, err := parseParameterValue(parameter, bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		return []float64{value}, nil
+	}
+
+	min, err := parseParameterValue(parameter, bounds[0])
+	if err != nil {
+		return nil, err
+	}
+	max, err := parseParameterValue(parameter, bounds[1])
+	if err != nil {
+		return nil, err
+	}
+	if max < min {
+		return nil, errors.New(fmt.Sprintf("parameter %s range %v..%v is descending", parameter.Name, min, max))
+	}
+	step := 1.0
+	if len(boundsAndStep) == 2 {
+		step, err = strconv.ParseFloat(strings.TrimSpace(boundsAndStep[1]), 64)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse step of parameter %s", parameter.Name))
+		}
+	}
+	if step <= 0 || (parameter.Type == ParameterInt && step != math.Trunc(step)) {
+		return nil, errors.New(fmt.Sprintf("step %v of %s parameter %s must be a positive %s", step, parameter.Type, parameter.Name, parameter.Type))
+	}
+
+	// Step by index so float steps do not accumulate rounding error
+	var values []float64
+	for index := 0; ; index++ {
+		value := min + float64(index)*step
+		if value > max+step*1e-9 {
+			break
+		}
+		values = append(values, math.Min(value, max))
+		if len(values) > maxGridSize {
+			return nil, errors.New(fmt.Sprintf("parameter %s range exceeds %v values", parameter.Name, maxGridSize))
+		}
+	}
+	return values, nil
+}
+
+// parseParameterValue parses a value of the parameter, checking its type & bounds
+func parseParameterValue(parameter Parameter, value string) (float64, error) {
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("failed to parse parameter %s", parameter.Name))
+	}
+	if parameter.Type == ParameterInt && parsed != math.Trunc(parsed) {
+		return 0, errors.New(fmt.Sprintf("parameter %s must be a whole number, got %v", parameter.Name, parsed))
+	}
+	if parsed < parameter.Min || parsed > parameter.Max {
+		return 0, errors.New(fmt.Sprintf("parameter %s must be between %v & %v, got %v", parameter.Name, parameter.Min, parameter.Max, parsed))
+	}
+	return parsed, nil
+}
+
+// lookupParameterSet returns the parameterSet of the named strategy, an empty name being the default RSI strategy
+func lookupParameterSet(strategyName string) (parameterSet, error) {
+	if strategyName == "" {
+		strategyName = StrategyRSI
+	}
+	set, isStrategy := strategyParameters[strategyName]
+	if !isStrategy {
+		return parameterSet{}, errors.New(fmt.Sprintf("unsupported strategy %s", strategyName))
+	}
+	return set, nil
+}
+
+// findParameter returns the named parameter
+func findParameter(parameters []Parameter, name string) (Parameter, bool) {
+	for _, parameter := range parameters {
+		if parameter.Name == name {
+			return parameter, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// splitFields splits a comma-separated specification, dropping empty fields
+func splitFields(specification string) []string {
+	var fields []string
+	for _, field := range strings.Split(specification, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,90 @@
+package strategy
+
+import (
+	"testing"
+)
+
+func TestParseParameters(t *testing.T) {
+	testCases := []struct {
+		name           string
+		specification  string
+		expectedError  bool
+		expectedParams Parameters
+	}{
+		{
+			name:           "TestParseParameters_defaults",
+			expectedParams: Parameters{"period": 2, "entry": 40, "exit": 60},
+		},
+		{
+			name:           "TestParseParameters_override",
+			specification:  "period:14, exit:70",
+			expectedParams: Parameters{"period": 14, "entry": 40, "exit": 70},
+		},
+		{
+			name:          "TestParseParameters_fractionalInt",
+			specification: "period:2.5",
+			expectedError: true,
+		},
+		{
+			name:          "TestParseParameters_outOfBounds",
+			specification: "entry:-5",
+			expectedError: true,
+		},
+		{
+			name:          "TestParseParameters_entryAboveExit",
+			specification: "entry:70",
+			expectedError: true,
+		},
+		{
+			name:          "TestParseParameters_unsupported",
+			specification: "lookback:14",
+			expectedError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			params, err := ParseParameters(StrategyRSI, testCase.specification)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if testCase.expectedError {
+				return
+			}
+			if params.String() != testCase.expectedParams.String() {
+				t.Errorf("expected %s, got %s", testCase.expectedParams, params)
+			}
+		})
+	}
+}
+
+func TestParseParameterGrid(t *testing.T) {
+	testCases := []struct {
+		name          string
+		specification string
+		expectedError bool
+		expectedSize  int
+	}{
+		{name: "TestParseParameterGrid_defaults", expectedSize: 1},
+		{name: "TestParseParameterGrid_intRange", specification: "period:2..14", expectedSize: 13},
+		{name: "TestParseParameterGrid_steps", specification: "period:2..14:4,entry:20..45:5,exit:55..80:5", expectedSize: 4 * 6 * 6},
+		// Entries of 60 & 65 are not below the exit of 60
+		{name: "TestParseParameterGrid_skipsInvalid", specification: "entry:55..65:5", expectedSize: 1},
+		{name: "TestParseParameterGrid_floatStep", specification: "entry:30..31:0.1", expectedSize: 11},
+		{name: "TestParseParameterGrid_fractionalIntStep", specification: "period:2..14:1.5", expectedError: true},
+		{name: "TestParseParameterGrid_descending", specification: "period:14..2", expectedError: true},
+		{name: "TestParseParameterGrid_noneValid", specification: "entry:70..80", expectedError: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			grid, err := ParseParameterGrid(StrategyRSI, testCase.specification)
+			if (err != nil) != testCase.expectedError {
+				t.Fatalf("expected error %v, got %v", testCase.expectedError, err)
+			}
+			if len(grid) != testCase.expectedSize {
+				t.Errorf("expected %v combinations, got %v", testCase.expectedSize, len(grid))
+			}
+		})
+	}
+}
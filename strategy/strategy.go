@@ -1,13 +1,18 @@
 package strategy
 
 import (
+	"fmt"
 	"github.com/eapache/queue"
 	"github.com/markcheno/go-talib"
+	"github.com/pkg/errors"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
 	"go.uber.org/zap"
-	"time"
+)
+
+const (
+	StrategyRSI = "rsi"
 )
 
 type Strategy interface {
@@ -19,6 +24,9 @@ type rsiStrategy struct {
 	eventQ       *queue.Queue
 	data         data.Handler
 	symbol 		 string
+	period 		 int 		// RSI lookback in bars
+	entry 		 float64 	// RSI below which to go long & close shorts
+	exit 		 float64 	// RSI above which to go short & close longs
 }
 
 // GenerateSignal analyses the current symbol data and appends a
@@ -29,24 +37,23 @@ func (s *rsiStrategy) GenerateSignal(market model.MarketEvent) error {
 	currentData, latestBarIndex := s.data.GetLatestData()
 
 	// Calculate RSI array
-	rsiPeriod := 2
-	if latestBarIndex < int64(rsiPeriod) {
+	if latestBarIndex < int64(s.period) {
 		return nil
 	}
-	rsi2Array := talib.Rsi(currentData.Closes, 2)
+	rsiArray := talib.Rsi(currentData.Closes, s.period)
 
 	// Construct SignalPairs map
 	signalPairs := make(map[string]float32)
-	if rsi2Array[latestBarIndex] < 40 {
+	if rsiArray[latestBarIndex] < s.entry {
 		signalPairs[model.DecisionLong] = determineSignalStrength()
 	}
-	if rsi2Array[latestBarIndex] > 60 {
+	if rsiArray[latestBarIndex] > s.exit {
 		signalPairs[model.DecisionCloseLong] = determineSignalStrength()
 	}
-	if rsi2Array[latestBarIndex] > 60 {
+	if rsiArray[latestBarIndex] > s.exit {
 		signalPairs[model.DecisionShort] = determineSignalStrength()
 	}
-	if rsi2Array[latestBarIndex] < 40 {
+	if rsiArray[latestBarIndex] < s.entry {
 		signalPairs[model.DecisionCloseShort] = determineSignalStrength()
 	}
 
@@ -55,7 +62,7 @@ func (s *rsiStrategy) GenerateSignal(market model.MarketEvent) error {
 		// Append SignalEvent to the queue
 		s.eventQ.Add(model.SignalEvent{
 			TraceId: 	 market.TraceId,
-			Timestamp:   time.Now().Truncate(time.Nanosecond),
+			Timestamp:   market.Timestamp,
 			Symbol:      s.symbol,
 			SignalPairs: signalPairs,
 		})
@@ -64,13 +71,30 @@ func (s *rsiStrategy) GenerateSignal(market model.MarketEvent) error {
 	return nil
 }
 
-// NewSimpleRSIStrategy constructs a new Strategy instance
-func NewSimpleRSIStrategy(cfg config.Trader, eventQ *queue.Queue, data data.Handler) *rsiStrategy {
+// NewSimpleRSIStrategy constructs a new Strategy instance tuned by the trader's STRATEGY_PARAMS
+func NewSimpleRSIStrategy(cfg config.Trader, eventQ *queue.Queue, data data.Handler) (*rsiStrategy, error) {
+	params, err := ParseParameters(StrategyRSI, cfg.StrategyParams)
+	if err != nil {
+		return &rsiStrategy{}, err
+	}
 	return &rsiStrategy{
 		log:    cfg.Log,
 		eventQ: eventQ,
 		data:   data,
 		symbol: cfg.Symbol,
+		period: params.Int("period"),
+		entry:  params.Float("entry"),
+		exit:   params.Float("exit"),
+	}, nil
+}
+
+// NewStrategy constructs the Strategy instance named by the trader's config
+func NewStrategy(cfg config.Trader, eventQ *queue.Queue, data data.Handler) (Strategy, error) {
+	switch cfg.Strategy {
+	case StrategyRSI, "":
+		return NewSimpleRSIStrategy(cfg, eventQ, data)
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported strategy %s", cfg.Strategy))
 	}
 }
 
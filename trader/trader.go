@@ -1,6 +1,7 @@
 package trader
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/eapache/queue"
@@ -8,124 +9,442 @@ import (
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/execution"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/export"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/portfolio"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/report"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/statistics"
 	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/strategy"
 	"go.uber.org/zap"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	ModeBacktest = "BACKTEST" // Replay historic data files as fast as possible
+	ModeDry      = "DRY"      // Paper trade a live feed, no orders are sent to the exchange
+	ModeLive     = "LIVE"     // Trade a live feed, placing real orders on the exchange
 )
 
 type Trader interface {
-	Run() error
-	DisplayResults() error
+	Run(ctx context.Context) error
+	Name() string
+	Results() statistics.Summary
+	EquityCurve() []statistics.EquityPoint
+	Export(directory string) error
+	Report(directory string) error
 }
 
+// trader runs the markets of one or more symbols against a single shared portfolio
 type trader struct {
-	log       *zap.Logger
-	eventQ    *queue.Queue
-	data      data.Handler
-	strategy  strategy.Strategy
-	portfolio portfolio.Portfolio
-	execution execution.Execution
+	log        *zap.Logger
+	name       string
+	eventQ     *queue.Queue
+	symbols    []string
+	data       map[string]data.Handler
+	strategies map[string]strategy.Strategy
+	portfolio  portfolio.Portfolio
+	executions map[string]execution.Execution
+	heartbeat  time.Duration // Interval between polls of the data feeds of streaming handlers
 }
 
-func (t *trader) Run() error {
+// Run processes the markets bar by bar until the data is exhausted or the context is cancelled - streaming handlers
+// & live executions are polled on every heartbeat until the feeds finish
+func (t *trader) Run(ctx context.Context) error {
 	for {
-		// Todo: Need to add check for stop loss and take profit - probably in strategy
-		if t.data.ShouldContinue() {
-			t.data.UpdateData()
+		if err := ctx.Err(); err != nil {
+			return errors.Wrap(err, "trader cancelled")
+		}
+
+		handlers := t.nextHandlers()
+		if len(handlers) == 0 && t.isStreaming() {
+			t.poll(ctx)
+			// Fills polled from live executions are processed without waiting for a new bar
+			if err := t.processEvents(); err != nil {
+				return err
+			}
+			if handlers = t.nextHandlers(); len(handlers) == 0 {
+				// This is the heartbeat -> frequency of polls to get data from the feeds & executions
+				select {
+				case <-ctx.Done():
+				case <-time.After(t.heartbeat):
+				}
+				continue
+			}
+		}
+
+		if len(handlers) > 0 {
+			for _, handler := range handlers {
+				handler.UpdateData()
+			}
 		} else {
-			t.log.Info("Backtest has finished.")
-			_ = t.DisplayResults()
-			// Save & Print results
+			t.log.Info("Market data exhausted, trader has finished.")
 			// Reset trader instance ready for another run
 			break
 		}
 
-		for {
-			if t.eventQ.Length() > 0 {
-				e := t.eventQ.Get(0) // 0 or -1?
-				t.eventQ.Remove()
-				switch e.(type) {
-				case model.MarketEvent:
-					repr, _ := json.Marshal(e.(model.MarketEvent))
-					t.log.Info(fmt.Sprintf("MARKET: %s", string(repr)))
-					err := t.strategy.GenerateSignal(e.(model.MarketEvent))
-					if err != nil {
-						return errors.Wrap(err, "failed to GenerateSignal()")
-					}
-					err = t.portfolio.UpdateFromMarket(e.(model.MarketEvent))
-					if err != nil {
-						return err
-					}
-				case model.SignalEvent:
-					repr, _ := json.Marshal(e.(model.SignalEvent))
-					t.log.Info(fmt.Sprintf("SIGNAL: %s", repr))
-					err := t.portfolio.GenerateOrders(e.(model.SignalEvent))
-					if err != nil {
-						return err
-					}
-				case model.OrderEvent:
-					repr, _ := json.Marshal(e.(model.OrderEvent))
-					t.log.Info(fmt.Sprintf("ORDER: %s", repr))
-					err := t.execution.GenerateFills(e.(model.OrderEvent))
-					if err != nil {
-						return err
-					}
-				case model.FillEvent:
-					repr, _ := json.Marshal(e.(model.FillEvent))
-					t.log.Info(fmt.Sprintf("FILL: %s", repr))
-					err := t.portfolio.UpdateFromFill(e.(model.FillEvent))
-					if err != nil {
-						return err
-					}
-				}
-			} else {
-				// Inner loop would break when the event queue is empty and we need another data drop
-				break
+		if err := t.processEvents(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processEvents dispatches every event on the queue, including those added whilst processing, until it is empty
+func (t *trader) processEvents() error {
+	for {
+		if t.eventQ.Length() > 0 {
+			e := t.eventQ.Get(0) // 0 or -1?
+			t.eventQ.Remove()
+			if err := t.dispatch(e); err != nil {
+				return err
 			}
+		} else {
+			// Loop breaks when the event queue is empty and we need another data drop
+			return nil
+		}
+	}
+}
+
+// dispatch routes an event to the trader's components
+func (t *trader) dispatch(e interface{}) error {
+	switch e.(type) {
+	case model.MarketEvent:
+		repr, _ := json.Marshal(e.(model.MarketEvent))
+		t.log.Info(fmt.Sprintf("MARKET: %s", string(repr)))
+		symbol := e.(model.MarketEvent).Symbol
+		if t.isWarmingUp(symbol, e.(model.MarketEvent).Timestamp) {
+			// Warm-up bars only feed the strategy & its indicators, trading & accounting start afterwards
+			err := t.strategies[symbol].GenerateSignal(e.(model.MarketEvent))
+			if err != nil {
+				return errors.Wrap(err, "failed to GenerateSignal()")
+			}
+			return nil
+		}
+		queued := t.eventQ.Length()
+		err := t.executions[symbol].UpdateFromMarket(e.(model.MarketEvent))
+		if err != nil {
+			return errors.Wrap(err, "failed to fill pending orders")
+		}
+		// Fills of pending orders on the new bar are applied before the portfolio checks the bar's range against the
+		// exits of their positions & records the bar's Snapshot
+		if err := t.dispatchAdded(queued); err != nil {
+			return err
+		}
+		err = t.strategies[symbol].GenerateSignal(e.(model.MarketEvent))
+		if err != nil {
+			return errors.Wrap(err, "failed to GenerateSignal()")
+		}
+		err = t.portfolio.UpdateFromMarket(e.(model.MarketEvent))
+		if err != nil {
+			return err
+		}
+	case model.SignalEvent:
+		repr, _ := json.Marshal(e.(model.SignalEvent))
+		t.log.Info(fmt.Sprintf("SIGNAL: %s", repr))
+		if t.isWarmingUp(e.(model.SignalEvent).Symbol, e.(model.SignalEvent).Timestamp) {
+			t.log.Debug("discarding signal generated during warm-up")
+			return nil
+		}
+		err := t.portfolio.GenerateOrders(e.(model.SignalEvent))
+		if err != nil {
+			return err
+		}
+	case model.OrderEvent:
+		repr, _ := json.Marshal(e.(model.OrderEvent))
+		t.log.Info(fmt.Sprintf("ORDER: %s", repr))
+		err := t.executions[e.(model.OrderEvent).Symbol].GenerateFills(e.(model.OrderEvent))
+		if err != nil {
+			return err
+		}
+	case model.CancelEvent:
+		repr, _ := json.Marshal(e.(model.CancelEvent))
+		t.log.Info(fmt.Sprintf("CANCEL: %s", repr))
+		err := t.executions[e.(model.CancelEvent).Symbol].CancelOrder(e.(model.CancelEvent))
+		if err != nil {
+			return err
+		}
+	case model.OrderUpdateEvent:
+		repr, _ := json.Marshal(e.(model.OrderUpdateEvent))
+		t.log.Info(fmt.Sprintf("ORDER-UPDATE: %s", repr))
+		err := t.portfolio.UpdateFromOrder(e.(model.OrderUpdateEvent))
+		if err != nil {
+			return err
+		}
+	case model.FillEvent:
+		repr, _ := json.Marshal(e.(model.FillEvent))
+		t.log.Info(fmt.Sprintf("FILL: %s", repr))
+		err := t.portfolio.UpdateFromFill(e.(model.FillEvent))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatchAdded immediately dispatches the events added to the queue behind its first queued events, which stay on
+// the queue in order
+func (t *trader) dispatchAdded(queued int) error {
+	var earlier, added []interface{}
+	for i := 0; i < queued; i++ {
+		earlier = append(earlier, t.eventQ.Remove())
+	}
+	for t.eventQ.Length() > 0 {
+		added = append(added, t.eventQ.Remove())
+	}
+	for _, e := range earlier {
+		t.eventQ.Add(e)
+	}
+
+	for _, e := range added {
+		if err := t.dispatch(e); err != nil {
+			return err
 		}
-		// This is the heartbeat -> would be frequency of poll to get data from execution
-		//time.Sleep(2*time.Millisecond)
 	}
 	return nil
 }
 
-func (t *trader) DisplayResults() error {
-	initialCash, currentCash, currentValue, positions := t.portfolio.GetPortfolio()
+// isWarmingUp determines if a bar of the symbol at the timestamp precedes the trading start of its handler, so it
+// should only warm up the strategy
+func (t *trader) isWarmingUp(symbol string, timestamp time.Time) bool {
+	warmUpper, isWarmUpper := t.data[symbol].(data.WarmUpper)
+	return isWarmUpper && timestamp.Before(warmUpper.TradingStart())
+}
+
+// isStreaming determines if any of the trader's handlers is a Streamer whose feed has more bars to send
+func (t *trader) isStreaming() bool {
+	for _, handler := range t.data {
+		if streamer, isStreamer := handler.(data.Streamer); isStreamer && !streamer.IsFinished() {
+			return true
+		}
+	}
+	return false
+}
+
+// poll fetches new bars for every Streamer & new executions for every Poller - a failed poll is retried on the next
+// heartbeat, so a dropped connection does not end the run
+func (t *trader) poll(ctx context.Context) {
+	for _, symbol := range t.symbols {
+		if streamer, isStreamer := t.data[symbol].(data.Streamer); isStreamer && !streamer.IsFinished() {
+			if err := streamer.Poll(ctx); err != nil && ctx.Err() == nil {
+				t.log.Warn(fmt.Sprintf("failed to poll data feed: %s", err))
+			}
+		}
+		if poller, isPoller := t.executions[symbol].(execution.Poller); isPoller {
+			if err := poller.Poll(ctx); err != nil && ctx.Err() == nil {
+				t.log.Warn(fmt.Sprintf("failed to poll open orders: %s", err))
+			}
+		}
+	}
+}
+
+// nextHandlers returns the data handlers of every symbol whose next bar has the earliest timestamp, so the markets of
+// all symbols advance through time together
+func (t *trader) nextHandlers() []data.Handler {
+	var handlers []data.Handler
+	var nextTimestamp time.Time
+	for _, symbol := range t.symbols {
+		handler := t.data[symbol]
+		if !handler.ShouldContinue() {
+			continue
+		}
+		timestamp := handler.NextTimestamp()
+		if len(handlers) == 0 || timestamp.Before(nextTimestamp) {
+			handlers = []data.Handler{handler}
+			nextTimestamp = timestamp
+		} else if timestamp.Equal(nextTimestamp) {
+			handlers = append(handlers, handler)
+		}
+	}
+	return handlers
+}
+
+// Name returns the identifier of the trader in the format "symbol_timeframe_exchange", joined by "+" for every market
+// sharing the trader's portfolio
+func (t *trader) Name() string {
+	return t.name
+}
+
+// Results calculates the performance statistics of the trader's portfolio
+func (t *trader) Results() statistics.Summary {
+	return statistics.Calculate(t.portfolio.GetHistoricPositions(), t.portfolio.GetEquityCurve(),
+		t.portfolio.GetSymbolEquityCurves())
+}
+
+// EquityCurve returns the value & exposure of the trader's portfolio at the close of every bar
+func (t *trader) EquityCurve() []statistics.EquityPoint {
+	return t.portfolio.GetEquityCurve()
+}
+
+// Export writes the trader's order book, fill journal, closed position ledger & portfolio Snapshots to CSV & JSON
+// Lines files, and the data quality reports of its historic data, in the provided directory
+func (t *trader) Export(directory string) error {
+	orders := t.portfolio.GetOrders()
+	fills := t.portfolio.GetFills()
+	historicPositions := t.portfolio.GetHistoricPositions()
+	snapshots := t.portfolio.GetSnapshots()
+
+	var positions []model.Position
+	for _, symbolPositions := range historicPositions {
+		positions = append(positions, symbolPositions...)
+	}
+
+	// Data quality reports of the markets loaded from historic data files
+	qualityReports := make(map[string]data.QualityReport)
+	for symbol, handler := range t.data {
+		if reporter, isReporter := handler.(data.QualityReporter); isReporter && reporter.QualityReport().Source != "" {
+			qualityReports[symbol] = reporter.QualityReport()
+		}
+	}
+
+	exports := map[string]func(io.Writer) error{
+		"orders.csv":      func(w io.Writer) error { return export.WriteOrdersCSV(w, orders) },
+		"orders.jsonl":    func(w io.Writer) error { return export.WriteJSONLines(w, orders) },
+		"fills.csv":       func(w io.Writer) error { return export.WriteFillsCSV(w, fills) },
+		"fills.jsonl":     func(w io.Writer) error { return export.WriteJSONLines(w, fills) },
+		"positions.csv":   func(w io.Writer) error { return export.WritePositionsCSV(w, historicPositions) },
+		"positions.jsonl": func(w io.Writer) error { return export.WriteJSONLines(w, positions) },
+		"snapshots.csv":   func(w io.Writer) error { return export.WriteSnapshotsCSV(w, snapshots) },
+		"snapshots.jsonl": func(w io.Writer) error { return export.WriteJSONLines(w, snapshots) },
+	}
+	if len(qualityReports) > 0 {
+		exports["data_quality.json"] = func(w io.Writer) error { return export.WriteJSON(w, qualityReports) }
+	}
+	for fileName, writeFunc := range exports {
+		filePath := filepath.Join(directory, fmt.Sprintf("%s_%s", t.name, fileName))
+		if err := export.WriteFile(filePath, writeFunc); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to export %s", fileName))
+		}
+	}
 
-	fmt.Printf("\nDisplay Results:\n")
-	fmt.Printf("Starting Cash: %v\n", initialCash)
-	fmt.Printf("Ending Cash: %v\n", currentCash)
-	fmt.Printf("Ending Value: %v\n", currentValue)
-	fmt.Printf("Number Trades: %v\n", len(positions["ETH-USD"]))
+	return nil
+}
 
-	totalProfit := currentValue - initialCash
-	fmt.Printf("Total Profit: %v\n", totalProfit)
-	percentProfit := (totalProfit / initialCash) * 100
-	fmt.Printf("Total Percent Profit: %v\n", percentProfit)
+// Report writes a self-contained HTML backtest report for the trader to the provided directory
+func (t *trader) Report(directory string) error {
+	prices := make(map[string]*model.SymbolData)
+	for symbol, handler := range t.data {
+		prices[symbol], _ = handler.GetLatestData()
+	}
+	input := report.Input{
+		Name:              t.name,
+		GeneratedAt:       time.Now(),
+		Summary:           t.Results(),
+		EquityCurve:       t.portfolio.GetEquityCurve(),
+		Prices:            prices,
+		HistoricPositions: t.portfolio.GetHistoricPositions(),
+	}
 
+	filePath := filepath.Join(directory, fmt.Sprintf("%s_report.html", t.name))
+	err := export.WriteFile(filePath, func(w io.Writer) error {
+		return report.Generate(w, input)
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to write report")
+	}
 	return nil
 }
 
-func NewTrader(cfg config.Trader) (*trader, error) {
+// NewTrader constructs a trader running the market of every config against one portfolio shared by their symbols -
+// BACKTEST traders replay the historic data files, whilst DRY & LIVE traders trade the bars polled from a live feed,
+// DRY traders on paper & LIVE traders with real orders on the exchange
+func NewTrader(cfgs []config.Trader) (*trader, error) {
+	if len(cfgs) == 0 {
+		return &trader{}, errors.New("trader requires at least one market")
+	}
 
 	eventQ := queue.New()
 
-	dataHandler, err := data.NewHistoricHandler(cfg, eventQ)
+	basicTrader := &trader{
+		log:        cfgs[0].Log,
+		eventQ:     eventQ,
+		data:       make(map[string]data.Handler),
+		strategies: make(map[string]strategy.Strategy),
+		executions: make(map[string]execution.Execution),
+		heartbeat:  cfgs[0].Heartbeat,
+	}
+
+	// Markets on the same exchange share its fee model, so volume tiers are reached on their combined volume
+	feeModels := make(execution.FeeModels)
+	var names []string
+	for _, cfg := range cfgs {
+		// Positions of a shared portfolio are held per Symbol
+		if _, isDuplicate := basicTrader.data[cfg.Symbol]; isDuplicate {
+			return &trader{}, errors.New(fmt.Sprintf("symbol %s cannot appear in more than one market of a shared portfolio", cfg.Symbol))
+		}
+
+		dataHandler, basicExecution, err := newMarket(cfg, eventQ, feeModels)
+		if err != nil {
+			return &trader{}, err
+		}
+		basicStrategy, err := strategy.NewStrategy(cfg, eventQ, dataHandler)
+		if err != nil {
+			return &trader{}, errors.Wrap(err, fmt.Sprintf("failed to init strategy for %s", cfg.Symbol))
+		}
+
+		basicTrader.symbols = append(basicTrader.symbols, cfg.Symbol)
+		basicTrader.data[cfg.Symbol] = dataHandler
+		basicTrader.strategies[cfg.Symbol] = basicStrategy
+		basicTrader.executions[cfg.Symbol] = basicExecution
+		names = append(names, fmt.Sprintf("%s_%s_%s", cfg.Symbol, cfg.Timeframe, cfg.Exchange))
+	}
+	basicTrader.name = strings.Join(names, "+")
+
+	basicPortfolio, err := portfolio.NewPortfolio(cfgs, eventQ, basicTrader.data)
 	if err != nil {
-		return &trader{}, errors.Wrap(err, "failed to init dataHandler")
-	}
-	basicStrategy := strategy.NewSimpleRSIStrategy(cfg, eventQ, dataHandler)
-	basicPortfolio := portfolio.NewPortfolio(cfg, eventQ, dataHandler)
-	basicExecution := execution.NewSimulatedExecution(cfg, eventQ)
-
-	trader := &trader{
-		log:       cfg.Log,
-		eventQ:    eventQ,
-		data:      dataHandler,
-		strategy:  basicStrategy,
-		portfolio: basicPortfolio,
-		execution: basicExecution,
-	}
-	return trader, nil
-}
\ No newline at end of file
+		return &trader{}, errors.Wrap(err, "failed to init portfolio")
+	}
+	basicTrader.portfolio = basicPortfolio
+
+	return basicTrader, nil
+}
+
+// newMarket constructs the data handler & execution of a market for the config's trading mode
+func newMarket(cfg config.Trader, eventQ *queue.Queue, feeModels execution.FeeModels) (data.Handler, execution.Execution, error) {
+	switch cfg.Mode {
+	case ModeBacktest:
+		dataHandler, err := data.NewBacktestHandler(cfg, eventQ)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to init dataHandler for %s", cfg.Symbol))
+		}
+		basicExecution, err := execution.NewExecution(cfg, eventQ, dataHandler, feeModels)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to init execution for %s", cfg.Symbol))
+		}
+		return dataHandler, basicExecution, nil
+
+	case ModeDry, ModeLive:
+		if cfg.Heartbeat <= 0 {
+			return nil, nil, errors.New(fmt.Sprintf("heartbeat %s must be positive", cfg.Heartbeat))
+		}
+		feed, err := data.NewFeed(cfg)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to init data feed for %s", cfg.Symbol))
+		}
+		dataHandler, err := data.NewStreamingHandler(cfg, eventQ, feed)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to init dataHandler for %s", cfg.Symbol))
+		}
+		if cfg.Mode == ModeDry {
+			paperExecution, err := execution.NewPaperExecution(cfg, eventQ, dataHandler, feeModels)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to init paper execution for %s", cfg.Symbol))
+			}
+			return dataHandler, paperExecution, nil
+		}
+
+		client, err := execution.NewExchangeClient(cfg)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to init exchange client for %s", cfg.Symbol))
+		}
+		liveExecution, err := execution.NewLiveExecution(cfg, eventQ, client, feeModels)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to init live execution for %s", cfg.Symbol))
+		}
+		return dataHandler, liveExecution, nil
+	}
+
+	return nil, nil, errors.New(fmt.Sprintf("unsupported trading mode %s", cfg.Mode))
+}
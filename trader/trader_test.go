@@ -0,0 +1,222 @@
+package trader
+
+import (
+	"context"
+	"github.com/eapache/queue"
+	"github.com/google/uuid"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/config"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/data"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/execution"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/model"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/portfolio"
+	"gitlab.com/open-source-keir/financial-modelling/trading/fm-trader/strategy"
+	"go.uber.org/zap"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeHandler replays a fixed set of bars, adding a MarketEvent for each
+type fakeHandler struct {
+	eventQ     *queue.Queue
+	symbol     string
+	bars       []model.Bar
+	symbolData model.SymbolData
+}
+
+func (f *fakeHandler) ShouldContinue() bool { return len(f.symbolData.Timestamps) < len(f.bars) }
+
+func (f *fakeHandler) UpdateData() {
+	bar := f.bars[len(f.symbolData.Timestamps)]
+	f.symbolData.AddBar(bar)
+	f.eventQ.Add(model.MarketEvent{TraceId: uuid.New(), Timestamp: bar.Timestamp, Symbol: f.symbol, Close: bar.Close})
+}
+
+func (f *fakeHandler) GetLatestData() (*model.SymbolData, int64) {
+	return &f.symbolData, int64(len(f.symbolData.Timestamps) - 1)
+}
+
+func (f *fakeHandler) NextTimestamp() time.Time {
+	return f.bars[len(f.symbolData.Timestamps)].Timestamp
+}
+
+// fakeStrategy advises the SignalPairs of a bar index
+type fakeStrategy struct {
+	eventQ  *queue.Queue
+	handler data.Handler
+	signals map[int64]map[string]float32 // map[bar index]SignalPairs
+}
+
+func (f *fakeStrategy) GenerateSignal(market model.MarketEvent) error {
+	_, latestBarIndex := f.handler.GetLatestData()
+	if signalPairs, isSignal := f.signals[latestBarIndex]; isSignal {
+		f.eventQ.Add(model.SignalEvent{TraceId: market.TraceId, Timestamp: market.Timestamp, Symbol: market.Symbol,
+			SignalPairs: signalPairs})
+	}
+	return nil
+}
+
+// newTestTrader constructs a trader of one market replaying the bars with a simulated execution & the signals
+func newTestTrader(t *testing.T, cfg config.Trader, bars []model.Bar, signals map[int64]map[string]float32) *trader {
+	eventQ := queue.New()
+	handler := &fakeHandler{eventQ: eventQ, symbol: cfg.Symbol, bars: bars}
+	handlers := map[string]data.Handler{cfg.Symbol: handler}
+
+	basicExecution, err := execution.NewSimulatedExecution(cfg, eventQ, handler, execution.FeeModels{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	basicPortfolio, err := portfolio.NewPortfolio([]config.Trader{cfg}, eventQ, handlers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &trader{
+		log:        zap.NewNop(),
+		name:       cfg.Symbol,
+		eventQ:     eventQ,
+		symbols:    []string{cfg.Symbol},
+		data:       handlers,
+		strategies: map[string]strategy.Strategy{cfg.Symbol: &fakeStrategy{eventQ: eventQ, handler: handler, signals: signals}},
+		portfolio:  basicPortfolio,
+		executions: map[string]execution.Execution{cfg.Symbol: basicExecution},
+	}
+}
+
+// newTestBars constructs daily bars from [open, high, low, close] prices
+func newTestBars(prices [][4]float64) []model.Bar {
+	testTimestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var bars []model.Bar
+	for index, price := range prices {
+		bars = append(bars, model.Bar{Timestamp: testTimestamp.Add(time.Duration(index) * 24 * time.Hour),
+			Open: price[0], High: price[1], Low: price[2], Close: price[3], Volume: 1000})
+	}
+	return bars
+}
+
+func TestTrader_Run_protectiveExitPrice(t *testing.T) {
+	enterLong := map[int64]map[string]float32{0: {model.DecisionLong: 1}}
+
+	testCases := []struct {
+		name               string
+		stopLoss           string
+		takeProfit         string
+		prices             [][4]float64
+		expectedExitReason string
+		expectedExitPrice  float64
+		expectedExitBar    int
+	}{
+		{
+			name:               "TestTrader_Run_protectiveExitPrice_stopLossLevel",
+			stopLoss:           "pct:0.05",
+			prices:             [][4]float64{{100, 100, 100, 100}, {98, 99, 93, 94}, {94, 94, 94, 94}},
+			expectedExitReason: model.ExitReasonStopLoss,
+			expectedExitPrice:  95,
+			expectedExitBar:    1,
+		},
+		{
+			name:               "TestTrader_Run_protectiveExitPrice_stopLossGap",
+			stopLoss:           "pct:0.05",
+			prices:             [][4]float64{{100, 100, 100, 100}, {99, 101, 97, 98}, {90, 92, 88, 91}},
+			expectedExitReason: model.ExitReasonStopLoss,
+			expectedExitPrice:  90,
+			expectedExitBar:    2,
+		},
+		{
+			name:               "TestTrader_Run_protectiveExitPrice_takeProfitLevel",
+			stopLoss:           "pct:0.05",
+			takeProfit:         "pct:0.1",
+			prices:             [][4]float64{{100, 100, 100, 100}, {101, 112, 100, 104}, {104, 104, 104, 104}},
+			expectedExitReason: model.ExitReasonTakeProfit,
+			expectedExitPrice:  110,
+			expectedExitBar:    1,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := config.Trader{Log: zap.NewNop(), Symbol: "ETH-USD", Exchange: "binance", Timeframe: "1D",
+				StartingCash: 10000, DefaultOrderValue: 1000, OrderType: model.OrderTypeMarket,
+				TimeInForce: model.TimeInForceGTC, FillTiming: execution.FillTimingClose, StopLoss: testCase.stopLoss,
+				TakeProfit: testCase.takeProfit, ExitPriority: portfolio.ExitPriorityStopFirst}
+			bars := newTestBars(testCase.prices)
+			basicTrader := newTestTrader(t, cfg, bars, enterLong)
+
+			if err := basicTrader.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			positions := basicTrader.portfolio.GetHistoricPositions()["ETH-USD"]
+			if len(positions) != 1 {
+				t.Fatalf("expected 1 closed position, got %v", len(positions))
+			}
+			position := positions[0]
+			if position.ExitReason != testCase.expectedExitReason {
+				t.Errorf("expected exit reason %s, got %s", testCase.expectedExitReason, position.ExitReason)
+			}
+			if math.Abs(position.ExitAvgPriceGross-testCase.expectedExitPrice) > 1e-9 {
+				t.Errorf("expected exit price %v, got %v", testCase.expectedExitPrice, position.ExitAvgPriceGross)
+			}
+			if !position.ExitTimestamp.Equal(bars[testCase.expectedExitBar].Timestamp) {
+				t.Errorf("expected exit at %s, got %s", bars[testCase.expectedExitBar].Timestamp, position.ExitTimestamp)
+			}
+		})
+	}
+}
+
+func TestTrader_Run_nextOpenFills(t *testing.T) {
+	enterLong := map[int64]map[string]float32{0: {model.DecisionLong: 1}}
+
+	testCases := []struct {
+		name              string
+		stopLoss          string
+		prices            [][4]float64
+		expectedValues    []float64 // Portfolio value at the close of each bar
+		expectedExposures []float64 // Portfolio exposure at the close of each bar
+		expectedExits     int
+	}{
+		{
+			name:   "TestTrader_Run_nextOpenFills_entrySnapshot",
+			prices: [][4]float64{{100, 100, 100, 100}, {102, 104, 101, 103}, {103, 103, 103, 103}},
+			// 10 units entered at the open of bar 1 are valued at its close
+			expectedValues:    []float64{10000, 10010, 10010},
+			expectedExposures: []float64{0, 1030, 1030},
+		},
+		{
+			name:     "TestTrader_Run_nextOpenFills_entryBarStopLoss",
+			stopLoss: "pct:0.05",
+			prices:   [][4]float64{{100, 100, 100, 100}, {102, 104, 95, 97}, {97, 97, 97, 97}},
+			// The stop 5% below the entry at the open of bar 1 is touched by bar 1's low & fills at 96.9
+			expectedValues:    []float64{10000, 9949, 9949},
+			expectedExposures: []float64{0, 0, 0},
+			expectedExits:     1,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := config.Trader{Log: zap.NewNop(), Symbol: "ETH-USD", Exchange: "binance", Timeframe: "1D",
+				StartingCash: 10000, DefaultOrderValue: 1000, OrderType: model.OrderTypeMarket,
+				TimeInForce: model.TimeInForceGTC, FillTiming: execution.FillTimingNextOpen, StopLoss: testCase.stopLoss,
+				ExitPriority: portfolio.ExitPriorityStopFirst}
+			basicTrader := newTestTrader(t, cfg, newTestBars(testCase.prices), enterLong)
+
+			if err := basicTrader.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			equityCurve := basicTrader.EquityCurve()
+			if len(equityCurve) != len(testCase.expectedValues) {
+				t.Fatalf("expected %v equity points, got %v", len(testCase.expectedValues), len(equityCurve))
+			}
+			for index, point := range equityCurve {
+				if math.Abs(point.Value-testCase.expectedValues[index]) > 1e-9 ||
+					math.Abs(point.Exposure-testCase.expectedExposures[index]) > 1e-9 {
+					t.Errorf("expected value %v & exposure %v at bar %v, got %v & %v", testCase.expectedValues[index],
+						testCase.expectedExposures[index], index, point.Value, point.Exposure)
+				}
+			}
+			if exits := len(basicTrader.portfolio.GetHistoricPositions()["ETH-USD"]); exits != testCase.expectedExits {
+				t.Errorf("expected %v closed positions, got %v", testCase.expectedExits, exits)
+			}
+		})
+	}
+}